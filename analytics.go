@@ -11,32 +11,35 @@ import (
 
 // AnalyticsRecord encodes the details of a request
 type AnalyticsRecord struct {
-	Method        string
-	Path          string
-	RawPath       string
-	ContentLength int64
-	UserAgent     string
-	Day           int
-	Month         time.Month
-	Year          int
-	Hour          int
-	ResponseCode  int
-	APIKey        string
-	TimeStamp     time.Time
-	APIVersion    string
-	APIName       string
-	APIID         string
-	OrgID         string
-	OauthID       string
-	RequestTime   int64
-	RawRequest    string
-	RawResponse   string
-	IPAddress     string
-	Geo           GeoData
-	Tags          []string
-	Alias         string
-	TrackPath     bool
-	ExpireAt      time.Time `bson:"expireAt" json:"expireAt"`
+	Method             string
+	Path               string
+	RawPath            string
+	ContentLength      int64
+	UserAgent          string
+	Day                int
+	Month              time.Month
+	Year               int
+	Hour               int
+	ResponseCode       int
+	APIKey             string
+	TimeStamp          time.Time
+	APIVersion         string
+	APIName            string
+	APIID              string
+	OrgID              string
+	OauthID            string
+	RequestTime        int64
+	RawRequest         string
+	RawResponse        string
+	IPAddress          string
+	Geo                GeoData
+	Tags               []string
+	Alias              string
+	TrackPath          bool
+	ContractViolations []string
+	WebSocket          *WebSocketStats
+	RequestID          string
+	ExpireAt           time.Time `bson:"expireAt" json:"expireAt"`
 }
 
 type GeoData struct {
@@ -15,7 +15,7 @@ import (
 	"time"
 
 	"github.com/TykTechnologies/logrus"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/gorilla/context"
 	"github.com/nu7hatch/gouuid"
 	"golang.org/x/crypto/bcrypt"
@@ -78,10 +78,8 @@ func GetSpecForOrg(APIID string) *APISpec {
 
 func checkAndApplyTrialPeriod(keyName string, apiId string, newSession *SessionState) {
 	// Check the policy to see if we are forcing an expiry on the key
-	if newSession.ApplyPolicyID != "" {
-		policiesMu.RLock()
-		thisPolicy, foundPolicy := policiesByID[newSession.ApplyPolicyID]
-		policiesMu.RUnlock()
+	if policyIDs := newSession.PolicyIDs(); len(policyIDs) > 0 {
+		thisPolicy, foundPolicy := MergePolicies(policyIDs)
 		if foundPolicy {
 			// Are we foring an expiry?
 			if thisPolicy.KeyExpiresIn > 0 {
@@ -99,6 +97,11 @@ func checkAndApplyTrialPeriod(keyName string, apiId string, newSession *SessionS
 
 func doAddOrUpdate(keyName string, newSession SessionState, dontReset bool) error {
 	newSession.LastUpdated = strconv.Itoa(int(time.Now().Unix()))
+	carryQuotaLastReset(keyName, &newSession)
+	if !dontReset {
+		// The counter is cleared below, resets scheduled until now have nothing left to clear
+		newSession.QuotaLastReset = time.Now().Unix()
+	}
 
 	if len(newSession.AccessRights) > 0 {
 		// We have a specific list of access rules, only add / update those
@@ -113,7 +116,7 @@ func doAddOrUpdate(keyName string, newSession SessionState, dontReset bool) erro
 					// Reset quote by default
 					if !dontReset {
 						thisAPISpec.SessionManager.ResetQuota(keyName, newSession)
-						newSession.QuotaRenews = time.Now().Unix() + newSession.QuotaRenewalRate
+						newSession.QuotaRenews = newSession.QuotaPeriodEnd(time.Now())
 					}
 
 					err := thisAPISpec.SessionManager.UpdateSession(keyName, newSession, GetLifetime(thisAPISpec, &newSession))
@@ -144,7 +147,7 @@ func doAddOrUpdate(keyName string, newSession SessionState, dontReset bool) erro
 			for _, spec := range ApiSpecRegister {
 				if !dontReset {
 					spec.SessionManager.ResetQuota(keyName, newSession)
-					newSession.QuotaRenews = time.Now().Unix() + newSession.QuotaRenewalRate
+					newSession.QuotaRenews = newSession.QuotaPeriodEnd(time.Now())
 				}
 				checkAndApplyTrialPeriod(keyName, spec.APIID, &newSession)
 				err := spec.SessionManager.UpdateSession(keyName, newSession, GetLifetime(spec, &newSession))
@@ -275,7 +278,7 @@ func handleAddOrUpdate(keyName string, r *http.Request) ([]byte, int) {
 	}
 
 	var action string
-	var event tykcommon.TykEvent
+	var event apidef.TykEvent
 	if r.Method == "POST" {
 		action = "added"
 		event = EVENT_TokenCreated
@@ -442,6 +445,7 @@ func handleDeleteKey(keyName string, apiID string) ([]byte, int) {
 			spec.SessionManager.RemoveSession(keyName)
 			spec.SessionManager.ResetQuota(keyName, SessionState{})
 		}
+		closeWebSocketsForKey(publicHash(keyName), apiID)
 
 		log.WithFields(logrus.Fields{
 			"prefix": "api",
@@ -464,6 +468,7 @@ func handleDeleteKey(keyName string, apiID string) ([]byte, int) {
 
 	sessionManager.RemoveSession(keyName)
 	sessionManager.ResetQuota(keyName, SessionState{})
+	closeWebSocketsForKey(publicHash(keyName), apiID)
 	code := 200
 
 	statusObj := APIModifyKeySuccess{keyName, "ok", "deleted"}
@@ -508,6 +513,7 @@ func handleDeleteHashedKey(keyName string, apiID string) ([]byte, int) {
 		for _, spec := range ApiSpecRegister {
 			spec.SessionManager.RemoveSession(keyName)
 		}
+		closeWebSocketsForKey(keyName, apiID)
 
 		log.WithFields(logrus.Fields{
 			"prefix": "api",
@@ -532,6 +538,7 @@ func handleDeleteHashedKey(keyName string, apiID string) ([]byte, int) {
 	// TODO: This is pretty ugly
 	setKeyName := "apikey-" + keyName
 	sessStore.DeleteRawKey(setKeyName)
+	closeWebSocketsForKey(keyName, apiID)
 	code := 200
 
 	statusObj := APIModifyKeySuccess{keyName, "ok", "deleted"}
@@ -606,7 +613,7 @@ func HandleGetAPIList() ([]byte, int) {
 
 	apisMu.RLock()
 	defer apisMu.RUnlock()
-	thisAPIIDList := make([]*tykcommon.APIDefinition, len(ApiSpecRegister))
+	thisAPIIDList := make([]*apidef.APIDefinition, len(ApiSpecRegister))
 
 	c := 0
 	for _, apiSpec := range ApiSpecRegister {
@@ -664,7 +671,7 @@ func HandleAddOrUpdateApi(APIID string, r *http.Request) ([]byte, int) {
 	success := true
 	decoder := json.NewDecoder(r.Body)
 	var responseMessage []byte
-	newDef := &tykcommon.APIDefinition{}
+	newDef := &apidef.APIDefinition{}
 	err := decoder.Decode(newDef)
 	code := 200
 
@@ -848,7 +855,8 @@ func keyHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 type PolicyUpdateObj struct {
-	Policy string `json:"policy"`
+	Policy   string   `json:"policy"`
+	Policies []string `json:"policies"`
 }
 
 func policyUpdateHandler(w http.ResponseWriter, r *http.Request) {
@@ -870,7 +878,7 @@ func policyUpdateHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		responseMessage, code = handleUpdateHashedKey(keyName, APIID, policRecord.Policy)
+		responseMessage, code = handleUpdateHashedKey(keyName, APIID, policRecord.Policy, policRecord.Policies)
 
 	} else {
 		// Return Not supported message (and code)
@@ -881,7 +889,7 @@ func policyUpdateHandler(w http.ResponseWriter, r *http.Request) {
 	DoJSONWrite(w, code, responseMessage)
 }
 
-func handleUpdateHashedKey(keyName, apiID, policyId string) ([]byte, int) {
+func handleUpdateHashedKey(keyName, apiID, policyId string, policyIDs []string) ([]byte, int) {
 	sessionManager := FallbackKeySesionManager
 	if apiID != "" {
 		spec := GetSpecForApi(apiID)
@@ -928,6 +936,7 @@ func handleUpdateHashedKey(keyName, apiID, policyId string) ([]byte, int) {
 	// Set the policy
 	sess.LastUpdated = strconv.Itoa(int(time.Now().Unix()))
 	sess.ApplyPolicyID = policyId
+	sess.ApplyPolicies = policyIDs
 
 	sessAsJS, encErr := json.Marshal(sess)
 	if encErr != nil {
@@ -976,6 +985,96 @@ func handleUpdateHashedKey(keyName, apiID, policyId string) ([]byte, int) {
 	return responseMessage, code
 }
 
+// APIQuotaResetSuccess is returned when a bulk quota reset has been scheduled
+type APIQuotaResetSuccess struct {
+	Status  string `json:"status"`
+	Action  string `json:"action"`
+	ResetAt int64  `json:"reset_at"`
+}
+
+// quotaResetHandler resets the quota of every key under a policy (/tyk/quotas/reset/policy/{id})
+// or an organisation (/tyk/quotas/reset/org/{id}) in one go
+func quotaResetHandler(w http.ResponseWriter, r *http.Request) {
+	target := strings.Trim(r.URL.Path[len("/tyk/quotas/reset/"):], "/")
+	var responseMessage []byte
+	var code int
+
+	if r.Method == "POST" {
+		parts := strings.SplitN(target, "/", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			code = 400
+			responseMessage = createError("Must specify a policy or org ID to reset")
+		} else {
+			responseMessage, code = handleQuotaReset(parts[0], parts[1])
+		}
+	} else {
+		// Return Not supported message (and code)
+		code = 405
+		responseMessage = createError("Method not supported")
+	}
+
+	DoJSONWrite(w, code, responseMessage)
+}
+
+func handleQuotaReset(scope, ID string) ([]byte, int) {
+	var rawKey string
+	var store StorageHandler
+
+	switch scope {
+	case "policy":
+		policiesMu.RLock()
+		_, found := policiesByID[ID]
+		policiesMu.RUnlock()
+		if !found {
+			notFound := APIStatusMessage{"error", "Policy not found"}
+			responseMessage, _ := json.Marshal(&notFound)
+			return responseMessage, 404
+		}
+		rawKey = QuotaResetPolicyPrefix + ID
+		store = FallbackKeySesionManager.GetStore()
+	case "org":
+		rawKey = QuotaResetOrgPrefix + ID
+		spec := GetSpecForOrg(ID)
+		if spec != nil {
+			store = spec.OrgSessionManager.GetStore()
+
+			// The org's own quota counter is reset straight away
+			spec.OrgSessionManager.ResetQuota(ID, SessionState{})
+		} else {
+			store = FallbackKeySesionManager.GetStore()
+		}
+	default:
+		return createError("Reset scope must be one of: policy, org"), 400
+	}
+
+	resetAt, err := ScheduleQuotaReset(rawKey, store)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "api",
+			"scope":  scope,
+			"id":     ID,
+			"status": "fail",
+			"err":    err,
+		}).Error("Failed to schedule quota reset.")
+		return createError("Could not write quota reset marker"), 500
+	}
+
+	responseMessage, err := json.Marshal(&APIQuotaResetSuccess{"ok", "reset", resetAt})
+	if err != nil {
+		log.Error("Marshalling failed: ", err)
+		return []byte(E_SYSTEM_ERROR), 500
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix": "api",
+		"scope":  scope,
+		"id":     ID,
+		"status": "ok",
+	}).Info("Quota reset scheduled.")
+
+	return responseMessage, 200
+}
+
 func orgHandler(w http.ResponseWriter, r *http.Request) {
 	keyName := r.URL.Path[len("/tyk/org/keys/"):]
 	filter := r.FormValue("filter")
@@ -1042,7 +1141,7 @@ func handleOrgAddOrUpdate(keyName string, r *http.Request) ([]byte, int) {
 		do_reset := r.FormValue("reset_quota")
 		if do_reset == "1" {
 			thisSessionManager.ResetQuota(keyName, newSession)
-			newSession.QuotaRenews = time.Now().Unix() + newSession.QuotaRenewalRate
+			newSession.QuotaRenews = newSession.QuotaPeriodEnd(time.Now())
 			rawKey := QuotaKeyPrefix + publicHash(keyName)
 
 			// manage quotas seperately
@@ -1323,7 +1422,7 @@ func createKeyHandler(w http.ResponseWriter, r *http.Request) {
 						if !thisAPISpec.DontSetQuotasOnCreate {
 							// Reset quota by default
 							thisAPISpec.SessionManager.ResetQuota(newKey, newSession)
-							newSession.QuotaRenews = time.Now().Unix() + newSession.QuotaRenewalRate
+							newSession.QuotaRenews = newSession.QuotaPeriodEnd(time.Now())
 						}
 						err := thisAPISpec.SessionManager.UpdateSession(newKey, newSession, GetLifetime(thisAPISpec, &newSession))
 						if err != nil {
@@ -1334,7 +1433,7 @@ func createKeyHandler(w http.ResponseWriter, r *http.Request) {
 					} else {
 						// Use fallback
 						thisSessionManager := FallbackKeySesionManager
-						newSession.QuotaRenews = time.Now().Unix() + newSession.QuotaRenewalRate
+						newSession.QuotaRenews = newSession.QuotaPeriodEnd(time.Now())
 						thisSessionManager.ResetQuota(newKey, newSession)
 						err := thisSessionManager.UpdateSession(newKey, newSession, -1)
 						if err != nil {
@@ -1365,7 +1464,7 @@ func createKeyHandler(w http.ResponseWriter, r *http.Request) {
 						if !spec.DontSetQuotasOnCreate {
 							// Reset quote by default
 							spec.SessionManager.ResetQuota(newKey, newSession)
-							newSession.QuotaRenews = time.Now().Unix() + newSession.QuotaRenewalRate
+							newSession.QuotaRenews = newSession.QuotaPeriodEnd(time.Now())
 						}
 						err := spec.SessionManager.UpdateSession(newKey, newSession, GetLifetime(spec, &newSession))
 						if err != nil {
@@ -1454,6 +1553,125 @@ func createKeyHandler(w http.ResponseWriter, r *http.Request) {
 	DoJSONWrite(w, code, responseMessage)
 }
 
+// APIRotateKeySuccess is returned when a key has been replaced by a successor
+type APIRotateKeySuccess struct {
+	Key                string `json:"key"`
+	Status             string `json:"status"`
+	Action             string `json:"action"`
+	PreviousKeyExpires int64  `json:"previous_key_expires"`
+}
+
+// rotateKeyHandler issues a successor for a key (/tyk/keys/rotate/{key}), the successor gets the
+// same session and the old key stays valid for the overlap window (?overlap=seconds)
+func rotateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	keyName := strings.Trim(r.URL.Path[len("/tyk/keys/rotate/"):], "/")
+	APIID := r.FormValue("api_id")
+	var responseMessage []byte
+	var code int
+
+	if r.Method == "POST" {
+		if keyName == "" {
+			code = 400
+			responseMessage = createError("Must specify a key to rotate")
+		} else {
+			overlap := keyRotationOverlap()
+			if overlapParam := r.FormValue("overlap"); overlapParam != "" {
+				parsed, err := strconv.ParseInt(overlapParam, 10, 64)
+				if err != nil || parsed < 0 {
+					DoJSONWrite(w, 400, createError("Overlap must be a positive number of seconds"))
+					return
+				}
+				overlap = parsed
+			}
+
+			responseMessage, code = handleRotateKey(keyName, APIID, overlap)
+		}
+	} else {
+		// Return Not supported message (and code)
+		code = 405
+		responseMessage = createError("Method not supported")
+	}
+
+	DoJSONWrite(w, code, responseMessage)
+}
+
+func handleRotateKey(keyName string, apiID string, overlap int64) ([]byte, int) {
+	sessionManager := FallbackKeySesionManager
+	if apiID != "" {
+		spec := GetSpecForApi(apiID)
+		if spec != nil {
+			sessionManager = spec.SessionManager
+		}
+	}
+
+	oldSession, ok := sessionManager.GetSessionDetail(keyName)
+	if !ok {
+		notFound := APIStatusMessage{"error", "Key not found"}
+		responseMessage, _ := json.Marshal(&notFound)
+		return responseMessage, 404
+	}
+
+	if oldSession.BasicAuthData.Password != "" {
+		return createError("Basic auth users cannot be rotated"), 400
+	}
+
+	if oldSession.RotatedAt > 0 {
+		return createError("Key has already been rotated"), 409
+	}
+
+	newKey := keyGen.GenerateAuthKey(oldSession.OrgID)
+	successor := oldSession
+	successor.RotatedAt = 0
+
+	// The successor takes over the quota used so far instead of starting a new period
+	copyQuotaState(sessionManager.GetStore(), keyName, newKey, oldSession, time.Now())
+	if err := doAddOrUpdate(newKey, successor, true); err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "api",
+			"key":    ObfuscateKeyString(keyName),
+			"status": "fail",
+			"err":    err,
+		}).Error("Failed to create successor key.")
+		return createError("Failed to rotate key - " + err.Error()), 500
+	}
+
+	retiring := rotateSession(oldSession, overlap, time.Now())
+	if err := doAddOrUpdate(keyName, retiring, true); err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "api",
+			"key":    ObfuscateKeyString(keyName),
+			"status": "fail",
+			"err":    err,
+		}).Error("Failed to retire rotated key.")
+		return createError("Failed to rotate key - " + err.Error()), 500
+	}
+
+	FireSystemEvent(EVENT_TokenCreated, EVENT_TokenMeta{
+		EventMetaDefault: EventMetaDefault{
+			Message:            "Key rotated.",
+			OriginatingRequest: "",
+		},
+		Org: successor.OrgID,
+		Key: newKey,
+	})
+
+	log.WithFields(logrus.Fields{
+		"prefix":  "api",
+		"key":     ObfuscateKeyString(keyName),
+		"new_key": ObfuscateKeyString(newKey),
+		"expires": retiring.Expires,
+		"status":  "ok",
+	}).Info("Key rotated.")
+
+	responseMessage, err := json.Marshal(&APIRotateKeySuccess{newKey, "ok", "rotated", retiring.Expires})
+	if err != nil {
+		log.Error("Marshalling failed: ", err)
+		return []byte(E_SYSTEM_ERROR), 500
+	}
+
+	return responseMessage, 200
+}
+
 // NewClientRequest is an outward facing JSON object translated from osin OAuthClients
 type NewClientRequest struct {
 	ClientID          string `json:"client_id"`
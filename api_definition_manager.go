@@ -15,18 +15,18 @@ import (
 	"time"
 
 	"github.com/TykTechnologies/logrus"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/gorilla/context"
 	"github.com/rubyist/circuitbreaker"
 	"gopkg.in/mgo.v2"
 )
 
 const (
-	DefaultAuthProvider    tykcommon.AuthProviderCode    = "default"
-	DefaultSessionProvider tykcommon.SessionProviderCode = "default"
-	DefaultStorageEngine   tykcommon.StorageEngineCode   = "redis"
-	LDAPStorageEngine      tykcommon.StorageEngineCode   = "ldap"
-	RPCStorageEngine       tykcommon.StorageEngineCode   = "rpc"
+	DefaultAuthProvider    apidef.AuthProviderCode    = "default"
+	DefaultSessionProvider apidef.SessionProviderCode = "default"
+	DefaultStorageEngine   apidef.StorageEngineCode   = "redis"
+	LDAPStorageEngine      apidef.StorageEngineCode   = "ldap"
+	RPCStorageEngine       apidef.StorageEngineCode   = "rpc"
 )
 
 // URLStatus is a custom enum type to avoid collisions
@@ -51,6 +51,11 @@ const (
 	MethodTransformed      URLStatus = 14
 	RequestTracked         URLStatus = 15
 	RequestNotTracked      URLStatus = 16
+	ValidateJSONRequest    URLStatus = 17
+	ValidateJSONResponse   URLStatus = 18
+	GRPCTranscoded         URLStatus = 19
+	SOAPMediated           URLStatus = 20
+	Mirrored               URLStatus = 21
 )
 
 // RequestStatus is a custom type to avoid collisions
@@ -82,6 +87,11 @@ const (
 	StatusRequestSizeControlled    RequestStatus = "Request Size Limited"
 	StatusRequesTracked            RequestStatus = "Request Tracked"
 	StatusRequestNotTracked        RequestStatus = "Request Not Tracked"
+	StatusValidateJSON             RequestStatus = "Validate JSON"
+	StatusValidateJSONResponse     RequestStatus = "Validate JSON Response"
+	StatusGRPCTranscoded           RequestStatus = "gRPC Transcoded"
+	StatusSOAPMediated             RequestStatus = "SOAP Mediated"
+	StatusMirrored                 RequestStatus = "Mirrored"
 )
 
 // URLSpec represents a flattened specification for URLs, used to check if a proxy URL
@@ -90,35 +100,61 @@ const (
 type URLSpec struct {
 	Spec                    *regexp.Regexp
 	Status                  URLStatus
-	MethodActions           map[string]tykcommon.EndpointMethodMeta
+	MethodActions           map[string]apidef.EndpointMethodMeta
 	TransformAction         TransformSpec
 	TransformResponseAction TransformSpec
-	InjectHeaders           tykcommon.HeaderInjectionMeta
-	InjectHeadersResponse   tykcommon.HeaderInjectionMeta
-	HardTimeout             tykcommon.HardTimeoutMeta
+	InjectHeaders           HeaderInjectionSpec
+	InjectHeadersResponse   HeaderInjectionSpec
+	HardTimeout             apidef.HardTimeoutMeta
 	CircuitBreaker          ExtendedCircuitBreakerMeta
-	URLRewrite              tykcommon.URLRewriteMeta
-	VirtualPathSpec         tykcommon.VirtualMeta
-	RequestSize             tykcommon.RequestSizeMeta
-	MethodTransform         tykcommon.MethodTransformMeta
-	TrackEndpoint           tykcommon.TrackEndpointMeta
-	DoNotTrackEndpoint      tykcommon.TrackEndpointMeta
+	URLRewrite              URLRewriteSpec
+	VirtualPathSpec         apidef.VirtualMeta
+	RequestSize             apidef.RequestSizeMeta
+	MethodTransform         apidef.MethodTransformMeta
+	TrackEndpoint           apidef.TrackEndpointMeta
+	DoNotTrackEndpoint      apidef.TrackEndpointMeta
+	ValidatePathMeta        ValidateJSONSpec
+	ValidateResponseMeta    ValidateResponseSpec
+	GRPCTranscode           GRPCTranscodeSpec
+	SOAPMediation           SOAPMediationSpec
+	Mirror                  apidef.MirrorMeta
 }
 
 type TransformSpec struct {
-	tykcommon.TemplateMeta
+	apidef.TemplateMeta
 	Template *textTemplate.Template
+	Mapping  *JSONMappingSpec
+}
+
+type ValidateJSONSpec struct {
+	apidef.ValidatePathMeta
+	Validator *JSONSchema
+}
+
+type ValidateResponseSpec struct {
+	apidef.ValidateResponseMeta
+	Validators map[string]*JSONSchema
+}
+
+// GRPCTranscodeSpec binds one REST route from a google.api.http annotation to its RPC
+type GRPCTranscodeSpec struct {
+	Method      string
+	Rule        ProtoHTTPRule
+	Pattern     *regexp.Regexp
+	Variables   []string
+	RPC         *ProtoMethod
+	Descriptors *ProtoDescriptorSet
 }
 
 type ExtendedCircuitBreakerMeta struct {
-	tykcommon.CircuitBreakerMeta
+	apidef.CircuitBreakerMeta
 	CB *circuit.Breaker
 }
 
 // APISpec represents a path specification for an API, to avoid enumerating multiple nested lists, a single
 // flattened URL list is checked for matching paths and then it's status evaluated if found.
 type APISpec struct {
-	*tykcommon.APIDefinition
+	*apidef.APIDefinition
 
 	RxPaths                  map[string][]URLSpec
 	WhiteListEnabled         map[string]bool
@@ -127,7 +163,7 @@ type APISpec struct {
 	SessionManager           SessionHandler
 	OAuthManager             *OAuthManager
 	OrgSessionManager        SessionHandler
-	EventPaths               map[tykcommon.TykEvent][]TykEventHandler
+	EventPaths               map[apidef.TykEvent][]TykEventHandler
 	Health                   HealthChecker
 	JSVM                     *JSVM
 	ResponseChain            *[]TykResponseHandler
@@ -136,9 +172,11 @@ type APISpec struct {
 	CircuitBreakerEnabled    bool
 	EnforcedTimeoutEnabled   bool
 	ResponseHandlersActive   bool
-	LastGoodHostList         *tykcommon.HostList
+	LastGoodHostList         *apidef.HostList
 	HasRun                   bool
 	ServiceRefreshInProgress bool
+	UpstreamAuthenticator    UpstreamAuthenticator
+	CompiledErrorOverrides   map[string]*ErrorOverrideSpec
 }
 
 // APIDefinitionLoader will load an Api definition from a storage system. It has two methods LoadDefinitionsFromMongo()
@@ -164,7 +202,7 @@ func (a *APIDefinitionLoader) Disconnect() {
 
 // MakeSpec will generate a flattened URLSpec from and APIDefinitions' VersionInfo data. paths are
 // keyed to the Api version name, which is determined during routing to speed up lookups
-func (a *APIDefinitionLoader) MakeSpec(thisAppConfig *tykcommon.APIDefinition) *APISpec {
+func (a *APIDefinitionLoader) MakeSpec(thisAppConfig *apidef.APIDefinition) *APISpec {
 	newAppSpec := &APISpec{}
 	newAppSpec.APIDefinition = thisAppConfig
 
@@ -199,6 +237,18 @@ func (a *APIDefinitionLoader) MakeSpec(thisAppConfig *tykcommon.APIDefinition) *
 		newAppSpec.OrgSessionManager = &DefaultSessionManager{}
 	}
 
+	// Upstream secrets are resolved once, APIs whose upstream auth can't be set up fail their requests
+	upstreamAuth, err := NewUpstreamAuthenticator(thisAppConfig.UpstreamAuth)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "main",
+			"api_id": thisAppConfig.APIID,
+		}).Error("Upstream authentication could not be set up: ", err)
+		upstreamAuth = upstreamAuthError{err}
+	}
+	newAppSpec.UpstreamAuthenticator = upstreamAuth
+	newAppSpec.CompiledErrorOverrides = compileErrorOverrides(thisAppConfig.APIID, thisAppConfig.ErrorOverrides)
+
 	// Create and init the virtual Machine
 	if config.EnableJSVM {
 		newAppSpec.JSVM = &JSVM{}
@@ -207,7 +257,7 @@ func (a *APIDefinitionLoader) MakeSpec(thisAppConfig *tykcommon.APIDefinition) *
 
 	// Set up Event Handlers
 	log.Debug("INITIALISING EVENT HANDLERS")
-	newAppSpec.EventPaths = make(map[tykcommon.TykEvent][]TykEventHandler)
+	newAppSpec.EventPaths = make(map[apidef.TykEvent][]TykEventHandler)
 	for eventName, eventHandlerConfs := range thisAppConfig.EventHandlers.Events {
 		log.Debug("FOUND EVENTS TO INIT")
 		for _, handlerConf := range eventHandlerConfs {
@@ -434,7 +484,7 @@ func (a *APIDefinitionLoader) LoadDefinitionsFromDashboardService(endpoint strin
 	// Extract tagged APIs#
 
 	type ResponseStruct struct {
-		ApiDefinition *tykcommon.APIDefinition `bson:"api_definition" json:"api_definition"`
+		ApiDefinition *apidef.APIDefinition `bson:"api_definition" json:"api_definition"`
 	}
 	type NodeResponseOK struct {
 		Status  string
@@ -460,11 +510,11 @@ func (a *APIDefinitionLoader) LoadDefinitionsFromDashboardService(endpoint strin
 	}
 
 	// Extract tagged entries only
-	APIDefinitions := make([]*tykcommon.APIDefinition, 0)
+	APIDefinitions := make([]*apidef.APIDefinition, 0)
 
 	if config.DBAppConfOptions.NodeIsSegmented {
 		tagList := make(map[string]bool)
-		toLoad := make(map[string]*tykcommon.APIDefinition)
+		toLoad := make(map[string]*apidef.APIDefinition)
 
 		for _, mt := range config.DBAppConfOptions.Tags {
 			tagList[mt] = true
@@ -532,7 +582,7 @@ func (a *APIDefinitionLoader) LoadDefinitionsFromRPC(orgId string) *[]*APISpec {
 func (a *APIDefinitionLoader) processRPCDefinitions(apiCollection string) *[]*APISpec {
 	var APISpecs = []*APISpec{}
 
-	var APIDefinitions = []*tykcommon.APIDefinition{}
+	var APIDefinitions = []*apidef.APIDefinition{}
 	var StringDefs = make([]map[string]interface{}, 0)
 
 	jErr1 := json.Unmarshal([]byte(apiCollection), &APIDefinitions)
@@ -569,8 +619,8 @@ func (a *APIDefinitionLoader) processRPCDefinitions(apiCollection string) *[]*AP
 	return &APISpecs
 }
 
-func (a *APIDefinitionLoader) ParseDefinition(apiDef []byte) (*tykcommon.APIDefinition, map[string]interface{}) {
-	thisAppConfig := &tykcommon.APIDefinition{}
+func (a *APIDefinitionLoader) ParseDefinition(apiDef []byte) (*apidef.APIDefinition, map[string]interface{}) {
+	thisAppConfig := &apidef.APIDefinition{}
 	err := json.Unmarshal(apiDef, thisAppConfig)
 	if err != nil {
 		log.Error("[RPC] --> Couldn't unmarshal api configuration")
@@ -611,7 +661,7 @@ func (a *APIDefinitionLoader) LoadDefinitions(dir string) *[]*APISpec {
 	return &APISpecs
 }
 
-func (a *APIDefinitionLoader) getPathSpecs(apiVersionDef tykcommon.VersionInfo) ([]URLSpec, bool) {
+func (a *APIDefinitionLoader) getPathSpecs(apiVersionDef apidef.VersionInfo) ([]URLSpec, bool) {
 	ignoredPaths := a.compilePathSpec(apiVersionDef.Paths.Ignored, Ignored)
 	blackListPaths := a.compilePathSpec(apiVersionDef.Paths.BlackList, BlackList)
 	whiteListPaths := a.compilePathSpec(apiVersionDef.Paths.WhiteList, WhiteList)
@@ -652,7 +702,7 @@ func (a *APIDefinitionLoader) compilePathSpec(paths []string, specType URLStatus
 	return thisURLSpec
 }
 
-func (a *APIDefinitionLoader) compileExtendedPathSpec(paths []tykcommon.EndPointMeta, specType URLStatus) []URLSpec {
+func (a *APIDefinitionLoader) compileExtendedPathSpec(paths []apidef.EndPointMeta, specType URLStatus) []URLSpec {
 
 	// transform an extended configuration URL into an array of URLSpecs
 	// This way we can iterate the whole array once, on match we break with status
@@ -705,7 +755,7 @@ func (a *APIDefinitionLoader) loadBlobTemplate(blob string) (*textTemplate.Templ
 	return thisT, tErr
 }
 
-func (a *APIDefinitionLoader) compileTransformPathSpec(paths []tykcommon.TemplateMeta, stat URLStatus) []URLSpec {
+func (a *APIDefinitionLoader) compileTransformPathSpec(paths []apidef.TemplateMeta, stat URLStatus) []URLSpec {
 
 	// transform an extended configuration URL into an array of URLSpecs
 	// This way we can iterate the whole array once, on match we break with status
@@ -724,15 +774,18 @@ func (a *APIDefinitionLoader) compileTransformPathSpec(paths []tykcommon.Templat
 		var templErr error
 
 		switch stringSpec.TemplateData.Mode {
-		case tykcommon.UseFile:
+		case apidef.UseFile:
 			log.Debug("-- Using File mode")
 			newTransformSpec.Template, templErr = a.loadFileTemplate(stringSpec.TemplateData.TemplateSource)
-		case tykcommon.UseBlob:
+		case apidef.UseBlob:
 			log.Debug("-- Blob mode")
 			newTransformSpec.Template, templErr = a.loadBlobTemplate(stringSpec.TemplateData.TemplateSource)
+		case apidef.UseMapping:
+			log.Debug("-- Mapping mode")
+			newTransformSpec.Mapping, templErr = CompileJSONMapping(stringSpec.TemplateData.Mapping)
 		default:
 			log.Warning("[Transform Templates] No tempalte mode defined! Found: ", stringSpec.TemplateData.Mode)
-			templErr = errors.New("No valid template mode defined, must be either 'file' or 'blob'.")
+			templErr = errors.New("No valid template mode defined, must be either 'file', 'blob' or 'mapping'.")
 		}
 
 		if stat == Transformed {
@@ -753,20 +806,29 @@ func (a *APIDefinitionLoader) compileTransformPathSpec(paths []tykcommon.Templat
 	return thisURLSpec
 }
 
-func (a *APIDefinitionLoader) compileInjectedHeaderSpec(paths []tykcommon.HeaderInjectionMeta, stat URLStatus) []URLSpec {
+func (a *APIDefinitionLoader) compileInjectedHeaderSpec(paths []apidef.HeaderInjectionMeta, stat URLStatus) []URLSpec {
 
 	// transform an extended configuration URL into an array of URLSpecs
 	// This way we can iterate the whole array once, on match we break with status
 	thisURLSpec := []URLSpec{}
 
 	for _, stringSpec := range paths {
+		headerSpec, err := CompileHeaderInjection(stringSpec)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": "main",
+				"path":   stringSpec.Path,
+			}).Error("[Header Transform] Skipping endpoint, failed to compile: ", err)
+			continue
+		}
+
 		newSpec := URLSpec{}
 		a.generateRegex(stringSpec.Path, &newSpec, stat)
 		// Extend with method actions
 		if stat == HeaderInjected {
-			newSpec.InjectHeaders = stringSpec
+			newSpec.InjectHeaders = headerSpec
 		} else {
-			newSpec.InjectHeadersResponse = stringSpec
+			newSpec.InjectHeadersResponse = headerSpec
 		}
 
 		thisURLSpec = append(thisURLSpec, newSpec)
@@ -775,7 +837,7 @@ func (a *APIDefinitionLoader) compileInjectedHeaderSpec(paths []tykcommon.Header
 	return thisURLSpec
 }
 
-func (a *APIDefinitionLoader) compileMethodTransformSpec(paths []tykcommon.MethodTransformMeta, stat URLStatus) []URLSpec {
+func (a *APIDefinitionLoader) compileMethodTransformSpec(paths []apidef.MethodTransformMeta, stat URLStatus) []URLSpec {
 
 	// transform an extended configuration URL into an array of URLSpecs
 	// This way we can iterate the whole array once, on match we break with status
@@ -792,7 +854,227 @@ func (a *APIDefinitionLoader) compileMethodTransformSpec(paths []tykcommon.Metho
 	return thisURLSpec
 }
 
-func (a *APIDefinitionLoader) compileTimeoutPathSpec(paths []tykcommon.HardTimeoutMeta, stat URLStatus) []URLSpec {
+func (a *APIDefinitionLoader) compileValidateJSONPathSpec(paths []apidef.ValidatePathMeta, stat URLStatus) []URLSpec {
+
+	// transform an extended configuration URL into an array of URLSpecs
+	// This way we can iterate the whole array once, on match we break with status
+	thisURLSpec := []URLSpec{}
+
+	for _, stringSpec := range paths {
+		validator, err := CompileJSONSchema(stringSpec.Schema)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": "main",
+				"path":   stringSpec.Path,
+				"method": stringSpec.Method,
+			}).Error("Invalid JSON schema, request validation disabled for this path: ", err)
+			continue
+		}
+
+		newSpec := URLSpec{}
+		a.generateRegex(stringSpec.Path, &newSpec, stat)
+		// Extend with the compiled schema
+		newSpec.ValidatePathMeta = ValidateJSONSpec{stringSpec, validator}
+
+		thisURLSpec = append(thisURLSpec, newSpec)
+	}
+
+	return thisURLSpec
+}
+
+func (a *APIDefinitionLoader) compileValidateResponsePathSpec(paths []apidef.ValidateResponseMeta, stat URLStatus) []URLSpec {
+
+	// transform an extended configuration URL into an array of URLSpecs
+	// This way we can iterate the whole array once, on match we break with status
+	thisURLSpec := []URLSpec{}
+
+	for _, stringSpec := range paths {
+		validators := make(map[string]*JSONSchema, len(stringSpec.Schemas))
+		for code, schema := range stringSpec.Schemas {
+			validator, err := CompileJSONSchema(schema)
+			if err != nil {
+				log.WithFields(logrus.Fields{
+					"prefix": "main",
+					"path":   stringSpec.Path,
+					"method": stringSpec.Method,
+					"code":   code,
+				}).Error("Invalid JSON schema, response validation disabled for this code: ", err)
+				continue
+			}
+			validators[strings.ToUpper(code)] = validator
+		}
+
+		newSpec := URLSpec{}
+		a.generateRegex(stringSpec.Path, &newSpec, stat)
+		// Extend with the compiled schemas
+		newSpec.ValidateResponseMeta = ValidateResponseSpec{stringSpec, validators}
+
+		thisURLSpec = append(thisURLSpec, newSpec)
+	}
+
+	return thisURLSpec
+}
+
+func (a *APIDefinitionLoader) loadProtoDescriptorSet(meta apidef.GRPCTranscodeMeta) (*ProtoDescriptorSet, error) {
+	var data []byte
+	var err error
+
+	switch meta.DescriptorMode {
+	case apidef.UseFile:
+		data, err = ioutil.ReadFile(meta.DescriptorSource)
+	case apidef.UseBlob:
+		data, err = b64.StdEncoding.DecodeString(meta.DescriptorSource)
+	default:
+		err = errors.New("No valid descriptor mode defined, must be either 'file' or 'blob'.")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseProtoDescriptorSet(data)
+}
+
+func grpcTranscodeServiceListed(service string, services []string) bool {
+	if len(services) == 0 {
+		return true
+	}
+	for _, listed := range services {
+		if listed == service {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *APIDefinitionLoader) loadSOAPMediation(meta apidef.SOAPMediationMeta) (SOAPMediationSpec, error) {
+	spec := SOAPMediationSpec{SOAPMediationMeta: meta}
+
+	if meta.WSDLSource != "" {
+		wsdl, err := ioutil.ReadFile(meta.WSDLSource)
+		if err != nil {
+			return spec, err
+		}
+		if err := spec.applyWSDL(wsdl); err != nil {
+			return spec, err
+		}
+	}
+
+	var err error
+	switch meta.TemplateMode {
+	case apidef.UseFile:
+		spec.Template, err = a.loadFileTemplate(meta.TemplateSource)
+	case apidef.UseBlob:
+		spec.Template, err = a.loadBlobTemplate(meta.TemplateSource)
+	case "":
+		if meta.Operation == "" {
+			err = errors.New("An operation or an envelope template is needed to build SOAP requests.")
+		}
+	default:
+		err = errors.New("No valid template mode defined, must be either 'file' or 'blob'.")
+	}
+	if err != nil {
+		return spec, err
+	}
+
+	if meta.ResponsePath != "" {
+		spec.ResponsePath, err = ParseJSONPath(meta.ResponsePath)
+	}
+
+	return spec, err
+}
+
+func (a *APIDefinitionLoader) compileSOAPMediationPathSpec(paths []apidef.SOAPMediationMeta, stat URLStatus) []URLSpec {
+
+	// transform an extended configuration URL into an array of URLSpecs
+	// This way we can iterate the whole array once, on match we break with status
+	thisURLSpec := []URLSpec{}
+
+	for _, stringSpec := range paths {
+		soapSpec, err := a.loadSOAPMediation(stringSpec)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": "main",
+				"path":   stringSpec.Path,
+			}).Error("[SOAP Mediation] Skipping endpoint, failed to load: ", err)
+			continue
+		}
+
+		newSpec := URLSpec{}
+		a.generateRegex(stringSpec.Path, &newSpec, stat)
+		newSpec.SOAPMediation = soapSpec
+
+		thisURLSpec = append(thisURLSpec, newSpec)
+	}
+
+	return thisURLSpec
+}
+
+func (a *APIDefinitionLoader) compileGRPCTranscodePathSpec(paths []apidef.GRPCTranscodeMeta, stat URLStatus) []URLSpec {
+
+	// Each descriptor set expands into one URLSpec per HTTP binding of its annotated methods
+	thisURLSpec := []URLSpec{}
+
+	for _, stringSpec := range paths {
+		descriptors, err := a.loadProtoDescriptorSet(stringSpec)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": "main",
+			}).Error("[gRPC Transcoding] Failed to load descriptor set: ", err)
+			continue
+		}
+
+		for _, method := range descriptors.Methods {
+			if !grpcTranscodeServiceListed(method.Service, stringSpec.Services) {
+				continue
+			}
+
+			if method.ClientStreaming || method.ServerStreaming {
+				if len(method.HTTPRules) > 0 {
+					log.WithFields(logrus.Fields{
+						"prefix": "main",
+					}).Warning("[gRPC Transcoding] Streaming methods can't be transcoded, skipping: ", method.Service, "/", method.Name)
+				}
+				continue
+			}
+
+			for _, rule := range method.HTTPRules {
+				pattern, variables, err := compileHTTPPathTemplate(rule.Path)
+				if err == nil {
+					input := descriptors.Messages[method.InputType]
+					for _, variable := range variables {
+						if _, err = descriptors.resolveFieldPath(input, variable); err != nil {
+							break
+						}
+					}
+				}
+				if err != nil {
+					log.WithFields(logrus.Fields{
+						"prefix": "main",
+						"path":   rule.Path,
+					}).Error("[gRPC Transcoding] Invalid HTTP binding for ", method.Service, "/", method.Name, ": ", err)
+					continue
+				}
+
+				newSpec := URLSpec{Spec: pattern, Status: stat}
+				newSpec.GRPCTranscode = GRPCTranscodeSpec{
+					Method:      rule.Method,
+					Rule:        rule,
+					Pattern:     pattern,
+					Variables:   variables,
+					RPC:         method,
+					Descriptors: descriptors,
+				}
+
+				thisURLSpec = append(thisURLSpec, newSpec)
+			}
+		}
+	}
+
+	return thisURLSpec
+}
+
+func (a *APIDefinitionLoader) compileTimeoutPathSpec(paths []apidef.HardTimeoutMeta, stat URLStatus) []URLSpec {
 
 	// transform an extended configuration URL into an array of URLSpecs
 	// This way we can iterate the whole array once, on match we break with status
@@ -810,7 +1092,24 @@ func (a *APIDefinitionLoader) compileTimeoutPathSpec(paths []tykcommon.HardTimeo
 	return thisURLSpec
 }
 
-func (a *APIDefinitionLoader) compileRequestSizePathSpec(paths []tykcommon.RequestSizeMeta, stat URLStatus) []URLSpec {
+func (a *APIDefinitionLoader) compileMirrorPathSpec(paths []apidef.MirrorMeta, stat URLStatus) []URLSpec {
+
+	// transform an extended configuration URL into an array of URLSpecs
+	// This way we can iterate the whole array once, on match we break with status
+	thisURLSpec := []URLSpec{}
+
+	for _, stringSpec := range paths {
+		newSpec := URLSpec{}
+		a.generateRegex(stringSpec.Path, &newSpec, stat)
+		newSpec.Mirror = stringSpec
+
+		thisURLSpec = append(thisURLSpec, newSpec)
+	}
+
+	return thisURLSpec
+}
+
+func (a *APIDefinitionLoader) compileRequestSizePathSpec(paths []apidef.RequestSizeMeta, stat URLStatus) []URLSpec {
 
 	// transform an extended configuration URL into an array of URLSpecs
 	// This way we can iterate the whole array once, on match we break with status
@@ -828,7 +1127,7 @@ func (a *APIDefinitionLoader) compileRequestSizePathSpec(paths []tykcommon.Reque
 	return thisURLSpec
 }
 
-func (a *APIDefinitionLoader) compileCircuitBreakerPathSpec(paths []tykcommon.CircuitBreakerMeta, stat URLStatus, apiSpec *APISpec) []URLSpec {
+func (a *APIDefinitionLoader) compileCircuitBreakerPathSpec(paths []apidef.CircuitBreakerMeta, stat URLStatus, apiSpec *APISpec) []URLSpec {
 
 	// transform an extended configuration URL into an array of URLSpecs
 	// This way we can iterate the whole array once, on match we break with status
@@ -897,7 +1196,7 @@ func (a *APIDefinitionLoader) compileCircuitBreakerPathSpec(paths []tykcommon.Ci
 	return thisURLSpec
 }
 
-func (a *APIDefinitionLoader) compileURLRewritesPathSpec(paths []tykcommon.URLRewriteMeta, stat URLStatus) []URLSpec {
+func (a *APIDefinitionLoader) compileURLRewritesPathSpec(paths []apidef.URLRewriteMeta, stat URLStatus) []URLSpec {
 
 	// transform an extended configuration URL into an array of URLSpecs
 	// This way we can iterate the whole array once, on match we break with status
@@ -905,9 +1204,16 @@ func (a *APIDefinitionLoader) compileURLRewritesPathSpec(paths []tykcommon.URLRe
 
 	for _, stringSpec := range paths {
 		newSpec := URLSpec{}
+		rewriteSpec, err := CompileURLRewrite(stringSpec)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": "main",
+			}).Error("Skipping URL rewrite for ", stringSpec.Path, ", compilation failed: ", err)
+			continue
+		}
 		a.generateRegex(stringSpec.Path, &newSpec, stat)
 		// Extend with method actions
-		newSpec.URLRewrite = stringSpec
+		newSpec.URLRewrite = rewriteSpec
 
 		thisURLSpec = append(thisURLSpec, newSpec)
 	}
@@ -915,7 +1221,7 @@ func (a *APIDefinitionLoader) compileURLRewritesPathSpec(paths []tykcommon.URLRe
 	return thisURLSpec
 }
 
-func (a *APIDefinitionLoader) compileVirtualPathspathSpec(paths []tykcommon.VirtualMeta, stat URLStatus, apiSpec *APISpec) []URLSpec {
+func (a *APIDefinitionLoader) compileVirtualPathspathSpec(paths []apidef.VirtualMeta, stat URLStatus, apiSpec *APISpec) []URLSpec {
 
 	// transform an extended configuration URL into an array of URLSpecs
 	// This way we can iterate the whole array once, on match we break with status
@@ -939,7 +1245,7 @@ func (a *APIDefinitionLoader) compileVirtualPathspathSpec(paths []tykcommon.Virt
 	return thisURLSpec
 }
 
-func (a *APIDefinitionLoader) compileTrackedEndpointPathspathSpec(paths []tykcommon.TrackEndpointMeta, stat URLStatus, apiSpec *APISpec) []URLSpec {
+func (a *APIDefinitionLoader) compileTrackedEndpointPathspathSpec(paths []apidef.TrackEndpointMeta, stat URLStatus, apiSpec *APISpec) []URLSpec {
 	thisURLSpec := []URLSpec{}
 
 	for _, stringSpec := range paths {
@@ -953,7 +1259,7 @@ func (a *APIDefinitionLoader) compileTrackedEndpointPathspathSpec(paths []tykcom
 	return thisURLSpec
 }
 
-func (a *APIDefinitionLoader) compileUnTrackedEndpointPathspathSpec(paths []tykcommon.TrackEndpointMeta, stat URLStatus, apiSpec *APISpec) []URLSpec {
+func (a *APIDefinitionLoader) compileUnTrackedEndpointPathspathSpec(paths []apidef.TrackEndpointMeta, stat URLStatus, apiSpec *APISpec) []URLSpec {
 	thisURLSpec := []URLSpec{}
 
 	for _, stringSpec := range paths {
@@ -967,7 +1273,7 @@ func (a *APIDefinitionLoader) compileUnTrackedEndpointPathspathSpec(paths []tykc
 	return thisURLSpec
 }
 
-func (a *APIDefinitionLoader) getExtendedPathSpecs(apiVersionDef tykcommon.VersionInfo, apiSpec *APISpec) ([]URLSpec, bool) {
+func (a *APIDefinitionLoader) getExtendedPathSpecs(apiVersionDef apidef.VersionInfo, apiSpec *APISpec) ([]URLSpec, bool) {
 	// TODO: New compiler here, needs to put data into a different structure
 
 	ignoredPaths := a.compileExtendedPathSpec(apiVersionDef.ExtendedPaths.Ignored, Ignored)
@@ -986,6 +1292,11 @@ func (a *APIDefinitionLoader) getExtendedPathSpecs(apiVersionDef tykcommon.Versi
 	methodTransforms := a.compileMethodTransformSpec(apiVersionDef.ExtendedPaths.MethodTransforms, MethodTransformed)
 	trackedPaths := a.compileTrackedEndpointPathspathSpec(apiVersionDef.ExtendedPaths.TrackEndpoints, RequestTracked, apiSpec)
 	unTrackedPaths := a.compileUnTrackedEndpointPathspathSpec(apiVersionDef.ExtendedPaths.DoNotTrackEndpoints, RequestNotTracked, apiSpec)
+	validateJSON := a.compileValidateJSONPathSpec(apiVersionDef.ExtendedPaths.ValidateJSON, ValidateJSONRequest)
+	validateResponse := a.compileValidateResponsePathSpec(apiVersionDef.ExtendedPaths.ValidateResponse, ValidateJSONResponse)
+	grpcTranscoded := a.compileGRPCTranscodePathSpec(apiVersionDef.ExtendedPaths.GRPCTranscode, GRPCTranscoded)
+	soapMediated := a.compileSOAPMediationPathSpec(apiVersionDef.ExtendedPaths.SOAPMediation, SOAPMediated)
+	mirrored := a.compileMirrorPathSpec(apiVersionDef.ExtendedPaths.Mirror, Mirrored)
 
 	combinedPath := []URLSpec{}
 	combinedPath = append(combinedPath, ignoredPaths...)
@@ -1004,6 +1315,11 @@ func (a *APIDefinitionLoader) getExtendedPathSpecs(apiVersionDef tykcommon.Versi
 	combinedPath = append(combinedPath, methodTransforms...)
 	combinedPath = append(combinedPath, trackedPaths...)
 	combinedPath = append(combinedPath, unTrackedPaths...)
+	combinedPath = append(combinedPath, validateJSON...)
+	combinedPath = append(combinedPath, validateResponse...)
+	combinedPath = append(combinedPath, grpcTranscoded...)
+	combinedPath = append(combinedPath, soapMediated...)
+	combinedPath = append(combinedPath, mirrored...)
 
 	if len(whiteListPaths) > 0 {
 		return combinedPath, true
@@ -1053,6 +1369,16 @@ func (a *APISpec) getURLStatus(stat URLStatus) RequestStatus {
 		return StatusRequesTracked
 	case RequestNotTracked:
 		return StatusRequestNotTracked
+	case ValidateJSONRequest:
+		return StatusValidateJSON
+	case ValidateJSONResponse:
+		return StatusValidateJSONResponse
+	case GRPCTranscoded:
+		return StatusGRPCTranscoded
+	case SOAPMediated:
+		return StatusSOAPMediated
+	case Mirrored:
+		return StatusMirrored
 	default:
 		log.Error("URL Status was not one of Ignored, Blacklist or WhiteList! Blocking.")
 		return EndPointNotAllowed
@@ -1070,10 +1396,10 @@ func (a *APISpec) IsURLAllowedAndIgnored(method, url string, RxPaths *[]URLSpec,
 				methodMeta, matchMethodOk := v.MethodActions[method]
 				if matchMethodOk {
 					// Matched the method, check what status it is:
-					if methodMeta.Action != tykcommon.NoAction {
+					if methodMeta.Action != apidef.NoAction {
 						// TODO: Extend here for additional reply options
 						switch methodMeta.Action {
-						case tykcommon.Reply:
+						case apidef.Reply:
 							return StatusRedirectFlowByReply, &methodMeta
 						default:
 							log.Error("URL Method Action was not set to NoAction, blocking.")
@@ -1095,7 +1421,7 @@ func (a *APISpec) IsURLAllowedAndIgnored(method, url string, RxPaths *[]URLSpec,
 				return StatusOk, nil
 			}
 
-			if v.TransformAction.Template != nil {
+			if v.TransformAction.Template != nil || v.TransformAction.Mapping != nil {
 				return a.getURLStatus(v.Status), &v.TransformAction
 			}
 
@@ -1186,6 +1512,26 @@ func (a *APISpec) CheckSpecMatchesStatus(url string, method interface{}, RxPaths
 					if method != nil && method.(string) == v.DoNotTrackEndpoint.Method {
 						return true, &v.DoNotTrackEndpoint
 					}
+				case ValidateJSONRequest:
+					if method != nil && method.(string) == v.ValidatePathMeta.Method {
+						return true, &v.ValidatePathMeta
+					}
+				case ValidateJSONResponse:
+					if method != nil && method.(string) == v.ValidateResponseMeta.Method {
+						return true, &v.ValidateResponseMeta
+					}
+				case GRPCTranscoded:
+					if method != nil && method.(string) == v.GRPCTranscode.Method {
+						return true, &v.GRPCTranscode
+					}
+				case SOAPMediated:
+					if method != nil && method.(string) == v.SOAPMediation.Method {
+						return true, &v.SOAPMediation
+					}
+				case Mirrored:
+					if method != nil && method.(string) == v.Mirror.Method {
+						return true, &v.Mirror
+					}
 				}
 
 			}
@@ -1242,7 +1588,7 @@ func (a *APISpec) getVersionFromRequest(r *http.Request) string {
 }
 
 // IsThisAPIVersionExpired checks if an API version (during a proxied request) is expired
-func (a *APISpec) IsThisAPIVersionExpired(versionDef *tykcommon.VersionInfo) bool {
+func (a *APISpec) IsThisAPIVersionExpired(versionDef *apidef.VersionInfo) bool {
 	// Never expires
 	if versionDef.Expires == "-1" {
 		return false
@@ -1313,8 +1659,8 @@ func (a *APISpec) IsRequestValid(r *http.Request) (bool, RequestStatus, interfac
 
 // GetVersionData attempts to extract the version data from a request, depending on where it is stored in the
 // request (currently only "header" is supported)
-func (a *APISpec) GetVersionData(r *http.Request) (*tykcommon.VersionInfo, *[]URLSpec, bool, RequestStatus) {
-	var thisVersion = tykcommon.VersionInfo{}
+func (a *APISpec) GetVersionData(r *http.Request) (*apidef.VersionInfo, *[]URLSpec, bool, RequestStatus) {
+	var thisVersion = apidef.VersionInfo{}
 	var versionKey string
 	var versionRxPaths = []URLSpec{}
 	var versionWLStatus bool
@@ -1323,7 +1669,7 @@ func (a *APISpec) GetVersionData(r *http.Request) (*tykcommon.VersionInfo, *[]UR
 	aVersion, foundInContext := context.GetOk(r, VersionData)
 
 	if foundInContext {
-		thisVersion = aVersion.(tykcommon.VersionInfo)
+		thisVersion = aVersion.(apidef.VersionInfo)
 		versionKey = context.Get(r, VersionKeyContext).(string)
 	} else {
 		// Are we versioned?
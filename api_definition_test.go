@@ -2,7 +2,7 @@ package main
 
 import (
 	"encoding/json"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/lonelycode/gorpc"
 	"io/ioutil"
 	"io"
@@ -142,7 +142,7 @@ func createDefinitionFromString(defStr string) *APISpec {
 	return thisSpec
 }
 
-func writeDefToFile(configStruct tykcommon.APIDefinition) {
+func writeDefToFile(configStruct apidef.APIDefinition) {
 	newConfig, err := json.Marshal(configStruct)
 	if err != nil {
 		log.Error("Problem marshalling configuration!")
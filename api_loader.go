@@ -11,7 +11,7 @@ import (
 
 	"github.com/TykTechnologies/logrus"
 	"github.com/TykTechnologies/tyk/coprocess"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
 	"github.com/justinas/alice"
@@ -170,7 +170,7 @@ func processSpec(referenceSpec *APISpec,
 
 	// Set up LB targets:
 	if referenceSpec.Proxy.EnableLoadBalancing {
-		thisSL := tykcommon.NewHostListFromList(referenceSpec.Proxy.Targets)
+		thisSL := apidef.NewHostListFromList(referenceSpec.Proxy.Targets)
 		referenceSpec.Proxy.StructuredTargetList = thisSL
 	}
 
@@ -224,12 +224,12 @@ func processSpec(referenceSpec *APISpec,
 
 	//Set up all the JSVM middleware
 	mwPaths := []string{}
-	var mwAuthCheckFunc tykcommon.MiddlewareDefinition
-	mwPreFuncs := []tykcommon.MiddlewareDefinition{}
-	mwPostFuncs := []tykcommon.MiddlewareDefinition{}
-	mwPostAuthCheckFuncs := []tykcommon.MiddlewareDefinition{}
+	var mwAuthCheckFunc apidef.MiddlewareDefinition
+	mwPreFuncs := []apidef.MiddlewareDefinition{}
+	mwPostFuncs := []apidef.MiddlewareDefinition{}
+	mwPostAuthCheckFuncs := []apidef.MiddlewareDefinition{}
 
-	var mwDriver tykcommon.MiddlewareDriver
+	var mwDriver apidef.MiddlewareDriver
 
 	if EnableCoProcess {
 		loadBundle(referenceSpec)
@@ -244,7 +244,7 @@ func processSpec(referenceSpec *APISpec,
 
 		mwPaths, mwAuthCheckFunc, mwPreFuncs, mwPostFuncs, mwPostAuthCheckFuncs, mwDriver = loadCustomMiddleware(referenceSpec)
 
-		if config.EnableJSVM && mwDriver == tykcommon.OttoDriver {
+		if config.EnableJSVM && mwDriver == apidef.OttoDriver {
 			var pathPrefix string
 			if referenceSpec.CustomMiddlewareBundle != "" {
 				pathPrefix = strings.Join([]string{referenceSpec.APIID, referenceSpec.CustomMiddlewareBundle}, "-")
@@ -322,24 +322,31 @@ func processSpec(referenceSpec *APISpec,
 		handleCORS(&chainArray, referenceSpec)
 
 		var baseChainArray = []alice.Constructor{}
+		AppendMiddleware(&baseChainArray, &RequestIDMiddleware{tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray, &RateCheckMW{TykMiddleware: tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray, &IPWhiteListMiddleware{TykMiddleware: tykMiddleware}, tykMiddleware)
+		AppendMiddleware(&baseChainArray, &ConcurrencyLimitCheck{tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray, &OrganizationMonitor{TykMiddleware: tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray, &MiddlewareContextVars{TykMiddleware: tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray, &VersionCheck{TykMiddleware: tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray, &RequestSizeLimitMiddleware{tykMiddleware}, tykMiddleware)
+		AppendMiddleware(&baseChainArray, &ValidateJSON{tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray, &TrackEndpointMiddleware{tykMiddleware}, tykMiddleware)
+		AppendMiddleware(&baseChainArray, &GraphQLMiddleware{tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray, &TransformMiddleware{tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray, &TransformHeaders{TykMiddleware: tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray, &RedisCacheMiddleware{TykMiddleware: tykMiddleware, CacheStore: CacheStore}, tykMiddleware)
 		AppendMiddleware(&baseChainArray, &VirtualEndpoint{TykMiddleware: tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray, &URLRewriteMiddleware{TykMiddleware: tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray, &TransformMethod{TykMiddleware: tykMiddleware}, tykMiddleware)
+		AppendMiddleware(&baseChainArray, &GRPCTranscode{tykMiddleware}, tykMiddleware)
+		AppendMiddleware(&baseChainArray, &SOAPMediation{tykMiddleware}, tykMiddleware)
+		AppendMiddleware(&baseChainArray, &TrafficMirror{tykMiddleware}, tykMiddleware)
 
 		log.Debug(referenceSpec.APIDefinition.Name, " - CHAIN SIZE: ", len(baseChainArray))
 
 		for _, obj := range mwPreFuncs {
-			if mwDriver != tykcommon.OttoDriver {
+			if mwDriver != apidef.OttoDriver {
 				log.WithFields(logrus.Fields{
 					"prefix":   "coprocess",
 					"api_name": referenceSpec.APIDefinition.Name,
@@ -355,7 +362,7 @@ func processSpec(referenceSpec *APISpec,
 		}
 
 		for _, obj := range mwPostFuncs {
-			if mwDriver != tykcommon.OttoDriver {
+			if mwDriver != apidef.OttoDriver {
 				log.WithFields(logrus.Fields{
 					"prefix":   "coprocess",
 					"api_name": referenceSpec.APIDefinition.Name,
@@ -376,6 +383,7 @@ func processSpec(referenceSpec *APISpec,
 		handleCORS(&chainArray, referenceSpec)
 
 		var baseChainArray_PreAuth = []alice.Constructor{}
+		AppendMiddleware(&baseChainArray_PreAuth, &RequestIDMiddleware{tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray_PreAuth, &RateCheckMW{TykMiddleware: tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray_PreAuth, &IPWhiteListMiddleware{TykMiddleware: tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray_PreAuth, &OrganizationMonitor{TykMiddleware: tykMiddleware}, tykMiddleware)
@@ -386,7 +394,7 @@ func processSpec(referenceSpec *APISpec,
 
 		// Add pre-process MW
 		for _, obj := range mwPreFuncs {
-			if mwDriver != tykcommon.OttoDriver {
+			if mwDriver != apidef.OttoDriver {
 				log.WithFields(logrus.Fields{
 					"prefix":   "coprocess",
 					"api_name": referenceSpec.APIDefinition.Name,
@@ -413,11 +421,11 @@ func processSpec(referenceSpec *APISpec,
 
 		}
 
-		useCoProcessAuth := EnableCoProcess && mwDriver != tykcommon.OttoDriver && referenceSpec.EnableCoProcessAuth
+		useCoProcessAuth := EnableCoProcess && mwDriver != apidef.OttoDriver && referenceSpec.EnableCoProcessAuth
 
 		var useOttoAuth bool = false
 		if !useCoProcessAuth {
-			useOttoAuth = mwDriver == tykcommon.OttoDriver && referenceSpec.EnableCoProcessAuth
+			useOttoAuth = mwDriver == apidef.OttoDriver && referenceSpec.EnableCoProcessAuth
 		}
 
 		if referenceSpec.APIDefinition.UseBasicAuth {
@@ -508,21 +516,27 @@ func processSpec(referenceSpec *APISpec,
 		var baseChainArray_PostAuth = []alice.Constructor{}
 		AppendMiddleware(&baseChainArray_PostAuth, &KeyExpired{tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray_PostAuth, &AccessRightsCheck{tykMiddleware}, tykMiddleware)
+		AppendMiddleware(&baseChainArray_PostAuth, &ConcurrencyLimitCheck{tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray_PostAuth, &RateLimitAndQuotaCheck{tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray_PostAuth, &GranularAccessMiddleware{tykMiddleware}, tykMiddleware)
+		AppendMiddleware(&baseChainArray_PostAuth, &GraphQLMiddleware{tykMiddleware}, tykMiddleware)
+		AppendMiddleware(&baseChainArray_PostAuth, &ValidateJSON{tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray_PostAuth, &TransformMiddleware{tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray_PostAuth, &TransformHeaders{TykMiddleware: tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray_PostAuth, &URLRewriteMiddleware{TykMiddleware: tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray_PostAuth, &RedisCacheMiddleware{TykMiddleware: tykMiddleware, CacheStore: CacheStore}, tykMiddleware)
 		AppendMiddleware(&baseChainArray_PostAuth, &TransformMethod{TykMiddleware: tykMiddleware}, tykMiddleware)
 		AppendMiddleware(&baseChainArray_PostAuth, &VirtualEndpoint{TykMiddleware: tykMiddleware}, tykMiddleware)
+		AppendMiddleware(&baseChainArray_PostAuth, &GRPCTranscode{tykMiddleware}, tykMiddleware)
+		AppendMiddleware(&baseChainArray_PostAuth, &SOAPMediation{tykMiddleware}, tykMiddleware)
+		AppendMiddleware(&baseChainArray_PostAuth, &TrafficMirror{tykMiddleware}, tykMiddleware)
 
 		for _, baseMw := range baseChainArray_PostAuth {
 			chainArray = append(chainArray, baseMw)
 		}
 
 		for _, obj := range mwPostFuncs {
-			if mwDriver != tykcommon.OttoDriver {
+			if mwDriver != apidef.OttoDriver {
 				log.WithFields(logrus.Fields{
 					"prefix":   "coprocess",
 					"api_name": referenceSpec.APIDefinition.Name,
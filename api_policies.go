@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/logrus"
+	"github.com/nu7hatch/gouuid"
+)
+
+// APIModifyPolicySuccess is returned when a policy is created, updated or deleted
+type APIModifyPolicySuccess struct {
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Action  string `json:"action"`
+	Version int64  `json:"version"`
+}
+
+// policyAPIMu serialises changes made through the API so version checks can't race
+var policyAPIMu sync.Mutex
+
+func policyETag(thisPolicy Policy) string {
+	return strconv.Quote(strconv.FormatInt(thisPolicy.Version, 10))
+}
+
+// policyPreconditionFailed checks an If-Match header against the current version of a policy
+func policyPreconditionFailed(r *http.Request, thisPolicy Policy) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" || ifMatch == "*" {
+		return false
+	}
+
+	return ifMatch != policyETag(thisPolicy)
+}
+
+// ValidatePolicy checks a policy before it is stored, policies is the set it will be stored into
+func ValidatePolicy(thisPolicy Policy, policies map[string]Policy) error {
+	if thisPolicy.ID == "" {
+		return errors.New("policy ID cannot be empty")
+	}
+
+	if thisPolicy.OrgID == "" {
+		return errors.New("policy must belong to an organisation")
+	}
+
+	if thisPolicy.Rate < 0 || thisPolicy.Per < 0 {
+		return errors.New("rate and per cannot be negative")
+	}
+
+	if thisPolicy.QuotaMax < -1 || thisPolicy.QuotaRenewalRate < 0 {
+		return errors.New("invalid quota settings")
+	}
+
+	switch QuotaPeriod(thisPolicy.QuotaRenewalPeriod) {
+	case QuotaPeriodRolling, QuotaPeriodHourly, QuotaPeriodDaily, QuotaPeriodWeekly, QuotaPeriodMonthly:
+	default:
+		return errors.New("unknown quota renewal period: " + thisPolicy.QuotaRenewalPeriod)
+	}
+
+	if thisPolicy.QuotaTimezone != "" {
+		if _, err := time.LoadLocation(thisPolicy.QuotaTimezone); err != nil {
+			return errors.New("invalid quota timezone: " + thisPolicy.QuotaTimezone)
+		}
+	}
+
+	if thisPolicy.MaxConcurrentRequests < 0 {
+		return errors.New("max concurrent requests cannot be negative")
+	}
+
+	if thisPolicy.ParentID != "" {
+		withPolicy := make(map[string]Policy, len(policies)+1)
+		for id, p := range policies {
+			withPolicy[id] = p
+		}
+		withPolicy[thisPolicy.ID] = thisPolicy
+
+		if _, err := resolvePolicy(thisPolicy.ID, withPolicy, map[string]bool{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getPolicySnapshot() map[string]Policy {
+	policiesMu.RLock()
+	defer policiesMu.RUnlock()
+
+	snapshot := make(map[string]Policy, len(policiesByID))
+	for id, p := range policiesByID {
+		snapshot[id] = p
+	}
+
+	return snapshot
+}
+
+// checkPolicySourceWritable reports why policies can't be changed through the API, if they can't,
+// handlers answer with a conflict as the request is fine but the node isn't set up to take it
+func checkPolicySourceWritable() error {
+	if config.Policies.PolicySource == "service" || config.Policies.PolicySource == "rpc" {
+		return errors.New("Policies are read only on this node, they are managed by the dashboard, please use the dashboard API")
+	}
+
+	if config.Policies.PolicySource != "redis" && config.Policies.PolicyRecordName == "" {
+		return errors.New("Policies are read only on this node, no policy file has been configured (policies.policy_record_name)")
+	}
+
+	return nil
+}
+
+// applyPolicyChange updates the local policy set and, for the redis source, tells the rest of the
+// cluster to reload. A policy file is local to the node that wrote it: other nodes read their own
+// copy and would reload stale policies, so changes made with the file source only apply to this
+// node. Clusters that manage policies through the API should use the redis source.
+func applyPolicyChange(policyID string, thisPolicy *Policy) {
+	policiesMu.Lock()
+	if thisPolicy == nil {
+		delete(policiesByID, policyID)
+	} else {
+		policiesByID[policyID] = *thisPolicy
+	}
+	flushMergedPolicies()
+	policiesMu.Unlock()
+
+	if config.Policies.PolicySource == "redis" {
+		MainNotifier.Notify(Notification{Command: NoticePolicyChanged})
+	}
+}
+
+func handleGetPolicy(policyID string, r *http.Request, w http.ResponseWriter) ([]byte, int) {
+	policiesMu.RLock()
+	thisPolicy, found := policiesByID[policyID]
+	policiesMu.RUnlock()
+
+	if !found {
+		return createError("Policy not found"), 404
+	}
+
+	w.Header().Set("ETag", policyETag(thisPolicy))
+	if r.Header.Get("If-None-Match") == policyETag(thisPolicy) {
+		return nil, 304
+	}
+
+	responseMessage, err := json.Marshal(&thisPolicy)
+	if err != nil {
+		log.Error("Marshalling failed: ", err)
+		return []byte(E_SYSTEM_ERROR), 500
+	}
+
+	return responseMessage, 200
+}
+
+func handleGetPolicyList() ([]byte, int) {
+	policies := getPolicySnapshot()
+	policyList := make([]Policy, 0, len(policies))
+	for _, p := range policies {
+		policyList = append(policyList, p)
+	}
+
+	responseMessage, err := json.Marshal(&policyList)
+	if err != nil {
+		log.Error("Marshalling failed: ", err)
+		return []byte(E_SYSTEM_ERROR), 500
+	}
+
+	return responseMessage, 200
+}
+
+func handleAddOrUpdatePolicy(policyID string, r *http.Request, w http.ResponseWriter) ([]byte, int) {
+	if err := checkPolicySourceWritable(); err != nil {
+		return createError(err.Error()), 409
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return createError("Could not read request body"), 400
+	}
+
+	newPolicy := Policy{}
+	if err := json.Unmarshal(body, &newPolicy); err != nil {
+		log.Error("Couldn't decode new policy object: ", err)
+		return createError("Request malformed"), 400
+	}
+
+	policyAPIMu.Lock()
+	defer policyAPIMu.Unlock()
+
+	policies := getPolicySnapshot()
+	action := "modified"
+
+	if r.Method == "POST" {
+		if policyID != "" {
+			return createError("Policy ID must be set in the request body when creating a policy"), 400
+		}
+
+		if newPolicy.ID == "" {
+			u5, _ := uuid.NewV4()
+			newPolicy.ID = strings.Replace(u5.String(), "-", "", -1)
+		}
+
+		if _, found := policies[newPolicy.ID]; found {
+			return createError("Policy already exists"), 409
+		}
+
+		newPolicy.Version = 1
+		action = "added"
+	} else {
+		if policyID == "" {
+			return createError("Must specify a policy ID to update"), 400
+		}
+
+		existing, found := policies[policyID]
+		if !found {
+			return createError("Policy not found"), 404
+		}
+
+		if newPolicy.ID != "" && newPolicy.ID != policyID {
+			return createError("Policy ID in the request body does not match the URL"), 400
+		}
+
+		if policyPreconditionFailed(r, existing) {
+			w.Header().Set("ETag", policyETag(existing))
+			return createError("Policy has been modified, version does not match"), 412
+		}
+
+		newPolicy.ID = policyID
+		newPolicy.Version = existing.Version + 1
+	}
+
+	if err := ValidatePolicy(newPolicy, policies); err != nil {
+		return createError("Policy validation failed: " + err.Error()), 400
+	}
+
+	newPolicy.LastUpdated = strconv.FormatInt(time.Now().Unix(), 10)
+
+	if err := SavePolicy(newPolicy); err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix":   "api",
+			"policyID": newPolicy.ID,
+			"status":   "fail",
+			"err":      err,
+		}).Error("Failed to save policy.")
+		return createError("Could not save policy"), 500
+	}
+
+	applyPolicyChange(newPolicy.ID, &newPolicy)
+
+	log.WithFields(logrus.Fields{
+		"prefix":   "api",
+		"policyID": newPolicy.ID,
+		"version":  newPolicy.Version,
+		"status":   "ok",
+	}).Info("Policy ", action, ".")
+
+	w.Header().Set("ETag", policyETag(newPolicy))
+	responseMessage, err := json.Marshal(&APIModifyPolicySuccess{newPolicy.ID, "ok", action, newPolicy.Version})
+	if err != nil {
+		log.Error("Marshalling failed: ", err)
+		return []byte(E_SYSTEM_ERROR), 500
+	}
+
+	return responseMessage, 200
+}
+
+func handleDeletePolicy(policyID string, r *http.Request) ([]byte, int) {
+	if err := checkPolicySourceWritable(); err != nil {
+		return createError(err.Error()), 409
+	}
+
+	policyAPIMu.Lock()
+	defer policyAPIMu.Unlock()
+
+	policies := getPolicySnapshot()
+	existing, found := policies[policyID]
+	if !found {
+		return createError("Policy not found"), 404
+	}
+
+	if policyPreconditionFailed(r, existing) {
+		return createError("Policy has been modified, version does not match"), 412
+	}
+
+	for id, p := range policies {
+		if p.ParentID == policyID {
+			return createError("Policy is extended by policy " + id + " and cannot be deleted"), 409
+		}
+	}
+
+	if err := DeletePolicy(policyID); err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix":   "api",
+			"policyID": policyID,
+			"status":   "fail",
+			"err":      err,
+		}).Error("Failed to delete policy.")
+		return createError("Delete failed"), 500
+	}
+
+	applyPolicyChange(policyID, nil)
+
+	log.WithFields(logrus.Fields{
+		"prefix":   "api",
+		"policyID": policyID,
+		"status":   "ok",
+	}).Info("Policy deleted.")
+
+	responseMessage, err := json.Marshal(&APIModifyPolicySuccess{policyID, "ok", "deleted", existing.Version})
+	if err != nil {
+		log.Error("Marshalling failed: ", err)
+		return []byte(E_SYSTEM_ERROR), 500
+	}
+
+	return responseMessage, 200
+}
+
+// policyHandler manages policies (/tyk/policies and /tyk/policies/{id}), changes are
+// persisted to the configured policy source and picked up by the rest of the cluster
+func policyHandler(w http.ResponseWriter, r *http.Request) {
+	var policyID string
+	if r.URL.Path != "/tyk/policies" {
+		policyID = strings.Trim(r.URL.Path[len("/tyk/policies/"):], "/")
+	}
+
+	var responseMessage []byte
+	var code int
+
+	switch r.Method {
+	case "GET":
+		if policyID != "" {
+			responseMessage, code = handleGetPolicy(policyID, r, w)
+		} else {
+			responseMessage, code = handleGetPolicyList()
+		}
+	case "POST", "PUT":
+		responseMessage, code = handleAddOrUpdatePolicy(policyID, r, w)
+	case "DELETE":
+		if policyID != "" {
+			responseMessage, code = handleDeletePolicy(policyID, r)
+		} else {
+			code = 400
+			responseMessage = createError("Must specify a policy ID to delete")
+		}
+	default:
+		// Return Not supported message (and code)
+		code = 405
+		responseMessage = createError("Method not supported")
+	}
+
+	if code == 304 {
+		w.WriteHeader(code)
+		return
+	}
+
+	DoJSONWrite(w, code, responseMessage)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidatePolicy(t *testing.T) {
+	policies := createMergeTestPolicies()
+
+	valid := Policy{ID: "silver", OrgID: "default", ParentID: "base", QuotaRenewalPeriod: "daily"}
+	if err := ValidatePolicy(valid, policies); err != nil {
+		t.Error("Policy should be valid: ", err)
+	}
+
+	invalid := map[string]Policy{
+		"missing org":      {ID: "p"},
+		"negative rate":    {ID: "p", OrgID: "default", Rate: -1},
+		"unknown period":   {ID: "p", OrgID: "default", QuotaRenewalPeriod: "fortnightly"},
+		"bad timezone":     {ID: "p", OrgID: "default", QuotaTimezone: "Nowhere/Special"},
+		"missing parent":   {ID: "p", OrgID: "default", ParentID: "nope"},
+		"other org":        {ID: "p", OrgID: "other", ParentID: "base"},
+		"inheritance loop": {ID: "base", OrgID: "default", ParentID: "gold"},
+	}
+
+	for name, p := range invalid {
+		if err := ValidatePolicy(p, policies); err == nil {
+			t.Error("Policy should be rejected: ", name)
+		}
+	}
+}
+
+func TestSavePolicyToFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyk-policies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldSource, oldRecord := config.Policies.PolicySource, config.Policies.PolicyRecordName
+	config.Policies.PolicySource = "file"
+	config.Policies.PolicyRecordName = filepath.Join(dir, "policies.json")
+	defer func() {
+		config.Policies.PolicySource, config.Policies.PolicyRecordName = oldSource, oldRecord
+	}()
+
+	ioutil.WriteFile(config.Policies.PolicyRecordName, []byte("{}"), 0644)
+
+	if err := SavePolicy(Policy{ID: "p1", OrgID: "default", Rate: 5, Per: 1, Version: 2}); err != nil {
+		t.Fatal("Save failed: ", err)
+	}
+
+	loaded := LoadPoliciesFromFile(config.Policies.PolicyRecordName)
+	if loaded["p1"].Version != 2 || loaded["p1"].Rate != 5 {
+		t.Error("Saved policy should be loaded back, got: ", loaded)
+	}
+
+	if err := DeletePolicy("p1"); err != nil {
+		t.Fatal("Delete failed: ", err)
+	}
+
+	loaded = LoadPoliciesFromFile(config.Policies.PolicyRecordName)
+	if _, found := loaded["p1"]; found {
+		t.Error("Deleted policy should be gone")
+	}
+}
+
+func TestPolicyWriteReadOnlySource(t *testing.T) {
+	oldSource, oldRecord := config.Policies.PolicySource, config.Policies.PolicyRecordName
+	defer func() {
+		config.Policies.PolicySource, config.Policies.PolicyRecordName = oldSource, oldRecord
+	}()
+
+	for _, source := range []string{"service", "file"} {
+		config.Policies.PolicySource, config.Policies.PolicyRecordName = source, ""
+		if body, code := handleDeletePolicy("p1", nil); code != 409 {
+			t.Errorf("A read only %s source should be a conflict, got %d: %s", source, code, body)
+		}
+	}
+}
+
+func TestSavePolicyBrokenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyk-policies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldSource, oldRecord := config.Policies.PolicySource, config.Policies.PolicyRecordName
+	config.Policies.PolicySource = "file"
+	config.Policies.PolicyRecordName = filepath.Join(dir, "policies.json")
+	defer func() {
+		config.Policies.PolicySource, config.Policies.PolicyRecordName = oldSource, oldRecord
+	}()
+
+	broken := []byte(`{"p1": {"id": "p1"`)
+	ioutil.WriteFile(config.Policies.PolicyRecordName, broken, 0644)
+
+	if err := SavePolicy(Policy{ID: "p2", OrgID: "default"}); err == nil {
+		t.Error("Saving into an unreadable policy file should fail")
+	}
+
+	if onDisk, _ := ioutil.ReadFile(config.Policies.PolicyRecordName); string(onDisk) != string(broken) {
+		t.Error("A failed save must leave the policy file alone, got: ", string(onDisk))
+	}
+}
+
+func TestGetPoliciesEmptyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tyk-policies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldSource, oldRecord := config.Policies.PolicySource, config.Policies.PolicyRecordName
+	config.Policies.PolicySource = "file"
+	config.Policies.PolicyRecordName = filepath.Join(dir, "policies.json")
+	policiesMu.Lock()
+	oldPolicies := policiesByID
+	policiesByID = map[string]Policy{"p1": {ID: "p1"}}
+	policiesMu.Unlock()
+	defer func() {
+		config.Policies.PolicySource, config.Policies.PolicyRecordName = oldSource, oldRecord
+		policiesMu.Lock()
+		policiesByID = oldPolicies
+		policiesMu.Unlock()
+	}()
+
+	ioutil.WriteFile(config.Policies.PolicyRecordName, []byte("not json"), 0644)
+	getPolicies()
+	if len(getPolicySnapshot()) != 1 {
+		t.Error("A policy file that can't be read should keep the current policies")
+	}
+
+	ioutil.WriteFile(config.Policies.PolicyRecordName, []byte("{}"), 0644)
+	getPolicies()
+	if len(getPolicySnapshot()) != 0 {
+		t.Error("An empty policy file should replace the current policies")
+	}
+}
@@ -3,13 +3,14 @@ package main
 import (
 	"encoding/json"
 	"github.com/gorilla/mux"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 var apiTestDef string = `
@@ -80,7 +81,7 @@ type Success struct {
 }
 
 type testAPIDefinition struct {
-	tykcommon.APIDefinition
+	apidef.APIDefinition
 	ID string `json:"id"`
 }
 
@@ -561,3 +562,41 @@ func TestGetOAuthClients(t *testing.T) {
 
 	ApiSpecRegister = nil
 }
+
+func TestUpdateKeyKeepsQuotaLastReset(t *testing.T) {
+	spec := createDefinitionFromString(apiTestDef)
+	store := &InMemoryStorageManager{Sessions: make(map[string]string)}
+	spec.Init(store, store, store, store)
+
+	apisMu.Lock()
+	previousRegister := ApiSpecRegister
+	ApiSpecRegister = map[string]*APISpec{spec.APIID: spec}
+	apisMu.Unlock()
+	defer func() {
+		apisMu.Lock()
+		ApiSpecRegister = previousRegister
+		apisMu.Unlock()
+	}()
+
+	session := createSampleSession()
+	if err := doAddOrUpdate("quota-reset-key", session, true); err != nil {
+		t.Fatal(err)
+	}
+
+	created, _ := spec.SessionManager.GetSessionDetail("quota-reset-key")
+	if created.QuotaLastReset < time.Now().Unix()-60 {
+		t.Error("New keys should start after earlier resets, got: ", created.QuotaLastReset)
+	}
+
+	created.QuotaLastReset = 1000
+	spec.SessionManager.UpdateSession("quota-reset-key", created, 0)
+
+	// Updates sent through the API don't know when the key was last reset
+	session.QuotaLastReset = 0
+	if err := doAddOrUpdate("quota-reset-key", session, true); err != nil {
+		t.Fatal(err)
+	}
+	if updated, _ := spec.SessionManager.GetSessionDetail("quota-reset-key"); updated.QuotaLastReset != 1000 {
+		t.Error("Updated keys should keep the resets they've had, got: ", updated.QuotaLastReset)
+	}
+}
@@ -1,4 +1,4 @@
-package tykcommon
+package apidef
 
 import (
 	"encoding/base64"
@@ -24,8 +24,9 @@ const (
 	NoAction EndpointMethodAction = "no_action"
 	Reply    EndpointMethodAction = "reply"
 
-	UseBlob TemplateMode = "blob"
-	UseFile TemplateMode = "file"
+	UseBlob    TemplateMode = "blob"
+	UseFile    TemplateMode = "file"
+	UseMapping TemplateMode = "mapping"
 
 	RequestXML  RequestInputType = "xml"
 	RequestJSON RequestInputType = "json"
@@ -54,11 +55,19 @@ const (
 	UnsetAuth     AuthTypeEnum = ""
 )
 
+type MockResponseMeta struct {
+	Name    string            `bson:"name" json:"name"`
+	Code    int               `bson:"code" json:"code"`
+	Data    string            `bson:"data" json:"data"`
+	Headers map[string]string `bson:"headers" json:"headers"`
+}
+
 type EndpointMethodMeta struct {
-	Action  EndpointMethodAction `bson:"action" json:"action"`
-	Code    int                  `bson:"code" json:"code"`
-	Data    string               `bson:"data" json:"data"`
-	Headers map[string]string    `bson:"headers" json:"headers"`
+	Action        EndpointMethodAction `bson:"action" json:"action"`
+	Code          int                  `bson:"code" json:"code"`
+	Data          string               `bson:"data" json:"data"`
+	Headers       map[string]string    `bson:"headers" json:"headers"`
+	MockResponses []MockResponseMeta   `bson:"mock_responses" json:"mock_responses,omitempty"`
 }
 
 type EndPointMeta struct {
@@ -68,23 +77,45 @@ type EndPointMeta struct {
 
 type RequestInputType string
 
+type JSONMappingField struct {
+	Target     string      `bson:"target" json:"target"`
+	Expression string      `bson:"expression" json:"expression"`
+	Default    interface{} `bson:"default" json:"default"`
+}
+
+type JSONMappingRename struct {
+	From string `bson:"from" json:"from"`
+	To   string `bson:"to" json:"to"`
+}
+
+type JSONMapping struct {
+	KeepInput bool                `bson:"keep_input" json:"keep_input"`
+	Fields    []JSONMappingField  `bson:"fields" json:"fields"`
+	Rename    []JSONMappingRename `bson:"rename" json:"rename"`
+	Remove    []string            `bson:"remove" json:"remove"`
+}
+
 type TemplateMeta struct {
 	TemplateData struct {
 		Input          RequestInputType `bson:"input_type" json:"input_type"`
 		Mode           TemplateMode     `bson:"template_mode" json:"template_mode"`
 		EnableSession  bool             `bson:"enable_session" json:"enable_session"`
 		TemplateSource string           `bson:"template_source" json:"template_source"`
+		Mapping        JSONMapping      `bson:"mapping" json:"mapping"`
 	} `bson:"template_data" json:"template_data"`
 	Path   string `bson:"path" json:"path"`
 	Method string `bson:"method" json:"method"`
 }
 
 type HeaderInjectionMeta struct {
-	DeleteHeaders []string          `bson:"delete_headers" json:"delete_headers"`
-	AddHeaders    map[string]string `bson:"add_headers" json:"add_headers"`
-	Path          string            `bson:"path" json:"path"`
-	Method        string            `bson:"method" json:"method"`
-	ActOnResponse bool              `bson:"act_on" json:"act_on"`
+	DeleteHeaders   []string               `bson:"delete_headers" json:"delete_headers"`
+	AddHeaders      map[string]string      `bson:"add_headers" json:"add_headers"`
+	TemplateHeaders map[string]string      `bson:"template_headers" json:"template_headers,omitempty"`
+	Path            string                 `bson:"path" json:"path"`
+	Method          string                 `bson:"method" json:"method"`
+	ActOnResponse   bool                   `bson:"act_on" json:"act_on"`
+	ConditionsOn    RoutingTriggerOnType   `bson:"conditions_on" json:"conditions_on,omitempty"`
+	Conditions      *RoutingTriggerOptions `bson:"conditions" json:"conditions,omitempty"`
 }
 
 type HardTimeoutMeta struct {
@@ -113,10 +144,37 @@ type CircuitBreakerMeta struct {
 }
 
 type URLRewriteMeta struct {
-	Path         string `bson:"path" json:"path"`
-	Method       string `bson:"method" json:"method"`
-	MatchPattern string `bson:"match_pattern" json:"match_pattern"`
-	RewriteTo    string `bson:"rewrite_to" json:"rewrite_to"`
+	Path         string           `bson:"path" json:"path"`
+	Method       string           `bson:"method" json:"method"`
+	MatchPattern string           `bson:"match_pattern" json:"match_pattern"`
+	RewriteTo    string           `bson:"rewrite_to" json:"rewrite_to"`
+	Triggers     []RoutingTrigger `bson:"triggers" json:"triggers"`
+}
+
+type RoutingTriggerOnType string
+
+const (
+	RoutingTriggerOnAny RoutingTriggerOnType = "any"
+	RoutingTriggerOnAll RoutingTriggerOnType = "all"
+)
+
+type StringRegexMap struct {
+	MatchPattern string `bson:"match_rx" json:"match_rx"`
+	Reverse      bool   `bson:"reverse" json:"reverse"`
+}
+
+type RoutingTriggerOptions struct {
+	HeaderMatches         map[string]StringRegexMap `bson:"header_matches" json:"header_matches"`
+	QueryValMatches       map[string]StringRegexMap `bson:"query_val_matches" json:"query_val_matches"`
+	SessionMetaMatches    map[string]StringRegexMap `bson:"session_meta_matches" json:"session_meta_matches"`
+	RequestContextMatches map[string]StringRegexMap `bson:"request_context_matches" json:"request_context_matches"`
+	PayloadMatches        map[string]StringRegexMap `bson:"payload_matches" json:"payload_matches"`
+}
+
+type RoutingTrigger struct {
+	On        RoutingTriggerOnType  `bson:"on" json:"on"`
+	Options   RoutingTriggerOptions `bson:"options" json:"options"`
+	RewriteTo string                `bson:"rewrite_to" json:"rewrite_to"`
 }
 
 type VirtualMeta struct {
@@ -134,6 +192,56 @@ type MethodTransformMeta struct {
 	ToMethod string `bson:"to_method" json:"to_method"`
 }
 
+type ValidatePathMeta struct {
+	Path              string                 `bson:"path" json:"path"`
+	Method            string                 `bson:"method" json:"method"`
+	Schema            map[string]interface{} `bson:"schema" json:"schema"`
+	ErrorResponseCode int                    `bson:"error_response_code" json:"error_response_code"`
+}
+
+type ValidateResponseMeta struct {
+	Path    string                            `bson:"path" json:"path"`
+	Method  string                            `bson:"method" json:"method"`
+	Schemas map[string]map[string]interface{} `bson:"schemas" json:"schemas"`
+}
+
+type GRPCTranscodeMeta struct {
+	DescriptorMode   TemplateMode `bson:"descriptor_mode" json:"descriptor_mode"`
+	DescriptorSource string       `bson:"descriptor_source" json:"descriptor_source"`
+	Services         []string     `bson:"services" json:"services"`
+}
+
+type SOAPMediationMeta struct {
+	Path             string         `bson:"path" json:"path"`
+	Method           string         `bson:"method" json:"method"`
+	SOAPVersion      string         `bson:"soap_version" json:"soap_version"`
+	Operation        string         `bson:"operation" json:"operation"`
+	Namespace        string         `bson:"namespace" json:"namespace"`
+	SOAPAction       string         `bson:"soap_action" json:"soap_action"`
+	WSDLSource       string         `bson:"wsdl_source" json:"wsdl_source"`
+	TemplateMode     TemplateMode   `bson:"template_mode" json:"template_mode"`
+	TemplateSource   string         `bson:"template_source" json:"template_source"`
+	ResponsePath     string         `bson:"response_path" json:"response_path"`
+	FaultStatusCodes map[string]int `bson:"fault_status_codes" json:"fault_status_codes"`
+}
+
+// MirrorOptions sends copies of requests to shadow targets whose responses are ignored. Requests are
+// sampled at SamplePercent, everything is mirrored when it isn't set. Timeout is in seconds.
+// Credentials are stripped from the copies unless ForwardAuth is set.
+type MirrorOptions struct {
+	Targets         []string `bson:"targets" json:"targets"`
+	SamplePercent   float64  `bson:"sample_percent" json:"sample_percent"`
+	Timeout         int      `bson:"timeout" json:"timeout"`
+	RecordAnalytics bool     `bson:"record_analytics" json:"record_analytics"`
+	ForwardAuth     bool     `bson:"forward_auth" json:"forward_auth"`
+}
+
+type MirrorMeta struct {
+	Path          string `bson:"path" json:"path"`
+	Method        string `bson:"method" json:"method"`
+	MirrorOptions `bson:",inline"`
+}
+
 type ExtendedPathsSet struct {
 	Ignored                 []EndPointMeta        `bson:"ignored" json:"ignored,omitempty"`
 	WhiteList               []EndPointMeta        `bson:"white_list" json:"white_list,omitempty"`
@@ -151,6 +259,11 @@ type ExtendedPathsSet struct {
 	MethodTransforms        []MethodTransformMeta `bson:"method_transforms" json:"method_transforms,omitempty"`
 	TrackEndpoints          []TrackEndpointMeta `bson:"track_endpoints" json:"track_endpoints,omitempty"`
 	DoNotTrackEndpoints 	[]TrackEndpointMeta `bson:"do_not_track_endpoints" json:"do_not_track_endpoints,omitempty"`
+	ValidateJSON            []ValidatePathMeta    `bson:"validate_json" json:"validate_json,omitempty"`
+	ValidateResponse        []ValidateResponseMeta `bson:"validate_response" json:"validate_response,omitempty"`
+	GRPCTranscode           []GRPCTranscodeMeta    `bson:"grpc_transcode" json:"grpc_transcode,omitempty"`
+	SOAPMediation           []SOAPMediationMeta    `bson:"soap_mediation" json:"soap_mediation,omitempty"`
+	Mirror                  []MirrorMeta           `bson:"mirror" json:"mirror,omitempty"`
 }
 
 type VersionInfo struct {
@@ -256,6 +369,99 @@ type OpenIDOptions struct {
 	SegregateByClient bool                `bson:"segregate_by_client" json:"segregate_by_client"`
 }
 
+type GraphQLConfig struct {
+	Enabled           bool     `bson:"enabled" json:"enabled"`
+	MaxDepth          int      `bson:"max_depth" json:"max_depth"`
+	MaxComplexity     int      `bson:"max_complexity" json:"max_complexity"`
+	MaxAliases        int      `bson:"max_aliases" json:"max_aliases"`
+	MaxBatchSize      int      `bson:"max_batch_size" json:"max_batch_size"`
+	AllowedOperations []string `bson:"allowed_operations" json:"allowed_operations"`
+	BlockedOperations []string `bson:"blocked_operations" json:"blocked_operations"`
+	BlockedFields     []string `bson:"blocked_fields" json:"blocked_fields"`
+}
+
+type WebSocketConfig struct {
+	MaxDuration          int64                `bson:"max_duration" json:"max_duration"`
+	IdleTimeout          int64                `bson:"idle_timeout" json:"idle_timeout"`
+	MaxConnectionsPerKey int64                `bson:"max_connections_per_key" json:"max_connections_per_key"`
+	MessageRate          float64              `bson:"message_rate" json:"message_rate"`
+	MessagePer           float64              `bson:"message_per" json:"message_per"`
+	MaxMessageSize       int64                `bson:"max_message_size" json:"max_message_size"`
+	AuthRefreshInterval  int64                `bson:"auth_refresh_interval" json:"auth_refresh_interval"`
+	MessageHook          MiddlewareDefinition `bson:"message_hook" json:"message_hook"`
+}
+
+type BatchRequestOptions struct {
+	MaxRequests    int   `bson:"max_requests" json:"max_requests"`
+	MaxConcurrency int   `bson:"max_concurrency" json:"max_concurrency"`
+	Timeout        int64 `bson:"timeout" json:"timeout"`
+}
+
+type ResponseCompressionOptions struct {
+	Enabled      bool     `bson:"enabled" json:"enabled"`
+	MinSize      int64    `bson:"min_size" json:"min_size"`
+	ContentTypes []string `bson:"content_types" json:"content_types"`
+	Level        int      `bson:"level" json:"level"`
+}
+
+// ErrorOverride replaces the error a client gets for a status code or error type. Code and Message
+// change what is reported, Body is a template rendered as ContentType in place of the negotiated
+// format.
+type ErrorOverride struct {
+	Code        int               `bson:"code" json:"code"`
+	Message     string            `bson:"message" json:"message"`
+	ProblemType string            `bson:"problem_type" json:"problem_type"`
+	ContentType string            `bson:"content_type" json:"content_type"`
+	Body        string            `bson:"body" json:"body"`
+	Headers     map[string]string `bson:"headers" json:"headers"`
+}
+
+type UpstreamAuthType string
+
+const (
+	UpstreamAuthHMAC   UpstreamAuthType = "hmac"
+	UpstreamAuthSigV4  UpstreamAuthType = "aws_sigv4"
+	UpstreamAuthOAuth2 UpstreamAuthType = "oauth2_client_credentials"
+	UpstreamAuthBasic  UpstreamAuthType = "basic_auth"
+)
+
+// Secrets in the upstream auth options can be given directly or as references, see the gateway's
+// secret resolution for the supported forms
+type UpstreamHMACOptions struct {
+	KeyID   string   `bson:"key_id" json:"key_id"`
+	Secret  string   `bson:"secret" json:"secret"`
+	Headers []string `bson:"headers" json:"headers"`
+}
+
+type UpstreamSigV4Options struct {
+	AccessKey    string `bson:"access_key" json:"access_key"`
+	SecretKey    string `bson:"secret_key" json:"secret_key"`
+	SessionToken string `bson:"session_token" json:"session_token"`
+	Region       string `bson:"region" json:"region"`
+	Service      string `bson:"service" json:"service"`
+}
+
+type UpstreamOAuth2Options struct {
+	TokenURL     string   `bson:"token_url" json:"token_url"`
+	ClientID     string   `bson:"client_id" json:"client_id"`
+	ClientSecret string   `bson:"client_secret" json:"client_secret"`
+	Scopes       []string `bson:"scopes" json:"scopes"`
+	Header       string   `bson:"header" json:"header"`
+}
+
+type UpstreamBasicAuthOptions struct {
+	Username string `bson:"username" json:"username"`
+	Password string `bson:"password" json:"password"`
+}
+
+type UpstreamAuthMeta struct {
+	Type      UpstreamAuthType         `bson:"type" json:"type"`
+	HMAC      UpstreamHMACOptions      `bson:"hmac" json:"hmac"`
+	SigV4     UpstreamSigV4Options     `bson:"aws_sigv4" json:"aws_sigv4"`
+	OAuth2    UpstreamOAuth2Options    `bson:"oauth2" json:"oauth2"`
+	BasicAuth UpstreamBasicAuthOptions `bson:"basic_auth" json:"basic_auth"`
+}
+
 // APIDefinition represents the configuration for a single proxied API and it's versions.
 type APIDefinition struct {
 	Id               bson.ObjectId `bson:"_id,omitempty" json:"id,omitempty"`
@@ -318,9 +524,15 @@ type APIDefinition struct {
 		StructuredTargetList        *HostList                     `bson:"-" json:"-"`
 		CheckHostAgainstUptimeTests bool                          `bson:"check_host_against_uptime_tests" json:"check_host_against_uptime_tests"`
 		ServiceDiscovery            ServiceDiscoveryConfiguration `bson:"service_discovery" json:"service_discovery"`
+		Transport                   string                        `bson:"transport" json:"transport"`
+		StreamChunkedResponses      bool                          `bson:"stream_chunked_responses" json:"stream_chunked_responses"`
 	} `bson:"proxy" json:"proxy"`
 	DisableRateLimit          bool                   `bson:"disable_rate_limit" json:"disable_rate_limit"`
 	DisableQuota              bool                   `bson:"disable_quota" json:"disable_quota"`
+	MaxConcurrentRequests     int64                  `bson:"max_concurrent_requests" json:"max_concurrent_requests"`
+	GraphQL                   GraphQLConfig          `bson:"graphql" json:"graphql"`
+	EnableGRPCWeb             bool                   `bson:"enable_grpc_web" json:"enable_grpc_web"`
+	WebSocket                 WebSocketConfig        `bson:"websocket" json:"websocket"`
 	CustomMiddleware          MiddlewareSection      `bson:"custom_middleware" json:"custom_middleware"`
 	CustomMiddlewareBundle 	string							 `bson:"custom_middleware_bundle" json:"custom_middleware_bundle"`
 	CacheOptions              CacheOptions           `bson:"cache_options" json:"cache_options"`
@@ -330,11 +542,17 @@ type APIDefinition struct {
 	SessionProvider           SessionProviderMeta    `bson:"session_provider" json:"session_provider"`
 	EventHandlers             EventHandlerMetaConfig `bson:"event_handlers" json:"event_handlers"`
 	EnableBatchRequestSupport bool                   `bson:"enable_batch_request_support" json:"enable_batch_request_support"`
+	BatchRequestOptions       BatchRequestOptions    `bson:"batch_request_options" json:"batch_request_options"`
 	EnableIpWhiteListing      bool                   `mapstructure:"enable_ip_whitelisting" bson:"enable_ip_whitelisting" json:"enable_ip_whitelisting"`
 	AllowedIPs                []string               `mapstructure:"allowed_ips" bson:"allowed_ips" json:"allowed_ips"`
 	DontSetQuotasOnCreate     bool                   `mapstructure:"dont_set_quota_on_create" bson:"dont_set_quota_on_create" json:"dont_set_quota_on_create"`
 	ExpireAnalyticsAfter      int64                  `mapstructure:"expire_analytics_after" bson:"expire_analytics_after" json:"expire_analytics_after"` // must have an expireAt TTL index set (http://docs.mongodb.org/manual/tutorial/expire-data/)
 	ResponseProcessors        []ResponseProcessor    `bson:"response_processors" json:"response_processors"`
+	ResponseCompression       ResponseCompressionOptions `bson:"response_compression" json:"response_compression"`
+	UpstreamAuth              UpstreamAuthMeta       `bson:"upstream_auth" json:"upstream_auth"`
+	ErrorFormat               string                 `bson:"error_format" json:"error_format"`
+	ErrorOverrides            map[string]ErrorOverride `bson:"error_overrides" json:"error_overrides"`
+	Mirror                    MirrorOptions          `bson:"mirror" json:"mirror"`
 	CORS                      struct {
 		Enable             bool     `bson:"enable" json:"enable"`
 		AllowedOrigins     []string `bson:"allowed_origins" json:"allowed_origins"`
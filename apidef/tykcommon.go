@@ -1,4 +1,4 @@
-package tykcommon
+package apidef
 
 import (
 	"github.com/TykTechnologies/logrus"
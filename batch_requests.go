@@ -6,30 +6,43 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"strconv"
+	"net/url"
 	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
 )
 
-// RequestDefinition defines a batch request
+// RequestDefinition defines a batch request, a named request can be depended on by later requests,
+// which can then reference its reply with templates such as {{ .user.body.id }}. Values rendered
+// into the relative URL are escaped for the path or query they land in.
 type RequestDefinition struct {
+	Name        string            `json:"name"`
 	Method      string            `json:"method"`
 	Headers     map[string]string `json:"headers"`
 	Body        string            `json:"body"`
 	RelativeURL string            `json:"relative_url"`
+	DependsOn   []string          `json:"depends_on"`
+	Timeout     int64             `json:"timeout"`
 }
 
 // BatchRequestStructure defines a batch request order
 type BatchRequestStructure struct {
 	Requests                  []RequestDefinition `json:"requests"`
 	SuppressParallelExecution bool                `json:"suppress_parallel_execution"`
+	FailFast                  bool                `json:"fail_fast"`
 }
 
 // BatchReplyUnit encodes a request suitable for replying to a batch request
 type BatchReplyUnit struct {
+	Name        string      `json:"name,omitempty"`
 	RelativeURL string      `json:"relative_url"`
 	Code        int         `json:"code"`
 	Headers     http.Header `json:"headers"`
 	Body        string      `json:"body"`
+	Error       string      `json:"error,omitempty"`
 }
 
 // BatchRequestHandler handles batch requests on /tyk/batch for any API Definition that has the feature enabled
@@ -37,61 +50,71 @@ type BatchRequestHandler struct {
 	API *APISpec
 }
 
-// doAsyncRequest runs an async request and replies to a channel
-func (b BatchRequestHandler) doAsyncRequest(req *http.Request, relURL string, out chan BatchReplyUnit) {
-	client := &http.Client{}
-	resp, doReqErr := client.Do(req)
+type batchResult struct {
+	index int
+	reply BatchReplyUnit
+}
 
-	if doReqErr != nil {
-		log.Error("Webhook request failed: ", doReqErr)
-		return
-	}
+const (
+	batchPending = iota
+	batchRunning
+	batchDone
+)
 
-	defer resp.Body.Close()
-	content, readErr := ioutil.ReadAll(resp.Body)
-	if readErr != nil {
-		log.Warning("Body read failure! ", readErr)
-		return
+// options returns the batch limits of the API, manual batches from the JSVM have none
+func (b BatchRequestHandler) options() apidef.BatchRequestOptions {
+	if b.API == nil {
+		return apidef.BatchRequestOptions{}
 	}
+	return b.API.BatchRequestOptions
+}
 
-	reply := BatchReplyUnit{
-		RelativeURL: relURL,
-		Code:        resp.StatusCode,
-		Headers:     resp.Header,
-		Body:        string(content),
+// timeout works out how long a request may take, the API timeout caps whatever the request asks for
+func (b BatchRequestHandler) timeout(requestDef RequestDefinition) time.Duration {
+	timeout := b.options().Timeout
+	if requestDef.Timeout > 0 && (timeout == 0 || requestDef.Timeout < timeout) {
+		timeout = requestDef.Timeout
 	}
-
-	out <- reply
-
+	return time.Duration(timeout) * time.Second
 }
 
-// doSyncRequest will make the same request but return a BatchReplyUnit
-func (b BatchRequestHandler) doSyncRequest(req *http.Request, relURL string) BatchReplyUnit {
-	client := &http.Client{}
-	resp, doReqErr := client.Do(req)
+// doRequest makes a request and encodes the reply, failures are reported in the reply's error
+func (b BatchRequestHandler) doRequest(req *http.Request, relURL string, timeout time.Duration) BatchReplyUnit {
+	reply := BatchReplyUnit{RelativeURL: relURL}
 
+	client := &http.Client{Timeout: timeout}
+	resp, doReqErr := client.Do(req)
 	if doReqErr != nil {
-		log.Error("Webhook request failed: ", doReqErr)
-		return BatchReplyUnit{}
+		log.Error("Batch request failed: ", doReqErr)
+		reply.Error = doReqErr.Error()
+		return reply
 	}
 
 	defer resp.Body.Close()
 	content, readErr := ioutil.ReadAll(resp.Body)
 	if readErr != nil {
 		log.Warning("Body read failure! ", readErr)
-		return BatchReplyUnit{}
+		reply.Error = readErr.Error()
+		return reply
 	}
 
-	reply := BatchReplyUnit{
-		RelativeURL: relURL,
-		Code:        resp.StatusCode,
-		Headers:     resp.Header,
-		Body:        string(content),
-	}
+	reply.Code = resp.StatusCode
+	reply.Headers = resp.Header
+	reply.Body = string(content)
 
 	return reply
 }
 
+// doAsyncRequest runs an async request and replies to a channel
+func (b BatchRequestHandler) doAsyncRequest(req *http.Request, relURL string, out chan BatchReplyUnit) {
+	out <- b.doRequest(req, relURL, 0)
+}
+
+// doSyncRequest will make the same request but return a BatchReplyUnit
+func (b BatchRequestHandler) doSyncRequest(req *http.Request, relURL string) BatchReplyUnit {
+	return b.doRequest(req, relURL, 0)
+}
+
 func (b BatchRequestHandler) DecodeBatchRequest(r *http.Request) (BatchRequestStructure, error) {
 	decoder := json.NewDecoder(r.Body)
 	var batchRequest BatchRequestStructure
@@ -100,62 +123,382 @@ func (b BatchRequestHandler) DecodeBatchRequest(r *http.Request) (BatchRequestSt
 	return batchRequest, decodeErr
 }
 
-func (b BatchRequestHandler) ConstructRequests(batchRequest BatchRequestStructure, unsafe bool) ([]*http.Request, error) {
-	requestSet := []*http.Request{}
+// ValidateBatch checks the batch against the API limits and makes sure that every dependency
+// exists and that they can all be resolved
+func (b BatchRequestHandler) ValidateBatch(batchRequest BatchRequestStructure, unsafe bool) error {
+	maxRequests := b.options().MaxRequests
+	if maxRequests > 0 && len(batchRequest.Requests) > maxRequests {
+		return fmt.Errorf("Batch request too large, at most %d requests are allowed", maxRequests)
+	}
+
+	dependencies := make(map[string][]string)
+	for _, requestDef := range batchRequest.Requests {
+		if requestDef.Name == "" {
+			continue
+		}
+		if _, found := dependencies[requestDef.Name]; found {
+			return fmt.Errorf("Batch request name %q is used more than once", requestDef.Name)
+		}
+		dependencies[requestDef.Name] = requestDef.DependsOn
+	}
 
 	for i, requestDef := range batchRequest.Requests {
-		// We re-build the URL to ensure that the requested URL is actually for the API in question
-		// URLs need to be built absolute so they go through the rate limiting and request limiting machinery
-		var absURL string
-		if !unsafe {
-			absUrlHeader := strings.Join([]string{"http://localhost", strconv.Itoa(config.ListenPort)}, ":")
-			absURL = strings.Join([]string{absUrlHeader, strings.Trim(b.API.Proxy.ListenPath, "/"), requestDef.RelativeURL}, "/")
-		} else {
-			absURL = requestDef.RelativeURL
+		for _, name := range requestDef.DependsOn {
+			if _, found := dependencies[name]; !found {
+				return fmt.Errorf("Batch request %d depends on unknown request %q", i, name)
+			}
+		}
+
+		// Requests with dependencies can only be built once their templates have been filled in
+		if len(requestDef.DependsOn) == 0 {
+			if _, createReqErr := b.constructRequest(requestDef, unsafe); createReqErr != nil {
+				log.Error("Failure generating batch request for request spec index: ", i)
+				return createReqErr
+			}
+		}
+	}
+
+	visited := make(map[string]int)
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch visited[name] {
+		case batchRunning:
+			return fmt.Errorf("Batch request %q has circular dependencies", name)
+		case batchDone:
+			return nil
+		}
+		visited[name] = batchRunning
+		for _, dependency := range dependencies[name] {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		visited[name] = batchDone
+		return nil
+	}
+	for name := range dependencies {
+		if err := visit(name); err != nil {
+			return err
 		}
+	}
+
+	return nil
+}
 
-		thisRequest, createReqErr := http.NewRequest(requestDef.Method, absURL, bytes.NewBuffer([]byte(requestDef.Body)))
+func (b BatchRequestHandler) constructRequest(requestDef RequestDefinition, unsafe bool) (*http.Request, error) {
+	// We re-build the URL to ensure that the requested URL is actually for the API in question
+	// Requests are routed internally so they still go through the rate limiting and request limiting machinery
+	var absURL string
+	if !unsafe {
+		absURL = InternalAPIScheme + "://" + b.API.APIID + "/" + strings.TrimPrefix(requestDef.RelativeURL, "/")
+	} else {
+		absURL = requestDef.RelativeURL
+	}
+
+	thisRequest, createReqErr := http.NewRequest(requestDef.Method, absURL, bytes.NewBuffer([]byte(requestDef.Body)))
+	if createReqErr != nil {
+		return nil, createReqErr
+	}
+
+	// Add headers
+	for k, v := range requestDef.Headers {
+		thisRequest.Header.Add(k, v)
+	}
+
+	return thisRequest, nil
+}
+
+func (b BatchRequestHandler) ConstructRequests(batchRequest BatchRequestStructure, unsafe bool) ([]*http.Request, error) {
+	requestSet := []*http.Request{}
+
+	for i, requestDef := range batchRequest.Requests {
+		thisRequest, createReqErr := b.constructRequest(requestDef, unsafe)
 		if createReqErr != nil {
 			log.Error("Failure generating batch request for request spec index: ", i)
 			return nil, createReqErr
 		}
 
-		// Add headers
-		for k, v := range requestDef.Headers {
-			thisRequest.Header.Add(k, v)
-		}
-
 		requestSet = append(requestSet, thisRequest)
 	}
 
 	return requestSet, nil
 }
 
-func (b BatchRequestHandler) MakeRequests(batchRequest BatchRequestStructure, requestSet []*http.Request) []BatchReplyUnit {
-	ReplySet := []BatchReplyUnit{}
+// copyCallerCredentials gives a sub-request the caller's key unless it sets its own, so that every
+// request in the batch is counted against the caller's rate limit and quota
+func (b BatchRequestHandler) copyCallerCredentials(caller, req *http.Request) {
+	if b.API == nil || caller == nil {
+		return
+	}
 
-	if len(batchRequest.Requests) != len(requestSet) {
-		log.Error("Something went wrong creating requests, they are of mismatched lengths!", len(batchRequest.Requests), len(requestSet))
+	authHeaderName := b.API.Auth.AuthHeaderName
+	if authHeaderName == "" {
+		authHeaderName = "Authorization"
+	}
+	if key := caller.Header.Get(authHeaderName); key != "" && req.Header.Get(authHeaderName) == "" {
+		req.Header.Set(authHeaderName, key)
 	}
 
-	if !batchRequest.SuppressParallelExecution {
-		replies := make(chan BatchReplyUnit)
-		for index, req := range requestSet {
-			go b.doAsyncRequest(req, batchRequest.Requests[index].RelativeURL, replies)
+	if b.API.Auth.UseParam {
+		paramName := b.API.Auth.ParamName
+		if paramName == "" {
+			paramName = authHeaderName
+		}
+		query := req.URL.Query()
+		if key := caller.URL.Query().Get(paramName); key != "" && query.Get(paramName) == "" {
+			query.Set(paramName, key)
+			req.URL.RawQuery = query.Encode()
 		}
+	}
 
-		for i := 0; i < len(batchRequest.Requests); i++ {
-			val := BatchReplyUnit{}
-			val = <-replies
+	if b.API.Auth.UseCookie && req.Header.Get("Cookie") == "" {
+		if cookie := caller.Header.Get("Cookie"); cookie != "" {
+			req.Header.Set("Cookie", cookie)
+		}
+	}
+}
 
-			ReplySet = append(ReplySet, val)
+// batchTemplateData exposes a reply to the templates of the requests that depend on it, JSON bodies
+// are decoded so that fields can be referenced, anything else is left as a string
+func batchTemplateData(reply BatchReplyUnit) map[string]interface{} {
+	headers := make(map[string]string)
+	for k, v := range reply.Headers {
+		if len(v) > 0 {
+			headers[k] = v[0]
 		}
-	} else {
-		for index, req := range requestSet {
-			reply := b.doSyncRequest(req, batchRequest.Requests[index].RelativeURL)
-			ReplySet = append(ReplySet, reply)
+	}
+
+	var body interface{} = reply.Body
+	var decoded interface{}
+	decoder := json.NewDecoder(strings.NewReader(reply.Body))
+	decoder.UseNumber()
+	if decoder.Decode(&decoded) == nil {
+		body = decoded
+	}
+
+	return map[string]interface{}{
+		"code":    reply.Code,
+		"headers": headers,
+		"body":    body,
+	}
+}
+
+// batchURLFuncs escape the values rendered into a relative URL. Every value is escaped for where it
+// sits, pathescape before the query and urlquery after it, unless the template already pipes it
+// through one of these or through raw to insert it as it is
+var batchURLFuncs = template.FuncMap{
+	"pathescape": batchPathEscape,
+	"raw":        fmt.Sprint,
+}
+
+func batchPathEscape(value interface{}) string {
+	escaped := url.PathEscape(fmt.Sprint(value))
+	// A value can't climb out of its segment either
+	if escaped == "." || escaped == ".." {
+		escaped = strings.Replace(escaped, ".", "%2E", -1)
+	}
+
+	return escaped
+}
+
+// escapeURLActions adds the escaper to each value in a URL template, as html/template does for
+// HTML. It reports whether the query string has started by the end of the list.
+func escapeURLActions(list *parse.ListNode, inQuery bool) bool {
+	if list == nil {
+		return inQuery
+	}
+
+	for _, node := range list.Nodes {
+		switch typed := node.(type) {
+		case *parse.TextNode:
+			inQuery = inQuery || bytes.Contains(typed.Text, []byte("?"))
+		case *parse.ActionNode:
+			// Declarations don't print anything
+			if len(typed.Pipe.Decl) > 0 || batchURLEscaped(typed.Pipe) {
+				continue
+			}
+			escaper := "pathescape"
+			if inQuery {
+				escaper = "urlquery"
+			}
+			typed.Pipe.Cmds = append(typed.Pipe.Cmds, &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Args:     []parse.Node{parse.NewIdentifier(escaper).SetTree(nil).SetPos(typed.Pos)},
+			})
+		case *parse.IfNode:
+			inQuery = escapeURLActions(typed.List, inQuery) || escapeURLActions(typed.ElseList, inQuery)
+		case *parse.RangeNode:
+			inQuery = escapeURLActions(typed.List, inQuery) || escapeURLActions(typed.ElseList, inQuery)
+		case *parse.WithNode:
+			inQuery = escapeURLActions(typed.List, inQuery) || escapeURLActions(typed.ElseList, inQuery)
+		}
+	}
+
+	return inQuery
+}
+
+func batchURLEscaped(pipe *parse.PipeNode) bool {
+	if len(pipe.Cmds) == 0 {
+		return false
+	}
+
+	last := pipe.Cmds[len(pipe.Cmds)-1]
+	if ident, ok := last.Args[0].(*parse.IdentifierNode); ok {
+		switch ident.Ident {
+		case "pathescape", "urlquery", "raw":
+			return true
+		}
+	}
+
+	return false
+}
+
+func renderBatchTemplate(text string, data map[string]interface{}, isURL bool) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New("").Option("missingkey=error").Funcs(batchURLFuncs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	if isURL {
+		escapeURLActions(tmpl.Tree.Root, false)
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", err
+	}
+
+	return rendered.String(), nil
+}
+
+// renderRequest fills in the references a request makes to the replies it depends on
+func renderRequest(requestDef RequestDefinition, data map[string]interface{}) (RequestDefinition, error) {
+	var err error
+	if requestDef.RelativeURL, err = renderBatchTemplate(requestDef.RelativeURL, data, true); err != nil {
+		return requestDef, err
+	}
+	if requestDef.Body, err = renderBatchTemplate(requestDef.Body, data, false); err != nil {
+		return requestDef, err
+	}
+
+	headers := make(map[string]string, len(requestDef.Headers))
+	for k, v := range requestDef.Headers {
+		if headers[k], err = renderBatchTemplate(v, data, false); err != nil {
+			return requestDef, err
 		}
 	}
+	requestDef.Headers = headers
+
+	return requestDef, nil
+}
+
+// MakeRequests runs a validated batch, a request starts once the requests it depends on have
+// finished and a free slot is available. Replies are returned in the order the requests were given.
+func (b BatchRequestHandler) MakeRequests(batchRequest BatchRequestStructure, unsafe bool, caller *http.Request) []BatchReplyUnit {
+	requests := batchRequest.Requests
+	ReplySet := make([]BatchReplyUnit, len(requests))
+	state := make([]int, len(requests))
+	finished := make(map[string]BatchReplyUnit)
+	failed := make(map[string]bool)
+
+	concurrency := b.options().MaxConcurrency
+	if batchRequest.SuppressParallelExecution {
+		concurrency = 1
+	}
+
+	results := make(chan batchResult)
+	running, remaining := 0, len(requests)
+	stopped := false
+
+	complete := func(index int, reply BatchReplyUnit) {
+		requestDef := requests[index]
+		reply.Name = requestDef.Name
+		ReplySet[index] = reply
+		state[index] = batchDone
+		remaining--
+
+		replyFailed := reply.Error != "" || reply.Code >= 400
+		if requestDef.Name != "" {
+			finished[requestDef.Name] = reply
+			failed[requestDef.Name] = replyFailed
+		}
+		if replyFailed && batchRequest.FailFast {
+			stopped = true
+		}
+	}
+
+	for remaining > 0 {
+		// Skipping a request can unblock ones that were already looked at, so keep going until
+		// nothing changes
+		for progress := true; progress; {
+			progress = false
+			for index, requestDef := range requests {
+				if state[index] != batchPending {
+					continue
+				}
+
+				if stopped {
+					complete(index, BatchReplyUnit{RelativeURL: requestDef.RelativeURL, Error: "skipped, an earlier request failed"})
+					progress = true
+					continue
+				}
+
+				ready := true
+				data := make(map[string]interface{})
+				skipReason := ""
+				for _, name := range requestDef.DependsOn {
+					reply, done := finished[name]
+					if !done {
+						ready = false
+						break
+					}
+					if failed[name] {
+						skipReason = fmt.Sprintf("skipped, dependency %q failed", name)
+						break
+					}
+					data[name] = batchTemplateData(reply)
+				}
+				if skipReason != "" {
+					complete(index, BatchReplyUnit{RelativeURL: requestDef.RelativeURL, Error: skipReason})
+					progress = true
+					continue
+				}
+				if !ready || (concurrency > 0 && running >= concurrency) {
+					continue
+				}
+
+				rendered, renderErr := renderRequest(requestDef, data)
+				var req *http.Request
+				if renderErr == nil {
+					req, renderErr = b.constructRequest(rendered, unsafe)
+				}
+				if renderErr != nil {
+					log.Error("Failure generating batch request for request spec index: ", index)
+					complete(index, BatchReplyUnit{RelativeURL: rendered.RelativeURL, Error: renderErr.Error()})
+					progress = true
+					continue
+				}
+				b.copyCallerCredentials(caller, req)
+
+				state[index] = batchRunning
+				running++
+				go func(index int, req *http.Request, relURL string, timeout time.Duration) {
+					results <- batchResult{index, b.doRequest(req, relURL, timeout)}
+				}(index, req, rendered.RelativeURL, b.timeout(requestDef))
+			}
+		}
+
+		if running == 0 {
+			break
+		}
+
+		result := <-results
+		running--
+		complete(result.index, result.reply)
+	}
 
 	return ReplySet
 }
@@ -173,15 +516,15 @@ func (b BatchRequestHandler) HandleBatchRequest(w http.ResponseWriter, r *http.R
 			return
 		}
 
-		// Construct the requests
-		requestSet, createReqErr := b.ConstructRequests(batchRequest, false)
-		if createReqErr != nil {
-			ReturnError(fmt.Sprintf("Batch request creation failed , request structure malformed"), w)
+		// Check the requests
+		if validateErr := b.ValidateBatch(batchRequest, false); validateErr != nil {
+			log.Error("Batch request rejected: ", validateErr)
+			ReturnError(fmt.Sprintf("Batch request creation failed , request structure malformed: %v", validateErr), w)
 			return
 		}
 
 		// Run requests and collate responses
-		ReplySet := b.MakeRequests(batchRequest, requestSet)
+		ReplySet := b.MakeRequests(batchRequest, false, r)
 
 		// Encode responses
 		replyMessage, encErr := json.Marshal(&ReplySet)
@@ -208,15 +551,14 @@ func (b BatchRequestHandler) ManualBatchRequest(RequestObject []byte) []byte {
 		return []byte{}
 	}
 
-	// Construct the unsafe requests
-	requestSet, createReqErr := b.ConstructRequests(batchRequest, true)
-	if createReqErr != nil {
-		log.Error("Batch request creation failed , request structure malformed: ", createReqErr)
+	// Check the unsafe requests
+	if validateErr := b.ValidateBatch(batchRequest, true); validateErr != nil {
+		log.Error("Batch request creation failed , request structure malformed: ", validateErr)
 		return []byte{}
 	}
 
 	// Run requests and collate responses
-	ReplySet := b.MakeRequests(batchRequest, requestSet)
+	ReplySet := b.MakeRequests(batchRequest, true, nil)
 
 	// Encode responses
 	replyMessage, encErr := json.Marshal(&ReplySet)
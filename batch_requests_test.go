@@ -3,9 +3,12 @@ package main
 import (
 	"fmt"
 	"github.com/justinas/alice"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -153,11 +156,11 @@ func TestBatchSuccess(t *testing.T) {
 		t.Error("Request set length should be 3, is: ", len(requestSet))
 	}
 
-	if requestSet[0].URL.Host != "localhost:8080" {
+	if requestSet[0].URL.Scheme != InternalAPIScheme || requestSet[0].URL.Host != "987999" {
 		t.Error("Request Host is wrong, is: ", requestSet[0].URL.Host)
 	}
 
-	if requestSet[0].URL.Path != "/v1/get/" {
+	if requestSet[0].URL.Path != "/get/" {
 		t.Error("Request Path is wrong, is: ", requestSet[0].URL.Path)
 	}
 
@@ -221,3 +224,146 @@ func TestMakeASyncRequest(t *testing.T) {
 	}
 
 }
+
+func TestBatchDependencies(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/user":
+			w.Header().Set("X-Region", "eu")
+			fmt.Fprint(w, `{"id": 12345678, "name": "test"}`)
+		case "/orders/12345678":
+			body, _ := ioutil.ReadAll(r.Body)
+			fmt.Fprintf(w, "%s %s %s", r.Header.Get("X-Region"), body, r.Header.Get("Authorization"))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer upstream.Close()
+
+	batchHandler := BatchRequestHandler{}
+	batchRequest := BatchRequestStructure{
+		Requests: []RequestDefinition{
+			{
+				Name:        "orders",
+				Method:      "POST",
+				RelativeURL: upstream.URL + "/orders/{{ .user.body.id }}",
+				Headers:     map[string]string{"X-Region": `{{ index .user.headers "X-Region" }}`},
+				Body:        "{{ .user.body.name }}",
+				DependsOn:   []string{"user"},
+			},
+			{Name: "user", Method: "GET", RelativeURL: upstream.URL + "/user"},
+		},
+		SuppressParallelExecution: true,
+	}
+
+	if err := batchHandler.ValidateBatch(batchRequest, true); err != nil {
+		t.Fatal("Batch should be valid, got: ", err)
+	}
+	replies := batchHandler.MakeRequests(batchRequest, true, nil)
+	if replies[0].Name != "orders" || replies[0].Code != 200 || replies[0].Body != "eu test " {
+		t.Error("Replies should be referenced by dependent requests, got: ", replies[0])
+	}
+
+	// Sub-requests carry the caller's key so they are counted against it
+	batchHandler.API = createDefinitionFromString(BatchTestDef)
+	caller, _ := http.NewRequest("POST", "/v1/tyk/batch/", nil)
+	caller.Header.Set("Authorization", "caller-key")
+	replies = batchHandler.MakeRequests(batchRequest, true, caller)
+	if replies[0].Body != "eu test caller-key" {
+		t.Error("The caller's credentials should be forwarded, got: ", replies[0].Body)
+	}
+
+	batchRequest.Requests[1].RelativeURL = upstream.URL + "/missing"
+	replies = batchHandler.MakeRequests(batchRequest, true, nil)
+	if replies[1].Code != 404 || replies[0].Code != 0 || replies[0].Error == "" {
+		t.Error("Requests should be skipped when a dependency fails, got: ", replies)
+	}
+
+	batchRequest.Requests[1].DependsOn = []string{"orders"}
+	if err := batchHandler.ValidateBatch(batchRequest, true); err == nil {
+		t.Error("Circular dependencies should be rejected")
+	}
+}
+
+func TestBatchURLEscaping(t *testing.T) {
+	data := map[string]interface{}{
+		"user": map[string]interface{}{
+			"body": map[string]interface{}{"id": "../admin?x=", "parent": ".."},
+		},
+	}
+
+	cases := []struct{ in, expected string }{
+		{"/orders/{{ .user.body.id }}", "/orders/..%2Fadmin%3Fx="},
+		{"/orders/{{ .user.body.parent }}/items", "/orders/%2E%2E/items"},
+		{"/orders?owner={{ .user.body.id }}", "/orders?owner=..%2Fadmin%3Fx%3D"},
+		{"/orders/{{ if .user.body.id }}{{ .user.body.id }}{{ end }}", "/orders/..%2Fadmin%3Fx="},
+		{"/orders/{{ .user.body.id | raw }}", "/orders/../admin?x="},
+	}
+	for _, c := range cases {
+		rendered, err := renderRequest(RequestDefinition{RelativeURL: c.in, Body: "{{ .user.body.id }}"}, data)
+		if err != nil {
+			t.Fatal("Template should render: ", err)
+		}
+		if rendered.RelativeURL != c.expected {
+			t.Errorf("Values in %s should be escaped for where they sit, got %s", c.in, rendered.RelativeURL)
+		}
+		if rendered.Body != "../admin?x=" {
+			t.Error("Bodies should be rendered as they are, got: ", rendered.Body)
+		}
+	}
+}
+
+func TestBatchLimits(t *testing.T) {
+	var inFlight, maxInFlight int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			seen := atomic.LoadInt32(&maxInFlight)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+				break
+			}
+		}
+		if r.URL.Path == "/slow" {
+			time.Sleep(2 * time.Second)
+		}
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(500)
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer upstream.Close()
+
+	spec := createDefinitionFromString(BatchTestDef)
+	spec.BatchRequestOptions.MaxRequests = 4
+	spec.BatchRequestOptions.MaxConcurrency = 2
+	batchHandler := BatchRequestHandler{API: spec}
+
+	batchRequest := BatchRequestStructure{}
+	for i := 0; i < 5; i++ {
+		batchRequest.Requests = append(batchRequest.Requests, RequestDefinition{Method: "GET", RelativeURL: upstream.URL + "/"})
+	}
+	if err := batchHandler.ValidateBatch(batchRequest, true); err == nil {
+		t.Error("Batches over the size limit should be rejected")
+	}
+
+	batchRequest.Requests = batchRequest.Requests[:4]
+	batchRequest.Requests[3].RelativeURL = upstream.URL + "/slow"
+	batchRequest.Requests[3].Timeout = 1
+	replies := batchHandler.MakeRequests(batchRequest, true, nil)
+	if maxInFlight != 2 {
+		t.Error("At most two requests should run at once, got: ", maxInFlight)
+	}
+	if replies[0].Code != 200 || replies[3].Code != 0 || replies[3].Error == "" {
+		t.Error("Requests should time out on their own, got: ", replies)
+	}
+
+	batchRequest.FailFast = true
+	batchRequest.SuppressParallelExecution = true
+	batchRequest.Requests[1].RelativeURL = upstream.URL + "/fail"
+	replies = batchHandler.MakeRequests(batchRequest, true, nil)
+	if replies[1].Code != 500 || replies[2].Code != 0 || replies[2].Error == "" || replies[3].Error == "" {
+		t.Error("Remaining requests should be skipped after a failure, got: ", replies)
+	}
+}
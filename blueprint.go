@@ -3,7 +3,7 @@ package main
 import (
 	"encoding/json"
 	"errors"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 	"strconv"
 )
 
@@ -15,8 +15,8 @@ const (
 
 type APIImporter interface {
 	ReadString(string) error
-	ConvertIntoApiVersion(bool) (tykcommon.VersionInfo, error)
-	InsertIntoAPIDefinitionAsVersion(tykcommon.VersionInfo, *tykcommon.APIDefinition, string) error
+	ConvertIntoApiVersion(bool) (apidef.VersionInfo, error)
+	InsertIntoAPIDefinitionAsVersion(apidef.VersionInfo, *apidef.APIDefinition, string) error
 }
 
 func GetImporterForSource(source APIImporterSource) (APIImporter, error) {
@@ -28,6 +28,9 @@ func GetImporterForSource(source APIImporterSource) (APIImporter, error) {
 	case SwaggerSource:
 		thisSwaggerSource := &SwaggerAST{}
 		return thisSwaggerSource, nil
+	case OpenAPISource:
+		thisOpenAPISource := &OpenAPIAST{}
+		return thisOpenAPISource, nil
 	default:
 		return nil, errors.New("Source not matched, failing.")
 	}
@@ -123,8 +126,8 @@ func (b *BluePrintAST) ReadString(asJson string) error {
 	return nil
 }
 
-func (b *BluePrintAST) ConvertIntoApiVersion(asMock bool) (tykcommon.VersionInfo, error) {
-	thisVersionInfo := tykcommon.VersionInfo{}
+func (b *BluePrintAST) ConvertIntoApiVersion(asMock bool) (apidef.VersionInfo, error) {
+	thisVersionInfo := apidef.VersionInfo{}
 	thisVersionInfo.UseExtendedPaths = true
 	thisVersionInfo.Name = b.Name
 
@@ -138,14 +141,14 @@ func (b *BluePrintAST) ConvertIntoApiVersion(asMock bool) (tykcommon.VersionInfo
 		}
 
 		for _, resource := range resourceGroup.Resources {
-			newMetaData := tykcommon.EndPointMeta{}
+			newMetaData := apidef.EndPointMeta{}
 			newMetaData.Path = resource.UriTemplate
-			newMetaData.MethodActions = make(map[string]tykcommon.EndpointMethodMeta)
+			newMetaData.MethodActions = make(map[string]apidef.EndpointMethodMeta)
 
 			for _, action := range resource.Actions {
 				if len(action.Examples) > 0 {
 					if len(action.Examples[0].Responses) > 0 {
-						thisEndPointMethodMeta := tykcommon.EndpointMethodMeta{}
+						thisEndPointMethodMeta := apidef.EndpointMethodMeta{}
 						code, err := strconv.Atoi(action.Examples[0].Responses[0].Name)
 						if err != nil {
 							log.Warning("Could not genrate response code form Name field, using 200")
@@ -154,9 +157,9 @@ func (b *BluePrintAST) ConvertIntoApiVersion(asMock bool) (tykcommon.VersionInfo
 						thisEndPointMethodMeta.Code = code
 
 						if asMock {
-							thisEndPointMethodMeta.Action = tykcommon.Reply
+							thisEndPointMethodMeta.Action = apidef.Reply
 						} else {
-							thisEndPointMethodMeta.Action = tykcommon.NoAction
+							thisEndPointMethodMeta.Action = apidef.NoAction
 						}
 
 						for _, h := range action.Examples[0].Responses[0].Headers {
@@ -170,7 +173,7 @@ func (b *BluePrintAST) ConvertIntoApiVersion(asMock bool) (tykcommon.VersionInfo
 			}
 
 			// Add it to the version
-			thisVersionInfo.ExtendedPaths.WhiteList = make([]tykcommon.EndPointMeta, 0)
+			thisVersionInfo.ExtendedPaths.WhiteList = make([]apidef.EndPointMeta, 0)
 			thisVersionInfo.ExtendedPaths.WhiteList = append(thisVersionInfo.ExtendedPaths.WhiteList, newMetaData)
 		}
 
@@ -179,7 +182,7 @@ func (b *BluePrintAST) ConvertIntoApiVersion(asMock bool) (tykcommon.VersionInfo
 	return thisVersionInfo, nil
 }
 
-func (b *BluePrintAST) InsertIntoAPIDefinitionAsVersion(thisVersion tykcommon.VersionInfo, thisDefinition *tykcommon.APIDefinition, versionName string) error {
+func (b *BluePrintAST) InsertIntoAPIDefinitionAsVersion(thisVersion apidef.VersionInfo, thisDefinition *apidef.APIDefinition, versionName string) error {
 
 	thisDefinition.VersionData.NotVersioned = false
 	thisDefinition.VersionData.Versions[versionName] = thisVersion
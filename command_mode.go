@@ -4,7 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/lonelycode/go-uuid/uuid"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 	"io/ioutil"
 	"strings"
 )
@@ -12,6 +12,7 @@ import (
 var CommandModeOptions = map[string]bool{
 	"--import-blueprint": true,
 	"--import-swagger":   true,
+	"--import-openapi":   true,
 	"--create-api":       true,
 	"--org-id":           true,
 	"--upstream-target":  true,
@@ -31,6 +32,10 @@ func HandleCommandModeArgs(arguments map[string]interface{}) {
 		handleSwaggerMode(arguments)
 	}
 
+	if arguments["--import-openapi"] != nil {
+		handleOpenAPIMode(arguments)
+	}
+
 }
 
 func handleBluePrintMode(arguments map[string]interface{}) {
@@ -101,7 +106,7 @@ func handleBluePrintMode(arguments map[string]interface{}) {
 	}
 }
 
-func printDef(def *tykcommon.APIDefinition) {
+func printDef(def *apidef.APIDefinition) {
 	asJson, err := json.MarshalIndent(def, "", "    ")
 	if err != nil {
 		log.Error("Marshalling failed: ", err)
@@ -112,8 +117,8 @@ func printDef(def *tykcommon.APIDefinition) {
 	fmt.Printf(fixed)
 }
 
-func createDefFromBluePrint(bp *BluePrintAST, orgId, upstreamURL string, as_mock bool) (*tykcommon.APIDefinition, error) {
-	thisAD := tykcommon.APIDefinition{}
+func createDefFromBluePrint(bp *BluePrintAST, orgId, upstreamURL string, as_mock bool) (*apidef.APIDefinition, error) {
+	thisAD := apidef.APIDefinition{}
 	thisAD.Name = bp.Name
 	thisAD.Active = true
 	thisAD.UseKeylessAccess = true
@@ -121,7 +126,7 @@ func createDefFromBluePrint(bp *BluePrintAST, orgId, upstreamURL string, as_mock
 	thisAD.OrgID = orgId
 	thisAD.VersionDefinition.Key = "version"
 	thisAD.VersionDefinition.Location = "header"
-	thisAD.VersionData.Versions = make(map[string]tykcommon.VersionInfo)
+	thisAD.VersionData.Versions = make(map[string]apidef.VersionInfo)
 	thisAD.VersionData.NotVersioned = false
 	thisAD.Proxy.ListenPath = "/" + thisAD.APIID + "/"
 	thisAD.Proxy.StripListenPath = true
@@ -161,8 +166,8 @@ func bluePrintLoadFile(filePath string) (*BluePrintAST, error) {
 	return thisBlueprint.(*BluePrintAST), nil
 }
 
-func apiDefLoadFile(filePath string) (*tykcommon.APIDefinition, error) {
-	thisDef := &tykcommon.APIDefinition{}
+func apiDefLoadFile(filePath string) (*apidef.APIDefinition, error) {
+	thisDef := &apidef.APIDefinition{}
 
 	defFileData, err := ioutil.ReadFile(filePath)
 
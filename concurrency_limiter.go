@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nu7hatch/gouuid"
+)
+
+const (
+	ConcurrencyKeyPrefix    string = "concurrency-"
+	ConcurrencyAPIKeyPrefix string = "api-"
+	ConcurrencyWSKeyPrefix  string = "websocket-"
+
+	defaultConcurrencyLeaseTimeout int64 = 120
+)
+
+// ConcurrencyLease represents a single in-flight request slot
+type ConcurrencyLease struct {
+	Key   string
+	ID    string
+	Limit int64
+}
+
+// ConcurrencyLimiter tracks the number of in-flight requests for a key or API, either
+// per node or across the cluster using leases in Redis that expire on their own
+type ConcurrencyLimiter struct {
+	sync.Mutex
+	store    *RedisClusterStorageManager
+	inFlight map[string]int64
+}
+
+var concurrencyLimiter = &ConcurrencyLimiter{inFlight: make(map[string]int64)}
+
+func (c *ConcurrencyLimiter) leaseTimeout() int64 {
+	if config.ConcurrencyLimiter.LeaseTimeout > 0 {
+		return config.ConcurrencyLimiter.LeaseTimeout
+	}
+
+	return defaultConcurrencyLeaseTimeout
+}
+
+func (c *ConcurrencyLimiter) getStore() *RedisClusterStorageManager {
+	c.Lock()
+	defer c.Unlock()
+	if c.store == nil {
+		c.store = &RedisClusterStorageManager{KeyPrefix: ConcurrencyKeyPrefix}
+		c.store.Connect()
+	}
+
+	return c.store
+}
+
+// Acquire takes a slot for key, returning false if there are already limit requests in flight
+func (c *ConcurrencyLimiter) Acquire(key string, limit int64) (ConcurrencyLease, bool) {
+	u5, _ := uuid.NewV4()
+	lease := ConcurrencyLease{Key: key, ID: strings.Replace(u5.String(), "-", "", -1), Limit: limit}
+
+	if config.ConcurrencyLimiter.EnableDistributed {
+		return lease, c.getStore().AcquireLease(key, lease.ID, limit, c.leaseTimeout())
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if c.inFlight[key] >= limit {
+		return lease, false
+	}
+	c.inFlight[key]++
+
+	return lease, true
+}
+
+// Renew pushes back the expiry of a distributed lease, long lived holders such as WebSocket
+// connections call this to keep their slot
+func (c *ConcurrencyLimiter) Renew(lease ConcurrencyLease, limit int64) {
+	if config.ConcurrencyLimiter.EnableDistributed {
+		c.getStore().AcquireLease(lease.Key, lease.ID, limit, c.leaseTimeout())
+	}
+}
+
+// KeepAlive renews distributed leases every half lease timeout until the returned channel is closed,
+// so requests that run for longer than the lease timeout don't lose their slots
+func (c *ConcurrencyLimiter) KeepAlive(leases []ConcurrencyLease) chan struct{} {
+	done := make(chan struct{})
+	if !config.ConcurrencyLimiter.EnableDistributed || len(leases) == 0 {
+		return done
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(c.leaseTimeout()) * time.Second / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				for _, lease := range leases {
+					c.Renew(lease, lease.Limit)
+				}
+			}
+		}
+	}()
+
+	return done
+}
+
+// Release frees a slot taken with Acquire
+func (c *ConcurrencyLimiter) Release(lease ConcurrencyLease) {
+	if config.ConcurrencyLimiter.EnableDistributed {
+		c.getStore().ReleaseLease(lease.Key, lease.ID)
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.inFlight[lease.Key]--
+	if c.inFlight[lease.Key] <= 0 {
+		delete(c.inFlight, lease.Key)
+	}
+}
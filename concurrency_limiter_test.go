@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestConcurrencyLimiterLocal(t *testing.T) {
+	limiter := &ConcurrencyLimiter{inFlight: make(map[string]int64)}
+
+	first, ok := limiter.Acquire("test-key", 2)
+	if !ok {
+		t.Fatal("First request should have been allowed")
+	}
+
+	if _, ok := limiter.Acquire("test-key", 2); !ok {
+		t.Fatal("Second request should have been allowed")
+	}
+
+	if _, ok := limiter.Acquire("test-key", 2); ok {
+		t.Fatal("Third request should have been rejected")
+	}
+
+	if _, ok := limiter.Acquire("other-key", 2); !ok {
+		t.Fatal("Limits should be tracked per key")
+	}
+
+	limiter.Release(first)
+	if _, ok := limiter.Acquire("test-key", 2); !ok {
+		t.Fatal("Released slot should be available again")
+	}
+}
+
+func TestConcurrencyLimitCheckEnabled(t *testing.T) {
+	spec := createDefinitionFromString(nonExpiringDef)
+	mw := &ConcurrencyLimitCheck{&TykMiddleware{spec, nil}}
+	if !mw.IsEnabledForSpec() {
+		t.Error("The check should run for APIs with keys, which can carry a limit")
+	}
+
+	spec.UseKeylessAccess = true
+	if mw.IsEnabledForSpec() {
+		t.Error("The check shouldn't run for keyless APIs without a limit")
+	}
+
+	spec.MaxConcurrentRequests = 2
+	if !mw.IsEnabledForSpec() {
+		t.Error("The check should run when the API has a limit")
+	}
+}
+
+func TestConcurrencyLimiterKeepAlive(t *testing.T) {
+	limiter := &ConcurrencyLimiter{inFlight: make(map[string]int64)}
+	lease, _ := limiter.Acquire("test-key", 2)
+	if lease.Limit != 2 {
+		t.Error("Leases should remember their limit so they can be renewed, got: ", lease.Limit)
+	}
+
+	// Local slots don't expire, the channel only has to be closable
+	close(limiter.KeepAlive([]ConcurrencyLease{lease}))
+}
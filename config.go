@@ -3,14 +3,20 @@ package main
 import (
 	"strings"
 
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 )
 
+type PolicyMergeStrategyConfig struct {
+	Quota     string `json:"quota"`
+	RateLimit string `json:"rate_limit"`
+}
+
 type PoliciesConfig struct {
-	PolicySource           string `json:"policy_source"`
-	PolicyConnectionString string `json:"policy_connection_string"`
-	PolicyRecordName       string `json:"policy_record_name"`
-	AllowExplicitPolicyID  bool   `json:"allow_explicit_policy_id"`
+	PolicySource           string                    `json:"policy_source"`
+	PolicyConnectionString string                    `json:"policy_connection_string"`
+	PolicyRecordName       string                    `json:"policy_record_name"`
+	AllowExplicitPolicyID  bool                      `json:"allow_explicit_policy_id"`
+	MergeStrategy          PolicyMergeStrategyConfig `json:"merge_strategy"`
 }
 
 type DBAppConfOptionsConfig struct {
@@ -115,13 +121,14 @@ type HttpServerOptionsConfig struct {
 	MinVersion            uint16     `json:"min_version"`
 	FlushInterval         int        `json:"flush_interval"`
 	SkipURLCleaning       bool       `json:"skip_url_cleaning"`
+	EnableHTTP2           bool       `json:"enable_http2"`
 }
 
 type AuthOverrideConf struct {
 	ForceAuthProvider    bool                          `json:"force_auth_provider"`
-	AuthProvider         tykcommon.AuthProviderMeta    `json:"auth_provider"`
+	AuthProvider         apidef.AuthProviderMeta    `json:"auth_provider"`
 	ForceSessionProvider bool                          `json:"force_session_provider"`
-	SessionProvider      tykcommon.SessionProviderMeta `json:"session_provider"`
+	SessionProvider      apidef.SessionProviderMeta `json:"session_provider"`
 }
 
 type UptimeTestsConfigDetail struct {
@@ -140,6 +147,22 @@ type ServiceDiscoveryConf struct {
 	DefaultCacheTimeout int `json:"default_cache_timeout"`
 }
 
+type ConcurrencyLimiterConf struct {
+	EnableDistributed bool  `json:"enable_distributed"`
+	LeaseTimeout      int64 `json:"lease_timeout"`
+}
+
+type KeyLifecycleConf struct {
+	ExpiryGracePeriod int64 `json:"expiry_grace_period"`
+	RotationOverlap   int64 `json:"rotation_overlap"`
+}
+
+type RequestIDConf struct {
+	Enabled    bool   `json:"enabled"`
+	HeaderName string `json:"header_name"`
+	Generator  string `json:"generator"`
+}
+
 type CoProcessConfig struct {
 	EnableCoProcess     bool   `json:"enable_coprocess"`
 	CoProcessGRPCServer string `json:"coprocess_grpc_server"`
@@ -211,8 +234,8 @@ type Config struct {
 	EnableJSVM                        bool                                     `json:"enable_jsvm"`
 	CoProcessOptions                  CoProcessConfig                          `json:"coprocess_options"`
 	HideGeneratorHeader               bool                                     `json:"hide_generator_header"`
-	EventHandlers                     tykcommon.EventHandlerMetaConfig         `json:"event_handlers"`
-	EventTriggers                     map[tykcommon.TykEvent][]TykEventHandler `json:"event_trigers_defunct"`
+	EventHandlers                     apidef.EventHandlerMetaConfig         `json:"event_handlers"`
+	EventTriggers                     map[apidef.TykEvent][]TykEventHandler `json:"event_trigers_defunct"`
 	PIDFileLocation                   string                                   `json:"pid_file_location"`
 	AllowInsecureConfigs              bool                                     `json:"allow_insecure_configs"`
 	PublicKeyPath                     string                                   `json:"public_key_path"`
@@ -227,7 +250,12 @@ type Config struct {
 	MaxIdleConnsPerHost               int                                      `bson:"max_idle_connections_per_host" json:"max_idle_connections_per_host"`
 	ReloadWaitTime                    int                                      `bson:"reload_wait_time" json:"reload_wait_time"`
 	ProxySSLInsecureSkipVerify        bool                                     `json:"proxy_ssl_insecure_skip_verify"`
+	ConcurrencyLimiter                ConcurrencyLimiterConf                   `json:"concurrency_limiter"`
+	KeyLifecycle                      KeyLifecycleConf                         `json:"key_lifecycle"`
     ProxyDefaultTimeout               int                                      `json:"proxy_default_timeout"`
+	Secrets                           map[string]string                        `json:"secrets"`
+	RequestID                         RequestIDConf                            `json:"request_id"`
+	MaxDecodedResponseSize            int64                                    `json:"max_decoded_response_size"`
 }
 
 type CertData struct {
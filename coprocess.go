@@ -11,7 +11,7 @@ import (
 	"github.com/mitchellh/mapstructure"
 
 	"github.com/TykTechnologies/tyk/coprocess"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 
 	"bytes"
 	"errors"
@@ -30,7 +30,7 @@ type CoProcessMiddleware struct {
 	*TykMiddleware
 	HookType         coprocess.HookType
 	HookName         string
-	MiddlewareDriver tykcommon.MiddlewareDriver
+	MiddlewareDriver apidef.MiddlewareDriver
 }
 
 func (mw *CoProcessMiddleware) GetName() string {
@@ -38,7 +38,7 @@ func (mw *CoProcessMiddleware) GetName() string {
 }
 
 // CreateCoProcessMiddleware initializes a new CP middleware, takes hook type (pre, post, etc.), hook name ("my_hook") and driver ("python").
-func CreateCoProcessMiddleware(hookName string, hookType coprocess.HookType, mwDriver tykcommon.MiddlewareDriver, tykMwSuper *TykMiddleware) func(http.Handler) http.Handler {
+func CreateCoProcessMiddleware(hookName string, hookType coprocess.HookType, mwDriver apidef.MiddlewareDriver, tykMwSuper *TykMiddleware) func(http.Handler) http.Handler {
 	dMiddleware := &CoProcessMiddleware{
 		TykMiddleware:    tykMwSuper,
 		HookType:         hookType,
@@ -198,7 +198,7 @@ func (m *CoProcessMiddleware) IsEnabledForSpec() bool {
 	// This flag indicates if the current spec specifies any CP custom middleware.
 	var usesCoProcessMiddleware bool
 
-	var supportedDrivers = []tykcommon.MiddlewareDriver{tykcommon.PythonDriver, tykcommon.LuaDriver, tykcommon.GrpcDriver}
+	var supportedDrivers = []apidef.MiddlewareDriver{apidef.PythonDriver, apidef.LuaDriver, apidef.GrpcDriver}
 
 	for _, driver := range supportedDrivers {
 		if m.TykMiddleware.Spec.CustomMiddleware.Driver == driver && CoProcessName == string(driver) {
@@ -232,7 +232,8 @@ func (m *CoProcessMiddleware) IsEnabledForSpec() bool {
 // ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
 func (m *CoProcessMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, configuration interface{}) (error, int) {
 	log.WithFields(logrus.Fields{
-		"prefix": "coprocess",
+		"prefix":     "coprocess",
+		"request_id": requestID(r),
 	}).Debug("CoProcess Request, HookType: ", m.HookType)
 
 	if !EnableCoProcess {
@@ -286,9 +287,10 @@ func (m *CoProcessMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Requ
 	if returnObject.Request.ReturnOverrides.ResponseCode > 400 {
 
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
-			"key":    authHeaderValue,
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"key":        authHeaderValue,
+			"request_id": requestID(r),
 		}).Info("Attempted access with invalid key.")
 
 		// Fire Authfailed Event
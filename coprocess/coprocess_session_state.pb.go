@@ -162,6 +162,14 @@ type SessionState struct {
 	LastUpdated             string                       `protobuf:"bytes,26,opt,name=last_updated,json=lastUpdated" json:"last_updated,omitempty"`
 	IdExtractorDeadline     int64                        `protobuf:"varint,27,opt,name=id_extractor_deadline,json=idExtractorDeadline" json:"id_extractor_deadline,omitempty"`
 	SessionLifetime         int64                        `protobuf:"varint,28,opt,name=session_lifetime,json=sessionLifetime" json:"session_lifetime,omitempty"`
+	ActivatesAt             int64                        `protobuf:"varint,29,opt,name=activates_at,json=activatesAt" json:"activates_at,omitempty"`
+	ExpiryGracePeriod       int64                        `protobuf:"varint,30,opt,name=expiry_grace_period,json=expiryGracePeriod" json:"expiry_grace_period,omitempty"`
+	RotatedAt               int64                        `protobuf:"varint,31,opt,name=rotated_at,json=rotatedAt" json:"rotated_at,omitempty"`
+	QuotaRenewalPeriod      string                       `protobuf:"bytes,32,opt,name=quota_renewal_period,json=quotaRenewalPeriod" json:"quota_renewal_period,omitempty"`
+	QuotaTimezone           string                       `protobuf:"bytes,33,opt,name=quota_timezone,json=quotaTimezone" json:"quota_timezone,omitempty"`
+	QuotaLastReset          int64                        `protobuf:"varint,34,opt,name=quota_last_reset,json=quotaLastReset" json:"quota_last_reset,omitempty"`
+	MaxConcurrentRequests   int64                        `protobuf:"varint,35,opt,name=max_concurrent_requests,json=maxConcurrentRequests" json:"max_concurrent_requests,omitempty"`
+	ApplyPolicies           []string                     `protobuf:"bytes,36,rep,name=apply_policies,json=applyPolicies" json:"apply_policies,omitempty"`
 }
 
 func (m *SessionState) Reset()                    { *m = SessionState{} }
@@ -365,6 +373,62 @@ func (m *SessionState) GetSessionLifetime() int64 {
 	return 0
 }
 
+func (m *SessionState) GetActivatesAt() int64 {
+	if m != nil {
+		return m.ActivatesAt
+	}
+	return 0
+}
+
+func (m *SessionState) GetExpiryGracePeriod() int64 {
+	if m != nil {
+		return m.ExpiryGracePeriod
+	}
+	return 0
+}
+
+func (m *SessionState) GetRotatedAt() int64 {
+	if m != nil {
+		return m.RotatedAt
+	}
+	return 0
+}
+
+func (m *SessionState) GetQuotaRenewalPeriod() string {
+	if m != nil {
+		return m.QuotaRenewalPeriod
+	}
+	return ""
+}
+
+func (m *SessionState) GetQuotaTimezone() string {
+	if m != nil {
+		return m.QuotaTimezone
+	}
+	return ""
+}
+
+func (m *SessionState) GetQuotaLastReset() int64 {
+	if m != nil {
+		return m.QuotaLastReset
+	}
+	return 0
+}
+
+func (m *SessionState) GetMaxConcurrentRequests() int64 {
+	if m != nil {
+		return m.MaxConcurrentRequests
+	}
+	return 0
+}
+
+func (m *SessionState) GetApplyPolicies() []string {
+	if m != nil {
+		return m.ApplyPolicies
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*AccessSpec)(nil), "coprocess.AccessSpec")
 	proto.RegisterType((*AccessDefinition)(nil), "coprocess.AccessDefinition")
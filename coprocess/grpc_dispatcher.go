@@ -4,7 +4,7 @@
 package coprocess
 
 import(
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 )
 
 const(
@@ -28,7 +28,7 @@ type Dispatcher interface {
 	LoadModules()
 
 	// HandleMiddlewareCache is called when a bundle has been loaded and the dispatcher needs to cache its contents. Used by Lua.
-	HandleMiddlewareCache(*tykcommon.BundleManifest, string)
+	HandleMiddlewareCache(*apidef.BundleManifest, string)
 
 	// Reload is called when a hot reload is triggered. Used by all the CPs.
 	Reload()
@@ -15,7 +15,7 @@ import "C"
 import "unsafe"
 
 import(
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 )
 
 const(
@@ -39,7 +39,7 @@ type Dispatcher interface {
 	LoadModules()
 
 	// HandleMiddlewareCache is called when a bundle has been loaded and the dispatcher needs to cache its contents. Used by Lua.
-	HandleMiddlewareCache(*tykcommon.BundleManifest, string)
+	HandleMiddlewareCache(*apidef.BundleManifest, string)
 
 	// Reload is called when a hot reload is triggered. Used by all the CPs.
 	Reload()
@@ -6,19 +6,19 @@ import (
 	"github.com/TykTechnologies/logrus"
 
 	"github.com/TykTechnologies/tyk/coprocess"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 
 	"net/http"
 )
 
 const (
-	EH_CoProcessHandler tykcommon.TykEventHandlerName = "cp_dynamic_handler"
+	EH_CoProcessHandler apidef.TykEventHandlerName = "cp_dynamic_handler"
 )
 
 type Dispatcher interface {
 	DispatchEvent([]byte)
 	LoadModules()
-	HandleMiddlewareCache(*tykcommon.BundleManifest, string)
+	HandleMiddlewareCache(*apidef.BundleManifest, string)
 	Reload()
 }
 
@@ -30,7 +30,7 @@ type CoProcessMiddleware struct {
 	*TykMiddleware
 	HookType         coprocess.HookType
 	HookName         string
-	MiddlewareDriver tykcommon.MiddlewareDriver
+	MiddlewareDriver apidef.MiddlewareDriver
 }
 
 func (mw *CoProcessMiddleware) GetName() string {
@@ -70,3 +70,7 @@ func doCoprocessReload() {
 
 func newExtractor(referenceSpec *APISpec, mw *TykMiddleware) {
 }
+
+func newCoProcessWebSocketHook(spec *APISpec, name string) WebSocketMessageHook {
+	return nil
+}
@@ -18,7 +18,7 @@ func TykSessionState(sessionState *coprocess.SessionState) SessionState {
 			allowedURL := AccessSpec{protoAllowedURL.Url, protoAllowedURL.Methods}
 			allowedUrls = append(allowedUrls, allowedURL)
 		}
-		accessDefinition := AccessDefinition{protoAccessDefinition.ApiName, protoAccessDefinition.ApiId, protoAccessDefinition.Versions, allowedUrls}
+		accessDefinition := AccessDefinition{protoAccessDefinition.ApiName, protoAccessDefinition.ApiId, protoAccessDefinition.Versions, allowedUrls, nil}
 		accessDefinitions[key] = accessDefinition
 	}
 
@@ -47,35 +47,41 @@ func TykSessionState(sessionState *coprocess.SessionState) SessionState {
 	}
 
 	session = SessionState{
-		sessionState.LastCheck,
-		sessionState.Allowance,
-		sessionState.Rate,
-		sessionState.Per,
-		sessionState.Expires,
-		sessionState.QuotaMax,
-		sessionState.QuotaRenews,
-		sessionState.QuotaRemaining,
-		sessionState.QuotaRenewalRate,
-		accessDefinitions,
-		sessionState.OrgId,
-		sessionState.OauthClientId,
-		sessionState.OauthKeys,
-		basicAuthData,
-		jwtData,
-		sessionState.HmacEnabled,
-		sessionState.HmacSecret,
-		sessionState.IsInactive,
-		sessionState.ApplyPolicyId,
-		sessionState.DataExpires,
-		monitor,
-		sessionState.EnableDetailedRecording,
-		nil,
-		sessionState.Tags,
-		sessionState.Alias,
-		sessionState.LastUpdated,
-		sessionState.IdExtractorDeadline,
-		sessionState.SessionLifetime,
-		"",
+		LastCheck:               sessionState.LastCheck,
+		Allowance:               sessionState.Allowance,
+		Rate:                    sessionState.Rate,
+		Per:                     sessionState.Per,
+		Expires:                 sessionState.Expires,
+		ActivatesAt:             sessionState.ActivatesAt,
+		ExpiryGracePeriod:       sessionState.ExpiryGracePeriod,
+		RotatedAt:               sessionState.RotatedAt,
+		QuotaMax:                sessionState.QuotaMax,
+		QuotaRenews:             sessionState.QuotaRenews,
+		QuotaRemaining:          sessionState.QuotaRemaining,
+		QuotaRenewalRate:        sessionState.QuotaRenewalRate,
+		QuotaRenewalPeriod:      sessionState.QuotaRenewalPeriod,
+		QuotaTimezone:           sessionState.QuotaTimezone,
+		QuotaLastReset:          sessionState.QuotaLastReset,
+		MaxConcurrentRequests:   sessionState.MaxConcurrentRequests,
+		AccessRights:            accessDefinitions,
+		OrgID:                   sessionState.OrgId,
+		OauthClientID:           sessionState.OauthClientId,
+		OauthKeys:               sessionState.OauthKeys,
+		BasicAuthData:           basicAuthData,
+		JWTData:                 jwtData,
+		HMACEnabled:             sessionState.HmacEnabled,
+		HmacSecret:              sessionState.HmacSecret,
+		IsInactive:              sessionState.IsInactive,
+		ApplyPolicyID:           sessionState.ApplyPolicyId,
+		ApplyPolicies:           sessionState.ApplyPolicies,
+		DataExpires:             sessionState.DataExpires,
+		Monitor:                 monitor,
+		EnableDetailedRecording: sessionState.EnableDetailedRecording,
+		Tags:                    sessionState.Tags,
+		Alias:                   sessionState.Alias,
+		LastUpdated:             sessionState.LastUpdated,
+		IdExtractorDeadline:     sessionState.IdExtractorDeadline,
+		SessionLifetime:         sessionState.SessionLifetime,
 	}
 
 	return session
@@ -111,34 +117,41 @@ func ProtoSessionState(sessionState SessionState) *coprocess.SessionState {
 	monitor = &coprocess.Monitor{sessionState.Monitor.TriggerLimits}
 
 	session := &coprocess.SessionState{
-		sessionState.LastCheck,
-		sessionState.Allowance,
-		sessionState.Rate,
-		sessionState.Per,
-		sessionState.Expires,
-		sessionState.QuotaMax,
-		sessionState.QuotaRenews,
-		sessionState.QuotaRemaining,
-		sessionState.QuotaRenewalRate,
-		accessDefinitions,
-		sessionState.OrgID,
-		sessionState.OauthClientID,
-		sessionState.OauthKeys,
-		basicAuthData,
-		jwtData,
-		sessionState.HMACEnabled,
-		sessionState.HmacSecret,
-		sessionState.IsInactive,
-		sessionState.ApplyPolicyID,
-		sessionState.DataExpires,
-		monitor,
-		sessionState.EnableDetailedRecording,
-		"",
-		sessionState.Tags,
-		sessionState.Alias,
-		sessionState.LastUpdated,
-		sessionState.IdExtractorDeadline,
-		sessionState.SessionLifetime,
+		LastCheck:               sessionState.LastCheck,
+		Allowance:               sessionState.Allowance,
+		Rate:                    sessionState.Rate,
+		Per:                     sessionState.Per,
+		Expires:                 sessionState.Expires,
+		QuotaMax:                sessionState.QuotaMax,
+		QuotaRenews:             sessionState.QuotaRenews,
+		QuotaRemaining:          sessionState.QuotaRemaining,
+		QuotaRenewalRate:        sessionState.QuotaRenewalRate,
+		AccessRights:            accessDefinitions,
+		OrgId:                   sessionState.OrgID,
+		OauthClientId:           sessionState.OauthClientID,
+		OauthKeys:               sessionState.OauthKeys,
+		BasicAuthData:           basicAuthData,
+		JwtData:                 jwtData,
+		HmacEnabled:             sessionState.HMACEnabled,
+		HmacSecret:              sessionState.HmacSecret,
+		IsInactive:              sessionState.IsInactive,
+		ApplyPolicyId:           sessionState.ApplyPolicyID,
+		DataExpires:             sessionState.DataExpires,
+		Monitor:                 monitor,
+		EnableDetailedRecording: sessionState.EnableDetailedRecording,
+		Tags:                    sessionState.Tags,
+		Alias:                   sessionState.Alias,
+		LastUpdated:             sessionState.LastUpdated,
+		IdExtractorDeadline:     sessionState.IdExtractorDeadline,
+		SessionLifetime:         sessionState.SessionLifetime,
+		ActivatesAt:             sessionState.ActivatesAt,
+		ExpiryGracePeriod:       sessionState.ExpiryGracePeriod,
+		RotatedAt:               sessionState.RotatedAt,
+		QuotaRenewalPeriod:      sessionState.QuotaRenewalPeriod,
+		QuotaTimezone:           sessionState.QuotaTimezone,
+		QuotaLastReset:          sessionState.QuotaLastReset,
+		MaxConcurrentRequests:   sessionState.MaxConcurrentRequests,
+		ApplyPolicies:           sessionState.ApplyPolicies,
 	}
 
 	return session
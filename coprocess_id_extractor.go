@@ -4,7 +4,7 @@ package main
 
 import (
 	"github.com/TykTechnologies/logrus"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/gorilla/context"
 	"github.com/mitchellh/mapstructure"
 	"gopkg.in/xmlpath.v2"
@@ -29,7 +29,7 @@ type IdExtractor interface {
 
 // BaseExtractor is the base structure for an ID extractor, it implements the IdExtractor interface. Other extractors may override some of its methods.
 type BaseExtractor struct {
-	Config        *tykcommon.MiddlewareIdExtractor
+	Config        *apidef.MiddlewareIdExtractor
 	TykMiddleware *TykMiddleware
 	Spec          *APISpec
 }
@@ -134,9 +134,9 @@ func (e *ValueExtractor) ExtractAndCheck(r *http.Request) (SessionID string, ret
 	}
 
 	switch e.Config.ExtractFrom {
-	case tykcommon.HeaderSource:
+	case apidef.HeaderSource:
 		extractorOutput, err = e.ExtractHeader(r)
-	case tykcommon.FormSource:
+	case apidef.FormSource:
 		extractorOutput, err = e.ExtractForm(r, config.FormParamName)
 	}
 
@@ -206,11 +206,11 @@ func (e *RegexExtractor) ExtractAndCheck(r *http.Request) (SessionID string, ret
 	}
 
 	switch e.Config.ExtractFrom {
-	case tykcommon.HeaderSource:
+	case apidef.HeaderSource:
 		extractorOutput, err = e.ExtractHeader(r)
-	case tykcommon.BodySource:
+	case apidef.BodySource:
 		extractorOutput, err = e.ExtractBody(r)
-	case tykcommon.FormSource:
+	case apidef.FormSource:
 		extractorOutput, err = e.ExtractForm(r, config.FormParamName)
 	}
 
@@ -280,11 +280,11 @@ func (e *XPathExtractor) ExtractAndCheck(r *http.Request) (SessionID string, ret
 	}
 
 	switch e.Config.ExtractFrom {
-	case tykcommon.HeaderSource:
+	case apidef.HeaderSource:
 		extractorOutput, err = e.ExtractHeader(r)
-	case tykcommon.BodySource:
+	case apidef.BodySource:
 		extractorOutput, err = e.ExtractBody(r)
-	case tykcommon.FormSource:
+	case apidef.FormSource:
 		extractorOutput, err = e.ExtractForm(r, config.FormParamName)
 	}
 
@@ -339,11 +339,11 @@ func newExtractor(referenceSpec *APISpec, mw *TykMiddleware) {
 
 	// Initialize a extractor based on the API spec.
 	switch referenceSpec.CustomMiddleware.IdExtractor.ExtractWith {
-	case tykcommon.ValueExtractor:
+	case apidef.ValueExtractor:
 		thisExtractor = &ValueExtractor{baseExtractor}
-	case tykcommon.RegexExtractor:
+	case apidef.RegexExtractor:
 		thisExtractor = &RegexExtractor{baseExtractor}
-	case tykcommon.XPathExtractor:
+	case apidef.XPathExtractor:
 		thisExtractor = &XPathExtractor{baseExtractor}
 	}
 
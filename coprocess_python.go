@@ -175,7 +175,7 @@ import (
 
 	"github.com/TykTechnologies/logrus"
 	"github.com/TykTechnologies/tyk/coprocess"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 )
 
 // CoProcessName declares the driver name.
@@ -216,7 +216,7 @@ func (d *PythonDispatcher) Reload() {
 }
 
 // HandleMiddlewareCache isn't used by Python.
-func (d *PythonDispatcher) HandleMiddlewareCache(b *tykcommon.BundleManifest, basePath string) {
+func (d *PythonDispatcher) HandleMiddlewareCache(b *apidef.BundleManifest, basePath string) {
 	go func() {
 		runtime.LockOSThread()
 		defer runtime.UnlockOSThread()
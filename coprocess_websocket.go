@@ -0,0 +1,66 @@
+// +build coprocess
+
+package main
+
+import (
+	"github.com/TykTechnologies/tyk/coprocess"
+)
+
+// CoProcessWebSocketHook sends WebSocket messages to a co-process middleware, the message is the
+// request body and its direction and type are set in the metadata. The middleware can replace the
+// body and set "websocket_action" in the metadata to drop the message or close the connection.
+type CoProcessWebSocketHook struct {
+	Spec *APISpec
+	Name string
+}
+
+func newCoProcessWebSocketHook(spec *APISpec, name string) WebSocketMessageHook {
+	return &CoProcessWebSocketHook{spec, name}
+}
+
+func (h *CoProcessWebSocketHook) HandleMessage(c *WebSocketConnection, direction string, opcode byte, payload []byte) (WebSocketMessageVerdict, error) {
+	messageType := "text"
+	if opcode == wsOpBinary {
+		messageType = "binary"
+	}
+
+	object := &coprocess.Object{
+		HookType: coprocess.HookType_Post,
+		HookName: h.Name,
+		Request: &coprocess.MiniRequestObject{
+			Headers:        ProtoMap(c.Request.Header),
+			SetHeaders:     make(map[string]string),
+			DeleteHeaders:  make([]string, 0),
+			Body:           string(payload),
+			Url:            c.Request.URL.Path,
+			Params:         ProtoMap(c.Request.URL.Query()),
+			AddParams:      make(map[string]string),
+			ExtendedParams: ProtoMap(nil),
+			DeleteParams:   make([]string, 0),
+			ReturnOverrides: &coprocess.ReturnOverrides{
+				ResponseCode:  -1,
+				ResponseError: "",
+			},
+		},
+		Metadata: map[string]string{
+			"websocket_direction": direction,
+			"websocket_type":      messageType,
+		},
+		Spec: map[string]string{
+			"OrgID": h.Spec.OrgID,
+			"APIID": h.Spec.APIID,
+		},
+	}
+
+	thisCoProcessor := CoProcessor{HookType: coprocess.HookType_Post}
+	returnObject, err := thisCoProcessor.Dispatch(object)
+	if err != nil {
+		return WebSocketMessageVerdict{}, err
+	}
+
+	return WebSocketMessageVerdict{
+		Action: returnObject.Metadata["websocket_action"],
+		Data:   []byte(returnObject.Request.Body),
+		Reason: returnObject.Request.ReturnOverrides.ResponseError,
+	}, nil
+}
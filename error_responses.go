@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	htmltemplate "html/template"
+	"mime"
+	"net/http"
+	"strconv"
+	"text/template"
+
+	"github.com/TykTechnologies/logrus"
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+// Error types let an API override a kind of failure whatever status code it is reported with
+const (
+	ErrorTypeAuth            = "auth"
+	ErrorTypeRateLimit       = "rate_limit"
+	ErrorTypeQuota           = "quota"
+	ErrorTypeUpstreamTimeout = "upstream_timeout"
+	ErrorTypeCircuitOpen     = "circuit_open"
+	ErrorTypeValidation      = "validation"
+	ErrorTypeGraphQL         = "graphql"
+)
+
+const (
+	errorFormatJSON    = "json"
+	errorFormatXML     = "xml"
+	errorFormatProblem = "problem+json"
+
+	problemContentType = "application/problem+json"
+)
+
+// TypedError is returned by middleware that know what kind of failure they are reporting, Errors
+// lists where a request failed validation so clients get each failure as well as the message
+type TypedError struct {
+	Type    string
+	Message string
+	Errors  []JSONSchemaError
+}
+
+func (t TypedError) Error() string {
+	return t.Message
+}
+
+func newTypedError(errorType, message string) error {
+	return TypedError{errorType, message, nil}
+}
+
+// errorDetailsFor returns the individual failures carried by a middleware error, if any
+func errorDetailsFor(err error) []JSONSchemaError {
+	if typed, ok := err.(TypedError); ok {
+		return typed.Errors
+	}
+
+	return nil
+}
+
+// authMiddlewareNames are the middleware whose failures are always authentication errors
+var authMiddlewareNames = map[string]bool{
+	"AuthKey":             true,
+	"BasicAuthKeyIsValid": true,
+	"HMAC":                true,
+	"JWTMiddleware":       true,
+	"Oauth2KeyExists":     true,
+	"OpenIDMW":            true,
+	"KeyExpired":          true,
+}
+
+// errorTypeFor works out the type of a middleware failure, nothing is returned when it has none
+func errorTypeFor(middlewareName string, err error, errCode int) string {
+	if typed, ok := err.(TypedError); ok {
+		return typed.Type
+	}
+
+	switch {
+	case authMiddlewareNames[middlewareName] || errCode == 401:
+		return ErrorTypeAuth
+	case errCode == 429:
+		return ErrorTypeRateLimit
+	}
+
+	return ""
+}
+
+// ErrorOverrideSpec is an error override with its body template compiled
+type ErrorOverrideSpec struct {
+	apidef.ErrorOverride
+	Template *template.Template
+}
+
+var errorTemplateFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+}
+
+// errorPageFuncs are available to the error templates in the template path, they are HTML templates
+// so encoded JSON is marked safe to keep it from being escaped
+var errorPageFuncs = htmltemplate.FuncMap{
+	"json": func(value interface{}) (htmltemplate.HTML, error) {
+		encoded, err := json.Marshal(value)
+		return htmltemplate.HTML(encoded), err
+	},
+}
+
+// compileErrorOverrides compiles the override bodies of an API, overrides with a broken body are
+// left out so the error falls back to the default shape
+func compileErrorOverrides(apiID string, overrides map[string]apidef.ErrorOverride) map[string]*ErrorOverrideSpec {
+	compiled := make(map[string]*ErrorOverrideSpec, len(overrides))
+	for key, override := range overrides {
+		thisSpec := &ErrorOverrideSpec{ErrorOverride: override}
+		if override.Body != "" {
+			bodyTemplate, err := template.New(key).Funcs(errorTemplateFuncs).Parse(override.Body)
+			if err != nil {
+				log.WithFields(logrus.Fields{
+					"prefix": "main",
+					"api_id": apiID,
+					"error":  key,
+				}).Error("Error override body template is invalid: ", err)
+				continue
+			}
+			thisSpec.Template = bodyTemplate
+		}
+		compiled[key] = thisSpec
+	}
+
+	return compiled
+}
+
+// errorOverride finds the override for an error, one set for its type wins over one for its code
+func (a *APISpec) errorOverride(errorType string, errCode int) *ErrorOverrideSpec {
+	if errorType != "" {
+		if override, found := a.CompiledErrorOverrides[errorType]; found {
+			return override
+		}
+	}
+
+	return a.CompiledErrorOverrides[strconv.Itoa(errCode)]
+}
+
+// negotiateErrorFormat picks the error format the client prefers from its Accept header. Clients that
+// don't ask for any of them get the format matching their Content-Type, and APIs set to use problem
+// details give them to every JSON client.
+func negotiateErrorFormat(r *http.Request, apiFormat string) string {
+	best, bestWeight := "", 0.0
+	for _, accepted := range parseAcceptHeader(r.Header.Get("Accept")) {
+		format := ""
+		switch accepted.value {
+		case problemContentType:
+			format = errorFormatProblem
+		case "application/json":
+			format = errorFormatJSON
+		case "application/xml", "text/xml":
+			format = errorFormatXML
+		}
+		if format != "" && accepted.weight > bestWeight {
+			best, bestWeight = format, accepted.weight
+		}
+	}
+
+	if best == "" {
+		best = errorFormatJSON
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil && mediaType == "application/xml" {
+			best = errorFormatXML
+		}
+	}
+	if best == errorFormatJSON && apiFormat == errorFormatProblem {
+		best = errorFormatProblem
+	}
+
+	return best
+}
+
+// problemDetails is an RFC 7807 error, the request ID and error type are added as extension members
+type problemDetails struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail"`
+	Instance  string            `json:"instance,omitempty"`
+	ErrorType string            `json:"error_type,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	Errors    []JSONSchemaError `json:"errors,omitempty"`
+}
+
+func newProblemDetails(thisError *APIError, problemType string) problemDetails {
+	if problemType == "" {
+		problemType = "about:blank"
+	}
+
+	return problemDetails{
+		Type:      problemType,
+		Title:     http.StatusText(thisError.Code),
+		Status:    thisError.Code,
+		Detail:    thisError.Message,
+		Instance:  thisError.Path,
+		ErrorType: thisError.Type,
+		RequestID: thisError.RequestID,
+		Errors:    thisError.Errors,
+	}
+}
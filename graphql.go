@@ -0,0 +1,828 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Upper bound on fields visited while analysing a query, stops fragment expansion blowing up
+const maxGraphQLAnalysedFields = 10000
+
+const (
+	graphQLField = iota
+	graphQLFragmentSpread
+	graphQLInlineFragment
+)
+
+type graphQLVariable struct {
+	Name string
+}
+
+type graphQLSelection struct {
+	Kind       int
+	Name       string
+	Alias      string
+	Arguments  map[string]interface{}
+	Selections []graphQLSelection
+}
+
+type graphQLOperation struct {
+	Type       string
+	Name       string
+	Selections []graphQLSelection
+}
+
+// GraphQLDocument is a parsed executable GraphQL document
+type GraphQLDocument struct {
+	Operations []*graphQLOperation
+	Fragments  map[string][]graphQLSelection
+}
+
+// GraphQLQueryStats describes the selected operation of a document
+type GraphQLQueryStats struct {
+	OperationType string
+	OperationName string
+	Depth         int
+	Complexity    int
+	Aliases       int
+	// Fields lists every selected field as a dotted path from the operation type, e.g. "query.user.email"
+	Fields []string
+}
+
+type graphQLToken struct {
+	kind  byte // 'p' punctuator, 'n' name, 'i' int, 'f' float, 's' string, 0 end of input
+	value string
+	pos   int
+}
+
+// graphQLMaxNesting bounds how deeply selection sets and input values can nest whatever the
+// configured depth limit, so a hostile document can't exhaust the stack while it is parsed
+const graphQLMaxNesting = 256
+
+type graphQLParser struct {
+	source   string
+	pos      int
+	token    graphQLToken
+	maxDepth int
+	depth    int
+	nesting  int
+}
+
+// ParseGraphQL parses an executable GraphQL document, type system definitions are rejected. Parsing
+// stops as soon as fields are nested deeper than maxDepth, 0 leaves the depth to be checked once
+// the document is analysed
+func ParseGraphQL(source string, maxDepth int) (*GraphQLDocument, error) {
+	p := &graphQLParser{source: source, maxDepth: maxDepth, depth: 1}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	doc := &GraphQLDocument{Fragments: make(map[string][]graphQLSelection)}
+	for p.token.kind != 0 {
+		if p.peek('p', "{") {
+			selections, err := p.parseSelectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, &graphQLOperation{Type: "query", Selections: selections})
+			continue
+		}
+
+		if p.token.kind != 'n' {
+			return nil, p.errorf("unexpected %q", p.token.value)
+		}
+
+		switch p.token.value {
+		case "query", "mutation", "subscription":
+			operation, err := p.parseOperation()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, operation)
+		case "fragment":
+			if err := p.parseFragment(doc); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, p.errorf("unexpected %q, only operations and fragments are allowed", p.token.value)
+		}
+	}
+
+	if len(doc.Operations) == 0 {
+		return nil, errors.New("document does not contain an operation")
+	}
+
+	return doc, nil
+}
+
+func (p *graphQLParser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.source[:p.token.pos], "\n") + 1
+	return fmt.Errorf("syntax error on line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *graphQLParser) peek(kind byte, value string) bool {
+	return p.token.kind == kind && p.token.value == value
+}
+
+func (p *graphQLParser) expect(kind byte, value string) error {
+	if !p.peek(kind, value) {
+		return p.errorf("expected %q but found %q", value, p.token.value)
+	}
+	return p.next()
+}
+
+func (p *graphQLParser) expectName() (string, error) {
+	if p.token.kind != 'n' {
+		return "", p.errorf("expected a name but found %q", p.token.value)
+	}
+	name := p.token.value
+	return name, p.next()
+}
+
+// next reads the following token, whitespace, commas and comments are insignificant
+func (p *graphQLParser) next() error {
+	for p.pos < len(p.source) {
+		c := p.source[p.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			p.pos++
+		} else if c == '#' {
+			for p.pos < len(p.source) && p.source[p.pos] != '\n' && p.source[p.pos] != '\r' {
+				p.pos++
+			}
+		} else if strings.HasPrefix(p.source[p.pos:], "\ufeff") {
+			p.pos += len("\ufeff")
+		} else {
+			break
+		}
+	}
+
+	start := p.pos
+	if p.pos >= len(p.source) {
+		p.token = graphQLToken{pos: start}
+		return nil
+	}
+
+	c := p.source[p.pos]
+	switch {
+	case strings.HasPrefix(p.source[p.pos:], "..."):
+		p.pos += 3
+		p.token = graphQLToken{'p', "...", start}
+	case strings.IndexByte("!$&():=@[]{}|", c) >= 0:
+		p.pos++
+		p.token = graphQLToken{'p', string(c), start}
+	case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		for p.pos < len(p.source) && isGraphQLNameChar(p.source[p.pos]) {
+			p.pos++
+		}
+		p.token = graphQLToken{'n', p.source[start:p.pos], start}
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.readNumber()
+	case c == '"':
+		return p.readString()
+	default:
+		r, _ := utf8.DecodeRuneInString(p.source[p.pos:])
+		p.token = graphQLToken{pos: start}
+		return p.errorf("unexpected character %q", r)
+	}
+
+	return nil
+}
+
+func isGraphQLNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *graphQLParser) readNumber() error {
+	start := p.pos
+	kind := byte('i')
+	if p.source[p.pos] == '-' {
+		p.pos++
+	}
+
+	digits := func() int {
+		from := p.pos
+		for p.pos < len(p.source) && p.source[p.pos] >= '0' && p.source[p.pos] <= '9' {
+			p.pos++
+		}
+		return p.pos - from
+	}
+
+	if digits() == 0 {
+		p.token = graphQLToken{pos: start}
+		return p.errorf("invalid number")
+	}
+	if p.pos < len(p.source) && p.source[p.pos] == '.' {
+		kind = 'f'
+		p.pos++
+		if digits() == 0 {
+			p.token = graphQLToken{pos: start}
+			return p.errorf("invalid number")
+		}
+	}
+	if p.pos < len(p.source) && (p.source[p.pos] == 'e' || p.source[p.pos] == 'E') {
+		kind = 'f'
+		p.pos++
+		if p.pos < len(p.source) && (p.source[p.pos] == '+' || p.source[p.pos] == '-') {
+			p.pos++
+		}
+		if digits() == 0 {
+			p.token = graphQLToken{pos: start}
+			return p.errorf("invalid number")
+		}
+	}
+
+	p.token = graphQLToken{kind, p.source[start:p.pos], start}
+	return nil
+}
+
+func (p *graphQLParser) readString() error {
+	start := p.pos
+	if strings.HasPrefix(p.source[p.pos:], `"""`) {
+		end := strings.Index(p.source[p.pos+3:], `"""`)
+		for end >= 0 && p.source[p.pos+3+end-1] == '\\' {
+			next := strings.Index(p.source[p.pos+3+end+3:], `"""`)
+			if next < 0 {
+				end = -1
+				break
+			}
+			end += 3 + next
+		}
+		if end < 0 {
+			p.token = graphQLToken{pos: start}
+			return p.errorf("unterminated block string")
+		}
+		value := p.source[p.pos+3 : p.pos+3+end]
+		p.pos += 3 + end + 3
+		p.token = graphQLToken{'s', strings.Replace(value, `\"""`, `"""`, -1), start}
+		return nil
+	}
+
+	p.pos++
+	var value bytes.Buffer
+	for p.pos < len(p.source) {
+		c := p.source[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			p.token = graphQLToken{'s', value.String(), start}
+			return nil
+		case c == '\n' || c == '\r':
+			p.token = graphQLToken{pos: start}
+			return p.errorf("unterminated string")
+		case c == '\\' && p.pos+1 < len(p.source):
+			escaped := p.source[p.pos+1]
+			p.pos += 2
+			switch escaped {
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			case 'r':
+				value.WriteByte('\r')
+			case 'b':
+				value.WriteByte('\b')
+			case 'f':
+				value.WriteByte('\f')
+			case 'u':
+				if p.pos+4 > len(p.source) {
+					p.token = graphQLToken{pos: start}
+					return p.errorf("invalid unicode escape")
+				}
+				code, err := strconv.ParseUint(p.source[p.pos:p.pos+4], 16, 32)
+				if err != nil {
+					p.token = graphQLToken{pos: start}
+					return p.errorf("invalid unicode escape")
+				}
+				value.WriteRune(rune(code))
+				p.pos += 4
+			default:
+				value.WriteByte(escaped)
+			}
+		default:
+			value.WriteByte(c)
+			p.pos++
+		}
+	}
+
+	p.token = graphQLToken{pos: start}
+	return p.errorf("unterminated string")
+}
+
+func (p *graphQLParser) parseOperation() (*graphQLOperation, error) {
+	operation := &graphQLOperation{Type: p.token.value}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	if p.token.kind == 'n' {
+		operation.Name = p.token.value
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.peek('p', "(") {
+		if err := p.skipVariableDefinitions(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.skipDirectives(); err != nil {
+		return nil, err
+	}
+
+	selections, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	operation.Selections = selections
+
+	return operation, nil
+}
+
+func (p *graphQLParser) parseFragment(doc *GraphQLDocument) error {
+	if err := p.next(); err != nil {
+		return err
+	}
+
+	name, err := p.expectName()
+	if err != nil {
+		return err
+	}
+	if name == "on" {
+		return p.errorf("fragments can not be named \"on\"")
+	}
+	if _, exists := doc.Fragments[name]; exists {
+		return p.errorf("fragment %q is defined more than once", name)
+	}
+
+	if err := p.expect('n', "on"); err != nil {
+		return err
+	}
+	if _, err := p.expectName(); err != nil {
+		return err
+	}
+
+	if err := p.skipDirectives(); err != nil {
+		return err
+	}
+
+	selections, err := p.parseSelectionSet()
+	if err != nil {
+		return err
+	}
+	doc.Fragments[name] = selections
+
+	return nil
+}
+
+func (p *graphQLParser) skipVariableDefinitions() error {
+	if err := p.expect('p', "("); err != nil {
+		return err
+	}
+
+	for !p.peek('p', ")") {
+		if err := p.expect('p', "$"); err != nil {
+			return err
+		}
+		if _, err := p.expectName(); err != nil {
+			return err
+		}
+		if err := p.expect('p', ":"); err != nil {
+			return err
+		}
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if p.peek('p', "=") {
+			if err := p.next(); err != nil {
+				return err
+			}
+			if _, err := p.parseValue(true); err != nil {
+				return err
+			}
+		}
+		if err := p.skipDirectives(); err != nil {
+			return err
+		}
+	}
+
+	return p.next()
+}
+
+func (p *graphQLParser) skipType() error {
+	if p.peek('p', "[") {
+		if err := p.next(); err != nil {
+			return err
+		}
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if err := p.expect('p', "]"); err != nil {
+			return err
+		}
+	} else if _, err := p.expectName(); err != nil {
+		return err
+	}
+
+	if p.peek('p', "!") {
+		return p.next()
+	}
+
+	return nil
+}
+
+func (p *graphQLParser) skipDirectives() error {
+	for p.peek('p', "@") {
+		if err := p.next(); err != nil {
+			return err
+		}
+		if _, err := p.expectName(); err != nil {
+			return err
+		}
+		if p.peek('p', "(") {
+			if _, err := p.parseArguments(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// nest is called on the way into a selection set or input value, the returned function is
+// called on the way out
+func (p *graphQLParser) nest() (func(), error) {
+	p.nesting++
+	if p.nesting > graphQLMaxNesting {
+		return nil, p.errorf("document is nested too deeply")
+	}
+
+	return func() { p.nesting-- }, nil
+}
+
+func (p *graphQLParser) parseSelectionSet() ([]graphQLSelection, error) {
+	if err := p.expect('p', "{"); err != nil {
+		return nil, err
+	}
+
+	unnest, err := p.nest()
+	if err != nil {
+		return nil, err
+	}
+	defer unnest()
+
+	selections := []graphQLSelection{}
+	for !p.peek('p', "}") {
+		if p.token.kind == 0 {
+			return nil, p.errorf("unterminated selection set")
+		}
+
+		selection, err := p.parseSelection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+
+	if len(selections) == 0 {
+		return nil, p.errorf("selection sets can not be empty")
+	}
+
+	return selections, p.next()
+}
+
+func (p *graphQLParser) parseSelection() (graphQLSelection, error) {
+	selection := graphQLSelection{}
+
+	if p.peek('p', "...") {
+		if err := p.next(); err != nil {
+			return selection, err
+		}
+
+		if p.token.kind == 'n' && p.token.value != "on" {
+			selection.Kind = graphQLFragmentSpread
+			selection.Name = p.token.value
+			if err := p.next(); err != nil {
+				return selection, err
+			}
+			return selection, p.skipDirectives()
+		}
+
+		selection.Kind = graphQLInlineFragment
+		if p.peek('n', "on") {
+			if err := p.next(); err != nil {
+				return selection, err
+			}
+			if _, err := p.expectName(); err != nil {
+				return selection, err
+			}
+		}
+		if err := p.skipDirectives(); err != nil {
+			return selection, err
+		}
+
+		var err error
+		selection.Selections, err = p.parseSelectionSet()
+		return selection, err
+	}
+
+	selection.Kind = graphQLField
+	name, err := p.expectName()
+	if err != nil {
+		return selection, err
+	}
+	selection.Name = name
+
+	if p.peek('p', ":") {
+		if err := p.next(); err != nil {
+			return selection, err
+		}
+		selection.Alias = name
+		if selection.Name, err = p.expectName(); err != nil {
+			return selection, err
+		}
+	}
+
+	if p.peek('p', "(") {
+		if selection.Arguments, err = p.parseArguments(); err != nil {
+			return selection, err
+		}
+	}
+
+	if err := p.skipDirectives(); err != nil {
+		return selection, err
+	}
+
+	if p.peek('p', "{") {
+		p.depth++
+		if p.maxDepth > 0 && p.depth > p.maxDepth {
+			return selection, fmt.Errorf("query depth exceeds the limit of %d", p.maxDepth)
+		}
+		selection.Selections, err = p.parseSelectionSet()
+		p.depth--
+	}
+
+	return selection, err
+}
+
+func (p *graphQLParser) parseArguments() (map[string]interface{}, error) {
+	if err := p.expect('p', "("); err != nil {
+		return nil, err
+	}
+
+	arguments := make(map[string]interface{})
+	for !p.peek('p', ")") {
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect('p', ":"); err != nil {
+			return nil, err
+		}
+		if arguments[name], err = p.parseValue(false); err != nil {
+			return nil, err
+		}
+	}
+
+	return arguments, p.next()
+}
+
+// parseValue reads an input value, variables are returned as graphQLVariable so that they can
+// be resolved against the request variables later
+func (p *graphQLParser) parseValue(constant bool) (interface{}, error) {
+	unnest, err := p.nest()
+	if err != nil {
+		return nil, err
+	}
+	defer unnest()
+
+	token := p.token
+	switch {
+	case token.kind == 'p' && token.value == "$" && !constant:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.expectName()
+		return graphQLVariable{name}, err
+	case token.kind == 'p' && token.value == "[":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		list := []interface{}{}
+		for !p.peek('p', "]") {
+			if p.token.kind == 0 {
+				return nil, p.errorf("unterminated list")
+			}
+			value, err := p.parseValue(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, p.next()
+	case token.kind == 'p' && token.value == "{":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		object := make(map[string]interface{})
+		for !p.peek('p', "}") {
+			name, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect('p', ":"); err != nil {
+				return nil, err
+			}
+			if object[name], err = p.parseValue(constant); err != nil {
+				return nil, err
+			}
+		}
+		return object, p.next()
+	case token.kind == 'i':
+		value, err := strconv.ParseInt(token.value, 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid integer %s", token.value)
+		}
+		return value, p.next()
+	case token.kind == 'f':
+		value, err := strconv.ParseFloat(token.value, 64)
+		if err != nil {
+			return nil, p.errorf("invalid float %s", token.value)
+		}
+		return value, p.next()
+	case token.kind == 's':
+		return token.value, p.next()
+	case token.kind == 'n':
+		var value interface{} = token.value
+		switch token.value {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		case "null":
+			value = nil
+		}
+		return value, p.next()
+	}
+
+	return nil, p.errorf("unexpected %q", token.value)
+}
+
+// Operation selects the operation to run, a name is required when there is more than one
+func (d *GraphQLDocument) Operation(name string) (*graphQLOperation, error) {
+	if name == "" {
+		if len(d.Operations) > 1 {
+			return nil, errors.New("operationName is required when the document contains several operations")
+		}
+		return d.Operations[0], nil
+	}
+
+	for _, operation := range d.Operations {
+		if operation.Name == name {
+			return operation, nil
+		}
+	}
+
+	return nil, fmt.Errorf("operation %q not found in document", name)
+}
+
+type graphQLAnalysis struct {
+	doc       *GraphQLDocument
+	variables map[string]interface{}
+	stats     *GraphQLQueryStats
+	expanding map[string]bool
+	visited   int
+}
+
+// Analyse computes the depth, complexity and aliases of an operation, fragments are expanded.
+// Every field costs one, fields with a "first", "last" or "limit" argument multiply the cost of
+// their selections as they return lists of that size
+func (d *GraphQLDocument) Analyse(operationName string, variables map[string]interface{}) (*GraphQLQueryStats, error) {
+	operation, err := d.Operation(operationName)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &graphQLAnalysis{
+		doc:       d,
+		variables: variables,
+		stats:     &GraphQLQueryStats{OperationType: operation.Type, OperationName: operation.Name},
+		expanding: make(map[string]bool),
+	}
+
+	depth, complexity, err := a.walk(operation.Selections, operation.Type, 1)
+	if err != nil {
+		return nil, err
+	}
+	a.stats.Depth = depth
+	a.stats.Complexity = complexity
+
+	return a.stats, nil
+}
+
+func (a *graphQLAnalysis) walk(selections []graphQLSelection, path string, depth int) (int, int, error) {
+	maxDepth, complexity := 0, 0
+
+	for _, selection := range selections {
+		a.visited++
+		if a.visited > maxGraphQLAnalysedFields {
+			return 0, 0, errors.New("query is too large to analyse")
+		}
+
+		var children []graphQLSelection
+		childDepth := depth
+		childPath := path
+
+		switch selection.Kind {
+		case graphQLField:
+			childPath = path + "." + selection.Name
+			childDepth = depth + 1
+			children = selection.Selections
+			if selection.Alias != "" {
+				a.stats.Aliases++
+			}
+			a.stats.Fields = append(a.stats.Fields, childPath)
+			if depth > maxDepth {
+				maxDepth = depth
+			}
+		case graphQLFragmentSpread:
+			fragment, found := a.doc.Fragments[selection.Name]
+			if !found {
+				return 0, 0, fmt.Errorf("unknown fragment %q", selection.Name)
+			}
+			if a.expanding[selection.Name] {
+				return 0, 0, fmt.Errorf("fragment %q spreads itself", selection.Name)
+			}
+			a.expanding[selection.Name] = true
+			children = fragment
+		case graphQLInlineFragment:
+			children = selection.Selections
+		}
+
+		subDepth, subComplexity, err := a.walk(children, childPath, childDepth)
+		if selection.Kind == graphQLFragmentSpread {
+			delete(a.expanding, selection.Name)
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if subDepth > maxDepth {
+			maxDepth = subDepth
+		}
+
+		if selection.Kind == graphQLField {
+			complexity = addCapped(complexity, multiplyCapped(1+subComplexity, a.listSize(selection.Arguments)))
+		} else {
+			complexity = addCapped(complexity, subComplexity)
+		}
+	}
+
+	return maxDepth, complexity, nil
+}
+
+func (a *graphQLAnalysis) listSize(arguments map[string]interface{}) int {
+	for _, name := range []string{"first", "last", "limit"} {
+		value, found := arguments[name]
+		if !found {
+			continue
+		}
+		if variable, isVariable := value.(graphQLVariable); isVariable {
+			value = a.variables[variable.Name]
+		}
+
+		switch typed := value.(type) {
+		case int64:
+			if typed > 0 {
+				return int(typed)
+			}
+		case float64:
+			if typed > 0 {
+				return int(typed)
+			}
+		}
+	}
+
+	return 1
+}
+
+const maxGraphQLComplexity = 1 << 30
+
+func addCapped(a, b int) int {
+	if a+b > maxGraphQLComplexity {
+		return maxGraphQLComplexity
+	}
+	return a + b
+}
+
+func multiplyCapped(a, b int) int {
+	if b != 0 && a > maxGraphQLComplexity/b {
+		return maxGraphQLComplexity
+	}
+	return a * b
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/context"
+)
+
+const graphQLTestQuery = `
+# Comments and commas are ignored
+query Feed($count: Int = 10, $tag: String!) @cached {
+  viewer { name, email }
+  recent: posts(first: $count, filter: {tag: $tag, tags: ["a", "b"]}) {
+    ...PostFields
+    ... on Post { comments(first: 5) { body } }
+  }
+}
+
+fragment PostFields on Post {
+  title
+  author { name }
+}
+
+mutation DeletePost { deletePost(id: "1é") { id } }
+`
+
+func TestGraphQLAnalysis(t *testing.T) {
+	doc, err := ParseGraphQL(graphQLTestQuery, 0)
+	if err != nil {
+		t.Fatal("Parsing failed: ", err)
+	}
+
+	if _, err := doc.Analyse("", nil); err == nil {
+		t.Error("An operation name should be required for documents with several operations")
+	}
+
+	stats, err := doc.Analyse("Feed", map[string]interface{}{"count": 3.0})
+	if err != nil {
+		t.Fatal("Analysis failed: ", err)
+	}
+
+	if stats.OperationType != "query" || stats.Depth != 3 || stats.Aliases != 1 {
+		t.Error("Unexpected stats: ", stats)
+	}
+
+	// viewer(1+2) + recent: 3 * (1 + title + author(1+1) + comments(5 * (1+1)))
+	if stats.Complexity != 3+3*(1+1+2+10) {
+		t.Error("Complexity should multiply list fields, got: ", stats.Complexity)
+	}
+
+	if len(stats.Fields) != 9 || stats.Fields[3] != "query.posts" {
+		t.Error("Fields should be listed by path, got: ", stats.Fields)
+	}
+
+	for _, bad := range []string{
+		`{ user }}`,
+		`type Query { user: User }`,
+		`{ user(id: ) }`,
+		`query { ...Missing }`,
+		`fragment A on T { ...A } query { ...A }`,
+		`{ name: "unterminated }`,
+	} {
+		doc, err := ParseGraphQL(bad, 0)
+		if err == nil {
+			_, err = doc.Analyse("", nil)
+		}
+		if err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestGraphQLParseDepth(t *testing.T) {
+	if _, err := ParseGraphQL(`{ a { b { c } } }`, 3); err != nil {
+		t.Error("Queries within the limit should parse, got: ", err)
+	}
+	if _, err := ParseGraphQL(`{ a { ... on B { b { c { d } } } } }`, 3); err == nil || !strings.Contains(err.Error(), "limit of 3") {
+		t.Error("Parsing should stop once the limit is passed, got: ", err)
+	}
+
+	deep := strings.Repeat("{ a ", 10000) + strings.Repeat("}", 10000)
+	if _, err := ParseGraphQL(deep, 0); err == nil || !strings.Contains(err.Error(), "nested too deeply") {
+		t.Error("Deeply nested documents should be rejected without a limit, got: ", err)
+	}
+
+	deepValue := "{ a(v: " + strings.Repeat("[", 10000) + strings.Repeat("]", 10000) + ") }"
+	if _, err := ParseGraphQL(deepValue, 0); err == nil || !strings.Contains(err.Error(), "nested too deeply") {
+		t.Error("Deeply nested values should be rejected, got: ", err)
+	}
+}
+
+func TestGraphQLMiddleware(t *testing.T) {
+	spec := createDefinitionFromString(nonExpiringDefNoWhiteList)
+	spec.GraphQL.Enabled = true
+	spec.GraphQL.MaxDepth = 3
+	spec.GraphQL.BlockedFields = []string{"password"}
+	mw := &GraphQLMiddleware{&TykMiddleware{spec, nil}}
+
+	check := func(body string, session *SessionState) (error, *http.Request, int) {
+		req, _ := http.NewRequest("POST", "/graphql", bytes.NewBufferString(body))
+		if session != nil {
+			context.Set(req, SessionData, *session)
+		}
+		err, code := mw.ProcessRequest(httptest.NewRecorder(), req, nil)
+		return err, req, code
+	}
+
+	_, req, code := check(`{"query": "query GetUser { user { name } }"}`, nil)
+	if code != 200 || context.Get(req, TrackThisEndpoint) != "/query/GetUser" {
+		t.Error("Operation name should be tracked as the path, got: ", context.Get(req, TrackThisEndpoint))
+	}
+	context.Clear(req)
+
+	err, req, code := check(`{"query": "{ a { b { c { d } } } }"}`, nil)
+	if err == nil || code != 400 {
+		t.Error("Deep queries should be rejected, got: ", code)
+	}
+	if errorType := errorTypeFor(mw.GetName(), err, code); errorType != ErrorTypeGraphQL {
+		t.Error("Rejections should be GraphQL errors so they can be overridden, got: ", errorType)
+	}
+	context.Clear(req)
+
+	err, req, code = check(`{"query": "{ user { password } }"}`, nil)
+	if err == nil || code != 403 {
+		t.Error("Blocked fields should be rejected, got: ", code)
+	}
+	context.Clear(req)
+
+	session := createNonThrottledSession()
+	session.AccessRights = map[string]AccessDefinition{"1": {APIID: "1", GraphQL: &GraphQLAccess{AllowedOperations: []string{"GetUser"}}}}
+	err, req, code = check(`[{"query": "query GetUser { user { name } }"}, {"query": "mutation Drop { drop }"}]`, &session)
+	if err == nil || code != 403 {
+		t.Error("Operations outside the key's allow list should be rejected, got: ", code)
+	}
+	context.Clear(req)
+
+	spec.GraphQL.MaxBatchSize = 2
+	err, req, code = check(`[{"query": "{ a }"}, {"query": "{ b }"}, {"query": "{ c }"}]`, nil)
+	if err == nil || code != 400 {
+		t.Error("Batches over the size limit should be rejected, got: ", code)
+	}
+	context.Clear(req)
+
+	spec.GraphQL.MaxComplexity = 3
+	if err, req, code = check(`{"query": "{ a b c }"}`, nil); err != nil || code != 200 {
+		t.Error("Operations within the complexity limit should pass, got: ", err, code)
+	}
+	context.Clear(req)
+
+	err, req, code = check(`[{"query": "{ a b c }"}, {"query": "{ d e }"}]`, nil)
+	if err == nil || code != 400 {
+		t.Error("Batches whose operations together exceed the complexity limit should be rejected, got: ", code)
+	}
+	context.Clear(req)
+}
+
+func TestMergeGraphQLAccess(t *testing.T) {
+	a := &GraphQLAccess{AllowedOperations: []string{"A"}, BlockedFields: []string{"password", "ssn"}}
+	b := &GraphQLAccess{AllowedOperations: []string{"B"}, BlockedFields: []string{"ssn"}}
+
+	merged := mergeGraphQLAccess(a, b)
+	if len(merged.AllowedOperations) != 2 || len(merged.BlockedFields) != 1 || merged.BlockedFields[0] != "ssn" {
+		t.Error("Merged access should be the most generous of both, got: ", merged)
+	}
+
+	if mergeGraphQLAccess(a, nil) != nil {
+		t.Error("An unrestricted side should lift all restrictions")
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/context"
+)
+
+// gRPC status codes, see https://github.com/grpc/grpc/blob/master/doc/statuscodes.md
+const (
+	GRPCStatusOK                 = 0
+	GRPCStatusCancelled          = 1
+	GRPCStatusUnknown            = 2
+	GRPCStatusInvalidArgument    = 3
+	GRPCStatusDeadlineExceeded   = 4
+	GRPCStatusNotFound           = 5
+	GRPCStatusAlreadyExists      = 6
+	GRPCStatusPermissionDenied   = 7
+	GRPCStatusResourceExhausted  = 8
+	GRPCStatusFailedPrecondition = 9
+	GRPCStatusAborted            = 10
+	GRPCStatusOutOfRange         = 11
+	GRPCStatusUnimplemented      = 12
+	GRPCStatusInternal           = 13
+	GRPCStatusUnavailable        = 14
+	GRPCStatusUnauthenticated    = 16
+)
+
+const (
+	grpcContentType        = "application/grpc"
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+
+	// grpcWebTrailerFlag marks the frame that carries the trailers at the end of a gRPC-Web body
+	grpcWebTrailerFlag = 0x80
+)
+
+func isGRPCRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), grpcContentType)
+}
+
+func isGRPCResponse(res *http.Response) bool {
+	return strings.HasPrefix(res.Header.Get("Content-Type"), grpcContentType)
+}
+
+// isGRPCWebRequest reports whether the request uses gRPC-Web and if its body is base64 encoded
+func isGRPCWebRequest(r *http.Request) (bool, bool) {
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, grpcWebTextContentType) {
+		return true, true
+	}
+
+	return strings.HasPrefix(contentType, grpcWebContentType), false
+}
+
+// grpcStatusForHTTP maps the status of a gateway generated error onto a gRPC status, 401 and 403
+// are only permission errors once a key has been authenticated
+func grpcStatusForHTTP(code int, authenticated bool) int {
+	switch code {
+	case 400, 411, 422:
+		return GRPCStatusInvalidArgument
+	case 401:
+		return GRPCStatusUnauthenticated
+	case 403:
+		if authenticated {
+			return GRPCStatusPermissionDenied
+		}
+		return GRPCStatusUnauthenticated
+	case 404, 405, 501:
+		return GRPCStatusUnimplemented
+	case 408, 504:
+		return GRPCStatusDeadlineExceeded
+	case 409:
+		return GRPCStatusAborted
+	case 412:
+		return GRPCStatusFailedPrecondition
+	case 413, 429:
+		return GRPCStatusResourceExhausted
+	case 499:
+		return GRPCStatusCancelled
+	case 500:
+		return GRPCStatusInternal
+	case 502, 503:
+		return GRPCStatusUnavailable
+	}
+
+	return GRPCStatusUnknown
+}
+
+// grpcPercentEncode encodes a grpc-message value, which may only carry printable ASCII
+func grpcPercentEncode(message string) string {
+	var encoded bytes.Buffer
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+			continue
+		}
+		encoded.WriteByte(c)
+	}
+
+	return encoded.String()
+}
+
+// writeGRPCError answers a gRPC or gRPC-Web call with a trailers-only response, clients read the
+// status from the headers and ignore the HTTP status code
+func writeGRPCError(w http.ResponseWriter, r *http.Request, err string, errCode int) {
+	_, authenticated := context.GetOk(r, SessionData)
+	status := grpcStatusForHTTP(errCode, authenticated)
+
+	w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+	w.Header().Set("Grpc-Status", strconv.Itoa(status))
+	w.Header().Set("Grpc-Message", grpcPercentEncode(err))
+	w.WriteHeader(http.StatusOK)
+}
+
+// translateGRPCWebRequest turns a gRPC-Web call into a plain gRPC call for the upstream, the
+// message framing is the same so only text mode bodies need decoding
+func translateGRPCWebRequest(outreq *http.Request, text bool) {
+	headers := make(http.Header)
+	copyHeader(headers, outreq.Header)
+	outreq.Header = headers
+
+	contentType := headers.Get("Content-Type")
+	subtype := ""
+	if plus := strings.Index(contentType, "+"); plus != -1 {
+		subtype = contentType[plus:]
+	}
+
+	headers.Set("Content-Type", grpcContentType+subtype)
+	headers.Set("Te", "trailers")
+	headers.Del("X-Grpc-Web")
+
+	if text {
+		headers.Del("Content-Length")
+		outreq.ContentLength = -1
+		outreq.Body = struct {
+			io.Reader
+			io.Closer
+		}{base64.NewDecoder(base64.StdEncoding, outreq.Body), outreq.Body}
+	}
+}
+
+// grpcWebTrailerFrame encodes trailers as the final frame of a gRPC-Web body
+func grpcWebTrailerFrame(trailer http.Header) []byte {
+	keys := make([]string, 0, len(trailer))
+	for key := range trailer {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var payload bytes.Buffer
+	for _, key := range keys {
+		for _, value := range trailer[key] {
+			payload.WriteString(strings.ToLower(key) + ": " + value + "\r\n")
+		}
+	}
+
+	frame := make([]byte, 5, 5+payload.Len())
+	frame[0] = grpcWebTrailerFlag
+	binary.BigEndian.PutUint32(frame[1:], uint32(payload.Len()))
+
+	return append(frame, payload.Bytes()...)
+}
+
+// translateGRPCWebResponse streams the upstream body back in gRPC-Web form, trailers are only
+// known once the body has been read so they are appended as a frame at the end
+func translateGRPCWebResponse(res *http.Response, contentType string, text bool) {
+	res.Header.Set("Content-Type", contentType)
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+
+	upstream := res.Body
+	reader, writer := io.Pipe()
+
+	go func() {
+		defer upstream.Close()
+
+		var out io.Writer = writer
+		var encoder io.WriteCloser
+		if text {
+			encoder = base64.NewEncoder(base64.StdEncoding, writer)
+			out = encoder
+		}
+
+		_, err := io.Copy(out, upstream)
+		if err == nil {
+			_, err = out.Write(grpcWebTrailerFrame(res.Trailer))
+		}
+		// The trailers now travel in the body, they must not be sent again as HTTP trailers
+		res.Trailer = nil
+
+		if encoder != nil {
+			encoder.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	res.Body = reader
+}
+
+// flushWriter pushes every write to the client straight away, gRPC streams and server-sent
+// events can't wait for a buffer to fill up
+type flushWriter struct {
+	dst writeFlusher
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.dst.Write(p)
+	f.dst.Flush()
+	return n, err
+}
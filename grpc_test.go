@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestGRPCErrorStatus(t *testing.T) {
+	spec := createDefinitionFromString(nonExpiringDefNoWhiteList)
+	spec.DoNotTrack = true
+	chain := getChain(spec)
+
+	req, _ := http.NewRequest("POST", "/v1/helloworld.Greeter/SayHello", nil)
+	req.Header.Set("Content-Type", "application/grpc")
+	recorder := httptest.NewRecorder()
+	chain.ServeHTTP(recorder, req)
+
+	if recorder.Code != 200 || recorder.Header().Get("Grpc-Status") != "16" {
+		t.Error("Missing keys should be UNAUTHENTICATED, got: ", recorder.Code, recorder.Header())
+	}
+	if recorder.Header().Get("Grpc-Message") != "Authorization field missing" {
+		t.Error("The error should be sent as the gRPC message, got: ", recorder.Header().Get("Grpc-Message"))
+	}
+
+	if grpcStatusForHTTP(429, true) != GRPCStatusResourceExhausted || grpcStatusForHTTP(403, true) != GRPCStatusPermissionDenied {
+		t.Error("Rate limits and access errors should map to their gRPC equivalents")
+	}
+
+	if encoded := grpcPercentEncode("100% done\né"); encoded != "100%25 done%0A%C3%A9" {
+		t.Error("Messages should be percent encoded, got: ", encoded)
+	}
+}
+
+func TestGRPCWebTranslation(t *testing.T) {
+	message := []byte{0, 0, 0, 0, 2, 'h', 'i'}
+
+	req, _ := http.NewRequest("POST", "/svc/Method", bytes.NewBufferString(base64.StdEncoding.EncodeToString(message)))
+	req.Header.Set("Content-Type", "application/grpc-web-text+proto")
+	translateGRPCWebRequest(req, true)
+
+	body, _ := ioutil.ReadAll(req.Body)
+	if req.Header.Get("Content-Type") != "application/grpc+proto" || !bytes.Equal(body, message) {
+		t.Error("Text requests should be decoded for the upstream, got: ", req.Header.Get("Content-Type"), body)
+	}
+
+	res := &http.Response{
+		Header: http.Header{"Content-Type": []string{"application/grpc+proto"}},
+		Body:   ioutil.NopCloser(bytes.NewReader(message)),
+	}
+	res.Trailer = http.Header{"Grpc-Status": []string{"0"}}
+	translateGRPCWebResponse(res, "application/grpc-web-text+proto", true)
+
+	encoded, _ := ioutil.ReadAll(res.Body)
+	decoded, err := base64.StdEncoding.DecodeString(string(encoded))
+	if err != nil {
+		t.Fatal("Text responses should be base64 encoded: ", err)
+	}
+
+	trailer := "grpc-status: 0\r\n"
+	expected := append(append(message, 0x80, 0, 0, 0, byte(len(trailer))), trailer...)
+	if !bytes.Equal(decoded, expected) || res.Trailer != nil {
+		t.Errorf("Trailers should be sent as the final frame, got: %q", decoded)
+	}
+}
+
+func TestH2CProxy(t *testing.T) {
+	config.HttpServerOptions.EnableHTTP2 = true
+	defer func() { config.HttpServerOptions.EnableHTTP2 = false }()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("X-Proto", r.Proto)
+		w.Write([]byte("reply"))
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	})
+	go serveGateway(l, &http.Server{Handler: upstream})
+
+	spec := createDefinitionFromString(nonExpiringDefNoWhiteList)
+	remote, _ := url.Parse("http://" + l.Addr().String())
+	proxy := TykNewSingleHostReverseProxy(remote, spec)
+
+	req, _ := http.NewRequest("POST", "/helloworld.Greeter/SayHello", bytes.NewBufferString("call"))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.RemoteAddr = "127.0.0.1:1234"
+	recorder := httptest.NewRecorder()
+	proxy.WrappedServeHTTP(recorder, req, false)
+
+	result := recorder.Result()
+	if result.Header.Get("X-Proto") != "HTTP/2.0" || recorder.Body.String() != "reply" {
+		t.Fatal("gRPC calls should reach the upstream over h2c, got: ", result.Header, recorder.Body.String())
+	}
+	if result.Trailer.Get("Grpc-Status") != "0" {
+		t.Error("Upstream trailers should be passed on, got: ", result.Trailer)
+	}
+}
+
+func TestHTTP2ResponseHeaderTimeout(t *testing.T) {
+	config.HttpServerOptions.EnableHTTP2 = true
+	defer func() { config.HttpServerOptions.EnableHTTP2 = false }()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(time.Second)
+		}
+		w.Write([]byte("reply"))
+	})
+	go serveGateway(l, &http.Server{Handler: upstream})
+
+	transport := headerTimeoutTransport{getHTTP2Transport(true, time.Second), 100 * time.Millisecond}
+	call := func(path string) (string, error) {
+		req, _ := http.NewRequest("GET", "http://"+l.Addr().String()+path, nil)
+		res, err := transport.RoundTrip(req)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		return string(body), err
+	}
+
+	if body, err := call("/fast"); err != nil || body != "reply" {
+		t.Fatal("Quick upstreams should answer, got: ", body, err)
+	}
+	if _, err := call("/slow"); err == nil {
+		t.Error("Waiting on the response headers should time out")
+	}
+}
@@ -3,10 +3,10 @@ package main
 import (
 	"bytes"
 	b64 "encoding/base64"
+	"encoding/json"
 	"fmt"
 	"github.com/TykTechnologies/logrus"
 	"github.com/gorilla/context"
-	"html/template"
 	"net"
 	"net/http"
 	"runtime/pprof"
@@ -21,9 +21,17 @@ const (
 	defaultContentType    = "application/json"
 )
 
-// APIError is generic error object returned if there is something wrong with the request
+// APIError is generic error object returned if there is something wrong with the request, it is
+// what error templates are rendered with
 type APIError struct {
-	Message string
+	Message   string
+	Code      int
+	Type      string
+	RequestID string
+	APIName   string
+	APIID     string
+	Path      string
+	Errors    []JSONSchemaError
 }
 
 // ErrorHandler is invoked whenever there is an issue with a proxied request, most middleware will invoke
@@ -34,47 +42,24 @@ type ErrorHandler struct {
 
 // HandleError is the actual error handler and will store the error details in analytics if analytics processing is enabled.
 func (e ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, err string, errCode int) {
-	if e.Spec.DoNotTrack {
-		var templateExtension string
-		var thisContentType string
-
-		switch r.Header.Get("Content-Type") {
-		case "application/xml":
-			templateExtension = "xml"
-			thisContentType = "application/xml"
-		default:
-			templateExtension = "json"
-			thisContentType = "application/json"
-		}
-
-		w.Header().Set("Content-Type", thisContentType)
-
-		var thisTemplate *template.Template
-		var templateName string = fmt.Sprintf("error_%s.%s", strconv.Itoa(errCode), templateExtension)
-
-		// templateError := templates.ExecuteTemplate(w, templateName, &thisError)
-
-		// Try to use an error template that matches the HTTP error code and the content type: 500.json, 400.xml, etc.
-		thisTemplate = templates.Lookup(templateName)
+	e.HandleTypedError(w, r, "", err, errCode, nil)
+}
 
-		// Fallback to a generic error template, but match the content type: error.json, error.xml, etc.
-		if thisTemplate == nil {
-			templateName = fmt.Sprintf("%s.%s", defaultTemplateName, templateExtension)
-			thisTemplate = templates.Lookup(templateName)
+// HandleTypedError handles an error of a known type, letting the API override it by type as well as by code,
+// details are the individual failures behind the error and are sent along with it
+func (e ErrorHandler) HandleTypedError(w http.ResponseWriter, r *http.Request, errorType string, err string, errCode int, details []JSONSchemaError) {
+	override := e.Spec.errorOverride(errorType, errCode)
+	if override != nil {
+		if override.Code != 0 {
+			errCode = override.Code
 		}
-
-		// If no template is available for this content type, fallback to "error.json".
-		if thisTemplate == nil {
-			templateName = fmt.Sprintf("%s.%s", defaultTemplateName, defaultTemplateFormat)
-			thisTemplate = templates.Lookup(templateName)
-			w.Header().Set("Content-Type", defaultContentType)
+		if override.Message != "" {
+			err = override.Message
 		}
+	}
 
-		// Need to return the correct error code!
-		w.WriteHeader(errCode)
-
-		thisError := APIError{fmt.Sprintf("%s", err)}
-		thisTemplate.Execute(w, &thisError)
+	if e.Spec.DoNotTrack {
+		e.writeError(w, r, errorType, err, details, errCode, override)
 
 		if doMemoryProfile {
 			pprof.WriteHeapProfile(profileFile)
@@ -179,6 +164,9 @@ func (e ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, err st
 			tags,
 			alias,
 			trackEP,
+			nil,
+			nil,
+			requestID(r),
 			time.Now(),
 		}
 
@@ -206,8 +194,6 @@ func (e ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, err st
 	// Report in health check
 	ReportHealthCheckValue(e.Spec.Health, BlockedRequestLog, "-1")
 
-	w.Header().Add("Content-Type", "application/json")
-
 	//If the config option is not set or is false, add the header
 	if !config.HideGeneratorHeader {
 		w.Header().Add("X-Generator", "tyk.io")
@@ -242,12 +228,11 @@ func (e ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, err st
 		"org_id":      e.Spec.APIDefinition.OrgID,
 		"api_id":      e.Spec.APIDefinition.APIID,
 		"path":        r.URL.Path,
+		"request_id":  requestID(r),
 	}).Error("request error: ", err)
 
 	log.Debug("Returning error header")
-	w.WriteHeader(errCode)
-	thisError := APIError{fmt.Sprintf("%s", err)}
-	templates.ExecuteTemplate(w, "error.json", &thisError)
+	e.writeError(w, r, errorType, err, details, errCode, override)
 	if doMemoryProfile {
 		pprof.WriteHeapProfile(profileFile)
 	}
@@ -255,3 +240,75 @@ func (e ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, err st
 	// Clean up
 	context.Clear(r)
 }
+
+// writeError sends the error in the format negotiated with the client, an override with a body of
+// its own is sent as it is set up
+func (e ErrorHandler) writeError(w http.ResponseWriter, r *http.Request, errorType string, err string, details []JSONSchemaError, errCode int, override *ErrorOverrideSpec) {
+	if isGRPCRequest(r) {
+		writeGRPCError(w, r, err, errCode)
+		return
+	}
+
+	thisError := APIError{
+		Message:   err,
+		Code:      errCode,
+		Type:      errorType,
+		RequestID: requestID(r),
+		APIName:   e.Spec.Name,
+		APIID:     e.Spec.APIID,
+		Path:      r.URL.Path,
+		Errors:    details,
+	}
+
+	problemType := ""
+	if override != nil {
+		for headerName, headerValue := range override.Headers {
+			w.Header().Set(headerName, headerValue)
+		}
+		problemType = override.ProblemType
+
+		if override.Template != nil {
+			contentType := override.ContentType
+			if contentType == "" {
+				contentType = defaultContentType
+			}
+			w.Header().Set("Content-Type", contentType)
+			w.WriteHeader(errCode)
+			if templateErr := override.Template.Execute(w, &thisError); templateErr != nil {
+				log.Error("Error override body could not be rendered: ", templateErr)
+			}
+			return
+		}
+	}
+
+	templateExtension := negotiateErrorFormat(r, e.Spec.ErrorFormat)
+	if templateExtension == errorFormatProblem {
+		w.Header().Set("Content-Type", problemContentType)
+		w.WriteHeader(errCode)
+		json.NewEncoder(w).Encode(newProblemDetails(&thisError, problemType))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/"+templateExtension)
+
+	// Try to use an error template that matches the HTTP error code and the format: error_500.json, error_400.xml, etc.
+	templateName := fmt.Sprintf("error_%s.%s", strconv.Itoa(errCode), templateExtension)
+	thisTemplate := templates.Lookup(templateName)
+
+	// Fallback to a generic error template, but match the format: error.json, error.xml, etc.
+	if thisTemplate == nil {
+		templateName = fmt.Sprintf("%s.%s", defaultTemplateName, templateExtension)
+		thisTemplate = templates.Lookup(templateName)
+	}
+
+	// If no template is available for this format, fallback to "error.json".
+	if thisTemplate == nil {
+		templateName = fmt.Sprintf("%s.%s", defaultTemplateName, defaultTemplateFormat)
+		thisTemplate = templates.Lookup(templateName)
+		w.Header().Set("Content-Type", defaultContentType)
+	}
+
+	// Need to return the correct error code!
+	w.WriteHeader(errCode)
+	thisTemplate.Execute(w, &thisError)
+}
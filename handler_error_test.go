@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+var errorOverrideDefinition = `
+
+	{
+		"name": "Tyk Test API",
+		"api_id": "1",
+		"org_id": "default",
+		"definition": {
+			"location": "header",
+			"key": "version"
+		},
+		"auth": {
+			"auth_header_name": "authorization"
+		},
+		"version_data": {
+			"not_versioned": true,
+			"versions": {
+				"Default": {
+					"name": "Default"
+				}
+			}
+		},
+		"error_format": "problem+json",
+		"error_overrides": {
+			"rate_limit": {
+				"content_type": "application/vnd.errors+json",
+				"headers": {"Retry-After": "60"},
+				"body": "{\"reason\": {{json .Message}}, \"api\": {{json .APIName}}, \"request\": {{json .RequestID}}}"
+			},
+			"auth": {
+				"code": 404,
+				"message": "Not found",
+				"problem_type": "https://example.com/problems/not-found"
+			},
+			"429": {
+				"message": "Slow down"
+			},
+			"500": {
+				"body": "{{.Broken"
+			}
+		},
+		"proxy": {
+			"listen_path": "/v1",
+			"target_url": "http://example.com",
+			"strip_listen_path": false
+		}
+	}
+
+`
+
+func TestErrorFormatNegotiation(t *testing.T) {
+	tests := []struct {
+		accept, contentType, apiFormat, expected string
+	}{
+		{"", "", "", errorFormatJSON},
+		{"", "application/xml; charset=utf-8", "", errorFormatXML},
+		{"application/json", "application/xml", "", errorFormatJSON},
+		{"text/html, application/xml;q=0.9, */*;q=0.8", "", "", errorFormatXML},
+		{"application/json;q=0.5, application/problem+json", "", "", errorFormatProblem},
+		{"application/json", "", errorFormatProblem, errorFormatProblem},
+		{"application/xml", "", errorFormatProblem, errorFormatXML},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", "/v1/orders", nil)
+		req.Header.Set("Accept", test.accept)
+		req.Header.Set("Content-Type", test.contentType)
+		if format := negotiateErrorFormat(req, test.apiFormat); format != test.expected {
+			t.Errorf("Accept %q, Content-Type %q: expected %s, got %s", test.accept, test.contentType, test.expected, format)
+		}
+	}
+}
+
+func TestErrorTypes(t *testing.T) {
+	if errorType := errorTypeFor("RateLimitAndQuotaCheck", newTypedError(ErrorTypeQuota, "Quota exceeded"), 403); errorType != ErrorTypeQuota {
+		t.Error("Typed errors should keep their type, got: ", errorType)
+	}
+	if errorType := errorTypeFor("JWTMiddleware", errors.New("Key not authorised"), 403); errorType != ErrorTypeAuth {
+		t.Error("Auth middleware failures should be auth errors, got: ", errorType)
+	}
+	if errorType := errorTypeFor("ConcurrencyLimitCheck", errors.New("Too many concurrent requests"), 429); errorType != ErrorTypeRateLimit {
+		t.Error("429s should be rate limit errors, got: ", errorType)
+	}
+	if errorType := errorTypeFor("ValidateJSON", errors.New("Invalid body"), 422); errorType != "" {
+		t.Error("Other failures should have no type, got: ", errorType)
+	}
+}
+
+func TestErrorOverrides(t *testing.T) {
+	spec := createDefinitionFromString(errorOverrideDefinition)
+	spec.DoNotTrack = true
+	handler := ErrorHandler{&TykMiddleware{spec, nil}}
+
+	if _, found := spec.CompiledErrorOverrides["500"]; found {
+		t.Error("Overrides with a broken body should be left out")
+	}
+
+	call := func(errorType, err string, errCode int, accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/v1/orders", nil)
+		req.RemoteAddr = "127.0.0.1:1234"
+		req.Header.Set("Accept", accept)
+		req.Header.Set("X-Request-Id", "req-1")
+		recorder := httptest.NewRecorder()
+		handler.HandleTypedError(recorder, req, errorType, err, errCode, nil)
+		return recorder
+	}
+
+	recorder := call(ErrorTypeRateLimit, "Rate limit exceeded", 429, "application/json")
+	if recorder.Code != 429 || recorder.Header().Get("Content-Type") != "application/vnd.errors+json" || recorder.Header().Get("Retry-After") != "60" {
+		t.Error("Type overrides should set their content type and headers, got: ", recorder.Code, recorder.Header())
+	}
+	if recorder.Body.String() != `{"reason": "Rate limit exceeded", "api": "Tyk Test API", "request": "req-1"}` {
+		t.Error("Override bodies should be rendered with the error, got: ", recorder.Body.String())
+	}
+
+	recorder = call("", "Too many concurrent requests", 429, "")
+	var problem problemDetails
+	json.Unmarshal(recorder.Body.Bytes(), &problem)
+	if recorder.Header().Get("Content-Type") != problemContentType || problem.Status != 429 || problem.Detail != "Slow down" {
+		t.Error("Untyped errors should use the override for their code, got: ", recorder.Body.String())
+	}
+
+	recorder = call(ErrorTypeAuth, "Key not authorised", 403, "application/problem+json")
+	problem = problemDetails{}
+	json.Unmarshal(recorder.Body.Bytes(), &problem)
+	expected := problemDetails{
+		Type:      "https://example.com/problems/not-found",
+		Title:     "Not Found",
+		Status:    404,
+		Detail:    "Not found",
+		Instance:  "/v1/orders",
+		ErrorType: ErrorTypeAuth,
+		RequestID: "req-1",
+	}
+	if recorder.Code != 404 || !reflect.DeepEqual(problem, expected) {
+		t.Error("Overrides should change the code and message of problem details, got: ", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = call(ErrorTypeUpstreamTimeout, "Upstream service reached hard timeout.", 408, "application/xml")
+	if recorder.Code != 408 || recorder.Header().Get("Content-Type") != defaultContentType {
+		t.Error("Formats without a template should fall back to error.json, got: ", recorder.Header())
+	}
+}
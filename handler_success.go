@@ -20,16 +20,22 @@ type ContextKey int
 // Enums for keys to be stored in a session context - this is how gorilla expects
 // these to be implemented and is lifted pretty much from docs
 const (
-	SessionData            = 0
-	AuthHeaderValue        = 1
-	VersionData            = 2
-	VersionKeyContext      = 3
-	OrgSessionContext      = 4
-	ContextData            = 5
-	RetainHost             = 6
-	SkipCoProcessAuth      = 7
-	TrackThisEndpoint      = 8
-	DoNotTrackThisEndpoint = 9
+	SessionData              = 0
+	AuthHeaderValue          = 1
+	VersionData              = 2
+	VersionKeyContext        = 3
+	OrgSessionContext        = 4
+	ContextData              = 5
+	RetainHost               = 6
+	SkipCoProcessAuth        = 7
+	TrackThisEndpoint        = 8
+	DoNotTrackThisEndpoint   = 9
+	ConcurrencyLeases        = 10
+	ResponseValidationErrors = 11
+	GRPCTranscodeMethod      = 12
+	WebSocketConnectionStats = 13
+	SOAPMediationSpecKey     = 14
+	JWTClaims                = 15
 )
 
 var SessionCache *cache.Cache = cache.New(10*time.Second, 5*time.Second)
@@ -97,13 +103,12 @@ func (t TykMiddleware) GetOrgSessionExpiry(orgid string) int64 {
 	return cachedVal.(int64)
 }
 
-// ApplyPolicyIfExists will check if a policy is loaded, if it is, it will overwrite the session state to use the policy values
+// ApplyPolicyIfExists will check if a policy is loaded, if it is, it will overwrite the session state to use the policy values.
+// Sessions with more than one policy have them merged first, see MergePolicies.
 func (t TykMiddleware) ApplyPolicyIfExists(key string, thisSession *SessionState) {
-	if thisSession.ApplyPolicyID != "" {
+	if policyIDs := thisSession.PolicyIDs(); len(policyIDs) > 0 {
 		log.Debug("Session has policy, checking")
-		policiesMu.RLock()
-		policy, ok := policiesByID[thisSession.ApplyPolicyID]
-		policiesMu.RUnlock()
+		policy, ok := MergePolicies(policyIDs)
 		if ok {
 			// Check ownership, policy org owner must be the same as API,
 			// otherwise youcould overwrite a session key with a policy from a different org!
@@ -123,6 +128,8 @@ func (t TykMiddleware) ApplyPolicyIfExists(key string, thisSession *SessionState
 					log.Debug("Applying partition: Quota")
 					thisSession.QuotaMax = policy.QuotaMax
 					thisSession.QuotaRenewalRate = policy.QuotaRenewalRate
+					thisSession.QuotaRenewalPeriod = policy.QuotaRenewalPeriod
+					thisSession.QuotaTimezone = policy.QuotaTimezone
 				}
 
 				if policy.Partitions.RateLimit {
@@ -131,6 +138,7 @@ func (t TykMiddleware) ApplyPolicyIfExists(key string, thisSession *SessionState
 					thisSession.Allowance = policy.Rate // This is a legacy thing, merely to make sure output is consistent. Needs to be purged
 					thisSession.Rate = policy.Rate
 					thisSession.Per = policy.Per
+					thisSession.MaxConcurrentRequests = policy.MaxConcurrentRequests
 					if policy.LastUpdated != "" {
 						thisSession.LastUpdated = policy.LastUpdated
 					}
@@ -149,11 +157,14 @@ func (t TykMiddleware) ApplyPolicyIfExists(key string, thisSession *SessionState
 				// Quotas
 				thisSession.QuotaMax = policy.QuotaMax
 				thisSession.QuotaRenewalRate = policy.QuotaRenewalRate
+				thisSession.QuotaRenewalPeriod = policy.QuotaRenewalPeriod
+				thisSession.QuotaTimezone = policy.QuotaTimezone
 
 				// Rate limting
 				thisSession.Allowance = policy.Rate // This is a legacy thing, merely to make sure output is consistent. Needs to be purged
 				thisSession.Rate = policy.Rate
 				thisSession.Per = policy.Per
+				thisSession.MaxConcurrentRequests = policy.MaxConcurrentRequests
 				if policy.LastUpdated != "" {
 					thisSession.LastUpdated = policy.LastUpdated
 				}
@@ -167,6 +178,10 @@ func (t TykMiddleware) ApplyPolicyIfExists(key string, thisSession *SessionState
 			thisSession.IsInactive = policy.IsInactive
 			thisSession.Tags = policy.Tags
 
+			if len(policy.MetaData) > 0 {
+				thisSession.MetaData = applyPolicyMetaData(thisSession.MetaData, policy.MetaData)
+			}
+
 			log.Debug("Policy Applied, Access rights are: ", thisSession.AccessRights)
 			log.Debug("Policy Applied, Access rights were: ", policy.AccessRights)
 
@@ -303,6 +318,16 @@ func (s SuccessHandler) RecordHit(w http.ResponseWriter, r *http.Request, timing
 			trackedPath = r.URL.Path
 		}
 
+		var violations []string
+		if found, ok := context.GetOk(r, ResponseValidationErrors); ok {
+			violations = found.([]string)
+		}
+
+		var webSocketStats *WebSocketStats
+		if found, ok := context.GetOk(r, WebSocketConnectionStats); ok {
+			webSocketStats = found.(*WebSocketStats)
+		}
+
 		thisRecord := AnalyticsRecord{
 			r.Method,
 			trackedPath,
@@ -329,6 +354,9 @@ func (s SuccessHandler) RecordHit(w http.ResponseWriter, r *http.Request, timing
 			tags,
 			alias,
 			trackEP,
+			violations,
+			webSocketStats,
+			requestID(r),
 			time.Now(),
 		}
 
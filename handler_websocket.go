@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"crypto/tls"
 	"errors"
 	"github.com/TykTechnologies/logrus"
@@ -24,6 +25,8 @@ type WSDialer struct {
 	*TykTransporter
 	RW        http.ResponseWriter
 	TLSConfig *tls.Config
+	Spec      *APISpec
+	Request   *http.Request
 }
 
 func (ws *WSDialer) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -32,6 +35,15 @@ func (ws *WSDialer) RoundTrip(req *http.Request) (*http.Response, error) {
 		return nil, errors.New("WebSockets has been disabled on this host")
 	}
 
+	// Connection slots are held for as long as the connection stays open
+	lease, err := acquireWebSocketLease(ws.Spec, ws.Request)
+	if err != nil {
+		return nil, err
+	}
+	if lease != nil {
+		defer concurrencyLimiter.Release(*lease)
+	}
+
 	target := canonicalAddr(req.URL)
 
 	// TLS
@@ -57,8 +69,9 @@ func (ws *WSDialer) RoundTrip(req *http.Request) (*http.Response, error) {
 	if err != nil {
 		http.Error(ws.RW, "Error contacting backend server.", 500)
 		log.WithFields(logrus.Fields{
-			"path":   target,
-			"origin": GetIPFromRequest(req),
+			"path":       target,
+			"origin":     GetIPFromRequest(req),
+			"request_id": requestID(req),
 		}).Error("Error dialing websocket backend", target, ": ", err)
 		return nil, err
 	}
@@ -70,34 +83,63 @@ func (ws *WSDialer) RoundTrip(req *http.Request) (*http.Response, error) {
 		return nil, errors.New("Not a hjijacker?")
 	}
 
-	nc, _, err := hj.Hijack()
+	nc, bufrw, err := hj.Hijack()
 	if err != nil {
 		log.WithFields(logrus.Fields{
-			"path":   req.URL.Path,
-			"origin": GetIPFromRequest(req),
+			"path":       req.URL.Path,
+			"origin":     GetIPFromRequest(req),
+			"request_id": requestID(req),
 		}).Error("Hijack error: %v", err)
 		return nil, err
 	}
 	defer nc.Close()
 
+	// Hooks rewrite whole messages, so nothing may be negotiated that changes how frames are encoded
+	if ws.Spec.WebSocket.MessageHook.Name != "" {
+		req.Header.Del("Sec-WebSocket-Extensions")
+	}
+
 	err = req.Write(d)
 	if err != nil {
 		log.WithFields(logrus.Fields{
-			"path":   req.URL.Path,
-			"origin": GetIPFromRequest(req),
+			"path":       req.URL.Path,
+			"origin":     GetIPFromRequest(req),
+			"request_id": requestID(req),
 		}).Error("Error copying request to target: %v", err)
 		return nil, err
 	}
 
-	errc := make(chan error, 2)
-	cp := func(dst io.Writer, src io.Reader) {
-		_, err := io.Copy(dst, src)
-		errc <- err
+	upstreamReader := bufio.NewReader(d)
+	head, status, err := readWebSocketHandshake(upstreamReader)
+	if _, writeErr := nc.Write(head); err == nil {
+		err = writeErr
+	}
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"path":       req.URL.Path,
+			"origin":     GetIPFromRequest(req),
+			"request_id": requestID(req),
+		}).Error("Error reading upgrade response from target: ", err)
+		return nil, nil
+	}
+
+	// A refused upgrade is an ordinary response, there are no frames to look at
+	if status != http.StatusSwitchingProtocols {
+		errc := make(chan error, 2)
+		cp := func(dst io.Writer, src io.Reader) {
+			_, err := io.Copy(dst, src)
+			errc <- err
+		}
+		go cp(d, bufrw)
+		go cp(nc, upstreamReader)
+
+		<-errc
+		return nil, nil
 	}
-	go cp(d, nc)
-	go cp(nc, d)
 
-	<-errc
+	wsConn := NewWebSocketConnection(ws.Spec, ws.Request, nc, bufrw.Reader, d, upstreamReader)
+	wsConn.lease = lease
+	wsConn.Serve()
 
 	return nil, nil
 }
@@ -6,7 +6,7 @@ import (
 	"errors"
 	"github.com/TykTechnologies/logrus"
 	"github.com/lonelycode/go-uuid/uuid"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 	"gopkg.in/vmihailenco/msgpack.v2"
 	"net/url"
 	"sync"
@@ -297,7 +297,7 @@ func (hc *HostCheckerManager) IsHostDown(thisUrl string) bool {
 	return err == nil
 }
 
-func (hc *HostCheckerManager) PrepareTrackingHost(checkObject tykcommon.HostCheckObject, APIID string) (HostData, error) {
+func (hc *HostCheckerManager) PrepareTrackingHost(checkObject apidef.HostCheckObject, APIID string) (HostData, error) {
 	// Build the check URL:
 	var thisHostData HostData
 	u, err := url.Parse(checkObject.CheckURL)
@@ -409,7 +409,7 @@ func (hc *HostCheckerManager) GetListFromService(APIID string) ([]HostData, erro
 	}
 
 	// The returned data is a string, so lets unmarshal it:
-	checkTargets := make([]tykcommon.HostCheckObject, 0)
+	checkTargets := make([]apidef.HostCheckObject, 0)
 	thisData, _ := data.GetIndex(0)
 	decodeErr := json.Unmarshal([]byte(thisData), &checkTargets)
 
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	gocontext "context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/logrus"
+	"golang.org/x/net/http2"
+)
+
+const (
+	UpstreamTransportHTTP1 = "http1"
+	UpstreamTransportH2    = "h2"
+	UpstreamTransportH2C   = "h2c"
+)
+
+// http2ClientPreface is what an HTTP/2 client sends first, the HTTP/1 parser only consumes the
+// "PRI * HTTP/2.0" request line and the blank line after it
+const http2ClientPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// serverNextProtos advertises HTTP/2 over ALPN on TLS listeners when it is enabled
+func serverNextProtos() []string {
+	if !config.HttpServerOptions.EnableHTTP2 {
+		return nil
+	}
+
+	return []string{"h2", "http/1.1"}
+}
+
+// serveGateway serves the gateway on l, adding HTTP/2 over TLS and cleartext HTTP/2 with prior
+// knowledge (h2c) when enable_http2 is set
+func serveGateway(l net.Listener, s *http.Server) error {
+	if !config.HttpServerOptions.EnableHTTP2 {
+		return s.Serve(l)
+	}
+
+	h2 := &http2.Server{}
+	if err := http2.ConfigureServer(s, h2); err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "main",
+		}).Error("Could not enable HTTP/2: ", err)
+		return s.Serve(l)
+	}
+
+	s.Handler = h2cHandler{server: s, h2: h2, handler: s.Handler}
+	return s.Serve(l)
+}
+
+// h2cHandler hands connections that open with the HTTP/2 preface over to the HTTP/2 server,
+// everything else goes to the gateway as usual
+type h2cHandler struct {
+	server  *http.Server
+	h2      *http2.Server
+	handler http.Handler
+}
+
+func (h h2cHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PRI" || r.URL.Path != "*" || r.ProtoMajor != 2 {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "HTTP/2 is not supported on this connection", http.StatusHTTPVersionNotSupported)
+		return
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "main",
+		}).Error("h2c hijack failed: ", err)
+		return
+	}
+
+	h2Conn, err := newH2CConn(conn, rw.Reader)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "main",
+		}).Debug("Invalid HTTP/2 preface: ", err)
+		conn.Close()
+		return
+	}
+
+	h.h2.ServeConn(h2Conn, &http2.ServeConnOpts{BaseConfig: h.server, Handler: h.handler})
+}
+
+// prefixedConn replays bytes that were already read from a connection before reading from it again
+type prefixedConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *prefixedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// newH2CConn checks the rest of the client preface and rebuilds a connection that starts with the
+// full preface, which is what the HTTP/2 server expects to read
+func newH2CConn(conn net.Conn, buffered *bufio.Reader) (net.Conn, error) {
+	rest := make([]byte, len("SM\r\n\r\n"))
+	if _, err := io.ReadFull(buffered, rest); err != nil {
+		return nil, err
+	}
+	if string(rest) != "SM\r\n\r\n" {
+		return nil, http2.ConnectionError(http2.ErrCodeProtocol)
+	}
+
+	pending, _ := buffered.Peek(buffered.Buffered())
+	replay := append([]byte(http2ClientPreface), pending...)
+
+	return &prefixedConn{Conn: conn, reader: io.MultiReader(bytes.NewReader(replay), conn)}, nil
+}
+
+const (
+	http2DialTimeout      = 30 * time.Second
+	http2KeepAliveTimeout = 30 * time.Second
+)
+
+type http2TransportKey struct {
+	cleartext   bool
+	dialTimeout time.Duration
+}
+
+var upstreamHTTP2Transports = struct {
+	sync.Mutex
+	transports map[http2TransportKey]*http2.Transport
+}{transports: map[http2TransportKey]*http2.Transport{}}
+
+// getHTTP2Transport returns the shared HTTP/2 transport for a dial timeout, cleartext transports dial
+// plain TCP instead of negotiating h2 over TLS. Certificate checks are set up on every dial so they
+// follow config reloads
+func getHTTP2Transport(cleartext bool, dialTimeout time.Duration) *http2.Transport {
+	key := http2TransportKey{cleartext, dialTimeout}
+
+	upstreamHTTP2Transports.Lock()
+	defer upstreamHTTP2Transports.Unlock()
+
+	if transport, found := upstreamHTTP2Transports.transports[key]; found {
+		return transport
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: http2KeepAliveTimeout}
+	transport := &http2.Transport{}
+	if cleartext {
+		transport.AllowHTTP = true
+		transport.DialTLS = func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return dialer.Dial(network, addr)
+		}
+	} else {
+		transport.DialTLS = func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			cfg.InsecureSkipVerify = config.ProxySSLInsecureSkipVerify
+			conn, err := tls.DialWithDialer(dialer, network, addr, cfg)
+			if err != nil {
+				return nil, err
+			}
+			if state := conn.ConnectionState(); state.NegotiatedProtocol != http2.NextProtoTLS {
+				conn.Close()
+				return nil, errors.New("upstream did not negotiate HTTP/2, got: " + state.NegotiatedProtocol)
+			}
+			return conn, nil
+		}
+	}
+
+	upstreamHTTP2Transports.transports[key] = transport
+	return transport
+}
+
+// headerTimeoutTransport gives up on a request when the response headers take longer than timeout,
+// as ResponseHeaderTimeout does for HTTP/1.1, the body can take as long as it needs. It covers the
+// upstreams TykTransporter doesn't reach: HTTP/2 connections and internal APIs
+type headerTimeoutTransport struct {
+	Transport http.RoundTripper
+	timeout   time.Duration
+}
+
+func (t headerTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 {
+		return t.Transport.RoundTrip(req)
+	}
+
+	ctx, cancel := gocontext.WithCancel(req.Context())
+	timer := time.AfterFunc(t.timeout, cancel)
+	res, err := t.Transport.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() {
+		if err == nil {
+			res.Body.Close()
+		}
+		cancel()
+		return nil, errors.New("timeout awaiting response headers")
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	res.Body = &cancelOnCloseBody{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+// cancelOnCloseBody releases the request context once the body has been read
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel gocontext.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// upstreamHTTP2Transport decides whether a request goes upstream over HTTP/2. APIs can ask for it
+// with proxy.transport, gRPC calls need it and get it unless the API forces HTTP/1.1. A timeout
+// above 0 applies to dialing and to waiting for the response headers, like it does over HTTP/1.1
+func (p *ReverseProxy) upstreamHTTP2Transport(outreq *http.Request, timeout int) (http.RoundTripper, bool) {
+	switch strings.ToLower(p.TykAPISpec.Proxy.Transport) {
+	case UpstreamTransportH2, UpstreamTransportH2C:
+	case "":
+		if !isGRPCRequest(outreq) {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	if IsWebsocket(outreq) || outreq.URL.Scheme == InternalAPIScheme {
+		return nil, false
+	}
+
+	dialTimeout := http2DialTimeout
+	if timeout > 0 {
+		dialTimeout = time.Duration(timeout) * time.Second
+	}
+
+	return headerTimeoutTransport{
+		Transport: getHTTP2Transport(outreq.URL.Scheme != "https", dialTimeout),
+		timeout:   time.Duration(timeout) * time.Second,
+	}, true
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	gocontext "context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/TykTechnologies/logrus"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// InternalAPIScheme targets another API on this gateway, e.g. tyk://<api id or name>/path
+	InternalAPIScheme = "tyk"
+
+	// InternalRouteHeader lists the APIs an internal request has been through, it is used to
+	// detect loops and never leaves the gateway
+	InternalRouteHeader = "X-Tyk-Internal-Route"
+)
+
+func init() {
+	TykDefaultTransport.RegisterProtocol(InternalAPIScheme, InternalAPITransport{})
+	if defaultTransport, ok := http.DefaultTransport.(*http.Transport); ok {
+		defaultTransport.RegisterProtocol(InternalAPIScheme, InternalAPITransport{})
+	}
+}
+
+// InternalAPITransport hands tyk:// requests straight to the target API's middleware chain, so
+// APIs can call each other without a network round trip. It is registered on the proxy and
+// default transports, which covers URL rewrites, batch requests and TykMakeHttpRequest.
+type InternalAPITransport struct{}
+
+// findInternalAPI looks an API up by ID first and then by name
+func findInternalAPI(name string) *APISpec {
+	apisMu.RLock()
+	defer apisMu.RUnlock()
+
+	if spec, found := ApiSpecRegister[name]; found {
+		return spec
+	}
+	for _, spec := range ApiSpecRegister {
+		if strings.EqualFold(spec.Name, name) {
+			return spec
+		}
+	}
+
+	return nil
+}
+
+func (t InternalAPITransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	spec := findInternalAPI(req.URL.Host)
+	if spec == nil {
+		return nil, fmt.Errorf("no API found for %s://%s", InternalAPIScheme, req.URL.Host)
+	}
+
+	// An API that is already on the route would be entered a second time, that is a loop
+	var route []string
+	if previous := req.Header.Get(InternalRouteHeader); previous != "" {
+		route = strings.Split(previous, ",")
+	}
+	for _, apiID := range route {
+		if apiID == spec.APIID {
+			log.WithFields(logrus.Fields{
+				"prefix": "proxy",
+				"api_id": spec.APIID,
+			}).Error("Internal API loop detected: ", strings.Join(append(route, spec.APIID), " -> "))
+			return internalAPIErrorResponse(req, "Internal API loop detected", 508), nil
+		}
+	}
+	route = append(route, spec.APIID)
+
+	internalReq := new(http.Request)
+	*internalReq = *req
+	internalReq.Header = make(http.Header)
+	copyHeader(internalReq.Header, req.Header)
+	internalReq.Header.Set(InternalRouteHeader, strings.Join(route, ","))
+	internalReq.URL = &url.URL{
+		Path:     singleJoiningSlash(spec.Proxy.ListenPath, req.URL.Path),
+		RawQuery: req.URL.RawQuery,
+	}
+	internalReq.RequestURI = internalReq.URL.RequestURI()
+	internalReq.Host = spec.Domain
+	if internalReq.Body == nil {
+		internalReq.Body = ioutil.NopCloser(&bytes.Buffer{})
+	}
+
+	// The calling API's context variables are carried over, the target API adds its own to them
+	if contextData, found := context.Get(req, ContextData).(map[string]interface{}); found {
+		carried := make(map[string]interface{}, len(contextData))
+		for k, v := range contextData {
+			carried[k] = v
+		}
+		context.Set(internalReq, ContextData, carried)
+	}
+
+	// The matched handler is called directly, serving through the router would give the handler a
+	// copy of the request without the context set above
+	var match mux.RouteMatch
+	if !mainRouter.Match(internalReq, &match) {
+		context.Clear(internalReq)
+		return internalAPIErrorResponse(req, "Internal API is not being served", 404), nil
+	}
+
+	// The request shares the caller's context, so batch and proxy timeouts reach the target API
+	rw := newInternalResponseWriter(req)
+	go rw.cancelOn(req.Context())
+	go func() {
+		defer context.Clear(internalReq)
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				log.Error("Internal API request failed: ", recovered)
+				rw.finish(fmt.Errorf("internal API request failed: %v", recovered))
+				return
+			}
+			rw.finish(nil)
+		}()
+		match.Handler.ServeHTTP(rw, internalReq)
+	}()
+
+	return rw.response(req.Context())
+}
+
+func internalAPIErrorResponse(req *http.Request, message string, code int) *http.Response {
+	body := createError(message)
+	return &http.Response{
+		Status:        strconv.Itoa(code) + " " + http.StatusText(code),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// internalResponseWriter turns what a handler writes into an http.Response, the response is
+// available as soon as the header is written and the body is streamed through a pipe
+type internalResponseWriter struct {
+	request     *http.Request
+	header      http.Header
+	res         *http.Response
+	ready       chan struct{}
+	done        chan struct{}
+	once        sync.Once
+	wroteHeader bool
+	pipeReader  *io.PipeReader
+	pipeWriter  *io.PipeWriter
+}
+
+func newInternalResponseWriter(req *http.Request) *internalResponseWriter {
+	pipeReader, pipeWriter := io.Pipe()
+	return &internalResponseWriter{
+		request:    req,
+		header:     make(http.Header),
+		ready:      make(chan struct{}),
+		done:       make(chan struct{}),
+		pipeReader: pipeReader,
+		pipeWriter: pipeWriter,
+	}
+}
+
+func (w *internalResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *internalResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	header := make(http.Header)
+	copyHeader(header, w.header)
+	w.res = &http.Response{
+		Status:        strconv.Itoa(code) + " " + http.StatusText(code),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          w.pipeReader,
+		ContentLength: -1,
+		Request:       w.request,
+	}
+	if length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil {
+		w.res.ContentLength = length
+	}
+
+	w.once.Do(func() { close(w.ready) })
+}
+
+func (w *internalResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(200)
+	}
+	return w.pipeWriter.Write(b)
+}
+
+// Flush is a no-op, writes reach the reader as soon as they are made
+func (w *internalResponseWriter) Flush() {}
+
+func (w *internalResponseWriter) finish(err error) {
+	if !w.wroteHeader {
+		if err != nil {
+			w.res = internalAPIErrorResponse(w.request, "There was a problem proxying the request", 500)
+			w.wroteHeader = true
+			w.once.Do(func() { close(w.ready) })
+		} else {
+			w.WriteHeader(200)
+		}
+	}
+	w.pipeWriter.CloseWithError(err)
+	close(w.done)
+}
+
+// cancelOn cuts the body off when ctx ends before the handler has finished, the reader sees the
+// context's error and further writes from the handler fail
+func (w *internalResponseWriter) cancelOn(ctx gocontext.Context) {
+	select {
+	case <-ctx.Done():
+		w.pipeWriter.CloseWithError(ctx.Err())
+		w.pipeReader.CloseWithError(ctx.Err())
+	case <-w.done:
+	}
+}
+
+func (w *internalResponseWriter) response(ctx gocontext.Context) (*http.Response, error) {
+	select {
+	case <-w.ready:
+		return w.res, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
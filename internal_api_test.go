@@ -0,0 +1,188 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+func createInternalAPITestProxy(apiID, listenPath, target string) (*APISpec, http.Handler) {
+	spec := createDefinitionFromString(nonExpiringDefNoWhiteList)
+	redisStore := RedisClusterStorageManager{KeyPrefix: "apikey-"}
+	healthStore := &RedisClusterStorageManager{KeyPrefix: "apihealth."}
+	orgStore := &RedisClusterStorageManager{KeyPrefix: "orgKey."}
+	spec.Init(&redisStore, &redisStore, healthStore, orgStore)
+	spec.APIID = apiID
+	spec.Name = apiID + "-name"
+	spec.Proxy.ListenPath = listenPath
+
+	remote, _ := url.Parse(target)
+	proxy := TykNewSingleHostReverseProxy(remote, spec)
+	proxy.New(nil, spec)
+
+	return spec, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		context.Set(r, ContextData, map[string]interface{}{"caller": apiID})
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+func TestInternalAPIRouting(t *testing.T) {
+	var upstreamRoute string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamRoute = r.Header.Get(InternalRouteHeader)
+	}))
+	defer upstream.Close()
+
+	callerSpec, caller := createInternalAPITestProxy("internal-caller", "/caller/", "tyk://internal-target")
+	loopSpec, loop := createInternalAPITestProxy("internal-loop", "/loop/", "tyk://internal-loop-name")
+	externalSpec, external := createInternalAPITestProxy("internal-external", "/external/", upstream.URL)
+	targetSpec := createDefinitionFromString(nonExpiringDefNoWhiteList)
+	targetSpec.APIID = "internal-target"
+	targetSpec.Proxy.ListenPath = "/target/"
+
+	router := mux.NewRouter()
+	router.PathPrefix("/caller/").Handler(caller)
+	router.PathPrefix("/loop/").Handler(loop)
+	router.PathPrefix("/external/").Handler(external)
+	router.PathPrefix("/target/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contextData, _ := context.Get(r, ContextData).(map[string]interface{})
+		caller, _ := contextData["caller"].(string)
+		w.Write([]byte(r.URL.Path + " " + r.Header.Get(InternalRouteHeader) + " " + caller))
+	})
+
+	apisMu.Lock()
+	previousRegister, previousRouter := ApiSpecRegister, mainRouter
+	ApiSpecRegister = map[string]*APISpec{
+		callerSpec.APIID:   callerSpec,
+		loopSpec.APIID:     loopSpec,
+		externalSpec.APIID: externalSpec,
+		targetSpec.APIID:   targetSpec,
+	}
+	mainRouter = router
+	apisMu.Unlock()
+	defer func() {
+		apisMu.Lock()
+		ApiSpecRegister, mainRouter = previousRegister, previousRouter
+		apisMu.Unlock()
+	}()
+
+	server := httptest.NewServer(mainHandler{})
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/caller/things?x=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(body) != "/target/caller/things internal-target internal-caller" {
+		t.Error("Requests should be dispatched to the target API with the caller's context, got: ", resp.StatusCode, string(body))
+	}
+
+	resp, err = http.Get(server.URL + "/loop/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 508 {
+		t.Error("Loops between APIs should be stopped, got: ", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+"/external/", nil)
+	req.Header.Set(InternalRouteHeader, "internal-caller")
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 || upstreamRoute != "" {
+		t.Error("The internal route should not be sent upstream, got: ", upstreamRoute)
+	}
+
+	// Plain clients can reach internal APIs too
+	if resp, err = http.Get("tyk://internal-target/direct"); err != nil {
+		t.Fatal(err)
+	}
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "/target/direct internal-target " {
+		t.Error("The default client should route tyk:// URLs internally, got: ", string(body))
+	}
+
+	// Coming back to an API already on the route is a loop, however short the route is
+	req, _ = http.NewRequest("GET", "tyk://internal-target/again", nil)
+	req.Header.Set(InternalRouteHeader, "internal-target,internal-caller")
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 508 {
+		t.Error("An API appearing twice on the route should be a loop, got: ", resp.StatusCode)
+	}
+}
+
+func TestInternalAPIContext(t *testing.T) {
+	release := make(chan bool)
+	defer close(release)
+
+	targetSpec := createDefinitionFromString(nonExpiringDefNoWhiteList)
+	targetSpec.APIID = "internal-slow"
+	targetSpec.Proxy.ListenPath = "/slow/"
+
+	router := mux.NewRouter()
+	router.Path("/slow/header").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	router.Path("/slow/body").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		<-release
+	})
+
+	apisMu.Lock()
+	previousRegister, previousRouter := ApiSpecRegister, mainRouter
+	ApiSpecRegister = map[string]*APISpec{targetSpec.APIID: targetSpec}
+	mainRouter = router
+	apisMu.Unlock()
+	defer func() {
+		apisMu.Lock()
+		ApiSpecRegister, mainRouter = previousRegister, previousRouter
+		apisMu.Unlock()
+	}()
+
+	client := &http.Client{Timeout: 100 * time.Millisecond}
+	if _, err := client.Get("tyk://internal-slow/header"); err == nil {
+		t.Error("Timeouts should apply while waiting for the internal API to respond")
+	}
+
+	// Hard timeouts on APIs proxying to tyk:// targets work the same way
+	req, _ := http.NewRequest("GET", "tyk://internal-slow/header", nil)
+	transport := headerTimeoutTransport{InternalAPITransport{}, 100 * time.Millisecond}
+	if _, err := transport.RoundTrip(req); err == nil || err.Error() != "timeout awaiting response headers" {
+		t.Error("Hard timeouts should apply to internal APIs, got: ", err)
+	}
+
+	resp, err := client.Get("tyk://internal-slow/body")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	read := make(chan error)
+	go func() {
+		_, err := ioutil.ReadAll(resp.Body)
+		read <- err
+	}()
+	select {
+	case err := <-read:
+		if err == nil {
+			t.Error("Reading the body should fail once the request times out")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Timeouts should apply while the internal API writes the body")
+	}
+}
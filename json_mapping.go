@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/clbanning/mxj"
+	"github.com/jmespath/go-jmespath"
+)
+
+type jsonPathStep struct {
+	field    string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// JSONPath is a parsed path to a location in a document, it is used where values are written,
+// renamed or removed, mapping expressions are full JMESPath. Fields are separated by dots or quoted in
+// brackets with an optional leading "$" ("$.items[0].id"), arrays take an index (negative indexes
+// count from the end) and "*" projects the rest of the path over every element ("items[*].id").
+type JSONPath []jsonPathStep
+
+func ParseJSONPath(expr string) (JSONPath, error) {
+	expr = strings.TrimPrefix(strings.TrimSpace(expr), "$")
+
+	var path JSONPath
+	for i := 0; i < len(expr); {
+		switch expr[i] {
+		case '.':
+			i++
+		case '[':
+			end := strings.IndexByte(expr[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed bracket in %q", expr)
+			}
+			inner := strings.TrimSpace(expr[i+1 : i+end])
+			switch {
+			case inner == "*":
+				path = append(path, jsonPathStep{wildcard: true})
+			case len(inner) > 1 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				path = append(path, jsonPathStep{field: inner[1 : len(inner)-1]})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index %q in %q", inner, expr)
+				}
+				path = append(path, jsonPathStep{index: index, isIndex: true})
+			}
+			i += end + 1
+		default:
+			end := strings.IndexAny(expr[i:], ".[")
+			if end < 0 {
+				end = len(expr) - i
+			}
+			if name := expr[i : i+end]; name == "*" {
+				path = append(path, jsonPathStep{wildcard: true})
+			} else {
+				path = append(path, jsonPathStep{field: name})
+			}
+			i += end
+		}
+	}
+
+	return path, nil
+}
+
+// Get finds the value at the path, the second value is false when there isn't one. A null value
+// is found, it is only missing values that aren't.
+func (p JSONPath) Get(doc interface{}) (interface{}, bool) {
+	value := doc
+	for i, step := range p {
+		switch {
+		case step.wildcard:
+			var items []interface{}
+			switch v := value.(type) {
+			case []interface{}:
+				items = v
+			case map[string]interface{}:
+				keys := make([]string, 0, len(v))
+				for k := range v {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for _, k := range keys {
+					items = append(items, v[k])
+				}
+			default:
+				return nil, false
+			}
+
+			results := []interface{}{}
+			for _, item := range items {
+				if result, found := p[i+1:].Get(item); found {
+					results = append(results, result)
+				}
+			}
+			return results, true
+		case step.isIndex:
+			list, ok := value.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			index := step.index
+			if index < 0 {
+				index += len(list)
+			}
+			if index < 0 || index >= len(list) {
+				return nil, false
+			}
+			value = list[index]
+		default:
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if value, ok = object[step.field]; !ok {
+				return nil, false
+			}
+		}
+	}
+
+	return value, true
+}
+
+// Set puts a value at the path, creating any objects on the way, and returns the updated document
+func (p JSONPath) Set(doc interface{}, value interface{}) (interface{}, error) {
+	if len(p) == 0 {
+		return value, nil
+	}
+
+	step := p[0]
+	switch {
+	case step.wildcard:
+		return doc, errors.New("cannot set a value through a wildcard")
+	case step.isIndex:
+		list, ok := doc.([]interface{})
+		index := step.index
+		if index < 0 {
+			index += len(list)
+		}
+		if !ok || index < 0 || index >= len(list) {
+			return doc, fmt.Errorf("index %d is out of range", step.index)
+		}
+		updated, err := p[1:].Set(list[index], value)
+		list[index] = updated
+		return list, err
+	}
+
+	object, ok := doc.(map[string]interface{})
+	if doc == nil {
+		object, ok = make(map[string]interface{}), true
+	}
+	if !ok {
+		return doc, fmt.Errorf("cannot set %q on a value that isn't an object", step.field)
+	}
+	updated, err := p[1:].Set(object[step.field], value)
+	object[step.field] = updated
+
+	return object, err
+}
+
+// Delete removes the field at the end of the path, wildcards remove it from every element
+func (p JSONPath) Delete(doc interface{}) {
+	if len(p) == 0 {
+		return
+	}
+
+	step, rest := p[0], p[1:]
+	switch {
+	case step.wildcard:
+		switch v := doc.(type) {
+		case []interface{}:
+			for _, item := range v {
+				rest.Delete(item)
+			}
+		case map[string]interface{}:
+			for _, item := range v {
+				rest.Delete(item)
+			}
+		}
+	case step.isIndex:
+		if list, ok := doc.([]interface{}); ok {
+			if item, found := (JSONPath{step}).Get(list); found {
+				rest.Delete(item)
+			}
+		}
+	default:
+		object, ok := doc.(map[string]interface{})
+		if !ok {
+			return
+		}
+		if len(rest) == 0 {
+			delete(object, step.field)
+			return
+		}
+		rest.Delete(object[step.field])
+	}
+}
+
+func (p JSONPath) endsInField() bool {
+	return len(p) > 0 && !p[len(p)-1].isIndex && !p[len(p)-1].wildcard
+}
+
+func (p JSONPath) hasWildcard() bool {
+	for _, step := range p {
+		if step.wildcard {
+			return true
+		}
+	}
+	return false
+}
+
+type jsonMappingField struct {
+	target     JSONPath
+	expression *jmespath.JMESPath
+	fromTyk    bool
+	def        interface{}
+}
+
+type jsonMappingRename struct {
+	from, to JSONPath
+}
+
+// JSONMappingSpec is a declarative body transform with its paths parsed
+type JSONMappingSpec struct {
+	apidef.JSONMapping
+	fields []jsonMappingField
+	rename []jsonMappingRename
+	remove []JSONPath
+}
+
+func CompileJSONMapping(mapping apidef.JSONMapping) (*JSONMappingSpec, error) {
+	spec := &JSONMappingSpec{JSONMapping: mapping}
+
+	for _, field := range mapping.Fields {
+		target, err := ParseJSONPath(field.Target)
+		if err != nil {
+			return nil, err
+		}
+		if target.hasWildcard() {
+			return nil, fmt.Errorf("mapping target %q cannot contain a wildcard", field.Target)
+		}
+
+		compiled := jsonMappingField{target: target, def: field.Default}
+		if field.Expression != "" {
+			expression := strings.TrimSpace(field.Expression)
+			// JSONPath's root is implied in JMESPath
+			if strings.HasPrefix(expression, "$.") {
+				expression = expression[2:]
+			}
+			if compiled.expression, err = jmespath.Compile(expression); err != nil {
+				return nil, fmt.Errorf("invalid mapping expression %q: %v", field.Expression, err)
+			}
+			compiled.fromTyk = isTykMappingData(expression)
+		}
+		spec.fields = append(spec.fields, compiled)
+	}
+
+	for _, rename := range mapping.Rename {
+		from, err := ParseJSONPath(rename.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := ParseJSONPath(rename.To)
+		if err != nil {
+			return nil, err
+		}
+		if !from.endsInField() || from.hasWildcard() || to.hasWildcard() {
+			return nil, fmt.Errorf("cannot rename %q to %q, renames must be between fields", rename.From, rename.To)
+		}
+		spec.rename = append(spec.rename, jsonMappingRename{from, to})
+	}
+
+	for _, remove := range mapping.Remove {
+		path, err := ParseJSONPath(remove)
+		if err != nil {
+			return nil, err
+		}
+		if !path.endsInField() {
+			return nil, fmt.Errorf("cannot remove %q, only fields can be removed", remove)
+		}
+		spec.remove = append(spec.remove, path)
+	}
+
+	return spec, nil
+}
+
+func isTykMappingData(expression string) bool {
+	for _, prefix := range []string{"_tyk_context", "_tyk_meta"} {
+		if expression == prefix || strings.HasPrefix(expression, prefix+".") || strings.HasPrefix(expression, prefix+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup evaluates an expression against the body, unless it starts with _tyk_context or
+// _tyk_meta in which case the request context or session meta data is used. As in JMESPath, a
+// null result is the same as no result.
+func (m *JSONMappingSpec) lookup(field jsonMappingField, input, contextData, metaData interface{}) (interface{}, bool, error) {
+	if field.fromTyk {
+		input = map[string]interface{}{"_tyk_context": contextData, "_tyk_meta": metaData}
+	}
+
+	value, err := field.expression.Search(input)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return value, value != nil, nil
+}
+
+// Apply builds the output document. Fields are set first, each from its expression or, without
+// one, from what is already at the target, falling back to the default when nothing is found.
+// Renames and removals are then applied to the output.
+func (m *JSONMappingSpec) Apply(input, contextData, metaData interface{}) (interface{}, error) {
+	var output interface{} = map[string]interface{}{}
+	if m.KeepInput {
+		output = input
+	}
+
+	// Values are all looked up before anything is changed
+	values := make([]interface{}, len(m.fields))
+	found := make([]bool, len(m.fields))
+	for i, field := range m.fields {
+		if field.expression != nil {
+			var err error
+			if values[i], found[i], err = m.lookup(field, input, contextData, metaData); err != nil {
+				return nil, err
+			}
+		} else {
+			values[i], found[i] = field.target.Get(output)
+		}
+		if !found[i] && field.def != nil {
+			values[i], found[i] = field.def, true
+		}
+	}
+
+	var err error
+	for i, field := range m.fields {
+		if !found[i] {
+			continue
+		}
+		if output, err = field.target.Set(output, values[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, rename := range m.rename {
+		value, found := rename.from.Get(output)
+		if !found {
+			continue
+		}
+		rename.from.Delete(output)
+		if output, err = rename.to.Set(output, value); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, remove := range m.remove {
+		remove.Delete(output)
+	}
+
+	return output, nil
+}
+
+// decodeMappingInput decodes a body for a mapping. Numbers become float64 so expressions can compare
+// and add them, integers a float64 can't hold exactly are kept as they were sent so they survive the
+// round trip. An empty body has no input.
+func decodeMappingInput(input apidef.RequestInputType, body []byte) (interface{}, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+
+	if input == apidef.RequestXML {
+		mxj.XmlCharsetReader = WrappedCharsetReader
+		xmlData, err := mxj.NewMapXml(body)
+		return map[string]interface{}(xmlData), err
+	}
+
+	var bodyData interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	err := decoder.Decode(&bodyData)
+
+	return mappingNumbers(bodyData), err
+}
+
+// maxExactFloatInt is the largest integer from which every smaller one fits in a float64
+const maxExactFloatInt = 1 << 53
+
+func mappingNumbers(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case json.Number:
+		if asInt, err := typed.Int64(); err == nil {
+			if asInt > maxExactFloatInt || asInt < -maxExactFloatInt {
+				return typed
+			}
+			return float64(asInt)
+		}
+		if asFloat, err := typed.Float64(); err == nil {
+			return asFloat
+		}
+		return typed
+	case map[string]interface{}:
+		for k, v := range typed {
+			typed[k] = mappingNumbers(v)
+		}
+	case []interface{}:
+		for i, v := range typed {
+			typed[i] = mappingNumbers(v)
+		}
+	}
+
+	return value
+}
+
+// applyJSONMapping transforms a body with a mapping and returns the encoded result
+func applyJSONMapping(mapping *JSONMappingSpec, input apidef.RequestInputType, body []byte, contextData, metaData interface{}) ([]byte, error) {
+	bodyData, err := decodeMappingInput(input, body)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := mapping.Apply(bodyData, contextData, metaData)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(output)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+func TestJSONPath(t *testing.T) {
+	doc, _ := decodeMappingInput(apidef.RequestJSON, []byte(`{"items": [{"id": 1, "tags": ["a"]}, {"id": 2}], "odd key": null}`))
+
+	cases := []struct {
+		expr     string
+		expected string
+		found    bool
+	}{
+		{"$.items[0].id", "1", true},
+		{"items[-1].id", "2", true},
+		{"items[*].id", "[1,2]", true},
+		{"$['odd key']", "null", true},
+		{"items[0].missing", "", false},
+		{"items[5]", "", false},
+	}
+	for _, c := range cases {
+		path, err := ParseJSONPath(c.expr)
+		if err != nil {
+			t.Fatal(c.expr, err)
+		}
+		value, found := path.Get(doc)
+		if found != c.found {
+			t.Errorf("%s should be found: %v", c.expr, c.found)
+			continue
+		}
+		if found {
+			if got, _ := json.Marshal(value); string(got) != c.expected {
+				t.Errorf("%s should give %s, got: %s", c.expr, c.expected, got)
+			}
+		}
+	}
+
+	if _, err := ParseJSONPath("items[x]"); err == nil {
+		t.Error("Invalid indexes should be rejected")
+	}
+}
+
+func TestJSONMapping(t *testing.T) {
+	mapping, err := CompileJSONMapping(apidef.JSONMapping{
+		KeepInput: true,
+		Fields: []apidef.JSONMappingField{
+			{Target: "customer.id", Expression: "$.user.id"},
+			{Target: "customer.region", Expression: "_tyk_meta.region"},
+			{Target: "request_path", Expression: "_tyk_context.path"},
+			{Target: "currency", Default: "EUR"},
+			{Target: "status", Expression: "state", Default: "new"},
+			{Target: "internal_skus", Expression: "lines[?internal].sku"},
+			{Target: "line_count", Expression: "length(lines)"},
+		},
+		Rename: []apidef.JSONMappingRename{{From: "lines", To: "items"}},
+		Remove: []string{"user", "items[*].internal"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte(`{"user": {"id": 12345678901234567}, "currency": "USD", "note": null, "lines": [{"sku": "a", "internal": true}]}`)
+	contextData := map[string]interface{}{"path": "/orders"}
+	metaData := map[string]interface{}{"region": "eu"}
+
+	mapped, err := applyJSONMapping(mapping, apidef.RequestJSON, body, contextData, metaData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"currency":"USD","customer":{"id":12345678901234567,"region":"eu"},"internal_skus":["a"],"items":[{"sku":"a"}],"line_count":1,"note":null,"request_path":"/orders","status":"new"}`
+	if string(mapped) != expected {
+		t.Error("Mapping output is wrong, got: ", string(mapped))
+	}
+
+	if _, err := CompileJSONMapping(apidef.JSONMapping{Remove: []string{"items[0]"}}); err == nil {
+		t.Error("Only fields should be removable")
+	}
+	if _, err := CompileJSONMapping(apidef.JSONMapping{Fields: []apidef.JSONMappingField{{Target: "id", Expression: "lines[?"}}}); err == nil {
+		t.Error("Invalid expressions should be rejected")
+	}
+}
+
+var jsonMappingDefinition = `
+	{
+		"name": "Tyk Test API",
+		"api_id": "1",
+		"org_id": "default",
+		"definition": {
+			"location": "header",
+			"key": "version"
+		},
+		"auth": {
+			"auth_header_name": "authorization"
+		},
+		"version_data": {
+			"not_versioned": true,
+			"versions": {
+				"Default": {
+					"name": "Default",
+					"use_extended_paths": true,
+					"extended_paths": {
+						"transform": [{
+							"path": "/orders",
+							"method": "POST",
+							"template_data": {
+								"input_type": "json",
+								"template_mode": "mapping",
+								"mapping": {"fields": [{"target": "id", "expression": "order.id"}]}
+							}
+						}],
+						"transform_response": [{
+							"path": "/orders",
+							"method": "POST",
+							"template_data": {
+								"input_type": "json",
+								"template_mode": "mapping",
+								"mapping": {"fields": [{"target": "id", "expression": "order.id"}]}
+							}
+						}]
+					}
+				}
+			}
+		},
+		"proxy": {
+			"listen_path": "/",
+			"target_url": "http://example.com",
+			"strip_listen_path": false
+		}
+	}
+`
+
+func TestJSONMappingFailure(t *testing.T) {
+	spec := createDefinitionFromString(jsonMappingDefinition)
+
+	req, _ := http.NewRequest("POST", "/orders", strings.NewReader(`{"order": `))
+	mw := &TransformMiddleware{&TykMiddleware{spec, nil}}
+	if err, code := mw.ProcessRequest(httptest.NewRecorder(), req, nil); err == nil || code != 400 {
+		t.Error("Request bodies that can't be mapped should be rejected, got: ", code, err)
+	}
+
+	transform, _ := ResponseTransformMiddleware{}.New(nil, spec)
+	req, _ = http.NewRequest("POST", "/orders", nil)
+	res := &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("<order/>"))),
+	}
+	transform.HandleResponse(httptest.NewRecorder(), res, req, nil)
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != 502 || strings.Contains(string(body), "order") {
+		t.Error("Upstream bodies that can't be mapped should not reach the client, got: ", res.StatusCode, string(body))
+	}
+
+	res = &http.Response{
+		StatusCode: 204,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+	}
+	transform.HandleResponse(httptest.NewRecorder(), res, req, nil)
+	body, _ = ioutil.ReadAll(res.Body)
+	if res.StatusCode != 204 || len(body) > 0 || res.Header.Get("Content-Length") != "" {
+		t.Error("Responses without a body should not be mapped, got: ", res.StatusCode, string(body))
+	}
+}
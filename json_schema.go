@@ -0,0 +1,614 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const maxJSONSchemaRefDepth = 32
+
+var jsonSchemaFormats = map[string]func(string) bool{
+	"date-time": func(s string) bool {
+		_, err := time.Parse(time.RFC3339, s)
+		return err == nil
+	},
+	"date": func(s string) bool {
+		_, err := time.Parse("2006-01-02", s)
+		return err == nil
+	},
+	"email": func(s string) bool {
+		at := strings.LastIndex(s, "@")
+		return at > 0 && at < len(s)-1 && !strings.ContainsAny(s, " \t\r\n")
+	},
+	"ipv4": func(s string) bool {
+		ip := net.ParseIP(s)
+		return ip != nil && ip.To4() != nil && strings.Contains(s, ".")
+	},
+	"ipv6": func(s string) bool {
+		ip := net.ParseIP(s)
+		return ip != nil && strings.Contains(s, ":")
+	},
+	"uri": func(s string) bool {
+		parsed, err := url.Parse(s)
+		return err == nil && parsed.Scheme != ""
+	},
+	"uuid": regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`).MatchString,
+}
+
+// JSONSchemaError describes a single validation failure, Pointer is a JSON pointer (RFC 6901)
+// to the offending value in the document
+type JSONSchemaError struct {
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+// JSONSchema is a compiled JSON schema (draft-07), patterns are compiled up front so that
+// validating a request does not need to parse anything
+type JSONSchema struct {
+	root     interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+// CompileJSONSchema checks that a schema can be used and precompiles its patterns
+func CompileJSONSchema(schema map[string]interface{}) (*JSONSchema, error) {
+	if schema == nil {
+		return nil, errors.New("schema is empty")
+	}
+
+	compiled := &JSONSchema{root: schema, patterns: make(map[string]*regexp.Regexp)}
+	if err := compiled.compilePatterns(schema); err != nil {
+		return nil, err
+	}
+
+	return compiled, nil
+}
+
+func (s *JSONSchema) compilePatterns(node interface{}) error {
+	switch typed := node.(type) {
+	case map[string]interface{}:
+		if pattern, isString := typed["pattern"].(string); isString {
+			if err := s.addPattern(pattern); err != nil {
+				return err
+			}
+		}
+		if patternProperties, isMap := typed["patternProperties"].(map[string]interface{}); isMap {
+			for pattern := range patternProperties {
+				if err := s.addPattern(pattern); err != nil {
+					return err
+				}
+			}
+		}
+		for key, child := range typed {
+			// Enum and const values are data, not schemas
+			if key == "enum" || key == "const" || key == "default" || key == "example" || key == "examples" {
+				continue
+			}
+			if err := s.compilePatterns(child); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, child := range typed {
+			if err := s.compilePatterns(child); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *JSONSchema) addPattern(pattern string) error {
+	if _, found := s.patterns[pattern]; found {
+		return nil
+	}
+
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	s.patterns[pattern] = compiled
+	return nil
+}
+
+// Validate checks a decoded JSON document against the schema, all failures are returned
+func (s *JSONSchema) Validate(document interface{}) []JSONSchemaError {
+	return s.validate(s.root, document, "", 0)
+}
+
+// ValidateBytes decodes and validates a JSON document, numbers are kept exact so that
+// integer checks are not affected by float rounding
+func (s *JSONSchema) ValidateBytes(body []byte) []JSONSchemaError {
+	decoder := json.NewDecoder(strings.NewReader(string(body)))
+	decoder.UseNumber()
+
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return []JSONSchemaError{{Pointer: "", Message: "Request body is not valid JSON: " + err.Error()}}
+	}
+	if decoder.More() {
+		return []JSONSchemaError{{Pointer: "", Message: "Request body contains more than one JSON document"}}
+	}
+
+	return s.Validate(document)
+}
+
+func (s *JSONSchema) resolveRef(ref string) (interface{}, bool) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, false
+	}
+
+	node := s.root
+	if ref == "#" || ref == "#/" {
+		return node, true
+	}
+
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		if unescaped, err := url.PathUnescape(token); err == nil {
+			token = unescaped
+		}
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+
+		asMap, isMap := node.(map[string]interface{})
+		if !isMap {
+			return nil, false
+		}
+		if node, isMap = asMap[token]; !isMap {
+			return nil, false
+		}
+	}
+
+	return node, true
+}
+
+func jsonPointerJoin(pointer string, token string) string {
+	token = strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+	return pointer + "/" + token
+}
+
+func jsonSchemaType(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := typed.Int64(); err == nil {
+			return "integer"
+		}
+		if f, err := typed.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	case float64:
+		if typed == math.Trunc(typed) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	return "unknown"
+}
+
+func jsonSchemaNumber(value interface{}) (float64, bool) {
+	switch typed := value.(type) {
+	case json.Number:
+		f, err := typed.Float64()
+		return f, err == nil
+	case float64:
+		return typed, true
+	case int:
+		return float64(typed), true
+	case int64:
+		return float64(typed), true
+	}
+
+	return 0, false
+}
+
+// jsonSchemaEqual compares two JSON values, numbers are compared by value regardless of
+// how they were decoded
+func jsonSchemaEqual(a, b interface{}) bool {
+	if an, isNumber := jsonSchemaNumber(a); isNumber {
+		bn, isNumber := jsonSchemaNumber(b)
+		return isNumber && an == bn
+	}
+
+	switch typedA := a.(type) {
+	case []interface{}:
+		typedB, isList := b.([]interface{})
+		if !isList || len(typedA) != len(typedB) {
+			return false
+		}
+		for i := range typedA {
+			if !jsonSchemaEqual(typedA[i], typedB[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		typedB, isMap := b.(map[string]interface{})
+		if !isMap || len(typedA) != len(typedB) {
+			return false
+		}
+		for k, v := range typedA {
+			other, found := typedB[k]
+			if !found || !jsonSchemaEqual(v, other) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func (s *JSONSchema) matches(schema interface{}, value interface{}, depth int) bool {
+	return len(s.validate(schema, value, "", depth)) == 0
+}
+
+func (s *JSONSchema) validate(node interface{}, value interface{}, pointer string, depth int) []JSONSchemaError {
+	if depth > maxJSONSchemaRefDepth {
+		// Self-referencing schemas can't be followed forever, values we can't check are rejected
+		return []JSONSchemaError{{pointer, "Schema nesting too deep"}}
+	}
+
+	switch typed := node.(type) {
+	case bool:
+		if !typed {
+			return []JSONSchemaError{{pointer, "No value is allowed here"}}
+		}
+		return nil
+	case map[string]interface{}:
+	default:
+		return nil
+	}
+	schema := node.(map[string]interface{})
+
+	// As in draft-07, a reference overrides any sibling keywords
+	if ref, isString := schema["$ref"].(string); isString {
+		target, found := s.resolveRef(ref)
+		if !found {
+			log.Debug("Unresolvable schema reference, value accepted: ", ref)
+			return nil
+		}
+		return s.validate(target, value, pointer, depth+1)
+	}
+
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable {
+			return nil
+		}
+	}
+
+	errs := []JSONSchemaError{}
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, JSONSchemaError{pointer, fmt.Sprintf(format, args...)})
+	}
+
+	valueType := jsonSchemaType(value)
+	if expected, found := schema["type"]; found {
+		allowed := []string{}
+		switch typed := expected.(type) {
+		case string:
+			allowed = append(allowed, typed)
+		case []interface{}:
+			for _, t := range typed {
+				if asString, isString := t.(string); isString {
+					allowed = append(allowed, asString)
+				}
+			}
+		}
+
+		matched := false
+		for _, t := range allowed {
+			if t == valueType || (t == "number" && valueType == "integer") {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("Expected %s but got %s", strings.Join(allowed, " or "), valueType)
+			return errs
+		}
+	}
+
+	if enum, isList := schema["enum"].([]interface{}); isList {
+		found := false
+		for _, option := range enum {
+			if jsonSchemaEqual(option, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("Value is not one of the allowed values")
+		}
+	}
+
+	if constant, found := schema["const"]; found && !jsonSchemaEqual(constant, value) {
+		fail("Value must be %v", constant)
+	}
+
+	// Nested errors are collected separately as fail appends to errs
+	var nested []JSONSchemaError
+	switch valueType {
+	case "integer", "number":
+		s.validateNumber(schema, value, fail)
+	case "string":
+		s.validateString(schema, value.(string), fail)
+	case "array":
+		nested = s.validateArray(schema, value.([]interface{}), pointer, depth, fail)
+	case "object":
+		nested = s.validateObject(schema, value.(map[string]interface{}), pointer, depth, fail)
+	}
+	errs = append(errs, nested...)
+
+	if parts, isList := schema["allOf"].([]interface{}); isList {
+		for _, part := range parts {
+			errs = append(errs, s.validate(part, value, pointer, depth+1)...)
+		}
+	}
+
+	if options, isList := schema["anyOf"].([]interface{}); isList {
+		matched := false
+		for _, option := range options {
+			if s.matches(option, value, depth+1) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("Value does not match any of the allowed schemas")
+		}
+	}
+
+	if options, isList := schema["oneOf"].([]interface{}); isList {
+		matched := 0
+		for _, option := range options {
+			if s.matches(option, value, depth+1) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			fail("Value must match exactly one schema, matched %d", matched)
+		}
+	}
+
+	if not, found := schema["not"]; found && s.matches(not, value, depth+1) {
+		fail("Value must not match the schema")
+	}
+
+	if condition, found := schema["if"]; found {
+		if s.matches(condition, value, depth+1) {
+			if then, found := schema["then"]; found {
+				errs = append(errs, s.validate(then, value, pointer, depth+1)...)
+			}
+		} else if otherwise, found := schema["else"]; found {
+			errs = append(errs, s.validate(otherwise, value, pointer, depth+1)...)
+		}
+	}
+
+	return errs
+}
+
+// exclusiveBound handles both the draft-04 (boolean) and draft-06+ (number) forms
+func exclusiveBound(schema map[string]interface{}, keyword string, inclusive string) (float64, bool) {
+	if bound, isNumber := jsonSchemaNumber(schema[keyword]); isNumber {
+		return bound, true
+	}
+	if exclusive, _ := schema[keyword].(bool); exclusive {
+		return jsonSchemaNumber(schema[inclusive])
+	}
+
+	return 0, false
+}
+
+func (s *JSONSchema) validateNumber(schema map[string]interface{}, value interface{}, fail func(string, ...interface{})) {
+	number, _ := jsonSchemaNumber(value)
+
+	_, exclusiveMinFlag := schema["exclusiveMinimum"].(bool)
+	_, exclusiveMaxFlag := schema["exclusiveMaximum"].(bool)
+
+	if minimum, isNumber := jsonSchemaNumber(schema["minimum"]); isNumber && !exclusiveMinFlag && number < minimum {
+		fail("Value must be at least %v", minimum)
+	}
+	if maximum, isNumber := jsonSchemaNumber(schema["maximum"]); isNumber && !exclusiveMaxFlag && number > maximum {
+		fail("Value must be at most %v", maximum)
+	}
+	if minimum, isSet := exclusiveBound(schema, "exclusiveMinimum", "minimum"); isSet && number <= minimum {
+		fail("Value must be greater than %v", minimum)
+	}
+	if maximum, isSet := exclusiveBound(schema, "exclusiveMaximum", "maximum"); isSet && number >= maximum {
+		fail("Value must be less than %v", maximum)
+	}
+
+	if multipleOf, isNumber := jsonSchemaNumber(schema["multipleOf"]); isNumber && multipleOf > 0 {
+		quotient := number / multipleOf
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			fail("Value must be a multiple of %v", multipleOf)
+		}
+	}
+}
+
+func (s *JSONSchema) validateString(schema map[string]interface{}, value string, fail func(string, ...interface{})) {
+	length := float64(utf8.RuneCountInString(value))
+
+	if minLength, isNumber := jsonSchemaNumber(schema["minLength"]); isNumber && length < minLength {
+		fail("String must be at least %v characters long", minLength)
+	}
+	if maxLength, isNumber := jsonSchemaNumber(schema["maxLength"]); isNumber && length > maxLength {
+		fail("String must be at most %v characters long", maxLength)
+	}
+
+	if pattern, isString := schema["pattern"].(string); isString {
+		if compiled := s.patterns[pattern]; compiled != nil && !compiled.MatchString(value) {
+			fail("String does not match the pattern %s", pattern)
+		}
+	}
+
+	// Unknown formats are annotations only
+	if format, isString := schema["format"].(string); isString {
+		if check, known := jsonSchemaFormats[format]; known && !check(value) {
+			fail("String is not a valid %s", format)
+		}
+	}
+}
+
+func (s *JSONSchema) validateArray(schema map[string]interface{}, value []interface{}, pointer string, depth int, fail func(string, ...interface{})) []JSONSchemaError {
+	errs := []JSONSchemaError{}
+	length := float64(len(value))
+
+	if minItems, isNumber := jsonSchemaNumber(schema["minItems"]); isNumber && length < minItems {
+		fail("Array must have at least %v items", minItems)
+	}
+	if maxItems, isNumber := jsonSchemaNumber(schema["maxItems"]); isNumber && length > maxItems {
+		fail("Array must have at most %v items", maxItems)
+	}
+
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+	uniqueLoop:
+		for i := range value {
+			for j := i + 1; j < len(value); j++ {
+				if jsonSchemaEqual(value[i], value[j]) {
+					fail("Array items must be unique, items %d and %d are equal", i, j)
+					break uniqueLoop
+				}
+			}
+		}
+	}
+
+	switch items := schema["items"].(type) {
+	case []interface{}:
+		// Tuple validation, anything past the tuple is checked by additionalItems
+		for i, item := range value {
+			itemPointer := jsonPointerJoin(pointer, strconv.Itoa(i))
+			if i < len(items) {
+				errs = append(errs, s.validate(items[i], item, itemPointer, depth+1)...)
+			} else if additional, found := schema["additionalItems"]; found {
+				errs = append(errs, s.validate(additional, item, itemPointer, depth+1)...)
+			}
+		}
+	case nil:
+	default:
+		for i, item := range value {
+			errs = append(errs, s.validate(items, item, jsonPointerJoin(pointer, strconv.Itoa(i)), depth+1)...)
+		}
+	}
+
+	if contains, found := schema["contains"]; found {
+		matched := false
+		for _, item := range value {
+			if s.matches(contains, item, depth+1) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("Array does not contain a matching item")
+		}
+	}
+
+	return errs
+}
+
+func (s *JSONSchema) validateObject(schema map[string]interface{}, value map[string]interface{}, pointer string, depth int, fail func(string, ...interface{})) []JSONSchemaError {
+	errs := []JSONSchemaError{}
+	count := float64(len(value))
+
+	if minProperties, isNumber := jsonSchemaNumber(schema["minProperties"]); isNumber && count < minProperties {
+		fail("Object must have at least %v properties", minProperties)
+	}
+	if maxProperties, isNumber := jsonSchemaNumber(schema["maxProperties"]); isNumber && count > maxProperties {
+		fail("Object must have at most %v properties", maxProperties)
+	}
+
+	if required, isList := schema["required"].([]interface{}); isList {
+		for _, name := range required {
+			if asString, isString := name.(string); isString {
+				if _, found := value[asString]; !found {
+					errs = append(errs, JSONSchemaError{jsonPointerJoin(pointer, asString), "Property is required"})
+				}
+			}
+		}
+	}
+
+	// Iterate in a stable order so that error lists are deterministic
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	patternProperties, _ := schema["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := schema["additionalProperties"]
+	propertyNames, hasPropertyNames := schema["propertyNames"]
+
+	for _, name := range names {
+		propertyPointer := jsonPointerJoin(pointer, name)
+		matched := false
+
+		if propertySchema, found := properties[name]; found {
+			matched = true
+			errs = append(errs, s.validate(propertySchema, value[name], propertyPointer, depth+1)...)
+		}
+
+		for pattern, patternSchema := range patternProperties {
+			if compiled := s.patterns[pattern]; compiled != nil && compiled.MatchString(name) {
+				matched = true
+				errs = append(errs, s.validate(patternSchema, value[name], propertyPointer, depth+1)...)
+			}
+		}
+
+		if !matched && hasAdditional {
+			if allowed, isBool := additional.(bool); isBool && !allowed {
+				errs = append(errs, JSONSchemaError{propertyPointer, "Additional properties are not allowed"})
+			} else {
+				errs = append(errs, s.validate(additional, value[name], propertyPointer, depth+1)...)
+			}
+		}
+
+		if hasPropertyNames && !s.matches(propertyNames, name, depth+1) {
+			errs = append(errs, JSONSchemaError{propertyPointer, "Property name is not allowed"})
+		}
+	}
+
+	if dependencies, isMap := schema["dependencies"].(map[string]interface{}); isMap {
+		for name, dependency := range dependencies {
+			if _, found := value[name]; !found {
+				continue
+			}
+			if requiredNames, isList := dependency.([]interface{}); isList {
+				for _, required := range requiredNames {
+					if asString, isString := required.(string); isString {
+						if _, found := value[asString]; !found {
+							errs = append(errs, JSONSchemaError{jsonPointerJoin(pointer, asString), fmt.Sprintf("Property is required when %s is present", name)})
+						}
+					}
+				}
+			} else {
+				errs = append(errs, s.validate(dependency, value, pointer, depth+1)...)
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pmylund/go-cache"
+)
+
+const defaultKeyRotationOverlap int64 = 3600
+
+// GraceEventCache remembers the keys that have had their grace period event fired, so it is
+// fired once per key rather than on every request made during the grace period
+var GraceEventCache = cache.New(10*time.Minute, 10*time.Minute)
+
+// IsNotYetActive returns true if the key has a scheduled activation time that hasn't been reached yet
+func (s *SessionState) IsNotYetActive(now time.Time) bool {
+	return s.ActivatesAt > 0 && now.Unix() < s.ActivatesAt
+}
+
+// expiryGracePeriod is the number of seconds an expired key keeps working for, a negative
+// value on the session disables the global default
+func (s *SessionState) expiryGracePeriod() int64 {
+	if s.ExpiryGracePeriod != 0 {
+		return s.ExpiryGracePeriod
+	}
+
+	return config.KeyLifecycle.ExpiryGracePeriod
+}
+
+// GraceEnds returns the epoch at which an expired key stops working, or 0 if the key
+// has no grace period
+func (s *SessionState) GraceEnds() int64 {
+	grace := s.expiryGracePeriod()
+	if s.Expires < 1 || grace <= 0 {
+		return 0
+	}
+
+	return s.Expires + grace
+}
+
+// InExpiryGracePeriod returns true if the key has expired but is still inside its grace period
+func (s *SessionState) InExpiryGracePeriod(now time.Time) bool {
+	graceEnds := s.GraceEnds()
+	return graceEnds > 0 && now.Unix() < graceEnds
+}
+
+// firstUseInGracePeriod returns true the first time an expired key is seen during its grace
+// period, the entry is kept until the grace period ends
+func firstUseInGracePeriod(key string, session *SessionState, now time.Time) bool {
+	remaining := time.Duration(session.GraceEnds()-now.Unix()) * time.Second
+	return GraceEventCache.Add(publicHash(key)+"-"+strconv.FormatInt(session.Expires, 10), true, remaining) == nil
+}
+
+func keyRotationOverlap() int64 {
+	if config.KeyLifecycle.RotationOverlap > 0 {
+		return config.KeyLifecycle.RotationOverlap
+	}
+
+	return defaultKeyRotationOverlap
+}
+
+// rotateSession prepares the session of a key that is being replaced, the old key keeps
+// working until the overlap window ends and gets no grace period afterwards
+func rotateSession(oldSession SessionState, overlap int64, now time.Time) SessionState {
+	retireAt := now.Unix() + overlap
+	if oldSession.Expires < 1 || oldSession.Expires > retireAt {
+		oldSession.Expires = retireAt
+	}
+
+	oldSession.RotatedAt = now.Unix()
+	oldSession.ExpiryGracePeriod = -1
+
+	return oldSession
+}
+
+// copyQuotaState carries the quota used by a key over to its successor so rotating a key doesn't
+// hand out a fresh quota, the counter expires when the current quota period ends
+func copyQuotaState(store StorageHandler, oldKey string, newKey string, session SessionState, now time.Time) {
+	if session.QuotaMax == -1 {
+		return
+	}
+
+	used, err := store.GetRawKey(QuotaKeyPrefix + publicHash(oldKey))
+	if err != nil {
+		// Nothing has been used in this quota period
+		return
+	}
+
+	if ttl := session.QuotaRenews - now.Unix(); ttl > 0 {
+		store.SetRawKey(QuotaKeyPrefix+publicHash(newKey), used, ttl)
+	}
+}
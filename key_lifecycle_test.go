@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyActivationAndGracePeriod(t *testing.T) {
+	now := time.Now()
+	session := SessionState{ActivatesAt: now.Unix() + 60}
+
+	if !session.IsNotYetActive(now) {
+		t.Error("Key should not be active before its activation time")
+	}
+
+	if session.IsNotYetActive(now.Add(2 * time.Minute)) {
+		t.Error("Key should be active after its activation time")
+	}
+
+	session = SessionState{Expires: now.Unix() - 10, ExpiryGracePeriod: 60}
+	if !session.InExpiryGracePeriod(now) {
+		t.Error("Expired key should be inside its grace period")
+	}
+
+	if session.InExpiryGracePeriod(now.Add(time.Minute)) {
+		t.Error("Grace period should have ended")
+	}
+
+	config.KeyLifecycle.ExpiryGracePeriod = 60
+	defer func() { config.KeyLifecycle.ExpiryGracePeriod = 0 }()
+
+	session = SessionState{Expires: now.Unix() - 10, ExpiryGracePeriod: -1}
+	if session.InExpiryGracePeriod(now) {
+		t.Error("A negative grace period should disable the global default")
+	}
+
+	session.ExpiryGracePeriod = 0
+	if !session.InExpiryGracePeriod(now) {
+		t.Error("The global grace period should apply")
+	}
+}
+
+func TestRotateSession(t *testing.T) {
+	now := time.Now()
+
+	retiring := rotateSession(SessionState{}, 300, now)
+	if retiring.Expires != now.Unix()+300 || retiring.RotatedAt != now.Unix() {
+		t.Error("Rotated key should expire at the end of the overlap window, got: ", retiring.Expires)
+	}
+
+	if retiring.GraceEnds() != 0 {
+		t.Error("Rotated keys should not get a grace period")
+	}
+
+	// A key that expires before the overlap ends keeps its own expiry
+	retiring = rotateSession(SessionState{Expires: now.Unix() + 10}, 300, now)
+	if retiring.Expires != now.Unix()+10 {
+		t.Error("Earlier expiry should be kept, got: ", retiring.Expires)
+	}
+}
+
+func TestGracePeriodEventOnce(t *testing.T) {
+	now := time.Now()
+	session := SessionState{Expires: now.Unix() - 10, ExpiryGracePeriod: 60}
+
+	if !firstUseInGracePeriod("grace-key", &session, now) {
+		t.Error("The first use during the grace period should fire the event")
+	}
+	if firstUseInGracePeriod("grace-key", &session, now) {
+		t.Error("Later uses during the grace period shouldn't fire the event again")
+	}
+	if !firstUseInGracePeriod("other-grace-key", &session, now) {
+		t.Error("The event should be fired for each key")
+	}
+}
+
+func TestCopyQuotaState(t *testing.T) {
+	now := time.Now()
+	store := &InMemoryStorageManager{Sessions: make(map[string]string)}
+	session := SessionState{QuotaMax: 100, QuotaRenews: now.Unix() + 60}
+
+	store.SetRawKey(QuotaKeyPrefix+publicHash("old-key"), "42", 60)
+	copyQuotaState(store, "old-key", "new-key", session, now)
+	if used, _ := store.GetRawKey(QuotaKeyPrefix + publicHash("new-key")); used != "42" {
+		t.Error("The successor should take over the quota used so far, got: ", used)
+	}
+
+	session.QuotaMax = -1
+	copyQuotaState(store, "old-key", "unlimited-key", session, now)
+	if _, err := store.GetRawKey(QuotaKeyPrefix + publicHash("unlimited-key")); err == nil {
+		t.Error("Unlimited keys have no quota to copy")
+	}
+}
@@ -24,7 +24,7 @@ import (
 	"github.com/TykTechnologies/logrus-logstash-hook"
 	logrus_syslog "github.com/TykTechnologies/logrus/hooks/syslog"
 	"github.com/TykTechnologies/logrus_sentry"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 	logger "github.com/TykTechnologies/tykcommon-logger"
 	"github.com/docopt/docopt.go"
 	"github.com/facebookgo/pidfile"
@@ -140,7 +140,7 @@ func setupGlobals() {
 
 	// Load all the files that have the "error" prefix.
 	templatesDir := filepath.Join(config.TemplatePath, "error*")
-	templates = template.Must(template.ParseGlob(templatesDir))
+	templates = template.Must(template.New("errors").Funcs(errorPageFuncs).ParseGlob(templatesDir))
 
 	// Set up global JSVM
 	if config.EnableJSVM {
@@ -281,6 +281,18 @@ func getPolicies() {
 			"prefix": "main",
 		}).Debug("Using Policies from RPC")
 		thesePolicies = LoadPoliciesFromRPC(config.SlaveOptions.RPCKey)
+	} else if config.Policies.PolicySource == "redis" {
+		log.WithFields(logrus.Fields{
+			"prefix": "main",
+		}).Debug("Using Policies from Redis")
+		loaded, err := readPoliciesFromRedis()
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": "main",
+			}).Error("Couldn't load policies from redis, keeping the current set: ", err)
+			return
+		}
+		thesePolicies = loaded
 	} else {
 		// this is the only case now where we need a policy record name
 		if config.Policies.PolicyRecordName == "" {
@@ -289,15 +301,27 @@ func getPolicies() {
 			}).Debug("No policy record name defined, skipping...")
 			return
 		}
-		thesePolicies = LoadPoliciesFromFile(config.Policies.PolicyRecordName)
+		loaded, err := readPolicyFile(config.Policies.PolicyRecordName)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": "main",
+			}).Error("Couldn't load policy file, keeping the current set: ", err)
+			return
+		}
+		thesePolicies = loaded
 	}
 
-	if len(thesePolicies) > 0 {
-		policiesMu.Lock()
-		policiesByID = thesePolicies
-		policiesMu.Unlock()
+	// The dashboard and RPC loaders return an empty set when they fail, so only trust an empty
+	// set from the sources that report errors; deleting the last policy must still take effect
+	isRemote := config.Policies.PolicySource == "service" || config.Policies.PolicySource == "rpc"
+	if isRemote && len(thesePolicies) == 0 {
 		return
 	}
+
+	policiesMu.Lock()
+	policiesByID = thesePolicies
+	flushMergedPolicies()
+	policiesMu.Unlock()
 }
 
 // Set up default Tyk control API endpoints - these are global, so need to be added first
@@ -327,6 +351,10 @@ func loadAPIEndpoints(Muxer *mux.Router) {
 		ApiMuxer.HandleFunc("/tyk/org/keys/"+"{rest:.*}", CheckIsAPIOwner(InstrumentationMW(orgHandler)))
 		ApiMuxer.HandleFunc("/tyk/keys/policy/"+"{rest:.*}", CheckIsAPIOwner(InstrumentationMW(policyUpdateHandler)))
 		ApiMuxer.HandleFunc("/tyk/keys/create", CheckIsAPIOwner(InstrumentationMW(createKeyHandler)))
+		ApiMuxer.HandleFunc("/tyk/keys/rotate/"+"{rest:.*}", CheckIsAPIOwner(InstrumentationMW(rotateKeyHandler)))
+		ApiMuxer.HandleFunc("/tyk/policies", CheckIsAPIOwner(InstrumentationMW(policyHandler)))
+		ApiMuxer.HandleFunc("/tyk/policies/"+"{rest:.*}", CheckIsAPIOwner(InstrumentationMW(policyHandler)))
+		ApiMuxer.HandleFunc("/tyk/quotas/reset/"+"{rest:.*}", CheckIsAPIOwner(InstrumentationMW(quotaResetHandler)))
 		ApiMuxer.HandleFunc("/tyk/apis", CheckIsAPIOwner(InstrumentationMW(apiHandler)))
 		ApiMuxer.HandleFunc("/tyk/apis/"+"{rest:.*}", CheckIsAPIOwner(InstrumentationMW(apiHandler)))
 		ApiMuxer.HandleFunc("/tyk/health/", CheckIsAPIOwner(InstrumentationMW(healthCheckhandler)))
@@ -426,13 +454,13 @@ func addBatchEndpoint(spec *APISpec, Muxer *mux.Router) {
 	Muxer.HandleFunc(apiBatchPath, thisBatchHandler.HandleBatchRequest)
 }
 
-func loadCustomMiddleware(referenceSpec *APISpec) ([]string, tykcommon.MiddlewareDefinition, []tykcommon.MiddlewareDefinition, []tykcommon.MiddlewareDefinition, []tykcommon.MiddlewareDefinition, tykcommon.MiddlewareDriver) {
+func loadCustomMiddleware(referenceSpec *APISpec) ([]string, apidef.MiddlewareDefinition, []apidef.MiddlewareDefinition, []apidef.MiddlewareDefinition, []apidef.MiddlewareDefinition, apidef.MiddlewareDriver) {
 	mwPaths := []string{}
-	var mwAuthCheckFunc tykcommon.MiddlewareDefinition
-	mwPreFuncs := []tykcommon.MiddlewareDefinition{}
-	mwPostFuncs := []tykcommon.MiddlewareDefinition{}
-	mwPostKeyAuthFuncs := []tykcommon.MiddlewareDefinition{}
-	mwDriver := tykcommon.OttoDriver
+	var mwAuthCheckFunc apidef.MiddlewareDefinition
+	mwPreFuncs := []apidef.MiddlewareDefinition{}
+	mwPostFuncs := []apidef.MiddlewareDefinition{}
+	mwPostKeyAuthFuncs := []apidef.MiddlewareDefinition{}
+	mwDriver := apidef.OttoDriver
 
 	// Set AuthCheck hook
 	if referenceSpec.APIDefinition.CustomMiddleware.AuthCheck.Name != "" {
@@ -479,7 +507,7 @@ func loadCustomMiddleware(referenceSpec *APISpec) ([]string, tykcommon.Middlewar
 			log.WithFields(logrus.Fields{
 				"prefix": "main",
 			}).Debug("-- Middleware requires session: ", requiresSession)
-			thisMWDef := tykcommon.MiddlewareDefinition{}
+			thisMWDef := apidef.MiddlewareDefinition{}
 			thisMWDef.Name = middlewareObjectName
 			thisMWDef.Path = filePath
 			thisMWDef.RequireSession = requiresSession
@@ -503,7 +531,7 @@ func loadCustomMiddleware(referenceSpec *APISpec) ([]string, tykcommon.Middlewar
 				"prefix": "main",
 			}).Debug("-- Middleware name ", middlewareObjectName)
 
-			thisMWDef := tykcommon.MiddlewareDefinition{}
+			thisMWDef := apidef.MiddlewareDefinition{}
 			thisMWDef.Name = middlewareObjectName
 			thisMWDef.Path = filePath
 			thisMWDef.RequireSession = false
@@ -533,7 +561,7 @@ func loadCustomMiddleware(referenceSpec *APISpec) ([]string, tykcommon.Middlewar
 			log.WithFields(logrus.Fields{
 				"prefix": "main",
 			}).Debug("-- Middleware requires session: ", requiresSession)
-			thisMWDef := tykcommon.MiddlewareDefinition{}
+			thisMWDef := apidef.MiddlewareDefinition{}
 			thisMWDef.Name = middlewareObjectName
 			thisMWDef.Path = filePath
 			thisMWDef.RequireSession = requiresSession
@@ -561,7 +589,7 @@ func loadCustomMiddleware(referenceSpec *APISpec) ([]string, tykcommon.Middlewar
 			log.WithFields(logrus.Fields{
 				"prefix": "main",
 			}).Debug("-- Middleware requires session: ", requiresSession)
-			thisMWDef := tykcommon.MiddlewareDefinition{}
+			thisMWDef := apidef.MiddlewareDefinition{}
 			thisMWDef.Name = middlewareObjectName
 			thisMWDef.Path = filePath
 			thisMWDef.RequireSession = requiresSession
@@ -585,6 +613,11 @@ func loadCustomMiddleware(referenceSpec *APISpec) ([]string, tykcommon.Middlewar
 		mwPostKeyAuthFuncs = append(mwPostKeyAuthFuncs, mwObj)
 	}
 
+	// The WebSocket message hook is loaded with the rest of the middleware
+	if referenceSpec.APIDefinition.WebSocket.MessageHook.Path != "" {
+		mwPaths = append(mwPaths, referenceSpec.APIDefinition.WebSocket.MessageHook.Path)
+	}
+
 	return mwPaths, mwAuthCheckFunc, mwPreFuncs, mwPostFuncs, mwPostKeyAuthFuncs, mwDriver
 }
 
@@ -996,6 +1029,7 @@ func getCmdArguments() map[string]interface{} {
 		--debug                      Enable Debug output
 		--import-blueprint=<file>    Import an API Blueprint file
 		--import-swagger=<file>      Import a Swagger file
+		--import-openapi=<file>      Import an OpenAPI 3 file (YAML or JSON)
 		--create-api                 Creates a new API Definition from the blueprint
 		--org-id=><id>               Assign the API Defintition to this org_id (required with create)
 		--upstream-target=<url>      Set the upstream target for the definition
@@ -1057,7 +1091,7 @@ func GetGlobalLocalCacheStorageHandler(KeyPrefix string, hashKeys bool) StorageH
 }
 
 func GetGlobalStorageHandler(KeyPrefix string, hashKeys bool) StorageHandler {
-	var Name tykcommon.StorageEngineCode
+	var Name apidef.StorageEngineCode
 	// Select configuration options
 	if config.SlaveOptions.UseRPC {
 		Name = RPCStorageEngine
@@ -1256,6 +1290,7 @@ func generateListener(l net.Listener) (net.Listener, error) {
 			ServerName:         config.HttpServerOptions.ServerName,
 			MinVersion:         config.HttpServerOptions.MinVersion,
 			InsecureSkipVerify: config.HttpServerOptions.SSLInsecureSkipVerify,
+			NextProtos:         serverNextProtos(),
 		}
 		return tls.Listen("tcp", targetPort, &config)
 
@@ -1269,6 +1304,7 @@ func generateListener(l net.Listener) (net.Listener, error) {
 
 		config := tls.Config{
 			GetCertificate: LE_MANAGER.GetCertificate,
+			NextProtos:     serverNextProtos(),
 		}
 		return tls.Listen("tcp", targetPort, &config)
 
@@ -1394,14 +1430,14 @@ func listen(l net.Listener, err error) {
 			}
 
 			// Accept connections in a new goroutine.
-			go s.Serve(l)
+			go serveGateway(l, s)
 			displayConfig()
 		} else {
 			log.WithFields(logrus.Fields{
 				"prefix": "main",
 			}).Printf("Gateway started (%s)", VERSION)
 
-			go http.Serve(l, mainHandler{})
+			go serveGateway(l, &http.Server{Handler: mainHandler{}})
 
 			displayConfig()
 		}
@@ -1456,7 +1492,7 @@ func listen(l net.Listener, err error) {
 			log.WithFields(logrus.Fields{
 				"prefix": "main",
 			}).Info("Custom gateway started")
-			go s.Serve(l)
+			go serveGateway(l, s)
 			displayConfig()
 		} else {
 			log.WithFields(logrus.Fields{
@@ -1464,7 +1500,7 @@ func listen(l net.Listener, err error) {
 			}).Printf("Gateway resumed (%v)", VERSION)
 			displayConfig()
 
-			go http.Serve(l, mainHandler{})
+			go serveGateway(l, &http.Server{Handler: mainHandler{}})
 		}
 
 		log.WithFields(logrus.Fields{
@@ -20,6 +20,12 @@ type TykMiddlewareImplementation interface {
 	GetName() string
 }
 
+// TykMiddlewareFinaliser can be implemented by middleware that needs to clean up once
+// the rest of the chain has served a request it let through
+type TykMiddlewareFinaliser interface {
+	Finalise(r *http.Request)
+}
+
 func CreateDynamicMiddleware(MiddlewareName string, IsPre, UseSession bool, tykMwSuper *TykMiddleware) func(http.Handler) http.Handler {
 	dMiddleware := &DynamicMiddleware{
 		TykMiddleware:       tykMwSuper,
@@ -76,13 +82,17 @@ func CreateMiddleware(mw TykMiddlewareImplementation, tykMwSuper *TykMiddleware)
 				reqErr, errCode := mw.ProcessRequest(w, r, thisMwConfiguration)
 				if reqErr != nil {
 					handler := ErrorHandler{tykMwSuper}
-					handler.HandleError(w, r, reqErr.Error(), errCode)
+					handler.HandleTypedError(w, r, errorTypeFor(mw.GetName(), reqErr, errCode), reqErr.Error(), errCode, errorDetailsFor(reqErr))
 					meta["error"] = reqErr.Error()
 					job.TimingKv("exec_time", time.Since(startTime).Nanoseconds(), meta)
 					job.TimingKv(eventName+".exec_time", time.Since(startTime).Nanoseconds(), meta)
 					return
 				}
 
+				if finaliser, ok := mw.(TykMiddlewareFinaliser); ok {
+					defer finaliser.Finalise(r)
+				}
+
 				// Special code, stops execution
 				if errCode == 1666 {
 					// Stop
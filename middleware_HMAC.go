@@ -13,7 +13,7 @@ import (
 	"time"
 
 	"github.com/TykTechnologies/logrus"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/gorilla/context"
 )
 
@@ -60,9 +60,10 @@ func (hm *HMACMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request,
 	fieldValues, fErr := getFieldValues(authHeaderValue)
 	if fErr != nil {
 		log.WithFields(logrus.Fields{
-			"prefix": "hmac",
-			"error":  fErr,
-			"header": authHeaderValue,
+			"prefix":     "hmac",
+			"error":      fErr,
+			"header":     authHeaderValue,
+			"request_id": requestID(r),
 		}).Error("Field extraction failed")
 		return hm.authorizationError(w, r)
 	}
@@ -74,6 +75,7 @@ func (hm *HMACMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request,
 			"prefix":           "hmac",
 			"error":            fErr,
 			"signature_string": signatureString,
+			"request_id":       requestID(r),
 		}).Error("Signature string generation failed")
 		return hm.authorizationError(w, r)
 	}
@@ -82,9 +84,10 @@ func (hm *HMACMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request,
 	thisSecret, thisSessionState, keyError := hm.getSecretAndSessionForKeyID(fieldValues.KeyID)
 	if keyError != nil {
 		log.WithFields(logrus.Fields{
-			"prefix": "hmac",
-			"error":  keyError,
-			"keyID":  fieldValues.KeyID,
+			"prefix":     "hmac",
+			"error":      keyError,
+			"keyID":      fieldValues.KeyID,
+			"request_id": requestID(r),
 		}).Error("No HMAC secret for this key")
 		return hm.authorizationError(w, r)
 	}
@@ -113,9 +116,10 @@ func (hm *HMACMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request,
 
 	if matchPass == false {
 		log.WithFields(logrus.Fields{
-			"prefix":   "hmac",
-			"expected": encodedSignature,
-			"got":      fieldValues.Signature,
+			"prefix":     "hmac",
+			"expected":   encodedSignature,
+			"got":        fieldValues.Signature,
+			"request_id": requestID(r),
 		}).Error("Signature string does not match!")
 		return hm.authorizationError(w, r)
 	}
@@ -124,13 +128,14 @@ func (hm *HMACMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request,
 	_, dateVal := getDateHeader(r)
 	if !hm.checkClockSkew(dateVal) {
 		log.WithFields(logrus.Fields{
-			"prefix": "hmac",
+			"prefix":     "hmac",
+			"request_id": requestID(r),
 		}).Error("Clock skew outside of acceptable bounds")
 		return hm.authorizationError(w, r)
 	}
 
 	// Set session state on context, we will need it later
-	if (hm.TykMiddleware.Spec.BaseIdentityProvidedBy == tykcommon.HMACKey) || (hm.TykMiddleware.Spec.BaseIdentityProvidedBy == tykcommon.UnsetAuth) {
+	if (hm.TykMiddleware.Spec.BaseIdentityProvidedBy == apidef.HMACKey) || (hm.TykMiddleware.Spec.BaseIdentityProvidedBy == apidef.UnsetAuth) {
 		context.Set(r, SessionData, thisSessionState)
 		context.Set(r, AuthHeaderValue, fieldValues.KeyID)
 		hm.setContextVars(r, fieldValues.KeyID)
@@ -176,9 +181,10 @@ func (hm *HMACMiddleware) setContextVars(r *http.Request, token string) {
 
 func (hm *HMACMiddleware) authorizationError(w http.ResponseWriter, r *http.Request) (error, int) {
 	log.WithFields(logrus.Fields{
-		"prefix": "hmac",
-		"path":   r.URL.Path,
-		"origin": r.RemoteAddr,
+		"prefix":     "hmac",
+		"path":       r.URL.Path,
+		"origin":     r.RemoteAddr,
+		"request_id": requestID(r),
 	}).Info("Authorization field missing or malformed")
 
 	AuthFailed(hm.TykMiddleware, r, r.Header.Get("Authorization"))
@@ -257,13 +263,15 @@ func getDateHeader(r *http.Request) (string, string) {
 		log.WithFields(logrus.Fields{
 			"prefix":      "hmac",
 			"auth_header": authHeaderValue,
+			"request_id":  requestID(r),
 		}).Warning("Using auxiliary header for this request")
 		return strings.ToLower(AltHeaderSpec), auxHeaderVal
 	}
 
 	if dateHeaderVal != "" {
 		log.WithFields(logrus.Fields{
-			"prefix": "hmac",
+			"prefix":     "hmac",
+			"request_id": requestID(r),
 		}).Debug("Got date header")
 		return strings.ToLower(DateHeaderSpec), dateHeaderVal
 	}
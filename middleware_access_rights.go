@@ -44,10 +44,11 @@ func (a *AccessRightsCheck) ProcessRequest(w http.ResponseWriter, r *http.Reques
 		versionList, apiExists := thisSessionState.AccessRights[a.Spec.APIID]
 		if !apiExists {
 			log.WithFields(logrus.Fields{
-				"path":      r.URL.Path,
-				"origin":    GetIPFromRequest(r),
-				"key":       authHeaderValue,
-				"api_found": false,
+				"path":       r.URL.Path,
+				"origin":     GetIPFromRequest(r),
+				"key":        authHeaderValue,
+				"api_found":  false,
+				"request_id": requestID(r),
 			}).Info("Attempted access to unauthorised API.")
 
 			return errors.New("Access to this API has been disallowed"), 403
@@ -75,6 +76,7 @@ func (a *AccessRightsCheck) ProcessRequest(w http.ResponseWriter, r *http.Reques
 				"key":           authHeaderValue,
 				"api_found":     true,
 				"version_found": false,
+				"request_id":    requestID(r),
 			}).Info("Attempted access to unauthorised API version.")
 
 			return errors.New("Access to this API has been disallowed"), 403
@@ -9,7 +9,7 @@ import (
 	"io/ioutil"
 
 	"github.com/TykTechnologies/logrus"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/gorilla/context"
 )
 
@@ -118,8 +118,9 @@ func (k *AuthKey) ProcessRequest(w http.ResponseWriter, r *http.Request, configu
 	if key == "" {
 		// No header value, fail
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"request_id": requestID(r),
 		}).Info("Attempted access with malformed header, no auth header found.")
 
 		return errors.New("Authorization field missing"), 401
@@ -132,9 +133,10 @@ func (k *AuthKey) ProcessRequest(w http.ResponseWriter, r *http.Request, configu
 	thisSessionState, keyExists := k.TykMiddleware.CheckSessionAndIdentityForValidKey(key)
 	if !keyExists {
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
-			"key":    key,
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"key":        key,
+			"request_id": requestID(r),
 		}).Info("Attempted access with non-existent key.")
 
 		// Fire Authfailed Event
@@ -147,7 +149,7 @@ func (k *AuthKey) ProcessRequest(w http.ResponseWriter, r *http.Request, configu
 	}
 
 	// Set session state on context, we will need it later
-	if (k.TykMiddleware.Spec.BaseIdentityProvidedBy == tykcommon.AuthToken) || (k.TykMiddleware.Spec.BaseIdentityProvidedBy == tykcommon.UnsetAuth) {
+	if (k.TykMiddleware.Spec.BaseIdentityProvidedBy == apidef.AuthToken) || (k.TykMiddleware.Spec.BaseIdentityProvidedBy == apidef.UnsetAuth) {
 		context.Set(r, SessionData, thisSessionState)
 		context.Set(r, AuthHeaderValue, key)
 		k.setContextVars(r, key)
@@ -159,7 +161,7 @@ func (k *AuthKey) ProcessRequest(w http.ResponseWriter, r *http.Request, configu
 func AuthFailed(m *TykMiddleware, r *http.Request, authHeaderValue string) {
 	go m.FireEvent(EVENT_AuthFailure,
 		EVENT_AuthFailureMeta{
-			EventMetaDefault: EventMetaDefault{Message: "Auth Failure", OriginatingRequest: EncodeRequestToEvent(r)},
+			EventMetaDefault: EventMetaDefault{Message: "Auth Failure", OriginatingRequest: EncodeRequestToEvent(r), RequestID: requestID(r)},
 			Path:             r.URL.Path,
 			Origin:           GetIPFromRequest(r),
 			Key:              authHeaderValue,
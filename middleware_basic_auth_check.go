@@ -8,7 +8,7 @@ import (
 	"strings"
 
 	"github.com/TykTechnologies/logrus"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/gorilla/context"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -48,8 +48,9 @@ func (k *BasicAuthKeyIsValid) ProcessRequest(w http.ResponseWriter, r *http.Requ
 	if authHeaderValue == "" {
 		// No header value, fail
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"request_id": requestID(r),
 		}).Info("Attempted access with malformed header, no auth header found.")
 
 		return k.requestForBasicAuth(w, "Authorization field missing")
@@ -59,8 +60,9 @@ func (k *BasicAuthKeyIsValid) ProcessRequest(w http.ResponseWriter, r *http.Requ
 	if len(bits) != 2 {
 		// Header malformed
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"request_id": requestID(r),
 		}).Info("Attempted access with malformed header, header not in basic auth format.")
 
 		return errors.New("Attempted access with malformed header, header not in basic auth format"), 400
@@ -70,8 +72,9 @@ func (k *BasicAuthKeyIsValid) ProcessRequest(w http.ResponseWriter, r *http.Requ
 	authvaluesStr, err := base64.StdEncoding.DecodeString(bits[1])
 	if err != nil {
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"request_id": requestID(r),
 		}).Info("Base64 Decoding failed of basic auth data: ", err)
 
 		return errors.New("Attempted access with malformed header, auth data not encoded correctly"), 400
@@ -81,8 +84,9 @@ func (k *BasicAuthKeyIsValid) ProcessRequest(w http.ResponseWriter, r *http.Requ
 	if len(authValues) != 2 {
 		// Header malformed
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"request_id": requestID(r),
 		}).Info("Attempted access with malformed header, values not in basic auth format.")
 
 		return errors.New("Attempted access with malformed header, values not in basic auth format"), 400
@@ -93,9 +97,10 @@ func (k *BasicAuthKeyIsValid) ProcessRequest(w http.ResponseWriter, r *http.Requ
 	thisSessionState, keyExists := k.TykMiddleware.CheckSessionAndIdentityForValidKey(keyName)
 	if !keyExists {
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
-			"key":    keyName,
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"key":        keyName,
+			"request_id": requestID(r),
 		}).Info("Attempted access with non-existent user.")
 
 		// Fire Authfailed Event
@@ -125,9 +130,10 @@ func (k *BasicAuthKeyIsValid) ProcessRequest(w http.ResponseWriter, r *http.Requ
 
 	if !passMatch {
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
-			"key":    keyName,
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"key":        keyName,
+			"request_id": requestID(r),
 		}).Info("Attempted access with existing user but failed password check.")
 
 		// Fire Authfailed Event
@@ -140,7 +146,7 @@ func (k *BasicAuthKeyIsValid) ProcessRequest(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Set session state on context, we will need it later
-	if (k.TykMiddleware.Spec.BaseIdentityProvidedBy == tykcommon.BasicAuthUser) || (k.TykMiddleware.Spec.BaseIdentityProvidedBy == tykcommon.UnsetAuth) {
+	if (k.TykMiddleware.Spec.BaseIdentityProvidedBy == apidef.BasicAuthUser) || (k.TykMiddleware.Spec.BaseIdentityProvidedBy == apidef.UnsetAuth) {
 		context.Set(r, SessionData, thisSessionState)
 		context.Set(r, AuthHeaderValue, keyName)
 	}
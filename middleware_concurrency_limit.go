@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/TykTechnologies/logrus"
+	"github.com/gorilla/context"
+)
+
+// concurrencyHold is kept in the request context while the request holds its slots
+type concurrencyHold struct {
+	leases []ConcurrencyLease
+	done   chan struct{}
+}
+
+// ConcurrencyLimitCheck will reject a request if the key or the API already has the maximum number
+// of requests in flight, slots are released once the rest of the chain has finished with the request.
+// It runs ahead of the rate limiter and quotas so a rejected request doesn't use up either.
+type ConcurrencyLimitCheck struct {
+	*TykMiddleware
+}
+
+func (mw *ConcurrencyLimitCheck) GetName() string {
+	return "ConcurrencyLimitCheck"
+}
+
+// New lets you do any initialisations for the object can be done here
+func (k *ConcurrencyLimitCheck) New() {}
+
+// GetConfig retrieves the configuration from the API config - we user mapstructure for this for simplicity
+func (k *ConcurrencyLimitCheck) GetConfig() (interface{}, error) {
+	return nil, nil
+}
+
+func (k *ConcurrencyLimitCheck) IsEnabledForSpec() bool {
+	if k.Spec.MaxConcurrentRequests > 0 {
+		return true
+	}
+
+	// Any key or policy can carry a limit, only keyless APIs have no session to check
+	return !k.Spec.UseKeylessAccess
+}
+
+func (k *ConcurrencyLimitCheck) handleConcurrencyLimitFailure(r *http.Request, authHeaderValue string, limitedBy string) (error, int) {
+	log.WithFields(logrus.Fields{
+		"path":       r.URL.Path,
+		"origin":     GetIPFromRequest(r),
+		"key":        authHeaderValue,
+		"limit":      limitedBy,
+		"request_id": requestID(r),
+	}).Info("Concurrent request limit exceeded.")
+
+	// Fire a concurrency limit exceeded event
+	go k.TykMiddleware.FireEvent(EVENT_ConcurrencyLimitExceeded,
+		EVENT_ConcurrencyLimitExceededMeta{
+			EventMetaDefault: EventMetaDefault{Message: "Concurrent Request Limit Exceeded", OriginatingRequest: EncodeRequestToEvent(r), RequestID: requestID(r)},
+			Path:             r.URL.Path,
+			Origin:           GetIPFromRequest(r),
+			Key:              authHeaderValue,
+			LimitedBy:        limitedBy,
+		})
+
+	// Report in health check
+	ReportHealthCheckValue(k.Spec.Health, Throttle, "-1")
+
+	return errors.New("Too many concurrent requests"), 429
+}
+
+// ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
+func (k *ConcurrencyLimitCheck) ProcessRequest(w http.ResponseWriter, r *http.Request, configuration interface{}) (error, int) {
+	leases := []ConcurrencyLease{}
+
+	if k.Spec.MaxConcurrentRequests > 0 {
+		lease, ok := concurrencyLimiter.Acquire(ConcurrencyAPIKeyPrefix+k.Spec.APIID, k.Spec.MaxConcurrentRequests)
+		if !ok {
+			return k.handleConcurrencyLimitFailure(r, "", "api")
+		}
+		leases = append(leases, lease)
+	}
+
+	if sessVal, found := context.GetOk(r, SessionData); found {
+		thisSessionState := sessVal.(SessionState)
+		if thisSessionState.MaxConcurrentRequests > 0 {
+			authHeaderValue := context.Get(r, AuthHeaderValue).(string)
+			lease, ok := concurrencyLimiter.Acquire(publicHash(authHeaderValue), thisSessionState.MaxConcurrentRequests)
+			if !ok {
+				for _, held := range leases {
+					concurrencyLimiter.Release(held)
+				}
+				return k.handleConcurrencyLimitFailure(r, authHeaderValue, "key")
+			}
+			leases = append(leases, lease)
+		}
+	}
+
+	if len(leases) > 0 {
+		context.Set(r, ConcurrencyLeases, concurrencyHold{leases, concurrencyLimiter.KeepAlive(leases)})
+	}
+
+	// Request is valid, carry on
+	return nil, 200
+}
+
+// Finalise releases any slots this request was holding
+func (k *ConcurrencyLimitCheck) Finalise(r *http.Request) {
+	hold, found := context.Get(r, ConcurrencyLeases).(concurrencyHold)
+	if !found {
+		return
+	}
+
+	close(hold.done)
+	for _, lease := range hold.leases {
+		concurrencyLimiter.Release(lease)
+	}
+	context.Delete(r, ConcurrencyLeases)
+}
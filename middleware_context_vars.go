@@ -44,6 +44,13 @@ func (m *MiddlewareContextVars) ProcessRequest(w http.ResponseWriter, r *http.Re
 	copiedRequest := CopyHttpRequest(r)
 	contextDataObject := make(map[string]interface{})
 
+	// Requests routed internally from another API arrive with that API's variables
+	if carried, found := context.Get(r, ContextData).(map[string]interface{}); found {
+		for k, v := range carried {
+			contextDataObject[k] = v
+		}
+	}
+
 	if copiedRequest != nil {
 		copiedRequest.ParseForm()
 
@@ -67,11 +74,28 @@ func (m *MiddlewareContextVars) ProcessRequest(w http.ResponseWriter, r *http.Re
 		// IP:Port
 		contextDataObject["remote_addr"] = copiedRequest.RemoteAddr
 
-	    //Correlation ID
-	    contextDataObject["request_id"] = uuid.NewUUID().String()
+	    //Correlation ID, kept when the request ID middleware has already given one
+	    if _, found := contextDataObject["request_id"]; !found {
+		    contextDataObject["request_id"] = uuid.NewUUID().String()
+	    }
 	}
 
 	context.Set(r, ContextData, contextDataObject)
 
 	return nil, 200
 }
+
+// requestID returns the ID given to the request by the context variables, falling back to the one
+// the client sent when it is safe to log
+func requestID(r *http.Request) string {
+	if contextData, ok := context.Get(r, ContextData).(map[string]interface{}); ok {
+		if id, found := contextData["request_id"]; found {
+			return contextValueString(id)
+		}
+	}
+
+	if id := r.Header.Get(requestIDHeader()); validRequestID(id) {
+		return id
+	}
+	return ""
+}
@@ -76,10 +76,11 @@ func (m *GranularAccessMiddleware) ProcessRequest(w http.ResponseWriter, r *http
 
 	// No paths matched, disallow
 	log.WithFields(logrus.Fields{
-		"path":      r.URL.Path,
-		"origin":    GetIPFromRequest(r),
-		"key":       authHeaderValue,
-		"api_found": false,
+		"path":       r.URL.Path,
+		"origin":     GetIPFromRequest(r),
+		"key":        authHeaderValue,
+		"api_found":  false,
+		"request_id": requestID(r),
 	}).Info("Attempted access to unauthorised endpoint (Granular).")
 
 	return errors.New("Access to this resource has been disallowed"), 403
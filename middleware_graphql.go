@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/TykTechnologies/logrus"
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/gorilla/context"
+)
+
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// GraphQLMiddleware parses GraphQL requests so that limits and access rules can be applied per
+// operation instead of per path
+type GraphQLMiddleware struct {
+	*TykMiddleware
+}
+
+type GraphQLMiddlewareConfig struct{}
+
+// New lets you do any initialisations for the object can be done here
+func (m *GraphQLMiddleware) New() {}
+
+func (m *GraphQLMiddleware) GetName() string {
+	return "GraphQLMiddleware"
+}
+
+// GetConfig retrieves the configuration from the API config - we user mapstructure for this for simplicity
+func (m *GraphQLMiddleware) GetConfig() (interface{}, error) {
+	return nil, nil
+}
+
+func (m *GraphQLMiddleware) IsEnabledForSpec() bool {
+	return m.Spec.GraphQL.Enabled
+}
+
+// readGraphQLRequests supports GET query parameters, "application/graphql" bodies and JSON
+// bodies, including batches. The body is left in place for the upstream
+func readGraphQLRequests(r *http.Request) ([]graphQLRequest, error) {
+	if r.Method == "GET" {
+		query := r.URL.Query()
+		request := graphQLRequest{Query: query.Get("query"), OperationName: query.Get("operationName")}
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				return nil, errors.New("variables must be a JSON object")
+			}
+		}
+		return []graphQLRequest{request}, nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql") {
+		return []graphQLRequest{{Query: string(body)}}, nil
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		requests := []graphQLRequest{}
+		if err := json.Unmarshal(trimmed, &requests); err != nil {
+			return nil, errors.New("request body is not a valid GraphQL batch")
+		}
+		return requests, nil
+	}
+
+	request := graphQLRequest{}
+	if err := json.Unmarshal(trimmed, &request); err != nil {
+		return nil, errors.New("request body is not a valid GraphQL request")
+	}
+
+	return []graphQLRequest{request}, nil
+}
+
+func graphQLFieldBlocked(field string, blocked []string) bool {
+	name := field[strings.LastIndex(field, ".")+1:]
+	for _, entry := range blocked {
+		if entry == field || (!strings.Contains(entry, ".") && entry == name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func graphQLOperationListed(name string, list []string) bool {
+	for _, entry := range list {
+		if entry == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkGraphQLOperation applies the API limits and the API and key access rules to an operation
+func checkGraphQLOperation(stats *GraphQLQueryStats, conf apidef.GraphQLConfig, access *GraphQLAccess) (error, int) {
+	if conf.MaxDepth > 0 && stats.Depth > conf.MaxDepth {
+		return fmt.Errorf("query depth %d exceeds the limit of %d", stats.Depth, conf.MaxDepth), 400
+	}
+	if conf.MaxComplexity > 0 && stats.Complexity > conf.MaxComplexity {
+		return fmt.Errorf("query complexity %d exceeds the limit of %d", stats.Complexity, conf.MaxComplexity), 400
+	}
+	if conf.MaxAliases > 0 && stats.Aliases > conf.MaxAliases {
+		return fmt.Errorf("query uses %d aliases, the limit is %d", stats.Aliases, conf.MaxAliases), 400
+	}
+
+	rules := []*GraphQLAccess{{conf.AllowedOperations, conf.BlockedOperations, conf.BlockedFields}}
+	if access != nil {
+		rules = append(rules, access)
+	}
+
+	for _, rule := range rules {
+		if len(rule.AllowedOperations) > 0 && !graphQLOperationListed(stats.OperationName, rule.AllowedOperations) {
+			return fmt.Errorf("operation %q is not allowed", stats.OperationName), 403
+		}
+		if graphQLOperationListed(stats.OperationName, rule.BlockedOperations) {
+			return fmt.Errorf("operation %q is not allowed", stats.OperationName), 403
+		}
+		for _, field := range stats.Fields {
+			if graphQLFieldBlocked(field, rule.BlockedFields) {
+				return fmt.Errorf("field %q is not allowed", field), 403
+			}
+		}
+	}
+
+	return nil, 200
+}
+
+// graphQLTrackedPath is recorded as the analytics path so that requests group by operation
+func graphQLTrackedPath(stats *GraphQLQueryStats) string {
+	name := stats.OperationName
+	if name == "" {
+		name = "anonymous"
+	}
+	return "/" + stats.OperationType + "/" + name
+}
+
+// ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
+func (m *GraphQLMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, configuration interface{}) (error, int) {
+	requests, err := readGraphQLRequests(r)
+	if err != nil {
+		return newTypedError(ErrorTypeGraphQL, err.Error()), 400
+	}
+
+	if maxBatch := m.Spec.GraphQL.MaxBatchSize; maxBatch > 0 && len(requests) > maxBatch {
+		return newTypedError(ErrorTypeGraphQL, fmt.Sprintf("batch of %d operations exceeds the limit of %d", len(requests), maxBatch)), 400
+	}
+
+	var access *GraphQLAccess
+	if session, found := context.GetOk(r, SessionData); found {
+		access = session.(SessionState).AccessRights[m.Spec.APIID].GraphQL
+	}
+
+	trackedPaths := []string{}
+	batchComplexity := 0
+	for _, request := range requests {
+		doc, err := ParseGraphQL(request.Query, m.Spec.GraphQL.MaxDepth)
+		if err != nil {
+			return newTypedError(ErrorTypeGraphQL, err.Error()), 400
+		}
+
+		stats, err := doc.Analyse(request.OperationName, request.Variables)
+		if err != nil {
+			return newTypedError(ErrorTypeGraphQL, err.Error()), 400
+		}
+
+		if err, code := checkGraphQLOperation(stats, m.Spec.GraphQL, access); err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix":     "graphql",
+				"api_id":     m.Spec.APIID,
+				"origin":     GetIPFromRequest(r),
+				"operation":  stats.OperationName,
+				"depth":      stats.Depth,
+				"complexity": stats.Complexity,
+				"request_id": requestID(r),
+			}).Info("GraphQL operation rejected: ", err)
+
+			return newTypedError(ErrorTypeGraphQL, err.Error()), code
+		}
+
+		// A batch costs the upstream as much as its operations together
+		batchComplexity = addCapped(batchComplexity, stats.Complexity)
+		if maxComplexity := m.Spec.GraphQL.MaxComplexity; maxComplexity > 0 && batchComplexity > maxComplexity {
+			return newTypedError(ErrorTypeGraphQL, fmt.Sprintf("batch complexity %d exceeds the limit of %d", batchComplexity, maxComplexity)), 400
+		}
+
+		trackedPaths = append(trackedPaths, graphQLTrackedPath(stats))
+	}
+
+	if len(trackedPaths) == 1 {
+		context.Set(r, TrackThisEndpoint, trackedPaths[0])
+	} else if len(trackedPaths) > 1 {
+		context.Set(r, TrackThisEndpoint, "/batch"+strings.Join(trackedPaths, ","))
+	}
+
+	return nil, 200
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/TykTechnologies/logrus"
+	"github.com/gorilla/context"
+)
+
+// GRPCTranscode turns REST calls on routes bound by google.api.http annotations into gRPC calls,
+// the proxy turns the replies back into JSON
+type GRPCTranscode struct {
+	*TykMiddleware
+}
+
+type GRPCTranscodeConfig struct{}
+
+func (t *GRPCTranscode) GetName() string {
+	return "GRPCTranscode"
+}
+
+// New lets you do any initialisations for the object can be done here
+func (t *GRPCTranscode) New() {}
+
+// GetConfig retrieves the configuration from the API config - we user mapstructure for this for simplicity
+func (t *GRPCTranscode) GetConfig() (interface{}, error) {
+	return nil, nil
+}
+
+func (t *GRPCTranscode) IsEnabledForSpec() bool {
+	for _, thisVersion := range t.TykMiddleware.Spec.VersionData.Versions {
+		if len(thisVersion.ExtendedPaths.GRPCTranscode) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// grpcFrame wraps a message in the length prefixed framing gRPC uses on the wire
+func grpcFrame(message []byte) []byte {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+
+	return append(frame, message...)
+}
+
+// setProtoJSONPath stores a value under a dotted field path, query parameters and path variables
+// are always strings and get converted when the message is encoded
+func (s *ProtoDescriptorSet) setProtoJSONPath(message *ProtoMessage, object map[string]interface{}, path string, values []string) error {
+	field, err := s.resolveFieldPath(message, path)
+	if err != nil {
+		return err
+	}
+
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		nested, _ := object[part].(map[string]interface{})
+		if nested == nil {
+			nested = map[string]interface{}{}
+			object[part] = nested
+		}
+		object = nested
+	}
+
+	last := parts[len(parts)-1]
+	if !field.Repeated {
+		object[last] = values[0]
+		return nil
+	}
+
+	list := make([]interface{}, len(values))
+	for i, value := range values {
+		list[i] = value
+	}
+	object[last] = list
+
+	return nil
+}
+
+// requestMessage builds the RPC input from the body, the query string and the path variables
+func (t *GRPCTranscodeSpec) requestMessage(r *http.Request) ([]byte, error) {
+	input := t.Descriptors.Messages[t.RPC.InputType]
+	object := map[string]interface{}{}
+
+	if t.Rule.Body != "*" {
+		for key, values := range r.URL.Query() {
+			// Parameters that aren't fields, such as API keys, are left alone
+			t.Descriptors.setProtoJSONPath(input, object, key, values)
+		}
+	}
+
+	if t.Rule.Body != "" {
+		body, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(bytes.TrimSpace(body)) > 0 {
+			decoder := json.NewDecoder(bytes.NewReader(body))
+			decoder.UseNumber()
+
+			var bodyData interface{}
+			if err := decoder.Decode(&bodyData); err != nil {
+				return nil, errors.New("request body is not valid JSON")
+			}
+
+			if t.Rule.Body == "*" {
+				bodyObject, ok := bodyData.(map[string]interface{})
+				if !ok {
+					return nil, errors.New("request body must be a JSON object")
+				}
+				object = bodyObject
+			} else {
+				object[t.Rule.Body] = bodyData
+			}
+		}
+	}
+
+	matches := t.Pattern.FindStringSubmatch(r.URL.Path)
+	for i, variable := range t.Variables {
+		if i+1 < len(matches) {
+			if err := t.Descriptors.setProtoJSONPath(input, object, variable, []string{matches[i+1]}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return t.Descriptors.EncodeJSON(input, object)
+}
+
+// ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
+func (t *GRPCTranscode) ProcessRequest(w http.ResponseWriter, r *http.Request, configuration interface{}) (error, int) {
+	_, versionPaths, _, _ := t.TykMiddleware.Spec.GetVersionData(r)
+	found, meta := t.TykMiddleware.Spec.CheckSpecMatchesStatus(r.URL.Path, r.Method, versionPaths, GRPCTranscoded)
+	if !found {
+		return nil, 200
+	}
+
+	thisMeta := meta.(*GRPCTranscodeSpec)
+	message, err := thisMeta.requestMessage(r)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix":      "grpc-transcode",
+			"server_name": t.Spec.APIDefinition.Proxy.TargetURL,
+			"api_id":      t.Spec.APIDefinition.APIID,
+			"path":        r.URL.Path,
+			"request_id":  requestID(r),
+		}).Info("Request could not be transcoded: ", err)
+		return err, 400
+	}
+
+	framed := grpcFrame(message)
+	r.Body = ioutil.NopCloser(bytes.NewReader(framed))
+	r.ContentLength = int64(len(framed))
+	r.Header.Del("Content-Length")
+
+	// The upstream path is the RPC, the listen path is added back so that stripping still works
+	rpcPath := "/" + thisMeta.RPC.Service + "/" + thisMeta.RPC.Name
+	if t.Spec.Proxy.StripListenPath {
+		rpcPath = strings.TrimSuffix(t.Spec.Proxy.ListenPath, "/") + rpcPath
+	}
+	r.Method = "POST"
+	r.URL.Path = rpcPath
+	r.URL.RawQuery = ""
+
+	context.Set(r, GRPCTranscodeMethod, thisMeta)
+
+	return nil, 200
+}
+
+// grpcStatusToHTTP is the mapping from google/rpc/code.proto
+func grpcStatusToHTTP(status int) int {
+	switch status {
+	case GRPCStatusOK:
+		return 200
+	case GRPCStatusCancelled:
+		return 499
+	case GRPCStatusInvalidArgument, GRPCStatusFailedPrecondition, GRPCStatusOutOfRange:
+		return 400
+	case GRPCStatusDeadlineExceeded:
+		return 504
+	case GRPCStatusNotFound:
+		return 404
+	case GRPCStatusAlreadyExists, GRPCStatusAborted:
+		return 409
+	case GRPCStatusPermissionDenied:
+		return 403
+	case GRPCStatusResourceExhausted:
+		return 429
+	case GRPCStatusUnimplemented:
+		return 501
+	case GRPCStatusUnavailable:
+		return 503
+	case GRPCStatusUnauthenticated:
+		return 401
+	}
+
+	return 500
+}
+
+// prepareGRPCTranscodeRequest switches the outbound request over to gRPC
+func prepareGRPCTranscodeRequest(outreq *http.Request) {
+	headers := make(http.Header)
+	copyHeader(headers, outreq.Header)
+	outreq.Header = headers
+
+	headers.Set("Content-Type", grpcContentType+"+proto")
+	headers.Set("Te", "trailers")
+	headers.Del("Accept")
+	headers.Del("Accept-Encoding")
+}
+
+func setTranscodedResponse(res *http.Response, code int, body interface{}) {
+	encoded, _ := json.Marshal(body)
+
+	res.StatusCode = code
+	res.Status = strconv.Itoa(code) + " " + http.StatusText(code)
+	res.Header.Set("Content-Type", "application/json")
+	res.Header.Set("Content-Length", strconv.Itoa(len(encoded)))
+	res.ContentLength = int64(len(encoded))
+	res.Body = ioutil.NopCloser(bytes.NewReader(encoded))
+}
+
+// transcodeGRPCResponse turns a unary gRPC reply into JSON, failed calls become a JSON error with
+// the matching HTTP status
+func transcodeGRPCResponse(res *http.Response, meta *GRPCTranscodeSpec) error {
+	if !isGRPCResponse(res) {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	// Trailers-only responses carry the status in the headers
+	status, message := res.Trailer.Get("Grpc-Status"), res.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = res.Header.Get("Grpc-Status"), res.Header.Get("Grpc-Message")
+	}
+	if unescaped, err := url.PathUnescape(message); err == nil {
+		message = unescaped
+	}
+
+	for _, header := range []string{"Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin", "Grpc-Encoding", "Grpc-Accept-Encoding"} {
+		res.Header.Del(header)
+	}
+	res.Trailer = nil
+
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		code, message = GRPCStatusUnknown, "upstream did not send a gRPC status"
+	}
+	if code != GRPCStatusOK {
+		setTranscodedResponse(res, grpcStatusToHTTP(code), map[string]interface{}{"code": code, "message": message})
+		return nil
+	}
+
+	if len(body) < 5 || body[0] != 0 || int(binary.BigEndian.Uint32(body[1:5])) > len(body)-5 {
+		setTranscodedResponse(res, http.StatusBadGateway, map[string]interface{}{"code": GRPCStatusInternal, "message": "unsupported gRPC response framing"})
+		return nil
+	}
+
+	output := meta.Descriptors.Messages[meta.RPC.OutputType]
+	decoded, err := meta.Descriptors.DecodeJSON(output, body[5:5+binary.BigEndian.Uint32(body[1:5])])
+	if err != nil {
+		setTranscodedResponse(res, http.StatusBadGateway, map[string]interface{}{"code": GRPCStatusInternal, "message": fmt.Sprintf("invalid gRPC response: %v", err)})
+		return nil
+	}
+
+	var reply interface{} = decoded
+	if meta.Rule.ResponseBody != "" {
+		if field := output.Field(meta.Rule.ResponseBody); field != nil {
+			value, found := decoded[field.JSONName]
+			if !found {
+				value = meta.Descriptors.protoJSONDefault(field)
+			}
+			reply = value
+		}
+	}
+
+	setTranscodedResponse(res, http.StatusOK, reply)
+	return nil
+}
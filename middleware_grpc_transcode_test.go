@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/context"
+)
+
+func pbField(number int, wireType int, payload []byte) []byte {
+	return append(proto.EncodeVarint(uint64(number)<<3|uint64(wireType)), payload...)
+}
+
+func pbString(number int, value string) []byte {
+	return pbField(number, protoWireBytes, appendProtoBytes(nil, []byte(value)))
+}
+
+func pbVarint(number int, value uint64) []byte {
+	return pbField(number, protoWireVarint, proto.EncodeVarint(value))
+}
+
+func pbMessage(number int, parts ...[]byte) []byte {
+	return pbField(number, protoWireBytes, appendProtoBytes(nil, bytes.Join(parts, nil)))
+}
+
+func pbFieldDescriptor(name string, number int, fieldType int, repeated bool, typeName string) []byte {
+	label := uint64(1)
+	if repeated {
+		label = protoLabelRepeated
+	}
+	parts := [][]byte{pbString(1, name), pbVarint(3, uint64(number)), pbVarint(4, label), pbVarint(5, uint64(fieldType))}
+	if typeName != "" {
+		parts = append(parts, pbString(6, typeName))
+	}
+	return pbMessage(2, parts...)
+}
+
+func pbMethod(name, input, output string, rule ...[]byte) []byte {
+	return pbMessage(2,
+		pbString(1, name),
+		pbString(2, input),
+		pbString(3, output),
+		pbMessage(4, pbMessage(protoHTTPRuleExtension, rule...)),
+	)
+}
+
+// libraryDescriptorSet is what protoc writes for a small library service with HTTP bindings
+func libraryDescriptorSet() []byte {
+	return pbMessage(1,
+		pbString(1, "library.proto"),
+		pbString(2, "library"),
+		pbMessage(4,
+			pbString(1, "Book"),
+			pbFieldDescriptor("name", 1, protoTypeString, false, ""),
+			pbFieldDescriptor("book_id", 2, protoTypeInt64, false, ""),
+			pbFieldDescriptor("tags", 3, protoTypeString, true, ""),
+			pbFieldDescriptor("state", 4, protoTypeEnum, false, ".library.State"),
+			pbFieldDescriptor("ratings", 5, protoTypeMessage, true, ".library.Book.RatingsEntry"),
+			pbFieldDescriptor("author", 6, protoTypeMessage, false, ".library.Author"),
+			pbFieldDescriptor("pages", 7, protoTypeSint32, true, ""),
+			pbMessage(3,
+				pbString(1, "RatingsEntry"),
+				pbFieldDescriptor("key", 1, protoTypeString, false, ""),
+				pbFieldDescriptor("value", 2, protoTypeDouble, false, ""),
+				pbMessage(7, pbVarint(7, 1)),
+			),
+		),
+		pbMessage(4,
+			pbString(1, "Author"),
+			pbFieldDescriptor("display_name", 1, protoTypeString, false, ""),
+		),
+		pbMessage(4,
+			pbString(1, "GetBookRequest"),
+			pbFieldDescriptor("shelf", 1, protoTypeString, false, ""),
+			pbFieldDescriptor("book_id", 2, protoTypeInt64, false, ""),
+			pbFieldDescriptor("fields", 3, protoTypeString, true, ""),
+		),
+		pbMessage(5,
+			pbString(1, "State"),
+			pbMessage(2, pbString(1, "DRAFT"), pbVarint(2, 0)),
+			pbMessage(2, pbString(1, "PUBLISHED"), pbVarint(2, 1)),
+		),
+		pbMessage(6,
+			pbString(1, "Library"),
+			pbMethod("GetBook", ".library.GetBookRequest", ".library.Book",
+				pbString(2, "/v1/shelves/{shelf}/books/{book_id}"),
+				pbMessage(11, pbString(2, "/v1/books/{book_id}:lookup")),
+			),
+			pbMethod("UpdateBook", ".library.Book", ".library.Book",
+				pbString(6, "/v1/books/{book_id}"),
+				pbString(7, "*"),
+				pbString(12, "author"),
+			),
+		),
+	)
+}
+
+var grpcTranscodeDefinition = `
+
+	{
+		"name": "Tyk Test API",
+		"api_id": "1",
+		"org_id": "default",
+		"definition": {
+			"location": "header",
+			"key": "version"
+		},
+		"auth": {
+			"auth_header_name": "authorization"
+		},
+		"version_data": {
+			"not_versioned": true,
+			"versions": {
+				"Default": {
+					"name": "Default",
+					"use_extended_paths": true,
+					"extended_paths": {
+						"grpc_transcode": [{
+							"descriptor_mode": "blob",
+							"descriptor_source": "%s"
+						}]
+					}
+				}
+			}
+		},
+		"proxy": {
+			"listen_path": "/v1",
+			"target_url": "http://example.com",
+			"transport": "h2c",
+			"strip_listen_path": false
+		}
+	}
+
+`
+
+func TestProtoDescriptorTranscoding(t *testing.T) {
+	set, err := ParseProtoDescriptorSet(libraryDescriptorSet())
+	if err != nil {
+		t.Fatal("Descriptor set should parse: ", err)
+	}
+
+	if len(set.Methods) != 2 || len(set.Methods[0].HTTPRules) != 2 || set.Methods[1].HTTPRules[0].Method != "PATCH" {
+		t.Fatal("Methods and their bindings should be read, got: ", set.Methods)
+	}
+
+	book := set.Messages["library.Book"]
+	if book.Field("bookId") == nil || book.Field("book_id") != book.Field("bookId") || !set.Messages["library.Book.RatingsEntry"].MapEntry {
+		t.Error("Fields should be found by JSON and proto names")
+	}
+
+	decoder := json.NewDecoder(bytes.NewBufferString(`{
+		"name": "Dune", "book_id": "-12", "tags": ["sf", "classic"], "state": "PUBLISHED",
+		"ratings": {"alice": 4.5}, "author": {"displayName": "Frank"}, "pages": [-1, 2]
+	}`))
+	decoder.UseNumber()
+	var object map[string]interface{}
+	decoder.Decode(&object)
+
+	encoded, err := set.EncodeJSON(book, object)
+	if err != nil {
+		t.Fatal("Encoding failed: ", err)
+	}
+
+	decoded, err := set.DecodeJSON(book, encoded)
+	if err != nil {
+		t.Fatal("Decoding failed: ", err)
+	}
+
+	expected := map[string]interface{}{
+		"name": "Dune", "bookId": "-12", "tags": []interface{}{"sf", "classic"}, "state": "PUBLISHED",
+		"ratings": map[string]interface{}{"alice": 4.5}, "author": map[string]interface{}{"displayName": "Frank"},
+		"pages": []interface{}{int32(-1), int32(2)},
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Error("Messages should survive a round trip, got: ", decoded)
+	}
+
+	if _, err := set.EncodeJSON(book, map[string]interface{}{"title": "x"}); err == nil {
+		t.Error("Unknown fields should be rejected")
+	}
+
+	pattern, variables, err := compileHTTPPathTemplate("/v1/{name=shelves/*}/books/{book.id}:publish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches := pattern.FindStringSubmatch("/library/v1/shelves/s1/books/9:publish")
+	if len(matches) != 3 || matches[1] != "shelves/s1" || variables[1] != "book.id" || pattern.MatchString("/v1/shelves/s1/books/9") {
+		t.Error("Path templates should match whole segments and the verb, got: ", matches)
+	}
+}
+
+func TestGRPCTranscode(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	set, _ := ParseProtoDescriptorSet(libraryDescriptorSet())
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		request, _ := set.DecodeJSON(set.Messages["library.GetBookRequest"], body[5:])
+
+		w.Header().Set("Content-Type", "application/grpc")
+		if r.URL.Path != "/library.Library/GetBook" || request["shelf"] != "fiction" {
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", "no such book: "+r.URL.Path)
+			return
+		}
+
+		reply, _ := set.EncodeJSON(set.Messages["library.Book"], map[string]interface{}{
+			"bookId": request["bookId"], "tags": request["fields"],
+		})
+		w.Write(grpcFrame(reply))
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	})
+	config.HttpServerOptions.EnableHTTP2 = true
+	defer func() { config.HttpServerOptions.EnableHTTP2 = false }()
+	go serveGateway(l, &http.Server{Handler: upstream})
+
+	spec := createDefinitionFromString(fmt.Sprintf(grpcTranscodeDefinition, base64.StdEncoding.EncodeToString(libraryDescriptorSet())))
+	spec.Proxy.TargetURL = "http://" + l.Addr().String()
+
+	remote, _ := url.Parse(spec.Proxy.TargetURL)
+	proxy := TykNewSingleHostReverseProxy(remote, spec)
+	mw := &GRPCTranscode{&TykMiddleware{spec, proxy}}
+
+	call := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RemoteAddr = "127.0.0.1:1234"
+		recorder := httptest.NewRecorder()
+		if err, code := mw.ProcessRequest(recorder, req, nil); err != nil {
+			t.Fatal("Transcoding failed: ", code, err)
+		}
+		proxy.ServeHTTP(recorder, req)
+		context.Clear(req)
+		return recorder
+	}
+
+	recorder := call("/v1/shelves/fiction/books/42?fields=title&fields=tags&api_key=abc")
+	if recorder.Code != 200 || recorder.Body.String() != `{"bookId":"42","tags":["title","tags"]}` {
+		t.Error("REST calls should be transcoded both ways, got: ", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = call("/v1/shelves/poetry/books/1")
+	if recorder.Code != 404 || recorder.Body.String() != `{"code":5,"message":"no such book: /library.Library/GetBook"}` {
+		t.Error("gRPC errors should map to HTTP statuses, got: ", recorder.Code, recorder.Body.String())
+	}
+}
@@ -14,7 +14,7 @@ import (
 	"time"
 
 	"github.com/TykTechnologies/logrus"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/context"
 	"github.com/pmylund/go-cache"
@@ -271,7 +271,7 @@ func (k *JWTMiddleware) processCentralisedJWT(w http.ResponseWriter, r *http.Req
 			k.Spec.SessionManager.UpdateSession(SessionID, thisSessionState, GetLifetime(k.Spec, &thisSessionState))
 			log.Debug("Policy applied to key")
 
-			if (k.TykMiddleware.Spec.BaseIdentityProvidedBy == tykcommon.JWTClaim) || (k.TykMiddleware.Spec.BaseIdentityProvidedBy == tykcommon.UnsetAuth) {
+			if (k.TykMiddleware.Spec.BaseIdentityProvidedBy == apidef.JWTClaim) || (k.TykMiddleware.Spec.BaseIdentityProvidedBy == apidef.UnsetAuth) {
 				context.Set(r, SessionData, thisSessionState)
 				context.Set(r, AuthHeaderValue, SessionID)
 			}
@@ -285,7 +285,7 @@ func (k *JWTMiddleware) processCentralisedJWT(w http.ResponseWriter, r *http.Req
 	}
 
 	log.Debug("Key found")
-	if (k.TykMiddleware.Spec.BaseIdentityProvidedBy == tykcommon.JWTClaim) || (k.TykMiddleware.Spec.BaseIdentityProvidedBy == tykcommon.UnsetAuth) {
+	if (k.TykMiddleware.Spec.BaseIdentityProvidedBy == apidef.JWTClaim) || (k.TykMiddleware.Spec.BaseIdentityProvidedBy == apidef.UnsetAuth) {
 		context.Set(r, SessionData, thisSessionState)
 		context.Set(r, AuthHeaderValue, SessionID)
 	}
@@ -349,8 +349,9 @@ func (k *JWTMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, c
 	if rawJWT == "" {
 		// No header value, fail
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"request_id": requestID(r),
 		}).Info("Attempted access with malformed header, no JWT auth header found.")
 
 		log.Debug("Looked in: ", thisConfig.AuthHeaderName)
@@ -408,6 +409,7 @@ func (k *JWTMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, c
 
 	if err == nil && token.Valid {
 		// Token is valid - let's move on
+		context.Set(r, JWTClaims, map[string]interface{}(token.Claims.(jwt.MapClaims)))
 
 		// Are we mapping to a central JWT Secret?
 		if k.TykMiddleware.Spec.APIDefinition.JWTSource != "" {
@@ -419,14 +421,16 @@ func (k *JWTMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, c
 
 	} else {
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"request_id": requestID(r),
 		}).Info("Attempted JWT access with non-existent key.")
 
 		if err != nil {
 			log.WithFields(logrus.Fields{
-				"path":   r.URL.Path,
-				"origin": GetIPFromRequest(r),
+				"path":       r.URL.Path,
+				"origin":     GetIPFromRequest(r),
+				"request_id": requestID(r),
 			}).Error("JWT validation error: ", err)
 		}
 
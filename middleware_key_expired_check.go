@@ -4,6 +4,7 @@ import "net/http"
 
 import (
 	"errors"
+	"time"
 
 	"github.com/TykTechnologies/logrus"
 	"github.com/gorilla/context"
@@ -43,15 +44,16 @@ func (k *KeyExpired) ProcessRequest(w http.ResponseWriter, r *http.Request, conf
 	if thisSessionState.IsInactive {
 		authHeaderValue := context.Get(r, AuthHeaderValue).(string)
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
-			"key":    authHeaderValue,
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"key":        authHeaderValue,
+			"request_id": requestID(r),
 		}).Info("Attempted access from inactive key.")
 
 		// Fire a key expired event
 		go k.TykMiddleware.FireEvent(EVENT_KeyExpired,
 			EVENT_KeyExpiredMeta{
-				EventMetaDefault: EventMetaDefault{Message: "Attempted access from inactive key.", OriginatingRequest: EncodeRequestToEvent(r)},
+				EventMetaDefault: EventMetaDefault{Message: "Attempted access from inactive key.", OriginatingRequest: EncodeRequestToEvent(r), RequestID: requestID(r)},
 				Path:             r.URL.Path,
 				Origin:           GetIPFromRequest(r),
 				Key:              authHeaderValue,
@@ -63,20 +65,62 @@ func (k *KeyExpired) ProcessRequest(w http.ResponseWriter, r *http.Request, conf
 		return errors.New("Key is inactive, please renew"), 403
 	}
 
+	now := time.Now()
+
+	if thisSessionState.IsNotYetActive(now) {
+		authHeaderValue := context.Get(r, AuthHeaderValue).(string)
+		log.WithFields(logrus.Fields{
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"key":        authHeaderValue,
+			"request_id": requestID(r),
+		}).Info("Attempted access from key before its activation time.")
+
+		// Report in health check
+		ReportHealthCheckValue(k.Spec.Health, KeyFailure, "-1")
+
+		return errors.New("Key is not active yet"), 403
+	}
+
 	keyExpired := k.Spec.AuthManager.IsKeyExpired(&thisSessionState)
 
+	if keyExpired && thisSessionState.InExpiryGracePeriod(now) {
+		authHeaderValue := context.Get(r, AuthHeaderValue).(string)
+		log.WithFields(logrus.Fields{
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"key":        authHeaderValue,
+			"request_id": requestID(r),
+		}).Info("Expired key used during its grace period.")
+
+		// Fire a key expired event the first time the key is used, the request is still allowed through
+		if firstUseInGracePeriod(authHeaderValue, &thisSessionState, now) {
+			go k.TykMiddleware.FireEvent(EVENT_KeyExpired,
+				EVENT_KeyExpiredMeta{
+					EventMetaDefault: EventMetaDefault{Message: "Expired key used during grace period.", OriginatingRequest: EncodeRequestToEvent(r), RequestID: requestID(r)},
+					Path:             r.URL.Path,
+					Origin:           GetIPFromRequest(r),
+					Key:              authHeaderValue,
+				})
+		}
+
+		setKeyDeprecationHeaders(w, thisSessionState.Expires, thisSessionState.GraceEnds())
+		return nil, 200
+	}
+
 	if keyExpired {
 		authHeaderValue := context.Get(r, AuthHeaderValue).(string)
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
-			"key":    authHeaderValue,
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"key":        authHeaderValue,
+			"request_id": requestID(r),
 		}).Info("Attempted access from expired key.")
 
 		// Fire a key expired event
 		go k.TykMiddleware.FireEvent(EVENT_KeyExpired,
 			EVENT_KeyExpiredMeta{
-				EventMetaDefault: EventMetaDefault{Message: "Attempted access from expired key."},
+				EventMetaDefault: EventMetaDefault{Message: "Attempted access from expired key.", RequestID: requestID(r)},
 				Path:             r.URL.Path,
 				Origin:           GetIPFromRequest(r),
 				Key:              authHeaderValue,
@@ -88,5 +132,18 @@ func (k *KeyExpired) ProcessRequest(w http.ResponseWriter, r *http.Request, conf
 		return errors.New("Key has expired, please renew"), 403
 	}
 
+	// Keys that have been rotated are told when they will stop working
+	if thisSessionState.RotatedAt > 0 {
+		setKeyDeprecationHeaders(w, thisSessionState.RotatedAt, thisSessionState.Expires)
+	}
+
 	return nil, 200
 }
+
+// setKeyDeprecationHeaders tells the client when the key was deprecated and when it will stop working
+func setKeyDeprecationHeaders(w http.ResponseWriter, deprecatedAt int64, sunset int64) {
+	w.Header().Set("Deprecation", time.Unix(deprecatedAt, 0).UTC().Format(http.TimeFormat))
+	if sunset > 0 {
+		w.Header().Set("Sunset", time.Unix(sunset, 0).UTC().Format(http.TimeFormat))
+	}
+}
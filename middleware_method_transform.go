@@ -5,7 +5,7 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 )
 
 // TransformMiddleware is a middleware that will apply a template to a request body to transform it's contents ready for an upstream API
@@ -53,7 +53,7 @@ func (t *TransformMethod) ProcessRequest(w http.ResponseWriter, r *http.Request,
 	}
 
 	if stat == StatusMethodTransformed {
-		thisMeta := meta.(*tykcommon.MethodTransformMeta)
+		thisMeta := meta.(*apidef.MethodTransformMeta)
 
 		switch strings.ToUpper(thisMeta.ToMethod) {
 		case "GET":
@@ -1,13 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"reflect"
 	"strings"
+	"text/template"
+	"time"
 
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/logrus"
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/gorilla/context"
 )
 
@@ -21,6 +30,138 @@ const TYK_CONTEXT_LABEL string = "$tyk_context."
 
 type TransformHeadersConfig struct{}
 
+var headerTemplateFuncs = template.FuncMap{
+	"hmacSHA256": func(key, message string) string {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(message))
+		return hex.EncodeToString(mac.Sum(nil))
+	},
+	"hmacSHA256Base64": func(key, message string) string {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(message))
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	},
+	"sha256": func(value string) string {
+		sum := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(sum[:])
+	},
+	"base64": func(value string) string {
+		return base64.StdEncoding.EncodeToString([]byte(value))
+	},
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// HeaderTemplateData is what header value templates are executed against, Status is only set
+// when the headers are for a response
+type HeaderTemplateData struct {
+	Method        string
+	Path          string
+	Host          string
+	RemoteAddr    string
+	Query         url.Values
+	Header        http.Header
+	APIID         string
+	OrgID         string
+	Alias         string
+	OAuthClientID string
+	Meta          map[string]interface{}
+	Context       map[string]interface{}
+	Claims        map[string]interface{}
+	RequestID     string
+	Time          time.Time
+	Status        int
+}
+
+func newHeaderTemplateData(r *http.Request, spec *APISpec) HeaderTemplateData {
+	data := HeaderTemplateData{
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Host:       r.Host,
+		RemoteAddr: GetIPFromRequest(r),
+		Query:      r.URL.Query(),
+		Header:     r.Header,
+		APIID:      spec.APIID,
+		OrgID:      spec.OrgID,
+		Time:       time.Now().UTC(),
+	}
+
+	if session, found := context.GetOk(r, SessionData); found {
+		sessionState := session.(SessionState)
+		data.Alias = sessionState.Alias
+		data.OAuthClientID = sessionState.OauthClientID
+		data.Meta, _ = sessionState.MetaData.(map[string]interface{})
+	}
+	data.Context, _ = context.Get(r, ContextData).(map[string]interface{})
+	data.Claims, _ = context.Get(r, JWTClaims).(map[string]interface{})
+	data.RequestID = requestID(r)
+
+	return data
+}
+
+// HeaderInjectionSpec is a header transform with its value templates and conditions compiled
+type HeaderInjectionSpec struct {
+	apidef.HeaderInjectionMeta
+	Templates map[string]*template.Template
+	Condition *RoutingTriggerSpec
+}
+
+func CompileHeaderInjection(meta apidef.HeaderInjectionMeta) (HeaderInjectionSpec, error) {
+	spec := HeaderInjectionSpec{HeaderInjectionMeta: meta}
+
+	if len(meta.TemplateHeaders) > 0 {
+		spec.Templates = make(map[string]*template.Template, len(meta.TemplateHeaders))
+	}
+	for name, text := range meta.TemplateHeaders {
+		tmpl, err := template.New(name).Funcs(headerTemplateFuncs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return spec, fmt.Errorf("header %q: %v", name, err)
+		}
+		spec.Templates[name] = tmpl
+	}
+
+	if meta.Conditions != nil {
+		if len(meta.Conditions.PayloadMatches) > 0 {
+			return spec, errors.New("header transforms can't be conditional on the payload")
+		}
+		condition, err := CompileRoutingTrigger(apidef.RoutingTrigger{On: meta.ConditionsOn, Options: *meta.Conditions})
+		if err != nil {
+			return spec, err
+		}
+		spec.Condition = &condition
+	}
+
+	return spec, nil
+}
+
+// Applies checks the transform's conditions against the request, transforms without any always apply
+func (h *HeaderInjectionSpec) Applies(r *http.Request) bool {
+	return h.Condition == nil || h.Condition.Matches(r, nil)
+}
+
+// renderTemplateHeaders sets each templated header. Whatever the client sent under the same name is
+// always removed, so a header the upstream trusts can't be forged by a request that makes the
+// template fail or come out empty.
+func (h *HeaderInjectionSpec) renderTemplateHeaders(header http.Header, data HeaderTemplateData) {
+	for name, tmpl := range h.Templates {
+		header.Del(name)
+
+		var value bytes.Buffer
+		if err := tmpl.Execute(&value, data); err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": "main",
+				"header": name,
+				"path":   data.Path,
+			}).Warning("Header template could not be rendered: ", err)
+			continue
+		}
+		if value.Len() > 0 {
+			header.Set(name, value.String())
+		}
+	}
+}
+
 func (mw *TransformHeaders) GetName() string {
 	return "TransformHeaders"
 }
@@ -164,14 +305,17 @@ func (t *TransformHeaders) ProcessRequest(w http.ResponseWriter, r *http.Request
 	}
 
 	if stat == StatusHeaderInjected {
-		thisMeta := meta.(*tykcommon.HeaderInjectionMeta)
+		thisMeta := meta.(*HeaderInjectionSpec)
+		if !thisMeta.Applies(r) {
+			return nil, 200
+		}
 
 		for _, dKey := range thisMeta.DeleteHeaders {
 			r.Header.Del(dKey)
 		}
 
 		t.iterateAddHeaders(thisMeta.AddHeaders, r)
-
+		thisMeta.renderTemplateHeaders(r.Header, newHeaderTemplateData(r, t.Spec))
 	}
 
 	return nil, 200
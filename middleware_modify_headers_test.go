@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/gorilla/context"
+)
+
+var headerTemplateDefinition = `
+
+	{
+		"name": "Tyk Test API",
+		"api_id": "1",
+		"org_id": "default",
+		"definition": {
+			"location": "header",
+			"key": "version"
+		},
+		"auth": {
+			"auth_header_name": "authorization"
+		},
+		"version_data": {
+			"not_versioned": true,
+			"versions": {
+				"Default": {
+					"name": "Default",
+					"use_extended_paths": true,
+					"extended_paths": {
+						"transform_headers": [{
+							"path": "/v1/orders",
+							"method": "POST",
+							"delete_headers": ["X-Debug"],
+							"template_headers": {
+								"X-User": "{{.Alias}}",
+								"X-Tenant": "{{.Meta.tenant}}",
+								"X-Subject": "{{.Claims.sub}}",
+								"X-Missing": "{{.Meta.nothing}}",
+								"X-Signature": "{{hmacSHA256 \"secret\" (printf \"%s %s\" .Method .Path)}}"
+							},
+							"conditions_on": "all",
+							"conditions": {
+								"header_matches": {"X-Channel": {"match_rx": "^web$"}}
+							}
+						}],
+						"transform_response_headers": [{
+							"path": "/v1/orders",
+							"method": "POST",
+							"template_headers": {"X-Served-For": "{{.OAuthClientID}}/{{.Status}}"}
+						}]
+					}
+				}
+			}
+		},
+		"proxy": {
+			"listen_path": "/v1",
+			"target_url": "http://example.com",
+			"strip_listen_path": false
+		}
+	}
+
+`
+
+func TestHeaderTemplates(t *testing.T) {
+	spec := createDefinitionFromString(headerTemplateDefinition)
+	mw := &TransformHeaders{&TykMiddleware{spec, nil}}
+
+	newRequest := func(channel string) *http.Request {
+		req, _ := http.NewRequest("POST", "/v1/orders", nil)
+		req.Header.Set("X-Channel", channel)
+		req.Header.Set("X-Debug", "1")
+		req.Header.Set("X-Missing", "forged")
+		session := createNonThrottledSession()
+		session.Alias = "alice"
+		session.OauthClientID = "app-1"
+		session.MetaData = map[string]interface{}{"tenant": "acme"}
+		context.Set(req, SessionData, session)
+		context.Set(req, JWTClaims, map[string]interface{}{"sub": "user-42"})
+		return req
+	}
+
+	req := newRequest("web")
+	mw.ProcessRequest(httptest.NewRecorder(), req, nil)
+	expected := map[string]string{
+		"X-User":      "alice",
+		"X-Tenant":    "acme",
+		"X-Subject":   "user-42",
+		"X-Missing":   "",
+		"X-Debug":     "",
+		"X-Signature": "6fc87b9f94033ca6f4ec9fe28d9d9748fd594742bdac3817b4fc9348e8481ec6",
+	}
+	for name, value := range expected {
+		if got := req.Header.Get(name); got != value {
+			t.Errorf("Header %s should be %q, got %q", name, value, got)
+		}
+	}
+	context.Clear(req)
+
+	req = newRequest("mobile")
+	mw.ProcessRequest(httptest.NewRecorder(), req, nil)
+	if req.Header.Get("X-User") != "" || req.Header.Get("X-Debug") != "1" {
+		t.Error("Transforms should only apply when their conditions match, got: ", req.Header)
+	}
+
+	injector, _ := HeaderInjector{}.New(map[string]interface{}{}, spec)
+	res := &http.Response{StatusCode: 201, Header: http.Header{}, Body: ioutil.NopCloser(&bytes.Buffer{})}
+	injector.HandleResponse(httptest.NewRecorder(), res, req, nil)
+	if res.Header.Get("X-Served-For") != "app-1/201" {
+		t.Error("Response headers should be templated too, got: ", res.Header)
+	}
+	context.Clear(req)
+
+	if _, err := CompileHeaderInjection(apidef.HeaderInjectionMeta{TemplateHeaders: map[string]string{"X-Bad": "{{.Alias"}}); err == nil {
+		t.Error("Broken templates should fail to compile")
+	}
+	payloadCondition := &apidef.RoutingTriggerOptions{PayloadMatches: map[string]apidef.StringRegexMap{"id": {MatchPattern: ".*"}}}
+	if _, err := CompileHeaderInjection(apidef.HeaderInjectionMeta{Conditions: payloadCondition}); err == nil {
+		t.Error("Payload conditions should be rejected")
+	}
+}
@@ -7,7 +7,7 @@ import (
 	"strings"
 
 	"github.com/TykTechnologies/logrus"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/gorilla/context"
 )
 
@@ -41,8 +41,9 @@ func (k *Oauth2KeyExists) ProcessRequest(w http.ResponseWriter, r *http.Request,
 	parts := strings.Split(authHeaderValue, " ")
 	if len(parts) < 2 {
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"request_id": requestID(r),
 		}).Info("Attempted access with malformed header, no auth header found.")
 
 		return errors.New("Authorization field missing"), 400
@@ -50,8 +51,9 @@ func (k *Oauth2KeyExists) ProcessRequest(w http.ResponseWriter, r *http.Request,
 
 	if strings.ToLower(parts[0]) != "bearer" {
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"request_id": requestID(r),
 		}).Info("Bearer token malformed")
 
 		return errors.New("Bearer token malformed"), 400
@@ -62,9 +64,10 @@ func (k *Oauth2KeyExists) ProcessRequest(w http.ResponseWriter, r *http.Request,
 
 	if !keyExists {
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
-			"key":    accessToken,
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"key":        accessToken,
+			"request_id": requestID(r),
 		}).Info("Attempted access with non-existent key.")
 
 		// Fire Authfailed Event
@@ -76,7 +79,7 @@ func (k *Oauth2KeyExists) ProcessRequest(w http.ResponseWriter, r *http.Request,
 	}
 
 	// Set session state on context, we will need it later
-	if (k.TykMiddleware.Spec.BaseIdentityProvidedBy == tykcommon.OAuthKey) || (k.TykMiddleware.Spec.BaseIdentityProvidedBy == tykcommon.UnsetAuth) {
+	if (k.TykMiddleware.Spec.BaseIdentityProvidedBy == apidef.OAuthKey) || (k.TykMiddleware.Spec.BaseIdentityProvidedBy == apidef.UnsetAuth) {
 		context.Set(r, SessionData, thisSessionState)
 		context.Set(r, AuthHeaderValue, accessToken)
 	}
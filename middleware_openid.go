@@ -11,7 +11,7 @@ import (
 
 	"github.com/TykTechnologies/logrus"
 	"github.com/TykTechnologies/openid2go/openid"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/context"
 )
@@ -93,7 +93,8 @@ func (k *OpenIDMW) getProviders() ([]openid.Provider, error) {
 // We don't want any of the error handling, we use our own
 func (k *OpenIDMW) dummyErrorHandler(e error, w http.ResponseWriter, r *http.Request) bool {
 	log.WithFields(logrus.Fields{
-		"prefix": OIDPREFIX,
+		"prefix":     OIDPREFIX,
+		"request_id": requestID(r),
 	}).Warning("JWT Invalid: ", e)
 	return true
 }
@@ -120,7 +121,8 @@ func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, config
 
 	if !found && !cfound {
 		log.WithFields(logrus.Fields{
-			"prefix": OIDPREFIX,
+			"prefix":     OIDPREFIX,
+			"request_id": requestID(r),
 		}).Error("No issuer or audiences found!")
 		k.reportLoginFailure("[NOT GENERATED]", r)
 		return errors.New("Key not authorised"), 403
@@ -131,7 +133,8 @@ func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, config
 	k.lock.Unlock()
 	if !foundIssuer {
 		log.WithFields(logrus.Fields{
-			"prefix": OIDPREFIX,
+			"prefix":     OIDPREFIX,
+			"request_id": requestID(r),
 		}).Error("No issuer or audiences found!")
 		k.reportLoginFailure("[NOT GENERATED]", r)
 		return errors.New("Key not authorised"), 403
@@ -160,7 +163,8 @@ func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, config
 
 	if policyID == "" {
 		log.WithFields(logrus.Fields{
-			"prefix": OIDPREFIX,
+			"prefix":     OIDPREFIX,
+			"request_id": requestID(r),
 		}).Error("No matching policy found!")
 		k.reportLoginFailure("[NOT GENERATED]", r)
 		return errors.New("Key not authorised"), 403
@@ -191,7 +195,8 @@ func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, config
 		if err != nil {
 			k.reportLoginFailure(SessionID, r)
 			log.WithFields(logrus.Fields{
-				"prefix": OIDPREFIX,
+				"prefix":     OIDPREFIX,
+				"request_id": requestID(r),
 			}).Error("Could not find a valid policy to apply to this token!")
 			return errors.New("Key not authorized: no matching policy"), 403
 		}
@@ -207,10 +212,11 @@ func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, config
 	}
 
 	// 4. Set session state on context, we will need it later
-	if (k.TykMiddleware.Spec.BaseIdentityProvidedBy == tykcommon.OIDCUser) || (k.TykMiddleware.Spec.BaseIdentityProvidedBy == tykcommon.UnsetAuth) {
+	if (k.TykMiddleware.Spec.BaseIdentityProvidedBy == apidef.OIDCUser) || (k.TykMiddleware.Spec.BaseIdentityProvidedBy == apidef.UnsetAuth) {
 		context.Set(r, SessionData, thisSessionState)
 		context.Set(r, AuthHeaderValue, SessionID)
 	}
+	context.Set(r, JWTClaims, map[string]interface{}(token.Claims.(jwt.MapClaims)))
 	k.setContextVars(r, token)
 
 	return nil, 200
@@ -218,8 +224,9 @@ func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, config
 
 func (k *OpenIDMW) reportLoginFailure(tykId string, r *http.Request) {
 	log.WithFields(logrus.Fields{
-		"prefix": OIDPREFIX,
-		"key":    tykId,
+		"prefix":     OIDPREFIX,
+		"key":        tykId,
+		"request_id": requestID(r),
 	}).Warning("Attempted access with invalid key.")
 
 	// Fire Authfailed Event
@@ -83,9 +83,10 @@ func (k *OrganizationMonitor) ProcessRequestLive(w http.ResponseWriter, r *http.
 	// Is it active?
 	if thisSessionState.IsInactive {
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
-			"key":    k.Spec.OrgID,
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"key":        k.Spec.OrgID,
+			"request_id": requestID(r),
 		}).Warning("Organisation access is disabled.")
 
 		return errors.New("This organisation access has been disabled, please contact your API administrator."), 403
@@ -101,21 +102,22 @@ func (k *OrganizationMonitor) ProcessRequestLive(w http.ResponseWriter, r *http.
 	if !forwardMessage {
 		if reason == 2 {
 			log.WithFields(logrus.Fields{
-				"path":   r.URL.Path,
-				"origin": GetIPFromRequest(r),
-				"key":    k.Spec.OrgID,
+				"path":       r.URL.Path,
+				"origin":     GetIPFromRequest(r),
+				"key":        k.Spec.OrgID,
+				"request_id": requestID(r),
 			}).Warning("Organisation quota has been exceeded.")
 
 			// Fire a quota exceeded event
 			go k.TykMiddleware.FireEvent(EVENT_OrgQuotaExceeded,
 				EVENT_QuotaExceededMeta{
-					EventMetaDefault: EventMetaDefault{Message: "Organisation quota has been exceeded", OriginatingRequest: EncodeRequestToEvent(r)},
+					EventMetaDefault: EventMetaDefault{Message: "Organisation quota has been exceeded", OriginatingRequest: EncodeRequestToEvent(r), RequestID: requestID(r)},
 					Path:             r.URL.Path,
 					Origin:           GetIPFromRequest(r),
 					Key:              k.Spec.OrgID,
 				})
 
-			return errors.New("This organisation quota has been exceeded, please contact your API administrator"), 403
+			return newTypedError(ErrorTypeQuota, "This organisation quota has been exceeded, please contact your API administrator"), 403
 		}
 	}
 
@@ -193,9 +195,10 @@ func (k *OrganizationMonitor) AllowAccessNext(orgChan chan bool, r *http.Request
 	// Is it active?
 	if thisSessionState.IsInactive {
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
-			"key":    k.Spec.OrgID,
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"key":        k.Spec.OrgID,
+			"request_id": requestID(r),
 		}).Warning("Organisation access is disabled.")
 
 		//return errors.New("This organisation access has been disabled, please contact your API administrator."), 403
@@ -210,15 +213,16 @@ func (k *OrganizationMonitor) AllowAccessNext(orgChan chan bool, r *http.Request
 
 	if isQuotaExceeded {
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
-			"key":    k.Spec.OrgID,
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"key":        k.Spec.OrgID,
+			"request_id": requestID(r),
 		}).Warning("Organisation quota has been exceeded.")
 
 		// Fire a quota exceeded event
 		go k.TykMiddleware.FireEvent(EVENT_OrgQuotaExceeded,
 			EVENT_QuotaExceededMeta{
-				EventMetaDefault: EventMetaDefault{Message: "Organisation quota has been exceeded", OriginatingRequest: EncodeRequestToEvent(r)},
+				EventMetaDefault: EventMetaDefault{Message: "Organisation quota has been exceeded", OriginatingRequest: EncodeRequestToEvent(r), RequestID: requestID(r)},
 				Path:             r.URL.Path,
 				Origin:           GetIPFromRequest(r),
 				Key:              k.Spec.OrgID,
@@ -39,15 +39,16 @@ func (k *RateLimitAndQuotaCheck) IsEnabledForSpec() bool {
 
 func (k *RateLimitAndQuotaCheck) handleRateLimitFailure(w http.ResponseWriter, r *http.Request, authHeaderValue string) (error, int) {
 	log.WithFields(logrus.Fields{
-		"path":   r.URL.Path,
-		"origin": GetIPFromRequest(r),
-		"key":    authHeaderValue,
+		"path":       r.URL.Path,
+		"origin":     GetIPFromRequest(r),
+		"key":        authHeaderValue,
+		"request_id": requestID(r),
 	}).Info("Key rate limit exceeded.")
 
 	// Fire a rate limit exceeded event
 	go k.TykMiddleware.FireEvent(EVENT_RateLimitExceeded,
 		EVENT_RateLimitExceededMeta{
-			EventMetaDefault: EventMetaDefault{Message: "Key Rate Limit Exceeded", OriginatingRequest: EncodeRequestToEvent(r)},
+			EventMetaDefault: EventMetaDefault{Message: "Key Rate Limit Exceeded", OriginatingRequest: EncodeRequestToEvent(r), RequestID: requestID(r)},
 			Path:             r.URL.Path,
 			Origin:           GetIPFromRequest(r),
 			Key:              authHeaderValue,
@@ -56,20 +57,21 @@ func (k *RateLimitAndQuotaCheck) handleRateLimitFailure(w http.ResponseWriter, r
 	// Report in health check
 	ReportHealthCheckValue(k.Spec.Health, Throttle, "-1")
 
-	return errors.New("Rate limit exceeded"), 429
+	return newTypedError(ErrorTypeRateLimit, "Rate limit exceeded"), 429
 }
 
 func (k *RateLimitAndQuotaCheck) handleQuotaFailure(w http.ResponseWriter, r *http.Request, authHeaderValue string) (error, int) {
 	log.WithFields(logrus.Fields{
-		"path":   r.URL.Path,
-		"origin": GetIPFromRequest(r),
-		"key":    authHeaderValue,
+		"path":       r.URL.Path,
+		"origin":     GetIPFromRequest(r),
+		"key":        authHeaderValue,
+		"request_id": requestID(r),
 	}).Info("Key quota limit exceeded.")
 
 	// Fire a quota exceeded event
 	go k.TykMiddleware.FireEvent(EVENT_QuotaExceeded,
 		EVENT_QuotaExceededMeta{
-			EventMetaDefault: EventMetaDefault{Message: "Key Quota Limit Exceeded", OriginatingRequest: EncodeRequestToEvent(r)},
+			EventMetaDefault: EventMetaDefault{Message: "Key Quota Limit Exceeded", OriginatingRequest: EncodeRequestToEvent(r), RequestID: requestID(r)},
 			Path:             r.URL.Path,
 			Origin:           GetIPFromRequest(r),
 			Key:              authHeaderValue,
@@ -78,7 +80,7 @@ func (k *RateLimitAndQuotaCheck) handleQuotaFailure(w http.ResponseWriter, r *ht
 	// Report in health check
 	ReportHealthCheckValue(k.Spec.Health, QuotaViolation, "-1")
 
-	return errors.New("Quota exceeded"), 403
+	return newTypedError(ErrorTypeQuota, "Quota exceeded"), 403
 }
 
 // ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
@@ -212,6 +212,12 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 					return nil, 200
 				}
 
+				// Streams were sent on as they arrived, there is no body to cache
+				if isStreamingResponse(reqVal, m.Spec) {
+					log.Debug("Streamed response, not caching")
+					return nil, 666
+				}
+
 				// make sure the status codes match if specified
 				if len(m.Spec.APIDefinition.CacheOptions.CacheOnlyResponseCodes) > 0 {
 					foundCode := false
@@ -289,10 +295,16 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 				log.Error("Could not create response object: ", resErr)
 			}
 
+			// Cached bodies are stored as they are, compression is down to the client asking for it
+			if err := encodeResponseBody(newRes, r, &m.Spec.ResponseCompression, false); err != nil {
+				log.Error("Failed to compress cached response: ", err)
+			}
+
 			defer newRes.Body.Close()
 			for _, h := range hopHeaders {
 				newRes.Header.Del(h)
 			}
+			dropUpstreamRequestID(newRes.Header)
 
 			copyHeader(w.Header(), newRes.Header)
 			sessObj := context.Get(r, SessionData)
@@ -6,7 +6,7 @@ import (
 	"strconv"
 
 	"github.com/TykTechnologies/logrus"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 )
 
 // TransformMiddleware is a middleware that will apply a template to a request body to transform it's contents ready for an upstream API
@@ -55,10 +55,11 @@ func (t *RequestSizeLimitMiddleware) checkRequestLimit(r *http.Request, sizeLimi
 	// Check stated size
 	if int64(asInt) > sizeLimit {
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
-			"size":   statedCL,
-			"limit":  sizeLimit,
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"size":       statedCL,
+			"limit":      sizeLimit,
+			"request_id": requestID(r),
 		}).Info("Attempted access with large request size, blocked.")
 
 		return errors.New("Request is too large"), 400
@@ -68,10 +69,11 @@ func (t *RequestSizeLimitMiddleware) checkRequestLimit(r *http.Request, sizeLimi
 	if r.ContentLength > sizeLimit {
 		// Request size is too big for globals
 		log.WithFields(logrus.Fields{
-			"path":   r.URL.Path,
-			"origin": GetIPFromRequest(r),
-			"size":   r.ContentLength,
-			"limit":  sizeLimit,
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"size":       r.ContentLength,
+			"limit":      sizeLimit,
+			"request_id": requestID(r),
 		}).Info("Attempted access with large request size, blocked.")
 
 		return errors.New("Request is too large"), 400
@@ -114,7 +116,7 @@ func (t *RequestSizeLimitMiddleware) ProcessRequest(w http.ResponseWriter, r *ht
 
 	if stat == StatusRequestSizeControlled {
 		log.Debug("Request size limit matched for this URL, checking...")
-		thisMeta := meta.(*tykcommon.RequestSizeMeta)
+		thisMeta := meta.(*apidef.RequestSizeMeta)
 
 		return t.checkRequestLimit(r, thisMeta.SizeLimit)
 
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/TykTechnologies/logrus"
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/gorilla/context"
+)
+
+// SOAPMediation turns JSON requests into SOAP calls for legacy services, the proxy turns the SOAP
+// replies and faults back into JSON
+type SOAPMediation struct {
+	*TykMiddleware
+}
+
+type SOAPMediationConfig struct{}
+
+func (s *SOAPMediation) GetName() string {
+	return "SOAPMediation"
+}
+
+// New lets you do any initialisations for the object can be done here
+func (s *SOAPMediation) New() {}
+
+// GetConfig retrieves the configuration from the API config - we user mapstructure for this for simplicity
+func (s *SOAPMediation) GetConfig() (interface{}, error) {
+	return nil, nil
+}
+
+func (s *SOAPMediation) IsEnabledForSpec() bool {
+	for _, thisVersion := range s.TykMiddleware.Spec.VersionData.Versions {
+		if len(thisVersion.ExtendedPaths.SOAPMediation) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// soapRequestData reads the JSON body of a request, requests without a body use their query
+// parameters instead so that simple lookups can be made with a GET
+func soapRequestData(r *http.Request) (interface{}, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	bodyData, err := decodeMappingInput(apidef.RequestJSON, body)
+	if err != nil || bodyData != nil {
+		return bodyData, err
+	}
+
+	query := r.URL.Query()
+	if len(query) == 0 {
+		return nil, nil
+	}
+	fields := make(map[string]interface{}, len(query))
+	for k, v := range query {
+		fields[k] = v[0]
+	}
+
+	return fields, nil
+}
+
+// ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
+func (s *SOAPMediation) ProcessRequest(w http.ResponseWriter, r *http.Request, configuration interface{}) (error, int) {
+	_, versionPaths, _, _ := s.TykMiddleware.Spec.GetVersionData(r)
+	found, meta := s.TykMiddleware.Spec.CheckSpecMatchesStatus(r.URL.Path, r.Method, versionPaths, SOAPMediated)
+	if !found {
+		return nil, 200
+	}
+
+	thisMeta := meta.(*SOAPMediationSpec)
+	bodyData, err := soapRequestData(r)
+	var envelope []byte
+	if err == nil {
+		envelope, err = thisMeta.BuildEnvelope(bodyData)
+	}
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix":      "soap-mediation",
+			"server_name": s.Spec.APIDefinition.Proxy.TargetURL,
+			"api_id":      s.Spec.APIDefinition.APIID,
+			"path":        r.URL.Path,
+			"request_id":  requestID(r),
+		}).Info("Request could not be turned into a SOAP call: ", err)
+		return err, 400
+	}
+
+	r.Method = "POST"
+	r.URL.RawQuery = ""
+	r.Body = ioutil.NopCloser(bytes.NewReader(envelope))
+	r.ContentLength = int64(len(envelope))
+	r.Header.Del("Content-Length")
+	thisMeta.SetRequestHeaders(r.Header)
+
+	context.Set(r, SOAPMediationSpecKey, thisMeta)
+
+	return nil, 200
+}
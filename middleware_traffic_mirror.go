@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/TykTechnologies/logrus"
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/gorilla/context"
+)
+
+const (
+	defaultMirrorTimeout = 5
+	maxMirrorsInFlight   = 512
+	mirrorAnalyticsTag   = "tyk-mirror"
+)
+
+// mirrorsInFlight bounds the copies being sent at once, copies past it are dropped rather than queued
+var mirrorsInFlight = make(chan struct{}, maxMirrorsInFlight)
+
+// mirroredRequest is what is kept of a request to send copies of it once the chain has moved on
+type mirroredRequest struct {
+	method   string
+	path     string
+	rawQuery string
+	header   http.Header
+	body     []byte
+	record   *AnalyticsRecord
+}
+
+// TrafficMirror sends copies of requests to shadow targets without waiting on them, so new upstreams
+// can be tried against live traffic without clients seeing any of it
+type TrafficMirror struct {
+	*TykMiddleware
+}
+
+func (t *TrafficMirror) GetName() string {
+	return "TrafficMirror"
+}
+
+// New lets you do any initialisations for the object can be done here
+func (t *TrafficMirror) New() {}
+
+// GetConfig retrieves the configuration from the API config - we user mapstructure for this for simplicity
+func (t *TrafficMirror) GetConfig() (interface{}, error) {
+	return nil, nil
+}
+
+func (t *TrafficMirror) IsEnabledForSpec() bool {
+	if len(t.Spec.Mirror.Targets) > 0 {
+		return true
+	}
+	for _, thisVersion := range t.Spec.VersionData.Versions {
+		if len(thisVersion.ExtendedPaths.Mirror) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func mirrorSampled(samplePercent float64) bool {
+	if samplePercent <= 0 || samplePercent >= 100 {
+		return true
+	}
+	return rand.Float64()*100 < samplePercent
+}
+
+// ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
+func (t *TrafficMirror) ProcessRequest(w http.ResponseWriter, r *http.Request, configuration interface{}) (error, int) {
+	options := &t.Spec.Mirror
+	_, versionPaths, _, _ := t.Spec.GetVersionData(r)
+	if found, meta := t.Spec.CheckSpecMatchesStatus(r.URL.Path, r.Method, versionPaths, Mirrored); found {
+		options = &meta.(*apidef.MirrorMeta).MirrorOptions
+	}
+
+	if len(options.Targets) == 0 || IsWebsocket(r) || !mirrorSampled(options.SamplePercent) {
+		return nil, 200
+	}
+
+	// The body is buffered so the request and each of its copies get all of it
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix":     "mirror",
+				"path":       r.URL.Path,
+				"request_id": requestID(r),
+			}).Error("Failed to read request body: ", err)
+			return errors.New("Request body could not be read"), 400
+		}
+	}
+
+	path := r.URL.Path
+	if t.Spec.Proxy.StripListenPath {
+		path = strings.Replace(path, t.Spec.Proxy.ListenPath, "", 1)
+	}
+
+	thisCopy := &mirroredRequest{
+		method:   r.Method,
+		path:     path,
+		rawQuery: r.URL.RawQuery,
+		header:   make(http.Header),
+		body:     body,
+	}
+	copyHeader(thisCopy.header, r.Header)
+	for _, h := range hopHeaders {
+		thisCopy.header.Del(h)
+	}
+	if !options.ForwardAuth {
+		t.stripMirrorCredentials(thisCopy)
+	}
+	if options.RecordAnalytics && !t.Spec.DoNotTrack && config.StoreAnalytics(r) {
+		thisCopy.record = t.newMirrorRecord(r, path)
+	}
+
+	timeout := time.Duration(options.Timeout) * time.Second
+	if options.Timeout <= 0 {
+		timeout = defaultMirrorTimeout * time.Second
+	}
+
+	for _, target := range options.Targets {
+		select {
+		case mirrorsInFlight <- struct{}{}:
+			go func(target string) {
+				defer func() { <-mirrorsInFlight }()
+				t.sendMirror(target, thisCopy, timeout)
+			}(target)
+		default:
+			log.WithFields(logrus.Fields{
+				"prefix":     "mirror",
+				"target":     target,
+				"request_id": requestID(r),
+			}).Warning("Too many mirrored requests in flight, dropping copy")
+		}
+	}
+
+	return nil, 200
+}
+
+// stripMirrorCredentials keeps the client's key away from shadow targets, which are usually less
+// trusted than the upstream: the API's auth header and param, Authorization and Cookie are removed
+func (t *TrafficMirror) stripMirrorCredentials(thisCopy *mirroredRequest) {
+	authConfig := t.Spec.Auth
+	thisCopy.header.Del("Authorization")
+	thisCopy.header.Del("Cookie")
+	if authConfig.AuthHeaderName != "" {
+		thisCopy.header.Del(authConfig.AuthHeaderName)
+	}
+
+	paramName := authConfig.ParamName
+	if paramName == "" && authConfig.UseParam {
+		paramName = authConfig.AuthHeaderName
+	}
+	if paramName == "" || thisCopy.rawQuery == "" {
+		return
+	}
+	query, err := url.ParseQuery(thisCopy.rawQuery)
+	if err != nil {
+		// A query that can't be parsed can't be checked for the key either
+		thisCopy.rawQuery = ""
+		return
+	}
+	if _, found := query[paramName]; found {
+		query.Del(paramName)
+		thisCopy.rawQuery = query.Encode()
+	}
+}
+
+// newMirrorRecord sets up the analytics of a copy from its request, the outcome is filled in once
+// the shadow target answers
+func (t *TrafficMirror) newMirrorRecord(r *http.Request, path string) *AnalyticsRecord {
+	now := time.Now()
+	thisRecord := &AnalyticsRecord{
+		Method:        r.Method,
+		Path:          path,
+		RawPath:       path,
+		ContentLength: r.ContentLength,
+		UserAgent:     r.Header.Get("User-Agent"),
+		Day:           now.Day(),
+		Month:         now.Month(),
+		Year:          now.Year(),
+		Hour:          now.Hour(),
+		TimeStamp:     now,
+		APIVersion:    t.Spec.getVersionFromRequest(r),
+		APIName:       t.Spec.Name,
+		APIID:         t.Spec.APIID,
+		OrgID:         t.Spec.OrgID,
+		IPAddress:     GetIPFromRequest(r),
+		Tags:          []string{},
+		RequestID:     requestID(r),
+	}
+	if thisRecord.APIVersion == "" {
+		thisRecord.APIVersion = "Non Versioned"
+	}
+
+	if authHeaderValue, ok := context.Get(r, AuthHeaderValue).(string); ok {
+		thisRecord.APIKey = authHeaderValue
+	}
+	if thisSessionState, ok := context.Get(r, SessionData).(SessionState); ok {
+		thisRecord.OauthID = thisSessionState.OauthClientID
+		thisRecord.Alias = thisSessionState.Alias
+		thisRecord.Tags = append(thisRecord.Tags, thisSessionState.Tags...)
+	}
+
+	thisRecord.GetGeo(thisRecord.IPAddress)
+	thisRecord.SetExpiry(t.Spec.ExpireAnalyticsAfter)
+	if config.AnalyticsConfig.NormaliseUrls.Enabled {
+		thisRecord.NormalisePath()
+	}
+
+	return thisRecord
+}
+
+// sendMirror sends one copy and throws the response away, only the status and time it took are kept
+// for analytics
+func (t *TrafficMirror) sendMirror(target string, thisCopy *mirroredRequest, timeout time.Duration) {
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "mirror",
+			"api_id": t.Spec.APIID,
+			"target": target,
+		}).Error("Invalid mirror target: ", err)
+		return
+	}
+
+	shadowURL := *targetURL
+	shadowURL.Path = singleJoiningSlash(targetURL.Path, thisCopy.path)
+	if targetURL.RawQuery == "" || thisCopy.rawQuery == "" {
+		shadowURL.RawQuery = targetURL.RawQuery + thisCopy.rawQuery
+	} else {
+		shadowURL.RawQuery = targetURL.RawQuery + "&" + thisCopy.rawQuery
+	}
+
+	shadowReq, err := http.NewRequest(thisCopy.method, shadowURL.String(), bytes.NewReader(thisCopy.body))
+	if err != nil {
+		log.Error("Failed to create mirrored request: ", err)
+		return
+	}
+	copyHeader(shadowReq.Header, thisCopy.header)
+
+	client := &http.Client{
+		Transport: TykDefaultTransport,
+		Timeout:   timeout,
+		// Redirects are the shadow target's answer, following them would send traffic elsewhere
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	start := time.Now()
+	status := 0
+	res, err := client.Do(shadowReq)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix":     "mirror",
+			"target":     shadowURL.Host,
+			"request_id": thisCopy.header.Get(requestIDHeader()),
+		}).Debug("Mirrored request failed: ", err)
+	} else {
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+		status = res.StatusCode
+	}
+
+	if thisCopy.record != nil {
+		thisRecord := *thisCopy.record
+		thisRecord.ResponseCode = status
+		thisRecord.RequestTime = int64(time.Since(start) / time.Millisecond)
+		thisRecord.Tags = append(append([]string{}, thisCopy.record.Tags...), mirrorAnalyticsTag, mirrorAnalyticsTag+"-target-"+shadowURL.Host)
+
+		analytics.RecordHit(thisRecord)
+	}
+}
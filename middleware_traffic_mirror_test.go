@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var trafficMirrorDefinition = `
+
+	{
+		"name": "Tyk Test API",
+		"api_id": "1",
+		"org_id": "default",
+		"definition": {
+			"location": "header",
+			"key": "version"
+		},
+		"auth": {
+			"auth_header_name": "authorization"
+		},
+		"version_data": {
+			"not_versioned": true,
+			"versions": {
+				"Default": {
+					"name": "Default",
+					"use_extended_paths": true,
+					"extended_paths": {
+						"mirror": [{
+							"path": "/v1/orders",
+							"method": "POST",
+							"targets": ["PATH_TARGET"]
+						}]
+					}
+				}
+			}
+		},
+		"mirror": {
+			"targets": ["API_TARGET/shadow?from=tyk"],
+			"timeout": 1
+		},
+		"proxy": {
+			"listen_path": "/v1/",
+			"target_url": "http://example.com",
+			"strip_listen_path": true
+		}
+	}
+
+`
+
+type mirroredCall struct {
+	target, method, uri, body, header string
+}
+
+func TestTrafficMirror(t *testing.T) {
+	calls := make(chan mirroredCall, 4)
+	shadow := func(target string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			calls <- mirroredCall{target, r.Method, r.URL.RequestURI(), string(body), r.Header.Get("X-Test")}
+			w.WriteHeader(500)
+		}))
+	}
+	apiTarget, pathTarget := shadow("api"), shadow("path")
+	defer apiTarget.Close()
+	defer pathTarget.Close()
+
+	definition := strings.Replace(trafficMirrorDefinition, "API_TARGET", apiTarget.URL, 1)
+	definition = strings.Replace(definition, "PATH_TARGET", pathTarget.URL, 1)
+	spec := createDefinitionFromString(definition)
+	mw := &TrafficMirror{&TykMiddleware{spec, nil}}
+	if !mw.IsEnabledForSpec() {
+		t.Fatal("Mirroring should be enabled for the API")
+	}
+
+	call := func(method, path, body string) mirroredCall {
+		req, _ := http.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("X-Test", "copied")
+		if err, code := mw.ProcessRequest(httptest.NewRecorder(), req, nil); err != nil {
+			t.Fatal("Mirroring shouldn't fail the request, got: ", code, err)
+		}
+		if primaryBody, _ := ioutil.ReadAll(req.Body); string(primaryBody) != body {
+			t.Error("The request should keep its body, got: ", string(primaryBody))
+		}
+
+		select {
+		case received := <-calls:
+			return received
+		case <-time.After(2 * time.Second):
+			t.Fatal("Mirrored request never arrived")
+		}
+		return mirroredCall{}
+	}
+
+	expected := mirroredCall{"api", "PUT", "/shadow/users/1?from=tyk&debug=1", `{"name": "a"}`, "copied"}
+	if received := call("PUT", "/v1/users/1?debug=1", `{"name": "a"}`); received != expected {
+		t.Errorf("Expected the copy %v, got %v", expected, received)
+	}
+
+	expected = mirroredCall{"path", "POST", "/orders", "order", "copied"}
+	if received := call("POST", "/v1/orders", "order"); received != expected {
+		t.Errorf("Path settings should override the API's, expected %v, got %v", expected, received)
+	}
+}
+
+func TestTrafficMirrorSampling(t *testing.T) {
+	for _, percent := range []float64{0, 100, 150} {
+		if !mirrorSampled(percent) {
+			t.Error("Everything should be mirrored at ", percent)
+		}
+	}
+
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		if mirrorSampled(0.001) {
+			sampled++
+		}
+	}
+	if sampled > 10 {
+		t.Error("Low sample rates should mirror few requests, got: ", sampled)
+	}
+}
+
+func TestTrafficMirrorStripsCredentials(t *testing.T) {
+	requests := make(chan *http.Request, 2)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+	}))
+	defer shadow.Close()
+
+	definition := strings.Replace(trafficMirrorDefinition, "API_TARGET", shadow.URL, 1)
+	definition = strings.Replace(definition, `"auth_header_name": "authorization"`, `"auth_header_name": "x-api-key", "use_param": true`, 1)
+	spec := createDefinitionFromString(definition)
+	mw := &TrafficMirror{&TykMiddleware{spec, nil}}
+
+	call := func() *http.Request {
+		req, _ := http.NewRequest("GET", "/v1/users?x-api-key=secret&debug=1", nil)
+		req.Header.Set("X-Api-Key", "secret")
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("Cookie", "session=secret")
+		mw.ProcessRequest(httptest.NewRecorder(), req, nil)
+
+		select {
+		case received := <-requests:
+			return received
+		case <-time.After(2 * time.Second):
+			t.Fatal("Mirrored request never arrived")
+		}
+		return nil
+	}
+
+	received := call()
+	for name, values := range received.Header {
+		if strings.Contains(strings.Join(values, ","), "secret") {
+			t.Error("The shadow target should not see the key, got header: ", name)
+		}
+	}
+	if uri := received.URL.RequestURI(); strings.Contains(uri, "secret") || !strings.Contains(uri, "debug=1") {
+		t.Error("Only the key should be taken out of the query, got: ", uri)
+	}
+
+	spec.Mirror.ForwardAuth = true
+	received = call()
+	if received.Header.Get("X-Api-Key") != "secret" || received.URL.Query().Get("x-api-key") != "secret" {
+		t.Error("Credentials should be forwarded when asked to, got: ", received.Header, received.URL)
+	}
+}
@@ -3,12 +3,13 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
 
 	"github.com/TykTechnologies/logrus"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/clbanning/mxj"
 	"github.com/gorilla/context"
 	"golang.org/x/net/html/charset"
@@ -70,10 +71,39 @@ func (t *TransformMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Requ
 		defer r.Body.Close()
 		body, err := ioutil.ReadAll(r.Body)
 
+		if thisMeta.Mapping != nil {
+			var contextData, metaData interface{}
+			if thisMeta.TemplateMeta.TemplateData.EnableSession {
+				metaData = sessionMetaData(r)
+			}
+			if t.Spec.EnableContextVars {
+				contextData = context.Get(r, ContextData)
+			}
+
+			mapped, mapErr := applyJSONMapping(thisMeta.Mapping, thisMeta.TemplateMeta.TemplateData.Input, body, contextData, metaData)
+			if mapErr != nil {
+				log.WithFields(logrus.Fields{
+					"prefix":      "inbound-transform",
+					"server_name": t.Spec.APIDefinition.Proxy.TargetURL,
+					"api_id":      t.Spec.APIDefinition.APIID,
+					"path":        r.URL.Path,
+					"request_id":  requestID(r),
+				}).Error("Failed to apply mapping to request: ", mapErr)
+
+				// The upstream expects the mapped shape, the original body is not sent in its place
+				return errors.New("Request body could not be transformed: " + mapErr.Error()), 400
+			}
+
+			r.Header.Set("Content-Type", "application/json")
+			r.Body = ioutil.NopCloser(bytes.NewReader(mapped))
+			r.ContentLength = int64(len(mapped))
+			return nil, 200
+		}
+
 		// Put into an interface:
 		var bodyData interface{}
 		switch thisMeta.TemplateMeta.TemplateData.Input {
-		case tykcommon.RequestXML:
+		case apidef.RequestXML:
 			mxj.XmlCharsetReader = WrappedCharsetReader
 			var xErr error
 			bodyData, xErr = mxj.NewMapXml(body) // unmarshal
@@ -83,9 +113,10 @@ func (t *TransformMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Requ
 					"server_name": t.Spec.APIDefinition.Proxy.TargetURL,
 					"api_id":      t.Spec.APIDefinition.APIID,
 					"path":        r.URL.Path,
+					"request_id":  requestID(r),
 				}).Error("Error unmarshalling XML: ", xErr)
 			}
-		case tykcommon.RequestJSON:
+		case apidef.RequestJSON:
 			json.Unmarshal(body, &bodyData)
 		default:
 			// unset, assume an open field
@@ -117,6 +148,7 @@ func (t *TransformMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Requ
 				"server_name": t.Spec.APIDefinition.Proxy.TargetURL,
 				"api_id":      t.Spec.APIDefinition.APIID,
 				"path":        r.URL.Path,
+				"request_id":  requestID(r),
 			}).Error("Failed to apply template to request: ", err)
 		}
 		r.Body = ioutil.NopCloser(&bodyBuffer)
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"reflect"
@@ -8,30 +12,268 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/gorilla/context"
 )
 
 type URLRewriter struct{}
 
-func (u URLRewriter) Rewrite(thisMeta *tykcommon.URLRewriteMeta, path string, useContext bool, r *http.Request) (string, error) {
-	// Find all the matching groups:
-	mp, mpErr := regexp.Compile(thisMeta.MatchPattern)
-	if mpErr != nil {
-		log.Debug("Compilation error: ", mpErr)
-		return "", mpErr
+const (
+	triggerHeader  = "header"
+	triggerQuery   = "query"
+	triggerSession = "session"
+	triggerContext = "context"
+	triggerPayload = "payload"
+)
+
+var (
+	rewriteGroupMatch   = regexp.MustCompile(`\$\d+`)
+	rewriteContextMatch = regexp.MustCompile(`\$tyk_context.(\w+)`)
+	rewriteMetaMatch    = regexp.MustCompile(`\$tyk_meta.(\w+)`)
+)
+
+// URLRewriteSpec is a URL rewrite with its match pattern and triggers compiled
+type URLRewriteSpec struct {
+	apidef.URLRewriteMeta
+	MatchRegexp *regexp.Regexp
+	Triggers    []RoutingTriggerSpec
+	readsBody   bool
+}
+
+type RoutingTriggerSpec struct {
+	apidef.RoutingTrigger
+	Conditions []RoutingCondition
+}
+
+// RoutingCondition matches one value taken from the request, the source says where to find it
+type RoutingCondition struct {
+	Source  string
+	Key     string
+	Pattern *regexp.Regexp
+	Reverse bool
+}
+
+// CompileURLRewrite compiles the patterns of a rewrite, this is done once when the API is loaded
+func CompileURLRewrite(meta apidef.URLRewriteMeta) (URLRewriteSpec, error) {
+	rewriteSpec := URLRewriteSpec{URLRewriteMeta: meta}
+
+	var err error
+	if rewriteSpec.MatchRegexp, err = regexp.Compile(meta.MatchPattern); err != nil {
+		return rewriteSpec, err
+	}
+
+	for i, trigger := range meta.Triggers {
+		triggerSpec, err := CompileRoutingTrigger(trigger)
+		if err != nil {
+			return rewriteSpec, fmt.Errorf("trigger %d %v", i, err)
+		}
+		if len(trigger.Options.PayloadMatches) > 0 {
+			rewriteSpec.readsBody = true
+		}
+		rewriteSpec.Triggers = append(rewriteSpec.Triggers, triggerSpec)
+	}
+
+	return rewriteSpec, nil
+}
+
+// CompileRoutingTrigger compiles the match patterns of each of a trigger's conditions
+func CompileRoutingTrigger(trigger apidef.RoutingTrigger) (RoutingTriggerSpec, error) {
+	triggerSpec := RoutingTriggerSpec{RoutingTrigger: trigger}
+	sources := map[string]map[string]apidef.StringRegexMap{
+		triggerHeader:  trigger.Options.HeaderMatches,
+		triggerQuery:   trigger.Options.QueryValMatches,
+		triggerSession: trigger.Options.SessionMetaMatches,
+		triggerContext: trigger.Options.RequestContextMatches,
+		triggerPayload: trigger.Options.PayloadMatches,
+	}
+	for source, matches := range sources {
+		for key, match := range matches {
+			pattern, err := regexp.Compile(match.MatchPattern)
+			if err != nil {
+				return triggerSpec, fmt.Errorf("%s match %q: %v", source, key, err)
+			}
+			triggerSpec.Conditions = append(triggerSpec.Conditions, RoutingCondition{source, key, pattern, match.Reverse})
+		}
+	}
+
+	return triggerSpec, nil
+}
+
+// contextValueString flattens a context or session meta value so it can be matched or substituted
+func contextValueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []string:
+		// Remove empty start
+		return strings.TrimPrefix(strings.Join(v, ","), ",")
+	case url.Values:
+		end := len(v)
+		i := 0
+		nVal := ""
+		for key, val := range v {
+			nVal += key + ":" + strings.Join(val, ",")
+			if i < end-1 {
+				nVal += ";"
+			}
+			i++
+		}
+		return nVal
+	case bool, float64, int, int64, json.Number:
+		return fmt.Sprint(v)
+	default:
+		log.Error("Context variable type is not supported: ", reflect.TypeOf(value))
+	}
+	return ""
+}
+
+func sessionMetaData(r *http.Request) map[string]interface{} {
+	sess, sessFound := context.GetOk(r, SessionData)
+	if !sessFound {
+		return nil
+	}
+	metaData, _ := sess.(SessionState).MetaData.(map[string]interface{})
+	return metaData
+}
+
+// value finds the value a condition matches against, body is the decoded JSON payload if there is one
+func (c RoutingCondition) value(r *http.Request, body interface{}) (string, bool) {
+	switch c.Source {
+	case triggerHeader:
+		values, found := r.Header[http.CanonicalHeaderKey(c.Key)]
+		if !found || len(values) == 0 {
+			return "", false
+		}
+		return values[0], true
+	case triggerQuery:
+		values, found := r.URL.Query()[c.Key]
+		if !found || len(values) == 0 {
+			return "", false
+		}
+		return values[0], true
+	case triggerSession:
+		value, found := sessionMetaData(r)[c.Key]
+		if !found {
+			return "", false
+		}
+		return contextValueString(value), true
+	case triggerContext:
+		contextData, _ := context.Get(r, ContextData).(map[string]interface{})
+		value, found := contextData[c.Key]
+		if !found {
+			return "", false
+		}
+		return contextValueString(value), true
+	case triggerPayload:
+		// Payload keys are dotted paths into the JSON body, e.g. "user.address.country"
+		value := body
+		for _, part := range strings.Split(c.Key, ".") {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return "", false
+			}
+			if value, ok = object[part]; !ok {
+				return "", false
+			}
+		}
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			encoded, _ := json.Marshal(value)
+			return string(encoded), true
+		case nil:
+			return "", false
+		}
+		return contextValueString(value), true
+	}
+
+	return "", false
+}
+
+// Matches checks the trigger conditions against the request, "all" needs every condition to match
+// and anything else needs just one
+func (t *RoutingTriggerSpec) Matches(r *http.Request, body interface{}) bool {
+	if len(t.Conditions) == 0 {
+		return false
 	}
+
+	all := t.On == apidef.RoutingTriggerOnAll
+	for _, condition := range t.Conditions {
+		value, found := condition.value(r, body)
+		matched := found && condition.Pattern.MatchString(value)
+		if condition.Reverse {
+			matched = !matched
+		}
+		if matched != all {
+			return matched
+		}
+	}
+
+	return all
+}
+
+// requestPayload decodes a JSON request body for payload triggers and puts the body back for
+// the rest of the chain
+func requestPayload(r *http.Request) interface{} {
+	if r.Body == nil {
+		return nil
+	}
+
+	bodyBytes, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(bodyBytes))
+	if err != nil {
+		log.Warning("Could not read request body for rewrite triggers: ", err)
+		return nil
+	}
+
+	var payload interface{}
+	decoder := json.NewDecoder(bytes.NewReader(bodyBytes))
+	decoder.UseNumber()
+	if decoder.Decode(&payload) != nil {
+		return nil
+	}
+
+	return payload
+}
+
+func (u URLRewriter) Rewrite(thisMeta *apidef.URLRewriteMeta, path string, useContext bool, r *http.Request) (string, error) {
+	rewriteSpec, err := CompileURLRewrite(*thisMeta)
+	if err != nil {
+		log.Debug("Compilation error: ", err)
+		return "", err
+	}
+
+	return u.RewriteSpec(&rewriteSpec, path, useContext, r), nil
+}
+
+// RewriteSpec rewrites a path with a compiled rewrite, the first trigger that matches the request
+// picks the target and RewriteTo is used when none do
+func (u URLRewriter) RewriteSpec(thisMeta *URLRewriteSpec, path string, useContext bool, r *http.Request) string {
 	log.Debug("Inbound path: ", path)
 	newpath := path
+	rewriteTo := thisMeta.RewriteTo
 
-	result_slice := mp.FindAllStringSubmatch(path, -1)
+	result_slice := thisMeta.MatchRegexp.FindAllStringSubmatch(path, -1)
 	// Make sure it matches the string
 	log.Debug("Rewriter checking matches, len is: ", len(result_slice))
 	if len(result_slice) > 0 {
-		newpath = thisMeta.RewriteTo
+		if r != nil && len(thisMeta.Triggers) > 0 {
+			var body interface{}
+			if thisMeta.readsBody {
+				body = requestPayload(r)
+			}
+			for i := range thisMeta.Triggers {
+				if thisMeta.Triggers[i].Matches(r, body) {
+					log.Debug("Rewrite trigger matched: ", i)
+					rewriteTo = thisMeta.Triggers[i].RewriteTo
+					break
+				}
+			}
+		}
+
+		newpath = rewriteTo
 		// get the indices for the replacements:
-		dollarMatch, _ := regexp.Compile(`\$\d+`) // Prepare our regex
-		replace_slice := dollarMatch.FindAllStringSubmatch(thisMeta.RewriteTo, -1)
+		replace_slice := rewriteGroupMatch.FindAllStringSubmatch(rewriteTo, -1)
 
 		log.Debug(result_slice)
 		log.Debug(replace_slice)
@@ -49,104 +291,43 @@ func (u URLRewriter) Rewrite(thisMeta *tykcommon.URLRewriteMeta, path string, us
 
 		log.Debug("URL Re-written from: ", path)
 		log.Debug("URL Re-written to: ", newpath)
+	}
 
-		// matched?? Set the modified path
-		// return newpath, nil
+	if r == nil {
+		return newpath
 	}
 
 	if useContext {
 		log.Debug("Using context")
-		var contextData map[string]interface{}
-		cnt, contextFound := context.GetOk(r, ContextData)
+		contextData, contextFound := context.Get(r, ContextData).(map[string]interface{})
 
-		if contextFound {
-			contextData = cnt.(map[string]interface{})
-		}
-
-		dollarMatch, _ := regexp.Compile(`\$tyk_context.(\w+)`)
-		replace_slice := dollarMatch.FindAllStringSubmatch(thisMeta.RewriteTo, -1)
+		replace_slice := rewriteContextMatch.FindAllStringSubmatch(rewriteTo, -1)
 		for _, v := range replace_slice {
 			contextKey := strings.Replace(v[0], "$tyk_context.", "", 1)
 			log.Debug("Replacing: ", v[0])
 
 			if contextFound {
-				tempVal, ok := contextData[contextKey]
-				var nVal string
-				if ok {
-					switch tempVal.(type) {
-					case string:
-						nVal = tempVal.(string)
-					case []string:
-						nVal = strings.Join(tempVal.([]string), ",")
-						// Remove empty start
-						nVal = strings.TrimPrefix(nVal, ",")
-					case url.Values:
-						end := len(tempVal.(url.Values))
-						i := 0
-						nVal = ""
-						for key, val := range tempVal.(url.Values) {
-							nVal += key + ":" + strings.Join(val, ",")
-							if i < end-1 {
-								nVal += ";"
-							}
-							i++
-						}
-					default:
-						log.Error("Context variable type is not supported: ", reflect.TypeOf(tempVal))
-					}
-					newpath = strings.Replace(newpath, string(v[0]), url.QueryEscape(nVal), -1)
+				if tempVal, ok := contextData[contextKey]; ok {
+					newpath = strings.Replace(newpath, string(v[0]), url.QueryEscape(contextValueString(tempVal)), -1)
 				}
-
 			}
-
 		}
 	}
 
 	// Meta data from the token
-	sess, sessFound := context.GetOk(r, SessionData)
-	if sessFound {
-		thisSessionState := sess.(SessionState)
-
-		metaDollarMatch, _ := regexp.Compile(`\$tyk_meta.(\w+)`)
-		metaReplace_slice := metaDollarMatch.FindAllStringSubmatch(thisMeta.RewriteTo, -1)
+	if metaData := sessionMetaData(r); metaData != nil {
+		metaReplace_slice := rewriteMetaMatch.FindAllStringSubmatch(rewriteTo, -1)
 		for _, v := range metaReplace_slice {
 			contextKey := strings.Replace(v[0], "$tyk_meta.", "", 1)
 			log.Debug("Replacing: ", v[0])
 
-			tempVal, ok := thisSessionState.MetaData.(map[string]interface{})[contextKey]
-			if ok {
-				var nVal string
-				if ok {
-					switch tempVal.(type) {
-					case string:
-						nVal = tempVal.(string)
-					case []string:
-						nVal = strings.Join(tempVal.([]string), ",")
-						// Remove empty start
-						nVal = strings.TrimPrefix(nVal, ",")
-					case url.Values:
-						end := len(tempVal.(url.Values))
-						i := 0
-						nVal = ""
-						for key, val := range tempVal.(url.Values) {
-							nVal += key + ":" + strings.Join(val, ",")
-							if i < end-1 {
-								nVal += ";"
-							}
-							i++
-						}
-					default:
-						log.Error("Context variable type is not supported: ", reflect.TypeOf(tempVal))
-					}
-					newpath = strings.Replace(newpath, string(v[0]), url.QueryEscape(nVal), -1)
-				}
-
+			if tempVal, ok := metaData[contextKey]; ok {
+				newpath = strings.Replace(newpath, string(v[0]), url.QueryEscape(contextValueString(tempVal)), -1)
 			}
-
 		}
 	}
 
-	return newpath, nil
+	return newpath
 }
 
 // URLRewriteMiddleware Will rewrite an inbund URL to a matching outbound one, it can also handle dynamic variable substitution
@@ -210,13 +391,10 @@ func (m *URLRewriteMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 
 	if stat == StatusURLRewrite {
 		log.Debug("Rewriter active")
-		thisMeta := meta.(*tykcommon.URLRewriteMeta)
+		thisMeta := meta.(*URLRewriteSpec)
 		log.Debug(r.URL)
 		oldPath := r.URL.String()
-		p, pErr := m.Rewriter.Rewrite(thisMeta, r.URL.String(), true, r)
-		if pErr != nil {
-			return pErr, 500
-		}
+		p := m.Rewriter.RewriteSpec(thisMeta, r.URL.String(), true, r)
 
 		m.CheckHostRewrite(oldPath, p, r)
 
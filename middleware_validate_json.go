@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/TykTechnologies/logrus"
+)
+
+const defaultValidationErrorCode = 422
+
+// ValidateJSON is a middleware that checks request bodies against a JSON schema before they are proxied
+type ValidateJSON struct {
+	*TykMiddleware
+}
+
+type ValidateJSONConfig struct{}
+
+// New lets you do any initialisations for the object can be done here
+func (t *ValidateJSON) New() {}
+
+func (mw *ValidateJSON) GetName() string {
+	return "ValidateJSON"
+}
+
+// GetConfig retrieves the configuration from the API config - we user mapstructure for this for simplicity
+func (t *ValidateJSON) GetConfig() (interface{}, error) {
+	return nil, nil
+}
+
+func (t *ValidateJSON) IsEnabledForSpec() bool {
+	var used bool
+	for _, thisVersion := range t.TykMiddleware.Spec.VersionData.Versions {
+		if len(thisVersion.ExtendedPaths.ValidateJSON) > 0 {
+			used = true
+			break
+		}
+	}
+
+	return used
+}
+
+// ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
+func (t *ValidateJSON) ProcessRequest(w http.ResponseWriter, r *http.Request, configuration interface{}) (error, int) {
+	_, versionPaths, _, _ := t.TykMiddleware.Spec.GetVersionData(r)
+	found, meta := t.TykMiddleware.Spec.CheckSpecMatchesStatus(r.URL.Path, r.Method, versionPaths, ValidateJSONRequest)
+	if !found {
+		return nil, 200
+	}
+
+	thisMeta := meta.(*ValidateJSONSpec)
+
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		log.Error("Failed to read request body for validation: ", err)
+		return err, 400
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	validationErrors := thisMeta.Validator.ValidateBytes(body)
+	if len(validationErrors) == 0 {
+		return nil, 200
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix":     "validate-json",
+		"api_id":     t.Spec.APIDefinition.APIID,
+		"path":       r.URL.Path,
+		"origin":     GetIPFromRequest(r),
+		"errors":     len(validationErrors),
+		"request_id": requestID(r),
+	}).Info("Request body failed validation, blocked.")
+
+	code := thisMeta.ErrorResponseCode
+	if code == 0 {
+		code = defaultValidationErrorCode
+	}
+
+	return TypedError{ErrorTypeValidation, validationErrorMessage(validationErrors), validationErrors}, code
+}
+
+// validationErrorMessage lists where the body failed validation, so the client can see what to fix
+// whatever format the error is sent in
+func validationErrorMessage(validationErrors []JSONSchemaError) string {
+	failures := make([]string, len(validationErrors))
+	for i, validationError := range validationErrors {
+		pointer := validationError.Pointer
+		if pointer == "" {
+			pointer = "/"
+		}
+		failures[i] = pointer + ": " + validationError.Message
+	}
+
+	return "Request body failed validation: " + strings.Join(failures, "; ")
+}
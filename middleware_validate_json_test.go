@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var validateJSONDefinition = `
+
+	{
+		"name": "Tyk Test API",
+		"api_id": "1",
+		"org_id": "default",
+		"definition": {
+			"location": "header",
+			"key": "version"
+		},
+		"auth": {
+			"auth_header_name": "authorization"
+		},
+		"version_data": {
+			"not_versioned": true,
+			"versions": {
+				"Default": {
+					"name": "Default",
+					"use_extended_paths": true,
+					"extended_paths": {
+						"validate_json": [{
+							"path": "/v1/pets",
+							"method": "POST",
+							"schema": {
+								"type": "object",
+								"required": ["name", "tags"],
+								"additionalProperties": false,
+								"properties": {
+									"name": {"type": "string", "minLength": 2},
+									"age": {"type": "integer", "minimum": 0},
+									"tags": {"type": "array", "items": {"$ref": "#/definitions/tag"}, "uniqueItems": true}
+								},
+								"definitions": {
+									"tag": {"type": "string", "enum": ["cat", "dog"]}
+								}
+							}
+						}]
+					}
+				}
+			}
+		},
+		"proxy": {
+			"listen_path": "/v1",
+			"target_url": "http://example.com",
+			"strip_listen_path": false
+		}
+	}
+
+`
+
+func TestJSONSchemaValidation(t *testing.T) {
+	schema, err := CompileJSONSchema(map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id":    map[string]interface{}{"type": "integer", "exclusiveMinimum": 0.0},
+			"email": map[string]interface{}{"type": "string", "format": "email"},
+			"code":  map[string]interface{}{"type": "string", "pattern": "^[A-Z]{3}$"},
+			"kind":  map[string]interface{}{"oneOf": []interface{}{map[string]interface{}{"const": "a"}, map[string]interface{}{"const": "b"}}},
+			"note":  map[string]interface{}{"type": "string", "nullable": true},
+		},
+		"if":   map[string]interface{}{"required": []interface{}{"kind"}},
+		"then": map[string]interface{}{"required": []interface{}{"code"}},
+	})
+	if err != nil {
+		t.Fatal("Schema should compile: ", err)
+	}
+
+	if errs := schema.ValidateBytes([]byte(`{"id": 1, "email": "a@b.com", "kind": "a", "code": "ABC", "note": null}`)); len(errs) != 0 {
+		t.Error("Valid document should pass, got: ", errs)
+	}
+
+	errs := schema.ValidateBytes([]byte(`{"id": 0, "email": "nope", "kind": "c"}`))
+	pointers := map[string]bool{}
+	for _, e := range errs {
+		pointers[e.Pointer] = true
+	}
+	for _, expected := range []string{"/id", "/email", "/kind", "/code"} {
+		if !pointers[expected] {
+			t.Errorf("Expected an error at %s, got: %v", expected, errs)
+		}
+	}
+
+	if errs := schema.ValidateBytes([]byte(`{"id": 1.5}`)); len(errs) != 1 || errs[0].Pointer != "/id" {
+		t.Error("Fractional numbers are not integers, got: ", errs)
+	}
+
+	if _, err := CompileJSONSchema(map[string]interface{}{"pattern": "("}); err == nil {
+		t.Error("Invalid patterns should be rejected at compile time")
+	}
+
+	looping, err := CompileJSONSchema(map[string]interface{}{
+		"definitions": map[string]interface{}{"loop": map[string]interface{}{"$ref": "#/definitions/loop"}},
+		"properties":  map[string]interface{}{"child": map[string]interface{}{"$ref": "#/definitions/loop"}},
+	})
+	if err != nil {
+		t.Fatal("Schema should compile: ", err)
+	}
+	if errs := looping.ValidateBytes([]byte(`{"child": 1}`)); len(errs) != 1 || errs[0].Pointer != "/child" {
+		t.Error("Values under schemas nested too deep to follow should be rejected, got: ", errs)
+	}
+}
+
+func TestValidateJSONMiddleware(t *testing.T) {
+	spec := createDefinitionFromString(validateJSONDefinition)
+	mw := &ValidateJSON{&TykMiddleware{spec, nil}}
+
+	if !mw.IsEnabledForSpec() {
+		t.Fatal("Middleware should be enabled when validate_json paths exist")
+	}
+
+	valid := `{"name": "Rex", "tags": ["dog"]}`
+	req, _ := http.NewRequest("POST", "/v1/pets", bytes.NewBufferString(valid))
+	recorder := httptest.NewRecorder()
+	if err, code := mw.ProcessRequest(recorder, req, nil); err != nil || code != 200 {
+		t.Fatal("Valid body should be allowed, got: ", err, code)
+	}
+	if body, _ := ioutil.ReadAll(req.Body); string(body) != valid {
+		t.Error("Body should be restored for the upstream, got: ", string(body))
+	}
+
+	req, _ = http.NewRequest("POST", "/v1/pets", bytes.NewBufferString(`{"name": "R", "age": -1, "tags": ["dog", "dog", "fish"], "extra": true}`))
+	err, code := mw.ProcessRequest(httptest.NewRecorder(), req, nil)
+	if err == nil || code != 422 {
+		t.Fatal("Invalid body should be rejected with a 422, got: ", err, code)
+	}
+	if errorType := errorTypeFor(mw.GetName(), err, code); errorType != ErrorTypeValidation {
+		t.Error("Rejections should be validation errors so they can be overridden, got: ", errorType)
+	}
+
+	// Errors are listed in pointer order
+	message, last := err.Error(), 0
+	for _, pointer := range []string{"/age: ", "/extra: ", "/name: ", "/tags: ", "/tags/2: "} {
+		at := strings.Index(message, pointer)
+		if at < last {
+			t.Fatalf("Expected an error at %s, got: %s", pointer, message)
+		}
+		last = at
+	}
+
+	req, _ = http.NewRequest("POST", "/v1/pets", bytes.NewBufferString(`{"name":`))
+	if err, code := mw.ProcessRequest(httptest.NewRecorder(), req, nil); err == nil || code != 422 {
+		t.Error("Malformed JSON should be rejected, got: ", code)
+	}
+
+	req, _ = http.NewRequest("PUT", "/v1/pets", bytes.NewBufferString(`{"name":`))
+	if err, code := mw.ProcessRequest(httptest.NewRecorder(), req, nil); err != nil || code != 200 {
+		t.Error("Other methods should not be validated, got: ", code)
+	}
+}
+
+func TestValidateJSONErrorResponse(t *testing.T) {
+	spec := createDefinitionFromString(validateJSONDefinition)
+	spec.DoNotTrack = true
+	mw := &ValidateJSON{&TykMiddleware{spec, nil}}
+	handler := ErrorHandler{mw.TykMiddleware}
+
+	call := func(accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/v1/pets", bytes.NewBufferString(`{"name": "Rex", "tags": ["fish"], "extra": true}`))
+		req.RemoteAddr = "127.0.0.1:1234"
+		req.Header.Set("Accept", accept)
+		err, code := mw.ProcessRequest(httptest.NewRecorder(), req, nil)
+		if err == nil {
+			t.Fatal("Invalid body should be rejected")
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.HandleTypedError(recorder, req, errorTypeFor(mw.GetName(), err, code), err.Error(), code, errorDetailsFor(err))
+		return recorder
+	}
+
+	expected := []JSONSchemaError{
+		{"/extra", "Additional properties are not allowed"},
+		{"/tags/0", "Value is not one of the allowed values"},
+	}
+
+	var body struct {
+		Error  string            `json:"error"`
+		Errors []JSONSchemaError `json:"errors"`
+	}
+	recorder := call("application/json")
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal("JSON errors should decode: ", err, recorder.Body.String())
+	}
+	if recorder.Code != 422 || body.Error == "" || !reflect.DeepEqual(body.Errors, expected) {
+		t.Error("JSON errors should list each failure with its pointer, got: ", recorder.Code, recorder.Body.String())
+	}
+
+	var problem problemDetails
+	recorder = call("application/problem+json")
+	if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+		t.Fatal("Problem details should decode: ", err, recorder.Body.String())
+	}
+	if problem.Status != 422 || !reflect.DeepEqual(problem.Errors, expected) {
+		t.Error("Problem details should list each failure with its pointer, got: ", recorder.Body.String())
+	}
+}
@@ -2,10 +2,9 @@ package main
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
 
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 )
 
 // VersionCheck will check whether the version of the requested API the request is accessing has any restrictions on URL endpoints
@@ -32,16 +31,21 @@ func (a *VersionCheck) IsEnabledForSpec() bool {
 	return true
 }
 
-func (v *VersionCheck) DoMockReply(w http.ResponseWriter, meta interface{}) {
-	// Reply with some alternate data
-	thisMeta := meta.(*tykcommon.EndpointMethodMeta)
-	responseMessage := []byte(thisMeta.Data)
-	for header, value := range thisMeta.Headers {
+func (v *VersionCheck) DoMockReply(w http.ResponseWriter, r *http.Request, meta interface{}) {
+	// Reply with some alternate data, clients can pick one of the alternatives with a Prefer header
+	thisMeta := meta.(*apidef.EndpointMethodMeta)
+	response, applied := selectMockResponse(r, thisMeta)
+	responseMessage := []byte(response.Data)
+	for header, value := range response.Headers {
 		w.Header().Add(header, value)
 	}
 
-	w.WriteHeader(thisMeta.Code)
-	fmt.Fprintf(w, string(responseMessage))
+	if applied != "" {
+		w.Header().Set("Preference-Applied", applied)
+	}
+
+	w.WriteHeader(response.Code)
+	w.Write(responseMessage)
 	return
 }
 
@@ -53,7 +57,7 @@ func (v *VersionCheck) ProcessRequest(w http.ResponseWriter, r *http.Request, co
 		// Fire a versioning failure event
 		go v.TykMiddleware.FireEvent(EVENT_VersionFailure,
 			EVENT_VersionFailureMeta{
-				EventMetaDefault: EventMetaDefault{Message: "Attempted access to disallowed version / path.", OriginatingRequest: EncodeRequestToEvent(r)},
+				EventMetaDefault: EventMetaDefault{Message: "Attempted access to disallowed version / path.", OriginatingRequest: EncodeRequestToEvent(r), RequestID: requestID(r)},
 				Path:             r.URL.Path,
 				Origin:           GetIPFromRequest(r),
 				Key:              "",
@@ -64,7 +68,7 @@ func (v *VersionCheck) ProcessRequest(w http.ResponseWriter, r *http.Request, co
 
 	// We handle redirects before ignores in case we aren't using a whitelist
 	if stat == StatusRedirectFlowByReply {
-		v.DoMockReply(w, meta)
+		v.DoMockReply(w, r, meta)
 		return nil, 666
 	}
 
@@ -10,7 +10,7 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/gorilla/context"
 )
 
@@ -43,7 +43,7 @@ func (mw *VirtualEndpoint) GetName() string {
 	return "VirtualEndpoint"
 }
 
-func PreLoadVirtualMetaCode(meta *tykcommon.VirtualMeta, j *JSVM) {
+func PreLoadVirtualMetaCode(meta *apidef.VirtualMeta, j *JSVM) {
 	if j == nil {
 		log.Error("No JSVM loaded, cannot init methods")
 		return
@@ -131,7 +131,7 @@ func (d *VirtualEndpoint) ServeHTTPForCache(w http.ResponseWriter, r *http.Reque
 	}
 
 	t1 := time.Now().UnixNano()
-	thisMeta := meta.(*tykcommon.VirtualMeta)
+	thisMeta := meta.(*apidef.VirtualMeta)
 
 	// Create the proxy object
 	defer r.Body.Close()
@@ -224,7 +224,7 @@ func (d *VirtualEndpoint) ServeHTTPForCache(w http.ResponseWriter, r *http.Reque
 	// Handle response middleware
 	ResponseHandler := ResponseChain{}
 
-	chainErr := ResponseHandler.Go(d.TykMiddleware.Spec.ResponseChain, w, newResponse, r, &thisSessionState)
+	chainErr := ResponseHandler.Go(d.TykMiddleware.Spec, w, newResponse, r, &thisSessionState)
 	if chainErr != nil {
 		log.Error("Response chain failed! ", chainErr)
 	}
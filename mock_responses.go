@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+const maxMockSchemaDepth = 8
+
+// mockResponseCode picks the lowest success code an operation declares, "default" and
+// wildcard ranges are only used when nothing more specific exists
+func mockResponseCode(codes []string) (int, string) {
+	sort.Strings(codes)
+
+	fallback := ""
+	for _, code := range codes {
+		if len(code) == 3 && code[0] == '2' {
+			if parsed, err := strconv.Atoi(code); err == nil {
+				return parsed, code
+			}
+			if strings.ToUpper(code) == "2XX" {
+				fallback = code
+			}
+		}
+	}
+
+	if fallback != "" {
+		return 200, fallback
+	}
+
+	for _, code := range codes {
+		if code == "default" {
+			return 200, code
+		}
+	}
+
+	if len(codes) > 0 {
+		if parsed, err := strconv.Atoi(codes[0]); err == nil {
+			return parsed, codes[0]
+		}
+	}
+
+	return 200, ""
+}
+
+// mockCodeForKey turns a response key into a status code, ranges such as "4XX" use the
+// first code in the range and "default" is treated as an error unless it is the only response
+func mockCodeForKey(key string, defaultKey string, defaultCode int) int {
+	if key == defaultKey {
+		return defaultCode
+	}
+
+	if parsed, err := strconv.Atoi(key); err == nil {
+		return parsed
+	}
+
+	if len(key) == 3 && strings.ToUpper(key[1:]) == "XX" && key[0] >= '1' && key[0] <= '5' {
+		return int(key[0]-'0') * 100
+	}
+
+	return 500
+}
+
+func encodeMockBody(mediaType string, example interface{}) string {
+	if asString, isString := example.(string); isString && !strings.Contains(mediaType, "json") {
+		return asString
+	}
+
+	asJSON, err := json.Marshal(example)
+	if err != nil {
+		log.Warning("Could not encode example: ", err)
+		return ""
+	}
+
+	return string(asJSON)
+}
+
+// synthesiseSchemaExample builds a representative value for a JSON schema, explicit examples,
+// defaults and enums are used where they exist
+func synthesiseSchemaExample(schema map[string]interface{}, depth int) interface{} {
+	if schema == nil || depth > maxMockSchemaDepth {
+		return nil
+	}
+
+	for _, field := range []string{"example", "x-example", "default"} {
+		if value, found := schema[field]; found {
+			return value
+		}
+	}
+
+	if enum, isList := schema["enum"].([]interface{}); isList && len(enum) > 0 {
+		return enum[0]
+	}
+
+	for _, combiner := range []string{"oneOf", "anyOf"} {
+		if options, isList := schema[combiner].([]interface{}); isList && len(options) > 0 {
+			option, _ := options[0].(map[string]interface{})
+			return synthesiseSchemaExample(option, depth+1)
+		}
+	}
+
+	if parts, isList := schema["allOf"].([]interface{}); isList {
+		merged := make(map[string]interface{})
+		for _, part := range parts {
+			partSchema, _ := part.(map[string]interface{})
+			if asObject, isObject := synthesiseSchemaExample(partSchema, depth+1).(map[string]interface{}); isObject {
+				for k, v := range asObject {
+					merged[k] = v
+				}
+			}
+		}
+		return merged
+	}
+
+	schemaType, _ := schema["type"].(string)
+	if schemaType == "" {
+		if _, found := schema["properties"]; found {
+			schemaType = "object"
+		} else if _, found := schema["items"]; found {
+			schemaType = "array"
+		}
+	}
+
+	switch schemaType {
+	case "object":
+		object := make(map[string]interface{})
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, property := range properties {
+			propertySchema, _ := property.(map[string]interface{})
+			if value := synthesiseSchemaExample(propertySchema, depth+1); value != nil {
+				object[name] = value
+			}
+		}
+		if additional, isSchema := schema["additionalProperties"].(map[string]interface{}); isSchema && len(properties) == 0 {
+			if value := synthesiseSchemaExample(additional, depth+1); value != nil {
+				object["key"] = value
+			}
+		}
+		return object
+	case "array":
+		items, _ := schema["items"].(map[string]interface{})
+		if item := synthesiseSchemaExample(items, depth+1); item != nil {
+			return []interface{}{item}
+		}
+		return []interface{}{}
+	case "string":
+		switch schema["format"] {
+		case "date-time":
+			return "2017-01-01T00:00:00Z"
+		case "date":
+			return "2017-01-01"
+		case "email":
+			return "user@example.com"
+		case "uuid":
+			return "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+		case "uri", "url":
+			return "http://example.com"
+		case "byte":
+			return "c3RyaW5n"
+		case "ipv4":
+			return "127.0.0.1"
+		}
+		return "string"
+	case "integer":
+		if minimum, isNumber := schema["minimum"].(float64); isNumber {
+			return int64(minimum)
+		}
+		return 0
+	case "number":
+		if minimum, isNumber := schema["minimum"].(float64); isNumber {
+			return minimum
+		}
+		return 0.0
+	case "boolean":
+		return true
+	}
+
+	return nil
+}
+
+// newMockMethodMeta creates a reply action that answers with the default response, the
+// alternatives are only kept when there is more than one to choose from
+func newMockMethodMeta(defaultCode int, responses []apidef.MockResponseMeta) apidef.EndpointMethodMeta {
+	thisMethodAction := apidef.EndpointMethodMeta{}
+	thisMethodAction.Action = apidef.Reply
+	thisMethodAction.Code = defaultCode
+
+	for _, response := range responses {
+		if response.Code == defaultCode {
+			thisMethodAction.Data = response.Data
+			thisMethodAction.Headers = response.Headers
+			break
+		}
+	}
+
+	if len(responses) > 1 {
+		thisMethodAction.MockResponses = responses
+	}
+
+	return thisMethodAction
+}
+
+// parsePreferHeader reads "Prefer: code=404, example=missing" style preferences
+func parsePreferHeader(header string) map[string]string {
+	preferences := make(map[string]string)
+	for _, token := range strings.FieldsFunc(header, func(r rune) bool { return r == ',' || r == ';' }) {
+		parts := strings.SplitN(strings.TrimSpace(token), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		preferences[strings.ToLower(strings.TrimSpace(parts[0]))] = strings.Trim(strings.TrimSpace(parts[1]), "\"")
+	}
+
+	return preferences
+}
+
+// selectMockResponse picks the response a client asked for with the Prefer header, falling back
+// to the default response of the endpoint
+func selectMockResponse(r *http.Request, meta *apidef.EndpointMethodMeta) (apidef.MockResponseMeta, string) {
+	selected := apidef.MockResponseMeta{Code: meta.Code, Data: meta.Data, Headers: meta.Headers}
+
+	preferences := parsePreferHeader(r.Header.Get("Prefer"))
+	code, name := preferences["code"], preferences["example"]
+	if code == "" && name == "" {
+		return selected, ""
+	}
+
+	for _, response := range meta.MockResponses {
+		if code != "" && strconv.Itoa(response.Code) != code {
+			continue
+		}
+		if name != "" && response.Name != name {
+			continue
+		}
+
+		applied := []string{}
+		if code != "" {
+			applied = append(applied, "code="+code)
+		}
+		if name != "" {
+			applied = append(applied, "example="+name)
+		}
+		return response, strings.Join(applied, ", ")
+	}
+
+	log.Debug("No mock response matches the requested preference, using the default")
+	return selected, ""
+}
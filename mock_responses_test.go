@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+const swaggerMockTestDoc = `{
+	"swagger": "2.0",
+	"info": {"title": "Widgets", "version": "v1"},
+	"produces": ["application/json"],
+	"paths": {
+		"/widgets/{id}": {
+			"get": {
+				"responses": {
+					"200": {
+						"description": "A widget",
+						"headers": {"X-Rate": {"type": "integer", "default": 10}},
+						"schema": {"$ref": "#/definitions/Widget"}
+					},
+					"404": {
+						"description": "Not found",
+						"examples": {"application/json": {"error": "not found"}}
+					}
+				}
+			}
+		}
+	},
+	"definitions": {
+		"Widget": {
+			"type": "object",
+			"properties": {
+				"id": {"type": "string", "format": "uuid"},
+				"tags": {"type": "array", "items": {"type": "string", "enum": ["red", "blue"]}},
+				"size": {"type": "integer", "minimum": 3},
+				"parent": {"$ref": "#/definitions/Widget"}
+			}
+		}
+	}
+}`
+
+func TestSwaggerMockGeneration(t *testing.T) {
+	importer, _ := GetImporterForSource(SwaggerSource)
+	if err := importer.ReadString(swaggerMockTestDoc); err != nil {
+		t.Fatal("Import failed: ", err)
+	}
+
+	version, err := importer.ConvertIntoApiVersion(true)
+	if err != nil {
+		t.Fatal("Conversion failed: ", err)
+	}
+
+	meta := version.ExtendedPaths.WhiteList[0].MethodActions["GET"]
+	if meta.Code != 200 || meta.Headers["X-Rate"] != "10" || meta.Headers["Content-Type"] != "application/json" {
+		t.Error("Default response should be the success response, got: ", meta)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(meta.Data), &body); err != nil {
+		t.Fatal("Synthesised body should be JSON, got: ", meta.Data)
+	}
+
+	if body["id"] != "3fa85f64-5717-4562-b3fc-2c963f66afa6" || body["size"] != 3.0 {
+		t.Error("Synthesised body should follow the schema, got: ", body)
+	}
+
+	if tags, _ := body["tags"].([]interface{}); len(tags) != 1 || tags[0] != "red" {
+		t.Error("Arrays should be synthesised from their items, got: ", body["tags"])
+	}
+
+	if len(meta.MockResponses) != 2 {
+		t.Fatal("All responses should be kept as alternatives, got: ", meta.MockResponses)
+	}
+
+	r, _ := http.NewRequest("GET", "/widgets/1", nil)
+	r.Header.Set("Prefer", "code=404")
+	selected, applied := selectMockResponse(r, &meta)
+	if selected.Code != 404 || selected.Data != `{"error":"not found"}` || applied != "code=404" {
+		t.Error("Prefer header should select the 404 response, got: ", selected, applied)
+	}
+
+	r.Header.Set("Prefer", "code=418")
+	if selected, applied = selectMockResponse(r, &meta); selected.Code != 200 || applied != "" {
+		t.Error("Unknown preferences should fall back to the default response, got: ", selected)
+	}
+}
+
+func TestParsePreferHeader(t *testing.T) {
+	preferences := parsePreferHeader(`code=201; example="created", respond-async`)
+	if preferences["code"] != "201" || preferences["example"] != "created" || len(preferences) != 2 {
+		t.Error("Prefer header parsed incorrectly, got: ", preferences)
+	}
+}
@@ -27,12 +27,14 @@ func (m *MultiTargetProxy) getProxyForRequest(r *http.Request) (*ReverseProxy, e
 
 func (m *MultiTargetProxy) ServeHTTP(rw http.ResponseWriter, r *http.Request) *http.Response {
 	log.WithFields(logrus.Fields{
-		"prefix": "multi-target",
+		"prefix":     "multi-target",
+		"request_id": requestID(r),
 	}).Debug("Serving Multi-target...")
 	thisProxy, err := m.getProxyForRequest(r)
 	if err != nil {
 		log.WithFields(logrus.Fields{
-			"prefix": "multi-target",
+			"prefix":     "multi-target",
+			"request_id": requestID(r),
 		}).Warning("No proxy found, using default")
 		return m.defaultProxy.ServeHTTP(rw, r)
 	}
@@ -0,0 +1,800 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/lonelycode/go-uuid/uuid"
+	"github.com/lonelycode/osin"
+)
+
+const (
+	OpenAPISource APIImporterSource = "openapi"
+)
+
+var openAPIPathParam = regexp.MustCompile(`{[^/}]*}`)
+
+// openAPIString accepts plain and numeric values, YAML documents often carry "version: 1.0"
+type openAPIString string
+
+func (o *openAPIString) UnmarshalJSON(data []byte) error {
+	var asString string
+	if err := json.Unmarshal(data, &asString); err == nil {
+		*o = openAPIString(asString)
+		return nil
+	}
+
+	var asNumber json.Number
+	if err := json.Unmarshal(data, &asNumber); err != nil {
+		return err
+	}
+	*o = openAPIString(asNumber.String())
+	return nil
+}
+
+type OpenAPIServerVariable struct {
+	Default openAPIString `json:"default"`
+	Enum    []string      `json:"enum"`
+}
+
+type OpenAPIServer struct {
+	URL         string                           `json:"url"`
+	Description string                           `json:"description"`
+	Variables   map[string]OpenAPIServerVariable `json:"variables"`
+}
+
+type OpenAPIExample struct {
+	Summary string      `json:"summary"`
+	Value   interface{} `json:"value"`
+}
+
+type OpenAPIMediaType struct {
+	Schema   map[string]interface{}    `json:"schema"`
+	Example  interface{}               `json:"example"`
+	Examples map[string]OpenAPIExample `json:"examples"`
+}
+
+type OpenAPIHeader struct {
+	Description string                 `json:"description"`
+	Schema      map[string]interface{} `json:"schema"`
+	Example     interface{}            `json:"example"`
+}
+
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Headers     map[string]OpenAPIHeader    `json:"headers"`
+	Content     map[string]OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIRequestBody struct {
+	Description string                      `json:"description"`
+	Required    bool                        `json:"required"`
+	Content     map[string]OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary"`
+	Description string                     `json:"description"`
+	RequestBody *OpenAPIRequestBody        `json:"requestBody"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+	Security    *[]map[string][]string     `json:"security"`
+}
+
+type OpenAPIPathItem struct {
+	Get     *OpenAPIOperation `json:"get"`
+	Put     *OpenAPIOperation `json:"put"`
+	Post    *OpenAPIOperation `json:"post"`
+	Delete  *OpenAPIOperation `json:"delete"`
+	Options *OpenAPIOperation `json:"options"`
+	Head    *OpenAPIOperation `json:"head"`
+	Patch   *OpenAPIOperation `json:"patch"`
+	Trace   *OpenAPIOperation `json:"trace"`
+}
+
+type OpenAPISecurityScheme struct {
+	Type             string                            `json:"type"`
+	Name             string                            `json:"name"`
+	In               string                            `json:"in"`
+	Scheme           string                            `json:"scheme"`
+	BearerFormat     string                            `json:"bearerFormat"`
+	OpenIDConnectURL string                            `json:"openIdConnectUrl"`
+	Flows            map[string]map[string]interface{} `json:"flows"`
+}
+
+type OpenAPIAST struct {
+	OpenAPI string `json:"openapi"`
+	Info    struct {
+		Title       string        `json:"title"`
+		Description string        `json:"description"`
+		Version     openAPIString `json:"version"`
+	} `json:"info"`
+	Servers    []OpenAPIServer            `json:"servers"`
+	Paths      map[string]OpenAPIPathItem `json:"paths"`
+	Components struct {
+		Schemas         map[string]interface{}           `json:"schemas"`
+		SecuritySchemes map[string]OpenAPISecurityScheme `json:"securitySchemes"`
+	} `json:"components"`
+	Security []map[string][]string `json:"security"`
+}
+
+// ReadString accepts an OpenAPI 3 document as YAML or JSON, local $refs are resolved on load
+func (s *OpenAPIAST) ReadString(asString string) error {
+	doc, err := decodeYAML(asString)
+	if err != nil {
+		log.Error("Decoding failed: ", err)
+		return err
+	}
+
+	resolved := resolveOpenAPIRefs(doc, doc, map[string]bool{})
+	asJSON, err := json.Marshal(resolved)
+	if err != nil {
+		log.Error("Marshalling failed: ", err)
+		return err
+	}
+
+	if err := json.Unmarshal(asJSON, &s); err != nil {
+		log.Error("Marshalling failed: ", err)
+		return err
+	}
+
+	if !strings.HasPrefix(s.OpenAPI, "3.") {
+		return errors.New("Not an OpenAPI 3 document, use the swagger importer for Swagger 2.0 files")
+	}
+
+	return nil
+}
+
+// resolveOpenAPIRefs replaces local "$ref" objects with the node they point to, recursive
+// references are left in place
+func resolveOpenAPIRefs(node, root interface{}, resolving map[string]bool) interface{} {
+	switch typed := node.(type) {
+	case map[string]interface{}:
+		if ref, isRef := typed["$ref"].(string); isRef {
+			if !strings.HasPrefix(ref, "#/") {
+				log.Warning("External references are not supported, skipping: ", ref)
+				return typed
+			}
+
+			if resolving[ref] {
+				return typed
+			}
+
+			target, found := lookupJSONPointer(root, ref[1:])
+			if !found {
+				log.Warning("Could not resolve reference: ", ref)
+				return typed
+			}
+
+			resolving[ref] = true
+			resolved := resolveOpenAPIRefs(target, root, resolving)
+			delete(resolving, ref)
+			return resolved
+		}
+
+		resolved := make(map[string]interface{}, len(typed))
+		for k, v := range typed {
+			resolved[k] = resolveOpenAPIRefs(v, root, resolving)
+		}
+		return resolved
+	case []interface{}:
+		resolved := make([]interface{}, len(typed))
+		for i, v := range typed {
+			resolved[i] = resolveOpenAPIRefs(v, root, resolving)
+		}
+		return resolved
+	}
+
+	return node
+}
+
+func lookupJSONPointer(root interface{}, pointer string) (interface{}, bool) {
+	current := root
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if unescaped, err := url.QueryUnescape(token); err == nil {
+			token = unescaped
+		}
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+
+		switch typed := current.(type) {
+		case map[string]interface{}:
+			next, found := typed[token]
+			if !found {
+				return nil, false
+			}
+			current = next
+		case []interface{}:
+			idx, err := strconv.Atoi(token)
+			if err != nil || idx < 0 || idx >= len(typed) {
+				return nil, false
+			}
+			current = typed[idx]
+		default:
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+func (p OpenAPIPathItem) operations() map[string]*OpenAPIOperation {
+	operations := map[string]*OpenAPIOperation{}
+	for method, op := range map[string]*OpenAPIOperation{
+		"GET":     p.Get,
+		"PUT":     p.Put,
+		"POST":    p.Post,
+		"DELETE":  p.Delete,
+		"OPTIONS": p.Options,
+		"HEAD":    p.Head,
+		"PATCH":   p.Patch,
+		"TRACE":   p.Trace,
+	} {
+		if op != nil {
+			operations[method] = op
+		}
+	}
+
+	return operations
+}
+
+// openAPIPathsBySpecificity orders paths most specific first, Tyk uses the first path that matches
+// a request so /pets/mine has to come before /pets/{petId}
+type openAPIPathsBySpecificity []string
+
+func (p openAPIPathsBySpecificity) Len() int      { return len(p) }
+func (p openAPIPathsBySpecificity) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p openAPIPathsBySpecificity) Less(i, j int) bool {
+	iSegments, jSegments := strings.Split(p[i], "/"), strings.Split(p[j], "/")
+	if len(iSegments) != len(jSegments) {
+		return len(iSegments) > len(jSegments)
+	}
+
+	for n := range iSegments {
+		iParam, jParam := openAPIPathParam.MatchString(iSegments[n]), openAPIPathParam.MatchString(jSegments[n])
+		if iParam != jParam {
+			return jParam
+		}
+	}
+
+	return p[i] < p[j]
+}
+
+func (s *OpenAPIAST) sortedPaths() []string {
+	paths := make([]string, 0, len(s.Paths))
+	for pathName := range s.Paths {
+		paths = append(paths, pathName)
+	}
+	sort.Sort(openAPIPathsBySpecificity(paths))
+
+	return paths
+}
+
+// openAPIPathPattern turns a path template into the pattern requests are matched with, parameters only
+// match a single segment and the end is anchored so /pets doesn't match /pets/1, the start can't be as
+// requests still carry the listen path
+func openAPIPathPattern(pathName string) string {
+	pattern := ""
+	last := 0
+	for _, loc := range openAPIPathParam.FindAllStringIndex(pathName, -1) {
+		pattern += regexp.QuoteMeta(pathName[last:loc[0]]) + "[^/]+"
+		last = loc[1]
+	}
+
+	return pattern + regexp.QuoteMeta(pathName[last:]) + "$"
+}
+
+func (s *OpenAPIAST) ConvertIntoApiVersion(asMock bool) (apidef.VersionInfo, error) {
+	thisVersionInfo := apidef.VersionInfo{}
+	thisVersionInfo.UseExtendedPaths = true
+	thisVersionInfo.Name = strings.TrimSpace(string(s.Info.Version))
+	thisVersionInfo.ExtendedPaths.WhiteList = make([]apidef.EndPointMeta, 0)
+	thisVersionInfo.ExtendedPaths.ValidateJSON = make([]apidef.ValidatePathMeta, 0)
+	thisVersionInfo.ExtendedPaths.ValidateResponse = make([]apidef.ValidateResponseMeta, 0)
+
+	if len(s.Paths) == 0 {
+		return thisVersionInfo, errors.New("No paths defined in OpenAPI document!")
+	}
+
+	for _, pathName := range s.sortedPaths() {
+		pathPattern := openAPIPathPattern(pathName)
+		newEndpointMeta := apidef.EndPointMeta{}
+		newEndpointMeta.MethodActions = make(map[string]apidef.EndpointMethodMeta)
+		newEndpointMeta.Path = pathPattern
+
+		for methodName, op := range s.Paths[pathName].operations() {
+			thisMethodAction := apidef.EndpointMethodMeta{}
+			thisMethodAction.Action = apidef.NoAction
+
+			if asMock {
+				thisMethodAction = openAPIMockMethodMeta(op)
+			}
+
+			newEndpointMeta.MethodActions[methodName] = thisMethodAction
+
+			if schema := s.requestBodySchema(op); schema != nil {
+				thisVersionInfo.ExtendedPaths.ValidateJSON = append(thisVersionInfo.ExtendedPaths.ValidateJSON, apidef.ValidatePathMeta{
+					Path:   pathPattern,
+					Method: methodName,
+					Schema: schema,
+				})
+			}
+
+			// Mocked endpoints never reach the upstream so there is nothing to check
+			if schemas := s.responseSchemas(op); !asMock && len(schemas) > 0 {
+				thisVersionInfo.ExtendedPaths.ValidateResponse = append(thisVersionInfo.ExtendedPaths.ValidateResponse, apidef.ValidateResponseMeta{
+					Path:    pathPattern,
+					Method:  methodName,
+					Schemas: schemas,
+				})
+			}
+		}
+
+		if len(newEndpointMeta.MethodActions) > 0 {
+			thisVersionInfo.ExtendedPaths.WhiteList = append(thisVersionInfo.ExtendedPaths.WhiteList, newEndpointMeta)
+		}
+	}
+
+	return thisVersionInfo, nil
+}
+
+// requestBodySchema returns the JSON schema of an operation's request body, if it has one
+func (s *OpenAPIAST) requestBodySchema(op *OpenAPIOperation) map[string]interface{} {
+	if op.RequestBody == nil {
+		return nil
+	}
+
+	mediaType, media, found := chooseMediaType(op.RequestBody.Content)
+	if !found || !strings.Contains(mediaType, "json") || len(media.Schema) == 0 {
+		return nil
+	}
+
+	return validationSchema(media.Schema, map[string]interface{}{
+		"components": map[string]interface{}{"schemas": s.Components.Schemas},
+	})
+}
+
+// responseSchemas returns the JSON schemas of an operation's responses keyed by status code
+func (s *OpenAPIAST) responseSchemas(op *OpenAPIOperation) map[string]map[string]interface{} {
+	schemas := make(map[string]map[string]interface{})
+	for code, response := range op.Responses {
+		mediaType, media, found := chooseMediaType(response.Content)
+		if !found || !strings.Contains(mediaType, "json") || len(media.Schema) == 0 {
+			continue
+		}
+
+		schemas[code] = validationSchema(media.Schema, map[string]interface{}{
+			"components": map[string]interface{}{"schemas": s.Components.Schemas},
+		})
+	}
+
+	return schemas
+}
+
+// validationSchema makes a schema self contained, recursive references are not resolved on
+// import so the documents they point into are carried along with the schema
+func validationSchema(schema map[string]interface{}, refRoot map[string]interface{}) map[string]interface{} {
+	if !schemaContainsRef(schema) {
+		return schema
+	}
+
+	withRefs := make(map[string]interface{}, len(schema)+len(refRoot))
+	for k, v := range refRoot {
+		withRefs[k] = v
+	}
+	for k, v := range schema {
+		withRefs[k] = v
+	}
+
+	return withRefs
+}
+
+func schemaContainsRef(node interface{}) bool {
+	switch typed := node.(type) {
+	case map[string]interface{}:
+		if _, found := typed["$ref"]; found {
+			return true
+		}
+		for _, v := range typed {
+			if schemaContainsRef(v) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, v := range typed {
+			if schemaContainsRef(v) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (s *OpenAPIAST) InsertIntoAPIDefinitionAsVersion(thisVersion apidef.VersionInfo, thisDefinition *apidef.APIDefinition, versionName string) error {
+	thisDefinition.VersionData.NotVersioned = false
+	thisDefinition.VersionData.Versions[versionName] = thisVersion
+	enableResponseValidation(thisDefinition)
+	return nil
+}
+
+// chooseMediaType prefers JSON, otherwise the first media type in alphabetical order
+func chooseMediaType(content map[string]OpenAPIMediaType) (string, OpenAPIMediaType, bool) {
+	if len(content) == 0 {
+		return "", OpenAPIMediaType{}, false
+	}
+
+	mediaTypes := make([]string, 0, len(content))
+	for mediaType := range content {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	sort.Strings(mediaTypes)
+
+	for _, mediaType := range mediaTypes {
+		if strings.Contains(mediaType, "json") {
+			return mediaType, content[mediaType], true
+		}
+	}
+
+	return mediaTypes[0], content[mediaTypes[0]], true
+}
+
+// openAPIExample returns the example for a media type, falling back to the first named
+// example and then to an example on the schema
+func openAPIExample(media OpenAPIMediaType) (interface{}, bool) {
+	if media.Example != nil {
+		return media.Example, true
+	}
+
+	if len(media.Examples) > 0 {
+		names := make([]string, 0, len(media.Examples))
+		for name := range media.Examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return media.Examples[names[0]].Value, true
+	}
+
+	if example, found := media.Schema["example"]; found {
+		return example, true
+	}
+
+	return nil, false
+}
+
+// openAPIResponseVariants returns a mock response for every named example of a response,
+// bodies are synthesised from the schema when there are no examples
+func openAPIResponseVariants(code int, response OpenAPIResponse) []apidef.MockResponseMeta {
+	headers := make(map[string]string)
+	for name, header := range response.Headers {
+		example := header.Example
+		if example == nil {
+			example = synthesiseSchemaExample(header.Schema, 0)
+		}
+		if example != nil {
+			headers[name] = strings.Trim(encodeMockBody("", example), "\"")
+		}
+	}
+
+	mediaType, media, found := chooseMediaType(response.Content)
+	if !found {
+		return []apidef.MockResponseMeta{{Code: code, Headers: headers}}
+	}
+	headers["Content-Type"] = mediaType
+
+	if len(media.Examples) > 1 {
+		names := make([]string, 0, len(media.Examples))
+		for name := range media.Examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		variants := []apidef.MockResponseMeta{}
+		for _, name := range names {
+			variants = append(variants, apidef.MockResponseMeta{
+				Name:    name,
+				Code:    code,
+				Data:    encodeMockBody(mediaType, media.Examples[name].Value),
+				Headers: headers,
+			})
+		}
+		return variants
+	}
+
+	variant := apidef.MockResponseMeta{Code: code, Headers: headers}
+	if example, found := openAPIExample(media); found {
+		variant.Data = encodeMockBody(mediaType, example)
+	} else if strings.Contains(mediaType, "json") {
+		if example := synthesiseSchemaExample(media.Schema, 0); example != nil {
+			variant.Data = encodeMockBody(mediaType, example)
+		}
+	}
+
+	return []apidef.MockResponseMeta{variant}
+}
+
+func openAPIMockMethodMeta(op *OpenAPIOperation) apidef.EndpointMethodMeta {
+	codes := make([]string, 0, len(op.Responses))
+	for code := range op.Responses {
+		codes = append(codes, code)
+	}
+
+	defaultCode, defaultKey := mockResponseCode(codes)
+	sort.Strings(codes)
+
+	responses := []apidef.MockResponseMeta{}
+	for _, key := range codes {
+		code := mockCodeForKey(key, defaultKey, defaultCode)
+		responses = append(responses, openAPIResponseVariants(code, op.Responses[key])...)
+	}
+
+	return newMockMethodMeta(defaultCode, responses)
+}
+
+// ServerURLs returns the absolute server URLs of the document with their variables set to the defaults
+func (s *OpenAPIAST) ServerURLs() []string {
+	urls := []string{}
+	for _, server := range s.Servers {
+		serverURL := server.URL
+		for name, variable := range server.Variables {
+			serverURL = strings.Replace(serverURL, "{"+name+"}", string(variable.Default), -1)
+		}
+
+		if !strings.HasPrefix(serverURL, "http://") && !strings.HasPrefix(serverURL, "https://") {
+			log.Warning("Skipping relative server URL: ", serverURL)
+			continue
+		}
+
+		urls = append(urls, serverURL)
+	}
+
+	return urls
+}
+
+// securityRequirement returns the security requirement that applies to the API, Tyk can only
+// use one auth mode per API so the global requirement wins over those set on operations
+func (s *OpenAPIAST) securityRequirement() []map[string][]string {
+	if len(s.Security) > 0 {
+		return s.Security
+	}
+
+	for _, pathName := range s.sortedPaths() {
+		for _, op := range s.Paths[pathName].operations() {
+			if op.Security != nil && len(*op.Security) > 0 {
+				return *op.Security
+			}
+		}
+	}
+
+	return nil
+}
+
+// ApplySecurity maps the first usable security scheme onto the matching auth mode, APIs without
+// security requirements stay keyless
+func (s *OpenAPIAST) ApplySecurity(thisDefinition *apidef.APIDefinition) {
+	for _, requirement := range s.securityRequirement() {
+		names := make([]string, 0, len(requirement))
+		for name := range requirement {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			scheme, found := s.Components.SecuritySchemes[name]
+			if !found {
+				log.Warning("Security scheme not defined: ", name)
+				continue
+			}
+
+			if applySecurityScheme(scheme, thisDefinition) {
+				thisDefinition.UseKeylessAccess = false
+				return
+			}
+		}
+	}
+}
+
+func applySecurityScheme(scheme OpenAPISecurityScheme, thisDefinition *apidef.APIDefinition) bool {
+	switch scheme.Type {
+	case "apiKey":
+		thisDefinition.UseStandardAuth = true
+		thisDefinition.Auth.AuthHeaderName = scheme.Name
+		switch scheme.In {
+		case "query":
+			thisDefinition.Auth.UseParam = true
+			thisDefinition.Auth.ParamName = scheme.Name
+		case "cookie":
+			thisDefinition.Auth.UseCookie = true
+			thisDefinition.Auth.CookieName = scheme.Name
+		}
+		return true
+
+	case "http":
+		switch strings.ToLower(scheme.Scheme) {
+		case "basic":
+			thisDefinition.UseBasicAuth = true
+			return true
+		case "bearer":
+			if strings.ToUpper(scheme.BearerFormat) == "JWT" {
+				thisDefinition.EnableJWT = true
+				thisDefinition.Auth.AuthHeaderName = "Authorization"
+				log.Warning("JWT auth enabled, the signing method and source must be set before the API is loaded")
+				return true
+			}
+			thisDefinition.UseStandardAuth = true
+			thisDefinition.Auth.AuthHeaderName = "Authorization"
+			return true
+		}
+		log.Warning("Unsupported HTTP auth scheme: ", scheme.Scheme)
+
+	case "oauth2":
+		thisDefinition.UseOauth2 = true
+		thisDefinition.Auth.AuthHeaderName = "Authorization"
+		for flowName := range scheme.Flows {
+			switch flowName {
+			case "authorizationCode":
+				thisDefinition.Oauth2Meta.AllowedAccessTypes = append(thisDefinition.Oauth2Meta.AllowedAccessTypes, osin.AUTHORIZATION_CODE, osin.REFRESH_TOKEN)
+				thisDefinition.Oauth2Meta.AllowedAuthorizeTypes = append(thisDefinition.Oauth2Meta.AllowedAuthorizeTypes, osin.CODE)
+			case "implicit":
+				thisDefinition.Oauth2Meta.AllowedAuthorizeTypes = append(thisDefinition.Oauth2Meta.AllowedAuthorizeTypes, osin.TOKEN)
+			case "password":
+				thisDefinition.Oauth2Meta.AllowedAccessTypes = append(thisDefinition.Oauth2Meta.AllowedAccessTypes, osin.PASSWORD)
+			case "clientCredentials":
+				thisDefinition.Oauth2Meta.AllowedAccessTypes = append(thisDefinition.Oauth2Meta.AllowedAccessTypes, osin.CLIENT_CREDENTIALS)
+			}
+		}
+		return true
+
+	case "openIdConnect":
+		thisDefinition.UseOpenID = true
+		issuer := strings.TrimSuffix(scheme.OpenIDConnectURL, "/.well-known/openid-configuration")
+		thisDefinition.OpenIDOptions.Providers = []apidef.OIDProviderConfig{
+			{Issuer: issuer, ClientIDs: map[string]string{}},
+		}
+		return true
+	}
+
+	return false
+}
+
+// Comand mode stuff
+
+func handleOpenAPIMode(arguments map[string]interface{}) {
+	doCreate := arguments["--create-api"]
+	inputFile := arguments["--import-openapi"]
+	if doCreate == true {
+		orgId := arguments["--org-id"]
+		if orgId == nil {
+			log.Error("No org ID defined, this is required")
+			return
+		}
+
+		s, err := openAPILoadFile(inputFile.(string))
+		if err != nil {
+			log.Error("File load error: ", err)
+			return
+		}
+
+		upstreamURL := ""
+		if upstreamVal := arguments["--upstream-target"]; upstreamVal != nil {
+			upstreamURL = upstreamVal.(string)
+		}
+
+		def, dErr := createDefFromOpenAPI(s, orgId.(string), upstreamURL, arguments["--as-mock"].(bool))
+		if dErr != nil {
+			log.Error("Failed to create API Defintition from file: ", dErr)
+			return
+		}
+
+		printDef(def)
+		return
+	}
+
+	forApiPath := arguments["--for-api"]
+	if forApiPath == nil {
+		log.Error("If ading to an API, the path to the defintiton must be listed")
+		return
+	}
+
+	versionName := arguments["--as-version"]
+	if versionName == nil {
+		log.Error("No version defined for this import operation, please set an import ID using the --as-version flag")
+		return
+	}
+
+	thisDefFromFile, fileErr := apiDefLoadFile(forApiPath.(string))
+	if fileErr != nil {
+		log.Error("failed to load and decode file data for API Definition: ", fileErr)
+		return
+	}
+
+	s, err := openAPILoadFile(inputFile.(string))
+	if err != nil {
+		log.Error("File load error: ", err)
+		return
+	}
+
+	versionData, err := s.ConvertIntoApiVersion(arguments["--as-mock"].(bool))
+	if err != nil {
+		log.Error("Conversion into API Def failed: ", err)
+		return
+	}
+
+	if insertErr := s.InsertIntoAPIDefinitionAsVersion(versionData, thisDefFromFile, versionName.(string)); insertErr != nil {
+		log.Error("Insertion failed: ", insertErr)
+		return
+	}
+
+	printDef(thisDefFromFile)
+}
+
+// createDefFromOpenAPI builds an API definition, the upstream defaults to the servers in the
+// document when no target is given and several servers are load balanced
+func createDefFromOpenAPI(s *OpenAPIAST, orgId, upstreamURL string, asMock bool) (*apidef.APIDefinition, error) {
+	thisAD := apidef.APIDefinition{}
+	thisAD.Name = s.Info.Title
+	thisAD.Active = true
+	thisAD.UseKeylessAccess = true
+	thisAD.APIID = uuid.NewUUID().String()
+	thisAD.OrgID = orgId
+	thisAD.VersionDefinition.Key = "version"
+	thisAD.VersionDefinition.Location = "header"
+	thisAD.VersionData.Versions = make(map[string]apidef.VersionInfo)
+	thisAD.VersionData.NotVersioned = false
+	thisAD.Proxy.ListenPath = "/" + thisAD.APIID + "/"
+	thisAD.Proxy.StripListenPath = true
+
+	if upstreamURL != "" {
+		thisAD.Proxy.TargetURL = upstreamURL
+	} else {
+		servers := s.ServerURLs()
+		if len(servers) == 0 && !asMock {
+			return nil, errors.New("no upstream target given and the document has no absolute server URLs")
+		}
+		if len(servers) > 0 {
+			thisAD.Proxy.TargetURL = servers[0]
+		}
+		if len(servers) > 1 {
+			thisAD.Proxy.EnableLoadBalancing = true
+			thisAD.Proxy.Targets = servers
+		}
+	}
+
+	s.ApplySecurity(&thisAD)
+
+	versionData, err := s.ConvertIntoApiVersion(asMock)
+	if err != nil {
+		return nil, err
+	}
+
+	s.InsertIntoAPIDefinitionAsVersion(versionData, &thisAD, strings.TrimSpace(string(s.Info.Version)))
+
+	return &thisAD, nil
+}
+
+func openAPILoadFile(filePath string) (*OpenAPIAST, error) {
+	thisOpenAPI, astErr := GetImporterForSource(OpenAPISource)
+	if astErr != nil {
+		log.Error("Couldn't get OpenAPI importer: ", astErr)
+		return nil, astErr
+	}
+
+	openAPIFileData, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		log.Error("Couldn't load OpenAPI file: ", err)
+		return nil, err
+	}
+
+	if readErr := thisOpenAPI.ReadString(string(openAPIFileData)); readErr != nil {
+		log.Error("Failed to decode object")
+		return nil, readErr
+	}
+
+	return thisOpenAPI.(*OpenAPIAST), nil
+}
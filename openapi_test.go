@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+const openAPITestDoc = `openapi: 3.0.1
+info:
+  title: Pet Store
+  version: 1.0 # numeric versions are common
+  description: |
+    Multi line
+    description
+servers:
+  - url: https://{region}.pets.example.com/v1
+    variables:
+      region:
+        default: eu
+  - url: https://backup.pets.example.com/v1
+  - url: /relative
+security:
+  - api_key: []
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      responses:
+        '200':
+          description: A list of pets
+          headers:
+            X-Total:
+              schema:
+                type: integer
+                example: 2
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: '#/components/schemas/Pet'
+              examples:
+                two:
+                  value: [{id: 1, name: "Rex"}, {id: 2, name: 'Fido'}]
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+      responses:
+        "201":
+          description: Created
+        default:
+          description: Error
+  /pets/{petId}:
+    get:
+      responses:
+        2XX:
+          description: A pet
+          content:
+            text/plain:
+              example: Rex
+components:
+  schemas:
+    Pet:
+      type: object
+      required: [id, name]
+      properties:
+        id:
+          type: integer
+        name:
+          type: string
+        parent:
+          $ref: '#/components/schemas/Pet'
+  securitySchemes:
+    api_key:
+      type: apiKey
+      in: query
+      name: token
+`
+
+func TestDecodeYAML(t *testing.T) {
+	doc, err := decodeYAML(openAPITestDoc)
+	if err != nil {
+		t.Fatal("Decoding failed: ", err)
+	}
+
+	asMap := doc.(map[string]interface{})
+	info := asMap["info"].(map[string]interface{})
+	if info["description"] != "Multi line\ndescription\n" {
+		t.Errorf("Block scalar decoded incorrectly: %q", info["description"])
+	}
+
+	if info["version"] != json.Number("1.0") {
+		t.Error("Numeric scalar decoded incorrectly: ", info["version"])
+	}
+
+	servers := asMap["servers"].([]interface{})
+	if len(servers) != 3 {
+		t.Fatal("Expected 3 servers, got: ", servers)
+	}
+
+	responses := asMap["paths"].(map[string]interface{})["/pets"].(map[string]interface{})["post"].(map[string]interface{})["responses"].(map[string]interface{})
+	if _, found := responses["201"]; !found {
+		t.Error("Quoted keys should be unquoted, got: ", responses)
+	}
+}
+
+func TestOpenAPIImport(t *testing.T) {
+	importer, _ := GetImporterForSource(OpenAPISource)
+	if err := importer.ReadString(openAPITestDoc); err != nil {
+		t.Fatal("Import failed: ", err)
+	}
+	s := importer.(*OpenAPIAST)
+
+	schema := s.Paths["/pets"].Post.RequestBody.Content["application/json"].Schema
+	if schema["type"] != "object" {
+		t.Error("$ref should be resolved, got: ", schema)
+	}
+
+	def, err := createDefFromOpenAPI(s, "default", "", true)
+	if err != nil {
+		t.Fatal("Definition creation failed: ", err)
+	}
+
+	if def.Proxy.TargetURL != "https://eu.pets.example.com/v1" || len(def.Proxy.Targets) != 2 || !def.Proxy.EnableLoadBalancing {
+		t.Error("Servers should become upstream targets, got: ", def.Proxy.TargetURL, def.Proxy.Targets)
+	}
+
+	if def.UseKeylessAccess || !def.UseStandardAuth || !def.Auth.UseParam || def.Auth.ParamName != "token" {
+		t.Error("API key security should map to standard auth using a query param")
+	}
+
+	version, found := def.VersionData.Versions["1.0"]
+	if !found {
+		t.Fatal("Version should be named after info.version, got: ", def.VersionData.Versions)
+	}
+
+	whiteList := version.ExtendedPaths.WhiteList
+	if len(whiteList) != 2 || whiteList[1].Path != "/pets$" || len(whiteList[1].MethodActions) != 2 {
+		t.Fatal("Paths should be whitelisted per operation, got: ", whiteList)
+	}
+
+	list := whiteList[1].MethodActions["GET"]
+	if list.Action != apidef.Reply || list.Code != 200 || list.Headers["X-Total"] != "2" {
+		t.Error("Mock should be built from the examples, got: ", list)
+	}
+
+	var body []map[string]interface{}
+	if err := json.Unmarshal([]byte(list.Data), &body); err != nil || len(body) != 2 || body[1]["name"] != "Fido" {
+		t.Error("Mock body should be the JSON example, got: ", list.Data)
+	}
+
+	if created := whiteList[1].MethodActions["POST"]; created.Code != 201 || created.Data != "" {
+		t.Error("Lowest success code should be used, got: ", created)
+	}
+
+	validation := version.ExtendedPaths.ValidateJSON
+	if len(validation) != 1 || validation[0].Path != "/pets$" || validation[0].Method != "POST" {
+		t.Fatal("Request bodies should become validation schemas, got: ", validation)
+	}
+
+	validator, err := CompileJSONSchema(validation[0].Schema)
+	if err != nil {
+		t.Fatal("Imported schema should compile: ", err)
+	}
+	if errs := validator.ValidateBytes([]byte(`{"id": 1, "name": "Rex", "parent": {"id": "x"}}`)); len(errs) != 2 {
+		t.Error("Recursive references should be validated, got: ", errs)
+	}
+
+	if single := whiteList[0].MethodActions["GET"]; single.Code != 200 || single.Data != "Rex" || single.Headers["Content-Type"] != "text/plain" {
+		t.Error("Plain text examples should be used as is, got: ", single)
+	}
+}
+
+func TestOpenAPIOverlappingPaths(t *testing.T) {
+	s := &OpenAPIAST{Paths: map[string]OpenAPIPathItem{
+		"/pets":         {Get: &OpenAPIOperation{}},
+		"/pets/{petId}": {Get: &OpenAPIOperation{}},
+		"/pets/mine":    {Get: &OpenAPIOperation{}},
+	}}
+
+	version, err := s.ConvertIntoApiVersion(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firstMatch := func(path string) string {
+		for _, endpoint := range version.ExtendedPaths.WhiteList {
+			if regexp.MustCompile(endpoint.Path).MatchString(path) {
+				return endpoint.Path
+			}
+		}
+		return ""
+	}
+
+	for path, expected := range map[string]string{
+		"/v1/pets":          "/pets$",
+		"/v1/pets/1":        "/pets/[^/]+$",
+		"/v1/pets/mine":     "/pets/mine$",
+		"/v1/pets/1/photos": "",
+	} {
+		if matched := firstMatch(path); matched != expected {
+			t.Errorf("%s should be matched by %q, got %q", path, expected, matched)
+		}
+	}
+}
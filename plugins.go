@@ -112,7 +112,8 @@ func (d *DynamicMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Reques
 	originalBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		log.WithFields(logrus.Fields{
-			"prefix": "jsvm",
+			"prefix":     "jsvm",
+			"request_id": requestID(r),
 		}).Error("Failed to read request body! ", err)
 		return nil, 200
 	}
@@ -133,7 +134,8 @@ func (d *DynamicMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Reques
 	asJsonRequestObj, encErr := json.Marshal(thisRequestData)
 	if encErr != nil {
 		log.WithFields(logrus.Fields{
-			"prefix": "jsvm",
+			"prefix":     "jsvm",
+			"request_id": requestID(r),
 		}).Error("Failed to encode request object for dynamic middleware: ", encErr)
 		return nil, 200
 	}
@@ -155,7 +157,8 @@ func (d *DynamicMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Reques
 
 	if sessEncErr != nil {
 		log.WithFields(logrus.Fields{
-			"prefix": "jsvm",
+			"prefix":     "jsvm",
+			"request_id": requestID(r),
 		}).Error("Failed to encode session for VM: ", sessEncErr)
 		return nil, 200
 	}
@@ -166,7 +169,8 @@ func (d *DynamicMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Reques
 	vm := d.Spec.JSVM.VM.Copy()
 	vm.Interrupt = make(chan func(), 1)
 	log.WithFields(logrus.Fields{
-		"prefix": "jsvm",
+		"prefix":     "jsvm",
+		"request_id": requestID(r),
 	}).Debug("Running: ", middlewareClassname)
 	// buffered, leaving no chance of a goroutine leak since the
 	// spawned goroutine will send 0 or 1 values.
@@ -189,7 +193,8 @@ func (d *DynamicMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Reques
 	case returnRaw = <-ret:
 		if err := <-errRet; err != nil {
 			log.WithFields(logrus.Fields{
-				"prefix": "jsvm",
+				"prefix":     "jsvm",
+				"request_id": requestID(r),
 			}).Error("Failed to run JS middleware: ", err)
 			return nil, 200
 		}
@@ -197,7 +202,8 @@ func (d *DynamicMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Reques
 	case <-t.C:
 		t.Stop()
 		log.WithFields(logrus.Fields{
-			"prefix": "jsvm",
+			"prefix":     "jsvm",
+			"request_id": requestID(r),
 		}).Error("JS middleware timed out after ", d.Spec.JSVM.Timeout)
 		vm.Interrupt <- func() {
 			// only way to stop the VM is to send it a func
@@ -215,10 +221,12 @@ func (d *DynamicMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Reques
 
 	if decErr != nil {
 		log.WithFields(logrus.Fields{
-			"prefix": "jsvm",
+			"prefix":     "jsvm",
+			"request_id": requestID(r),
 		}).Error("Failed to decode middleware request data on return from VM: ", decErr)
 		log.WithFields(logrus.Fields{
-			"prefix": "jsvm",
+			"prefix":     "jsvm",
+			"request_id": requestID(r),
 		}).Debug(returnDataStr)
 		return nil, 200
 	}
@@ -273,7 +281,8 @@ func (d *DynamicMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Reques
 	}
 
 	log.WithFields(logrus.Fields{
-		"prefix": "jsvm",
+		"prefix":     "jsvm",
+		"request_id": requestID(r),
 	}).Debug("JSVM middleware execution took: (ns) ", time.Now().UnixNano()-t1)
 
 	if newRequestData.Request.ReturnOverrides.ResponseCode != 0 {
@@ -6,13 +6,13 @@ import (
 	"testing"
 	"time"
 
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 )
 
 func TestJSVMProcessTimeout(t *testing.T) {
 	dynMid := &DynamicMiddleware{
 		TykMiddleware: &TykMiddleware{
-			Spec: &APISpec{APIDefinition: &tykcommon.APIDefinition{}},
+			Spec: &APISpec{APIDefinition: &apidef.APIDefinition{}},
 		},
 		MiddlewareClassName: "leakMid",
 		Pre:                 true,
@@ -50,7 +50,7 @@ leakMid.NewProcessRequest(function(request, session) {
 }
 
 func TestJSVMConfigData(t *testing.T) {
-	spec := &APISpec{APIDefinition: &tykcommon.APIDefinition{}}
+	spec := &APISpec{APIDefinition: &apidef.APIDefinition{}}
 	spec.RawData = map[string]interface{}{
 		"config_data": map[string]interface{}{
 			"foo": "x",
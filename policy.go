@@ -2,41 +2,54 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/TykTechnologies/logrus"
+	"github.com/garyburd/redigo/redis"
 	"gopkg.in/mgo.v2/bson"
 )
 
 type Policy struct {
-	MID              bson.ObjectId               `bson:"_id,omitempty" json:"_id"`
-	ID               string                      `bson:"id,omitempty" json:"id"`
-	OrgID            string                      `bson:"org_id" json:"org_id"`
-	Rate             float64                     `bson:"rate" json:"rate"`
-	Per              float64                     `bson:"per" json:"per"`
-	QuotaMax         int64                       `bson:"quota_max" json:"quota_max"`
-	QuotaRenewalRate int64                       `bson:"quota_renewal_rate" json:"quota_renewal_rate"`
-	AccessRights     map[string]AccessDefinition `bson:"access_rights" json:"access_rights"`
-	HMACEnabled      bool                        `bson:"hmac_enabled" json:"hmac_enabled"`
-	Active           bool                        `bson:"active" json:"active"`
-	IsInactive       bool                        `bson:"is_inactive" json:"is_inactive"`
-	Tags             []string                    `bson:"tags" json:"tags"`
-	KeyExpiresIn     int64                       `bson:"key_expires_in" json:"key_expires_in"`
-	Partitions       struct {
+	MID                   bson.ObjectId               `bson:"_id,omitempty" json:"_id"`
+	ID                    string                      `bson:"id,omitempty" json:"id"`
+	OrgID                 string                      `bson:"org_id" json:"org_id"`
+	Rate                  float64                     `bson:"rate" json:"rate"`
+	Per                   float64                     `bson:"per" json:"per"`
+	QuotaMax              int64                       `bson:"quota_max" json:"quota_max"`
+	QuotaRenewalRate      int64                       `bson:"quota_renewal_rate" json:"quota_renewal_rate"`
+	QuotaRenewalPeriod    string                      `bson:"quota_renewal_period" json:"quota_renewal_period"`
+	QuotaTimezone         string                      `bson:"quota_timezone" json:"quota_timezone"`
+	MaxConcurrentRequests int64                       `bson:"max_concurrent_requests" json:"max_concurrent_requests"`
+	AccessRights          map[string]AccessDefinition `bson:"access_rights" json:"access_rights"`
+	HMACEnabled           bool                        `bson:"hmac_enabled" json:"hmac_enabled"`
+	Active                bool                        `bson:"active" json:"active"`
+	IsInactive            bool                        `bson:"is_inactive" json:"is_inactive"`
+	Tags                  []string                    `bson:"tags" json:"tags"`
+	KeyExpiresIn          int64                       `bson:"key_expires_in" json:"key_expires_in"`
+	ParentID              string                      `bson:"parent_id" json:"parent_id"`
+	MetaData              map[string]interface{}      `bson:"meta_data" json:"meta_data"`
+	Partitions            struct {
 		Quota     bool `bson:"quota" json:"quota"`
 		RateLimit bool `bson:"rate_limit" json:"rate_limit"`
 		Acl       bool `bson:"acl" json:"acl"`
 	} `bson:"partitions" json:"partitions"`
 	LastUpdated string `bson:"last_updated" json:"last_updated"`
+	Version     int64  `bson:"version" json:"version"`
 }
 
 type DBAccessDefinition struct {
-	APIName     string       `json:"apiname"`
-	APIID       string       `json:"apiid"`
-	Versions    []string     `json:"versions"`
-	AllowedURLs []AccessSpec `bson:"allowed_urls"  json:"allowed_urls"` // mapped string MUST be a valid regex
+	APIName     string         `json:"apiname"`
+	APIID       string         `json:"apiid"`
+	Versions    []string       `json:"versions"`
+	AllowedURLs []AccessSpec   `bson:"allowed_urls"  json:"allowed_urls"` // mapped string MUST be a valid regex
+	GraphQL     *GraphQLAccess `bson:"graphql" json:"graphql"`
 }
 
 func (d *DBAccessDefinition) ToRegularAD() AccessDefinition {
@@ -45,6 +58,7 @@ func (d *DBAccessDefinition) ToRegularAD() AccessDefinition {
 		APIID:       d.APIID,
 		Versions:    d.Versions,
 		AllowedURLs: d.AllowedURLs,
+		GraphQL:     d.GraphQL,
 	}
 
 	return thisAD
@@ -66,25 +80,42 @@ func (d *DBPolicy) ToRegularPolicy() Policy {
 	return thisPolicy
 }
 
-func LoadPoliciesFromFile(filePath string) map[string]Policy {
-	policies := make(map[string]Policy)
+const PolicyKeyPrefix string = "policy-"
 
-	policyConfig, err := ioutil.ReadFile(filePath)
+var policyWriteMu sync.Mutex
+
+func getPolicyStore() StorageHandler {
+	store := &RedisClusterStorageManager{KeyPrefix: PolicyKeyPrefix}
+	store.Connect()
+	return store
+}
+
+func LoadPoliciesFromFile(filePath string) map[string]Policy {
+	policies, err := readPolicyFile(filePath)
 	if err != nil {
 		log.WithFields(logrus.Fields{
 			"prefix": "policy",
 		}).Error("Couldn't load policy file: ", err)
-		return policies
+		return make(map[string]Policy)
 	}
 
-	mErr := json.Unmarshal(policyConfig, &policies)
-	if mErr != nil {
-		log.WithFields(logrus.Fields{
-			"prefix": "policy",
-		}).Error("Couldn't unmarshal policies: ", mErr)
+	return policies
+}
+
+// readPolicyFile is LoadPoliciesFromFile for callers that must not mistake a broken file for an empty one
+func readPolicyFile(filePath string) (map[string]Policy, error) {
+	policies := make(map[string]Policy)
+
+	policyConfig, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
 	}
 
-	return policies
+	if err := json.Unmarshal(policyConfig, &policies); err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal policies: %v", err)
+	}
+
+	return policies, nil
 }
 
 // LoadPoliciesFromDashboard will connect and download Policies from a Tyk Dashboard instance.
@@ -185,6 +216,137 @@ func LoadPoliciesFromDashboard(endpoint string, secret string, allowExplicit boo
 	return policies
 }
 
+// LoadPoliciesFromRedis will load all policies stored by the policy management API
+func LoadPoliciesFromRedis() map[string]Policy {
+	policies, err := readPoliciesFromRedis()
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "policy",
+		}).Error("Couldn't load policies from redis: ", err)
+		return make(map[string]Policy)
+	}
+
+	return policies
+}
+
+// readPoliciesFromRedis reports connection errors instead of returning an empty set, GetKeysAndValues
+// can't tell the two apart
+func readPoliciesFromRedis() (map[string]Policy, error) {
+	store := &RedisClusterStorageManager{KeyPrefix: PolicyKeyPrefix}
+	store.Connect()
+	cluster := GetRelevantClusterReference(store.IsCache)
+	if cluster == nil {
+		return nil, errors.New("no redis connection")
+	}
+
+	keys, err := redis.Strings(cluster.Do("KEYS", store.KeyPrefix+"*"))
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make(map[string]Policy)
+	if len(keys) == 0 {
+		return policies, nil
+	}
+
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	values, err := redis.Strings(cluster.Do("MGET", args...))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, key := range keys {
+		policyID := store.cleanKey(key)
+		thisPolicy := Policy{}
+		if err := json.Unmarshal([]byte(values[i]), &thisPolicy); err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix":   "policy",
+				"policyID": policyID,
+			}).Error("Couldn't unmarshal policy: ", err)
+			continue
+		}
+
+		thisPolicy.ID = policyID
+		policies[policyID] = thisPolicy
+	}
+
+	return policies, nil
+}
+
+// SavePolicy persists a single policy to the configured policy source (file or redis)
+func SavePolicy(thisPolicy Policy) error {
+	policyWriteMu.Lock()
+	defer policyWriteMu.Unlock()
+
+	if config.Policies.PolicySource == "redis" {
+		asJSON, err := json.Marshal(thisPolicy)
+		if err != nil {
+			return err
+		}
+		return getPolicyStore().SetKey(thisPolicy.ID, string(asJSON), 0)
+	}
+
+	policies, err := readPolicyFile(config.Policies.PolicyRecordName)
+	if err != nil {
+		return err
+	}
+	policies[thisPolicy.ID] = thisPolicy
+	return writePolicyFile(policies)
+}
+
+// DeletePolicy removes a single policy from the configured policy source (file or redis)
+func DeletePolicy(policyID string) error {
+	policyWriteMu.Lock()
+	defer policyWriteMu.Unlock()
+
+	if config.Policies.PolicySource == "redis" {
+		if !getPolicyStore().DeleteKey(policyID) {
+			return errors.New("could not delete policy from store")
+		}
+		return nil
+	}
+
+	policies, err := readPolicyFile(config.Policies.PolicyRecordName)
+	if err != nil {
+		return err
+	}
+	delete(policies, policyID)
+	return writePolicyFile(policies)
+}
+
+// writePolicyFile replaces the policy file in one step, so a failed write or a reader in the middle
+// of it never sees a truncated file
+func writePolicyFile(policies map[string]Policy) error {
+	asByte, err := json.MarshalIndent(policies, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fileName := config.Policies.PolicyRecordName
+	tmpFile, err := ioutil.TempFile(filepath.Dir(fileName), "."+filepath.Base(fileName))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(asByte); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Chmod(0644); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), fileName)
+}
+
 func LoadPoliciesFromRPC(orgId string) map[string]Policy {
 	dbPolicyList := make([]Policy, 0)
 	policies := make(map[string]Policy)
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/TykTechnologies/logrus"
+)
+
+const (
+	PolicyMergeMostGenerous    string = "most_generous"
+	PolicyMergeMostRestrictive string = "most_restrictive"
+)
+
+// mergedPolicies caches the result of resolving and merging a list of policy IDs, it is guarded
+// by policiesMu and must be flushed whenever policiesByID changes
+var mergedPolicies = make(map[string]Policy)
+
+// flushMergedPolicies must be called with policiesMu held for writing, in the same critical
+// section that changes policiesByID
+func flushMergedPolicies() {
+	mergedPolicies = make(map[string]Policy)
+}
+
+// PolicyIDs returns the policies applied to a session in the order they should be merged
+func (s *SessionState) PolicyIDs() []string {
+	if len(s.ApplyPolicies) > 0 {
+		return s.ApplyPolicies
+	}
+
+	if s.ApplyPolicyID != "" {
+		return []string{s.ApplyPolicyID}
+	}
+
+	return []string{}
+}
+
+// MergePolicies resolves the parents of each policy and merges the results in order,
+// the merged policy is cached until policies are reloaded
+func MergePolicies(policyIDs []string) (Policy, bool) {
+	cacheKey := strings.Join(policyIDs, ",")
+
+	policiesMu.RLock()
+	cache := mergedPolicies
+	if cached, found := cache[cacheKey]; found {
+		policiesMu.RUnlock()
+		return cached, true
+	}
+
+	resolved := []Policy{}
+	for _, id := range policyIDs {
+		policy, err := resolvePolicy(id, policiesByID, map[string]bool{})
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix":   "policy",
+				"policyID": id,
+			}).Error("Could not resolve policy: ", err)
+			continue
+		}
+		resolved = append(resolved, policy)
+	}
+	policiesMu.RUnlock()
+
+	if len(resolved) == 0 {
+		return Policy{}, false
+	}
+
+	merged := mergePolicyList(resolved)
+
+	// If the policies were reloaded in the meantime the result goes into the flushed cache,
+	// which is no longer read, so a stale merge is never served
+	policiesMu.Lock()
+	cache[cacheKey] = merged
+	policiesMu.Unlock()
+
+	return merged, true
+}
+
+// resolvePolicy flattens a policy with the policy it extends, values set on the child win
+func resolvePolicy(id string, policies map[string]Policy, seen map[string]bool) (Policy, error) {
+	policy, found := policies[id]
+	if !found {
+		return policy, errors.New("policy not found")
+	}
+
+	if policy.ParentID == "" {
+		return policy, nil
+	}
+
+	if seen[id] {
+		return policy, errors.New("policy inheritance loop detected")
+	}
+	seen[id] = true
+
+	parent, err := resolvePolicy(policy.ParentID, policies, seen)
+	if err != nil {
+		return policy, errors.New("parent " + policy.ParentID + ": " + err.Error())
+	}
+
+	if parent.OrgID != policy.OrgID {
+		return policy, errors.New("parent policy belongs to a different organisation")
+	}
+
+	return extendPolicy(parent, policy), nil
+}
+
+func extendPolicy(parent, child Policy) Policy {
+	extended := child
+
+	if child.Rate == 0 && child.Per == 0 {
+		extended.Rate = parent.Rate
+		extended.Per = parent.Per
+	}
+
+	if child.QuotaMax == 0 {
+		extended.QuotaMax = parent.QuotaMax
+		extended.QuotaRenewalRate = parent.QuotaRenewalRate
+		extended.QuotaRenewalPeriod = parent.QuotaRenewalPeriod
+		extended.QuotaTimezone = parent.QuotaTimezone
+	}
+
+	if child.MaxConcurrentRequests == 0 {
+		extended.MaxConcurrentRequests = parent.MaxConcurrentRequests
+	}
+
+	if child.KeyExpiresIn == 0 {
+		extended.KeyExpiresIn = parent.KeyExpiresIn
+	}
+
+	if !child.Partitions.Quota && !child.Partitions.RateLimit && !child.Partitions.Acl {
+		extended.Partitions = parent.Partitions
+	}
+
+	extended.HMACEnabled = parent.HMACEnabled || child.HMACEnabled
+	extended.IsInactive = parent.IsInactive || child.IsInactive
+	extended.AccessRights = mergeAccessRights(parent.AccessRights, child.AccessRights)
+	extended.Tags = mergeTags(parent.Tags, child.Tags)
+	extended.MetaData = mergeMetaData(parent.MetaData, child.MetaData)
+
+	if parent.LastUpdated > extended.LastUpdated {
+		extended.LastUpdated = parent.LastUpdated
+	}
+
+	return extended
+}
+
+func policyAppliesTo(policy Policy, quota, rateLimit, acl bool) bool {
+	if !policy.Partitions.Quota && !policy.Partitions.RateLimit && !policy.Partitions.Acl {
+		return true
+	}
+
+	return (quota && policy.Partitions.Quota) || (rateLimit && policy.Partitions.RateLimit) || (acl && policy.Partitions.Acl)
+}
+
+func quotaPerSecond(policy Policy) float64 {
+	if policy.QuotaMax == -1 {
+		return -1
+	}
+
+	var period float64
+	switch QuotaPeriod(policy.QuotaRenewalPeriod) {
+	case QuotaPeriodHourly:
+		period = 3600
+	case QuotaPeriodDaily:
+		period = 86400
+	case QuotaPeriodWeekly:
+		period = 604800
+	case QuotaPeriodMonthly:
+		period = 2592000
+	default:
+		period = float64(policy.QuotaRenewalRate)
+	}
+
+	if period <= 0 {
+		return float64(policy.QuotaMax)
+	}
+
+	return float64(policy.QuotaMax) / period
+}
+
+func ratePerSecond(policy Policy) float64 {
+	if policy.Per <= 0 {
+		return 0
+	}
+
+	return policy.Rate / policy.Per
+}
+
+// isMoreGenerous compares two limits where -1 means unlimited
+func isMoreGenerous(a, b float64) bool {
+	if b == -1 {
+		return false
+	}
+
+	return a == -1 || a > b
+}
+
+func preferLimit(strategy string, candidate, current float64) bool {
+	if strategy == PolicyMergeMostRestrictive {
+		return isMoreGenerous(current, candidate)
+	}
+
+	return isMoreGenerous(candidate, current)
+}
+
+// mergePolicyList merges already resolved policies, on a tie the policy listed first wins and
+// the first policy to set a meta data key keeps it
+func mergePolicyList(policies []Policy) Policy {
+	if len(policies) == 1 {
+		return policies[0]
+	}
+
+	quotaStrategy := config.Policies.MergeStrategy.Quota
+	rateStrategy := config.Policies.MergeStrategy.RateLimit
+
+	merged := Policy{
+		ID:    policies[0].ID,
+		OrgID: policies[0].OrgID,
+	}
+
+	var haveQuota, haveRate bool
+	for _, policy := range policies {
+		if policy.OrgID != merged.OrgID {
+			log.WithFields(logrus.Fields{
+				"prefix":   "policy",
+				"policyID": policy.ID,
+			}).Error("Policies from different organisations cannot be merged, skipping")
+			continue
+		}
+
+		if policyAppliesTo(policy, true, false, false) {
+			merged.Partitions.Quota = true
+			if !haveQuota || preferLimit(quotaStrategy, quotaPerSecond(policy), quotaPerSecond(merged)) {
+				merged.QuotaMax = policy.QuotaMax
+				merged.QuotaRenewalRate = policy.QuotaRenewalRate
+				merged.QuotaRenewalPeriod = policy.QuotaRenewalPeriod
+				merged.QuotaTimezone = policy.QuotaTimezone
+				haveQuota = true
+			}
+		}
+
+		if policyAppliesTo(policy, false, true, false) {
+			merged.Partitions.RateLimit = true
+			if !haveRate || preferLimit(rateStrategy, ratePerSecond(policy), ratePerSecond(merged)) {
+				merged.Rate = policy.Rate
+				merged.Per = policy.Per
+			}
+
+			// 0 means no concurrency limit
+			concurrency := float64(policy.MaxConcurrentRequests)
+			if concurrency == 0 {
+				concurrency = -1
+			}
+			current := float64(merged.MaxConcurrentRequests)
+			if current == 0 {
+				current = -1
+			}
+			if !haveRate || preferLimit(rateStrategy, concurrency, current) {
+				merged.MaxConcurrentRequests = policy.MaxConcurrentRequests
+			}
+			haveRate = true
+		}
+
+		if policyAppliesTo(policy, false, false, true) {
+			merged.Partitions.Acl = true
+			merged.AccessRights = mergeAccessRights(merged.AccessRights, policy.AccessRights)
+			merged.HMACEnabled = merged.HMACEnabled || policy.HMACEnabled
+		}
+
+		if policy.KeyExpiresIn > 0 && (merged.KeyExpiresIn == 0 || policy.KeyExpiresIn < merged.KeyExpiresIn) {
+			merged.KeyExpiresIn = policy.KeyExpiresIn
+		}
+
+		merged.Active = merged.Active || policy.Active
+		merged.IsInactive = merged.IsInactive || policy.IsInactive
+		merged.Tags = mergeTags(merged.Tags, policy.Tags)
+		merged.MetaData = mergeMetaData(policy.MetaData, merged.MetaData)
+
+		if policy.LastUpdated > merged.LastUpdated {
+			merged.LastUpdated = policy.LastUpdated
+		}
+	}
+
+	return merged
+}
+
+// mergeAccessRights returns the union of two sets of access rights, an API granted without
+// URL restrictions by either side stays unrestricted
+func mergeAccessRights(a, b map[string]AccessDefinition) map[string]AccessDefinition {
+	merged := make(map[string]AccessDefinition)
+	for apiID, ad := range a {
+		merged[apiID] = ad
+	}
+
+	for apiID, ad := range b {
+		existing, found := merged[apiID]
+		if !found {
+			merged[apiID] = ad
+			continue
+		}
+
+		existing.Versions = mergeTags(existing.Versions, ad.Versions)
+		if len(existing.AllowedURLs) == 0 || len(ad.AllowedURLs) == 0 {
+			existing.AllowedURLs = nil
+		} else {
+			existing.AllowedURLs = mergeAllowedURLs(existing.AllowedURLs, ad.AllowedURLs)
+		}
+		existing.GraphQL = mergeGraphQLAccess(existing.GraphQL, ad.GraphQL)
+		merged[apiID] = existing
+	}
+
+	return merged
+}
+
+// mergeGraphQLAccess follows the same rule as allowed URLs, an operation or field is only
+// refused when both sides refuse it
+func mergeGraphQLAccess(a, b *GraphQLAccess) *GraphQLAccess {
+	if a == nil || b == nil {
+		return nil
+	}
+
+	merged := &GraphQLAccess{
+		BlockedOperations: intersectTags(a.BlockedOperations, b.BlockedOperations),
+		BlockedFields:     intersectTags(a.BlockedFields, b.BlockedFields),
+	}
+	if len(a.AllowedOperations) > 0 && len(b.AllowedOperations) > 0 {
+		merged.AllowedOperations = mergeTags(a.AllowedOperations, b.AllowedOperations)
+	}
+
+	return merged
+}
+
+func mergeAllowedURLs(a, b []AccessSpec) []AccessSpec {
+	merged := make([]AccessSpec, len(a))
+	copy(merged, a)
+
+	for _, spec := range b {
+		found := false
+		for i, existing := range merged {
+			if existing.URL == spec.URL {
+				merged[i].Methods = mergeTags(existing.Methods, spec.Methods)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			merged = append(merged, spec)
+		}
+	}
+
+	return merged
+}
+
+// mergeTags returns the ordered union of two string lists
+func mergeTags(a, b []string) []string {
+	merged := []string{}
+	seen := make(map[string]bool)
+	for _, list := range [][]string{a, b} {
+		for _, val := range list {
+			if !seen[val] {
+				seen[val] = true
+				merged = append(merged, val)
+			}
+		}
+	}
+
+	return merged
+}
+
+// intersectTags returns the entries present in both lists, in the order of the first
+func intersectTags(a, b []string) []string {
+	inB := make(map[string]bool, len(b))
+	for _, val := range b {
+		inB[val] = true
+	}
+
+	intersection := []string{}
+	for _, val := range a {
+		if inB[val] {
+			intersection = append(intersection, val)
+		}
+	}
+
+	return intersection
+}
+
+// mergeMetaData overlays b on a, on a conflict the value in b wins unless both values are
+// objects, which are merged the same way
+func mergeMetaData(a, b map[string]interface{}) map[string]interface{} {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+
+	merged := make(map[string]interface{})
+	for k, v := range a {
+		merged[k] = v
+	}
+	for k, v := range b {
+		existing, existingIsMap := merged[k].(map[string]interface{})
+		overlay, overlayIsMap := v.(map[string]interface{})
+		if existingIsMap && overlayIsMap {
+			merged[k] = mergeMetaData(existing, overlay)
+			continue
+		}
+		merged[k] = v
+	}
+
+	return merged
+}
+
+// applyPolicyMetaData adds the meta data of a policy to that of a session, values set on the key
+// itself win, meta data that isn't an object is left alone as there are no keys to merge into
+func applyPolicyMetaData(sessionMeta interface{}, policyMeta map[string]interface{}) interface{} {
+	if sessionMeta == nil {
+		return mergeMetaData(policyMeta, nil)
+	}
+
+	keyMeta, ok := sessionMeta.(map[string]interface{})
+	if !ok {
+		return sessionMeta
+	}
+
+	return mergeMetaData(policyMeta, keyMeta)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"testing"
+)
+
+func createMergeTestPolicies() map[string]Policy {
+	base := Policy{
+		ID:               "base",
+		OrgID:            "default",
+		Rate:             10,
+		Per:              1,
+		QuotaMax:         1000,
+		QuotaRenewalRate: 3600,
+		AccessRights: map[string]AccessDefinition{
+			"api1": {APIID: "api1", Versions: []string{"v1"}},
+		},
+		Tags:     []string{"base"},
+		MetaData: map[string]interface{}{"tier": "base", "region": "eu"},
+	}
+
+	gold := Policy{
+		ID:       "gold",
+		OrgID:    "default",
+		ParentID: "base",
+		QuotaMax: 5000,
+		AccessRights: map[string]AccessDefinition{
+			"api1": {APIID: "api1", Versions: []string{"v2"}},
+			"api2": {APIID: "api2", Versions: []string{"Default"}},
+		},
+		Tags:     []string{"gold"},
+		MetaData: map[string]interface{}{"tier": "gold"},
+	}
+
+	burst := Policy{
+		ID:               "burst",
+		OrgID:            "default",
+		Rate:             100,
+		Per:              1,
+		QuotaMax:         -1,
+		QuotaRenewalRate: 60,
+		Tags:             []string{"burst", "base"},
+	}
+	burst.Partitions.RateLimit = true
+
+	loopA := Policy{ID: "loop-a", OrgID: "default", ParentID: "loop-b"}
+	loopB := Policy{ID: "loop-b", OrgID: "default", ParentID: "loop-a"}
+
+	return map[string]Policy{
+		"base":   base,
+		"gold":   gold,
+		"burst":  burst,
+		"loop-a": loopA,
+		"loop-b": loopB,
+	}
+}
+
+func TestResolvePolicyInheritance(t *testing.T) {
+	policies := createMergeTestPolicies()
+
+	resolved, err := resolvePolicy("gold", policies, map[string]bool{})
+	if err != nil {
+		t.Fatal("Policy should resolve: ", err)
+	}
+
+	if resolved.Rate != 10 || resolved.Per != 1 {
+		t.Error("Rate limit should be inherited from the parent, got: ", resolved.Rate, resolved.Per)
+	}
+
+	if resolved.QuotaMax != 5000 {
+		t.Error("Quota set on the child should win, got: ", resolved.QuotaMax)
+	}
+
+	if len(resolved.AccessRights) != 2 || len(resolved.AccessRights["api1"].Versions) != 2 {
+		t.Error("Access rights should be a union, got: ", resolved.AccessRights)
+	}
+
+	if resolved.MetaData["tier"] != "gold" || resolved.MetaData["region"] != "eu" {
+		t.Error("Meta data should be merged with the child winning, got: ", resolved.MetaData)
+	}
+
+	if _, err := resolvePolicy("loop-a", policies, map[string]bool{}); err == nil {
+		t.Error("Inheritance loops should be detected")
+	}
+}
+
+func TestMergePolicyListGenerous(t *testing.T) {
+	policies := createMergeTestPolicies()
+	config.Policies.MergeStrategy.Quota = ""
+	config.Policies.MergeStrategy.RateLimit = ""
+
+	merged := mergePolicyList([]Policy{policies["base"], policies["burst"]})
+
+	if merged.Rate != 100 {
+		t.Error("Most generous rate should win, got: ", merged.Rate)
+	}
+
+	// burst is only partitioned for rate limits, so its unlimited quota must not apply
+	if merged.QuotaMax != 1000 {
+		t.Error("Quota should come from the base policy only, got: ", merged.QuotaMax)
+	}
+
+	if !merged.Partitions.Quota || !merged.Partitions.RateLimit || !merged.Partitions.Acl {
+		t.Error("All partitions should be active, got: ", merged.Partitions)
+	}
+
+	if len(merged.Tags) != 2 || merged.Tags[0] != "base" || merged.Tags[1] != "burst" {
+		t.Error("Tags should be an ordered union, got: ", merged.Tags)
+	}
+}
+
+func TestMergePolicyListRestrictive(t *testing.T) {
+	policies := createMergeTestPolicies()
+	config.Policies.MergeStrategy.RateLimit = PolicyMergeMostRestrictive
+	defer func() { config.Policies.MergeStrategy.RateLimit = "" }()
+
+	merged := mergePolicyList([]Policy{policies["burst"], policies["base"]})
+
+	if merged.Rate != 10 {
+		t.Error("Most restrictive rate should win, got: ", merged.Rate)
+	}
+}
+
+func TestMergeMetaDataPrecedence(t *testing.T) {
+	first := Policy{ID: "first", OrgID: "default", MetaData: map[string]interface{}{
+		"tier":   "gold",
+		"limits": map[string]interface{}{"upload": "10mb"},
+	}}
+	second := Policy{ID: "second", OrgID: "default", MetaData: map[string]interface{}{
+		"tier":   "silver",
+		"region": "us",
+		"limits": map[string]interface{}{"upload": "1mb", "download": "5mb"},
+	}}
+
+	merged := mergePolicyList([]Policy{first, second})
+	limits := merged.MetaData["limits"].(map[string]interface{})
+	if merged.MetaData["tier"] != "gold" || merged.MetaData["region"] != "us" || limits["upload"] != "10mb" || limits["download"] != "5mb" {
+		t.Error("The first policy to set a key should keep it and objects should be merged, got: ", merged.MetaData)
+	}
+
+	keyMeta := applyPolicyMetaData(map[string]interface{}{"tier": "custom"}, merged.MetaData).(map[string]interface{})
+	if keyMeta["tier"] != "custom" || keyMeta["region"] != "us" {
+		t.Error("Values set on the key should win over its policies, got: ", keyMeta)
+	}
+
+	if meta := applyPolicyMetaData("opaque", merged.MetaData); meta != "opaque" {
+		t.Error("Meta data that isn't an object should be kept, got: ", meta)
+	}
+
+	if meta := applyPolicyMetaData(nil, merged.MetaData).(map[string]interface{}); meta["tier"] != "gold" {
+		t.Error("Keys without meta data should get the policy's, got: ", meta)
+	}
+}
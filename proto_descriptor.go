@@ -0,0 +1,568 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Field types and labels from google/protobuf/descriptor.proto
+const (
+	protoTypeDouble   = 1
+	protoTypeFloat    = 2
+	protoTypeInt64    = 3
+	protoTypeUint64   = 4
+	protoTypeInt32    = 5
+	protoTypeFixed64  = 6
+	protoTypeFixed32  = 7
+	protoTypeBool     = 8
+	protoTypeString   = 9
+	protoTypeGroup    = 10
+	protoTypeMessage  = 11
+	protoTypeBytes    = 12
+	protoTypeUint32   = 13
+	protoTypeEnum     = 14
+	protoTypeSfixed32 = 15
+	protoTypeSfixed64 = 16
+	protoTypeSint32   = 17
+	protoTypeSint64   = 18
+
+	protoLabelRepeated = 3
+)
+
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+	protoWireFixed32 = 5
+)
+
+// protoHTTPRuleExtension is the field number of the google.api.http method option
+const protoHTTPRuleExtension = 72295728
+
+type protoWireField struct {
+	Number   int
+	WireType int
+	Value    uint64
+	Bytes    []byte
+}
+
+// readProtoFields splits an encoded message into its fields, groups are deprecated and rejected
+func readProtoFields(data []byte) ([]protoWireField, error) {
+	fields := []protoWireField{}
+	for len(data) > 0 {
+		key, n := proto.DecodeVarint(data)
+		if n == 0 {
+			return nil, errors.New("malformed field key")
+		}
+		data = data[n:]
+
+		field := protoWireField{Number: int(key >> 3), WireType: int(key & 7)}
+		switch field.WireType {
+		case protoWireVarint:
+			field.Value, n = proto.DecodeVarint(data)
+			if n == 0 {
+				return nil, errors.New("malformed varint")
+			}
+			data = data[n:]
+		case protoWireFixed64:
+			if len(data) < 8 {
+				return nil, errors.New("truncated fixed64")
+			}
+			field.Value = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case protoWireFixed32:
+			if len(data) < 4 {
+				return nil, errors.New("truncated fixed32")
+			}
+			field.Value = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		case protoWireBytes:
+			length, n := proto.DecodeVarint(data)
+			if n == 0 || length > uint64(len(data)-n) {
+				return nil, errors.New("truncated length delimited field")
+			}
+			field.Bytes = data[n : n+int(length)]
+			data = data[n+int(length):]
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d", field.WireType)
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+type ProtoField struct {
+	Name     string
+	JSONName string
+	Number   int
+	Type     int
+	Repeated bool
+	TypeName string
+}
+
+type ProtoMessage struct {
+	FullName string
+	Fields   []*ProtoField
+	MapEntry bool
+
+	byNumber map[int]*ProtoField
+	byName   map[string]*ProtoField
+}
+
+// Field finds a field by its proto or JSON name
+func (m *ProtoMessage) Field(name string) *ProtoField {
+	return m.byName[name]
+}
+
+type ProtoEnum struct {
+	FullName string
+	Values   map[string]int32
+	Names    map[int32]string
+}
+
+// ProtoHTTPRule is a google.api.http binding of an RPC to a REST call
+type ProtoHTTPRule struct {
+	Method       string
+	Path         string
+	Body         string
+	ResponseBody string
+}
+
+type ProtoMethod struct {
+	Name            string
+	Service         string
+	InputType       string
+	OutputType      string
+	ClientStreaming bool
+	ServerStreaming bool
+	HTTPRules       []ProtoHTTPRule
+}
+
+// ProtoDescriptorSet holds what transcoding needs from a compiled FileDescriptorSet, as written by
+// protoc --include_imports --descriptor_set_out
+type ProtoDescriptorSet struct {
+	Messages map[string]*ProtoMessage
+	Enums    map[string]*ProtoEnum
+	Methods  []*ProtoMethod
+}
+
+func ParseProtoDescriptorSet(data []byte) (*ProtoDescriptorSet, error) {
+	set := &ProtoDescriptorSet{
+		Messages: map[string]*ProtoMessage{},
+		Enums:    map[string]*ProtoEnum{},
+	}
+
+	files, err := readProtoFields(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if file.Number != 1 || file.WireType != protoWireBytes {
+			continue
+		}
+		if err := set.parseFile(file.Bytes); err != nil {
+			return nil, err
+		}
+	}
+
+	return set, set.check()
+}
+
+func protoQualify(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// protoJSONName is what protoc generates when a descriptor carries no json_name
+func protoJSONName(name string) string {
+	var jsonName bytes.Buffer
+	upper := false
+	for i := 0; i < len(name); i++ {
+		switch {
+		case name[i] == '_':
+			upper = true
+		case upper && name[i] >= 'a' && name[i] <= 'z':
+			jsonName.WriteByte(name[i] - 'a' + 'A')
+			upper = false
+		default:
+			jsonName.WriteByte(name[i])
+			upper = false
+		}
+	}
+
+	return jsonName.String()
+}
+
+func (s *ProtoDescriptorSet) parseFile(data []byte) error {
+	fields, err := readProtoFields(data)
+	if err != nil {
+		return err
+	}
+
+	pkg := ""
+	for _, field := range fields {
+		if field.Number == 2 {
+			pkg = string(field.Bytes)
+		}
+	}
+
+	for _, field := range fields {
+		switch field.Number {
+		case 4:
+			err = s.parseMessage(pkg, field.Bytes)
+		case 5:
+			err = s.parseEnum(pkg, field.Bytes)
+		case 6:
+			err = s.parseService(pkg, field.Bytes)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *ProtoDescriptorSet) parseMessage(prefix string, data []byte) error {
+	fields, err := readProtoFields(data)
+	if err != nil {
+		return err
+	}
+
+	message := &ProtoMessage{byNumber: map[int]*ProtoField{}, byName: map[string]*ProtoField{}}
+	for _, field := range fields {
+		if field.Number == 1 {
+			message.FullName = protoQualify(prefix, string(field.Bytes))
+		}
+	}
+
+	for _, field := range fields {
+		switch field.Number {
+		case 2:
+			protoField, err := parseProtoField(field.Bytes)
+			if err != nil {
+				return err
+			}
+			message.Fields = append(message.Fields, protoField)
+			message.byNumber[protoField.Number] = protoField
+			message.byName[protoField.Name] = protoField
+			message.byName[protoField.JSONName] = protoField
+		case 3:
+			err = s.parseMessage(message.FullName, field.Bytes)
+		case 4:
+			err = s.parseEnum(message.FullName, field.Bytes)
+		case 7:
+			var options []protoWireField
+			options, err = readProtoFields(field.Bytes)
+			for _, option := range options {
+				if option.Number == 7 && option.WireType == protoWireVarint {
+					message.MapEntry = option.Value != 0
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	s.Messages[message.FullName] = message
+	return nil
+}
+
+func parseProtoField(data []byte) (*ProtoField, error) {
+	fields, err := readProtoFields(data)
+	if err != nil {
+		return nil, err
+	}
+
+	protoField := &ProtoField{}
+	for _, field := range fields {
+		switch field.Number {
+		case 1:
+			protoField.Name = string(field.Bytes)
+		case 3:
+			protoField.Number = int(field.Value)
+		case 4:
+			protoField.Repeated = field.Value == protoLabelRepeated
+		case 5:
+			protoField.Type = int(field.Value)
+		case 6:
+			protoField.TypeName = strings.TrimPrefix(string(field.Bytes), ".")
+		case 10:
+			protoField.JSONName = string(field.Bytes)
+		}
+	}
+
+	if protoField.JSONName == "" {
+		protoField.JSONName = protoJSONName(protoField.Name)
+	}
+
+	return protoField, nil
+}
+
+func (s *ProtoDescriptorSet) parseEnum(prefix string, data []byte) error {
+	fields, err := readProtoFields(data)
+	if err != nil {
+		return err
+	}
+
+	enum := &ProtoEnum{Values: map[string]int32{}, Names: map[int32]string{}}
+	for _, field := range fields {
+		switch field.Number {
+		case 1:
+			enum.FullName = protoQualify(prefix, string(field.Bytes))
+		case 2:
+			valueFields, err := readProtoFields(field.Bytes)
+			if err != nil {
+				return err
+			}
+			var name string
+			var number int32
+			for _, valueField := range valueFields {
+				switch valueField.Number {
+				case 1:
+					name = string(valueField.Bytes)
+				case 2:
+					number = int32(valueField.Value)
+				}
+			}
+			enum.Values[name] = number
+			if _, found := enum.Names[number]; !found {
+				enum.Names[number] = name
+			}
+		}
+	}
+
+	s.Enums[enum.FullName] = enum
+	return nil
+}
+
+func (s *ProtoDescriptorSet) parseService(prefix string, data []byte) error {
+	fields, err := readProtoFields(data)
+	if err != nil {
+		return err
+	}
+
+	service := ""
+	for _, field := range fields {
+		if field.Number == 1 {
+			service = protoQualify(prefix, string(field.Bytes))
+		}
+	}
+
+	for _, field := range fields {
+		if field.Number != 2 {
+			continue
+		}
+
+		methodFields, err := readProtoFields(field.Bytes)
+		if err != nil {
+			return err
+		}
+
+		method := &ProtoMethod{Service: service}
+		for _, methodField := range methodFields {
+			switch methodField.Number {
+			case 1:
+				method.Name = string(methodField.Bytes)
+			case 2:
+				method.InputType = strings.TrimPrefix(string(methodField.Bytes), ".")
+			case 3:
+				method.OutputType = strings.TrimPrefix(string(methodField.Bytes), ".")
+			case 4:
+				options, err := readProtoFields(methodField.Bytes)
+				if err != nil {
+					return err
+				}
+				for _, option := range options {
+					if option.Number == protoHTTPRuleExtension && option.WireType == protoWireBytes {
+						if method.HTTPRules, err = parseProtoHTTPRule(option.Bytes, method.HTTPRules); err != nil {
+							return err
+						}
+					}
+				}
+			case 5:
+				method.ClientStreaming = methodField.Value != 0
+			case 6:
+				method.ServerStreaming = methodField.Value != 0
+			}
+		}
+
+		s.Methods = append(s.Methods, method)
+	}
+
+	return nil
+}
+
+// parseProtoHTTPRule appends a google.api.HttpRule and its additional bindings to rules
+func parseProtoHTTPRule(data []byte, rules []ProtoHTTPRule) ([]ProtoHTTPRule, error) {
+	fields, err := readProtoFields(data)
+	if err != nil {
+		return nil, err
+	}
+
+	rule := ProtoHTTPRule{}
+	additional := [][]byte{}
+	for _, field := range fields {
+		switch field.Number {
+		case 2, 3, 4, 5, 6:
+			rule.Method = []string{"GET", "PUT", "POST", "DELETE", "PATCH"}[field.Number-2]
+			rule.Path = string(field.Bytes)
+		case 7:
+			rule.Body = string(field.Bytes)
+		case 8:
+			custom, err := readProtoFields(field.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			for _, customField := range custom {
+				switch customField.Number {
+				case 1:
+					rule.Method = strings.ToUpper(string(customField.Bytes))
+				case 2:
+					rule.Path = string(customField.Bytes)
+				}
+			}
+		case 11:
+			additional = append(additional, field.Bytes)
+		case 12:
+			rule.ResponseBody = string(field.Bytes)
+		}
+	}
+
+	if rule.Path != "" {
+		rules = append(rules, rule)
+	}
+
+	for _, binding := range additional {
+		if rules, err = parseProtoHTTPRule(binding, rules); err != nil {
+			return nil, err
+		}
+	}
+
+	return rules, nil
+}
+
+// check makes sure every referenced type is part of the set
+func (s *ProtoDescriptorSet) check() error {
+	for _, message := range s.Messages {
+		for _, field := range message.Fields {
+			switch field.Type {
+			case protoTypeMessage:
+				if _, found := s.Messages[field.TypeName]; !found {
+					return fmt.Errorf("message %s is missing from the descriptor set", field.TypeName)
+				}
+			case protoTypeEnum:
+				if _, found := s.Enums[field.TypeName]; !found {
+					return fmt.Errorf("enum %s is missing from the descriptor set", field.TypeName)
+				}
+			}
+		}
+	}
+
+	for _, method := range s.Methods {
+		for _, typeName := range []string{method.InputType, method.OutputType} {
+			if _, found := s.Messages[typeName]; !found {
+				return fmt.Errorf("message %s is missing from the descriptor set", typeName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolveFieldPath follows a dotted path of field names from a message
+func (s *ProtoDescriptorSet) resolveFieldPath(message *ProtoMessage, path string) (*ProtoField, error) {
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		field := message.Field(part)
+		if field == nil {
+			return nil, fmt.Errorf("%s has no field %q", message.FullName, part)
+		}
+		if i == len(parts)-1 {
+			return field, nil
+		}
+		if field.Type != protoTypeMessage || field.Repeated {
+			return nil, fmt.Errorf("field %q of %s is not a message", part, message.FullName)
+		}
+		message = s.Messages[field.TypeName]
+	}
+
+	return nil, errors.New("empty field path")
+}
+
+func protoSegmentsPattern(segments string) string {
+	parts := strings.Split(segments, "/")
+	for i, part := range parts {
+		switch part {
+		case "*":
+			parts[i] = "[^/]+"
+		case "**":
+			parts[i] = ".*"
+		default:
+			parts[i] = regexp.QuoteMeta(part)
+		}
+	}
+
+	return strings.Join(parts, "/")
+}
+
+// compileHTTPPathTemplate turns a google.api.http path template into a regular expression and
+// the field paths of its variables. The start is left open so that listen paths still match
+func compileHTTPPathTemplate(template string) (*regexp.Regexp, []string, error) {
+	if !strings.HasPrefix(template, "/") {
+		return nil, nil, fmt.Errorf("path template %q must start with /", template)
+	}
+
+	verb := ""
+	if i := strings.LastIndex(template, ":"); i > strings.LastIndex(template, "/") && i > strings.LastIndex(template, "}") {
+		verb = template[i:]
+		template = template[:i]
+	}
+
+	var pattern bytes.Buffer
+	variables := []string{}
+	for i := 0; i < len(template); {
+		switch {
+		case template[i] == '{':
+			end := strings.IndexByte(template[i:], '}')
+			if end == -1 {
+				return nil, nil, fmt.Errorf("unterminated variable in path template %q", template)
+			}
+			variable, segments := template[i+1:i+end], "*"
+			if eq := strings.IndexByte(variable, '='); eq != -1 {
+				variable, segments = variable[:eq], variable[eq+1:]
+			}
+			variables = append(variables, variable)
+			pattern.WriteString("(" + protoSegmentsPattern(segments) + ")")
+			i += end + 1
+		case strings.HasPrefix(template[i:], "**"):
+			pattern.WriteString(".*")
+			i += 2
+		case template[i] == '*':
+			pattern.WriteString("[^/]+")
+			i++
+		default:
+			next := strings.IndexAny(template[i:], "{*")
+			if next == -1 {
+				next = len(template) - i
+			}
+			pattern.WriteString(regexp.QuoteMeta(template[i : i+next]))
+			i += next
+		}
+	}
+
+	compiled, err := regexp.Compile(pattern.String() + regexp.QuoteMeta(verb) + "$")
+	return compiled, variables, err
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// The proto3 JSON mapping: 64 bit integers are strings, enums use their names, bytes are base64
+// and fields are keyed by their JSON names. Both JSON and proto names are accepted on input
+
+func protoWireType(fieldType int) int {
+	switch fieldType {
+	case protoTypeDouble, protoTypeFixed64, protoTypeSfixed64:
+		return protoWireFixed64
+	case protoTypeFloat, protoTypeFixed32, protoTypeSfixed32:
+		return protoWireFixed32
+	case protoTypeString, protoTypeBytes, protoTypeMessage:
+		return protoWireBytes
+	}
+
+	return protoWireVarint
+}
+
+func appendProtoKey(out []byte, number int, wireType int) []byte {
+	return append(out, proto.EncodeVarint(uint64(number)<<3|uint64(wireType))...)
+}
+
+func appendProtoBytes(out []byte, data []byte) []byte {
+	out = append(out, proto.EncodeVarint(uint64(len(data)))...)
+	return append(out, data...)
+}
+
+func protoJSONInt(value interface{}, bits int) (int64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return protoJSONInt(string(v), bits)
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("%v is not an integer", v)
+		}
+		return protoJSONInt(strconv.FormatFloat(v, 'f', -1, 64), bits)
+	case string:
+		if i, err := strconv.ParseInt(v, 10, bits); err == nil {
+			return i, nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f != math.Trunc(f) {
+			return 0, fmt.Errorf("%q is not an integer", v)
+		}
+		return strconv.ParseInt(strconv.FormatFloat(f, 'f', -1, 64), 10, bits)
+	}
+
+	return 0, fmt.Errorf("%v is not an integer", value)
+}
+
+func protoJSONUint(value interface{}, bits int) (uint64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return protoJSONUint(string(v), bits)
+	case float64:
+		return protoJSONUint(strconv.FormatFloat(v, 'f', -1, 64), bits)
+	case string:
+		return strconv.ParseUint(v, 10, bits)
+	}
+
+	return 0, fmt.Errorf("%v is not an unsigned integer", value)
+}
+
+func protoJSONFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return strconv.ParseFloat(string(v), 64)
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+
+	return 0, fmt.Errorf("%v is not a number", value)
+}
+
+// appendProtoValue encodes a single JSON value as the payload of a field, without its key
+func (s *ProtoDescriptorSet) appendProtoValue(out []byte, field *ProtoField, value interface{}) ([]byte, error) {
+	switch field.Type {
+	case protoTypeDouble:
+		f, err := protoJSONFloat(value)
+		if err != nil {
+			return nil, err
+		}
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(f))
+		return append(out, buf[:]...), nil
+	case protoTypeFloat:
+		f, err := protoJSONFloat(value)
+		if err != nil {
+			return nil, err
+		}
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], math.Float32bits(float32(f)))
+		return append(out, buf[:]...), nil
+	case protoTypeInt64, protoTypeInt32:
+		bits := 64
+		if field.Type == protoTypeInt32 {
+			bits = 32
+		}
+		i, err := protoJSONInt(value, bits)
+		if err != nil {
+			return nil, err
+		}
+		return append(out, proto.EncodeVarint(uint64(i))...), nil
+	case protoTypeUint64, protoTypeUint32:
+		bits := 64
+		if field.Type == protoTypeUint32 {
+			bits = 32
+		}
+		u, err := protoJSONUint(value, bits)
+		if err != nil {
+			return nil, err
+		}
+		return append(out, proto.EncodeVarint(u)...), nil
+	case protoTypeSint32, protoTypeSint64:
+		bits := 64
+		if field.Type == protoTypeSint32 {
+			bits = 32
+		}
+		i, err := protoJSONInt(value, bits)
+		if err != nil {
+			return nil, err
+		}
+		return append(out, proto.EncodeVarint(uint64(i<<1)^uint64(i>>63))...), nil
+	case protoTypeFixed64, protoTypeFixed32:
+		bits := 64
+		if field.Type == protoTypeFixed32 {
+			bits = 32
+		}
+		u, err := protoJSONUint(value, bits)
+		if err != nil {
+			return nil, err
+		}
+		if bits == 32 {
+			var buf [4]byte
+			binary.LittleEndian.PutUint32(buf[:], uint32(u))
+			return append(out, buf[:]...), nil
+		}
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], u)
+		return append(out, buf[:]...), nil
+	case protoTypeSfixed64, protoTypeSfixed32:
+		bits := 64
+		if field.Type == protoTypeSfixed32 {
+			bits = 32
+		}
+		i, err := protoJSONInt(value, bits)
+		if err != nil {
+			return nil, err
+		}
+		if bits == 32 {
+			var buf [4]byte
+			binary.LittleEndian.PutUint32(buf[:], uint32(int32(i)))
+			return append(out, buf[:]...), nil
+		}
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], uint64(i))
+		return append(out, buf[:]...), nil
+	case protoTypeBool:
+		switch v := value.(type) {
+		case bool:
+			if v {
+				return append(out, 1), nil
+			}
+			return append(out, 0), nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a boolean", v)
+			}
+			return s.appendProtoValue(out, field, b)
+		}
+		return nil, fmt.Errorf("%v is not a boolean", value)
+	case protoTypeString:
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a string", value)
+		}
+		return appendProtoBytes(out, []byte(str)), nil
+	case protoTypeBytes:
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a base64 string", value)
+		}
+		for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+			if decoded, err := encoding.DecodeString(str); err == nil {
+				return appendProtoBytes(out, decoded), nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not a base64 string", str)
+	case protoTypeEnum:
+		enum := s.Enums[field.TypeName]
+		if name, ok := value.(string); ok {
+			if number, found := enum.Values[name]; found {
+				return append(out, proto.EncodeVarint(uint64(number))...), nil
+			}
+		}
+		i, err := protoJSONInt(value, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%v is not a value of %s", value, enum.FullName)
+		}
+		return append(out, proto.EncodeVarint(uint64(i))...), nil
+	case protoTypeMessage:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v is not an object", value)
+		}
+		encoded, err := s.EncodeJSON(s.Messages[field.TypeName], object)
+		if err != nil {
+			return nil, err
+		}
+		return appendProtoBytes(out, encoded), nil
+	}
+
+	return nil, fmt.Errorf("unsupported field type %d", field.Type)
+}
+
+func (s *ProtoDescriptorSet) appendProtoField(out []byte, field *ProtoField, value interface{}) ([]byte, error) {
+	if value == nil {
+		return out, nil
+	}
+
+	if !field.Repeated {
+		return s.appendProtoValue(appendProtoKey(out, field.Number, protoWireType(field.Type)), field, value)
+	}
+
+	if field.Type == protoTypeMessage && s.Messages[field.TypeName].MapEntry {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v is not an object", value)
+		}
+
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var err error
+		for _, key := range keys {
+			entry := map[string]interface{}{"key": key, "value": object[key]}
+			if out, err = s.appendProtoValue(appendProtoKey(out, field.Number, protoWireBytes), field, entry); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v is not a list", value)
+	}
+	if len(list) == 0 {
+		return out, nil
+	}
+
+	// Scalar numbers are packed, which every proto2 and proto3 parser accepts
+	if protoWireType(field.Type) != protoWireBytes {
+		packed := []byte{}
+		for _, item := range list {
+			var err error
+			if packed, err = s.appendProtoValue(packed, field, item); err != nil {
+				return nil, err
+			}
+		}
+		return appendProtoBytes(appendProtoKey(out, field.Number, protoWireBytes), packed), nil
+	}
+
+	for _, item := range list {
+		var err error
+		if out, err = s.appendProtoValue(appendProtoKey(out, field.Number, protoWireBytes), field, item); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// EncodeJSON encodes a JSON object, decoded with UseNumber, as a message
+func (s *ProtoDescriptorSet) EncodeJSON(message *ProtoMessage, object map[string]interface{}) ([]byte, error) {
+	for key := range object {
+		if message.Field(key) == nil {
+			return nil, fmt.Errorf("%s has no field %q", message.FullName, key)
+		}
+	}
+
+	out := []byte{}
+	for _, field := range message.Fields {
+		value, found := object[field.JSONName]
+		if !found {
+			value = object[field.Name]
+		}
+
+		var err error
+		if out, err = s.appendProtoField(out, field, value); err != nil {
+			return nil, fmt.Errorf("%s: %v", field.JSONName, err)
+		}
+	}
+
+	return out, nil
+}
+
+func protoJSONFloatValue(f float64) interface{} {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+
+	return f
+}
+
+// decodeProtoValue turns a single encoded value into its JSON representation
+func (s *ProtoDescriptorSet) decodeProtoValue(field *ProtoField, wireField protoWireField) (interface{}, error) {
+	if wireField.WireType != protoWireType(field.Type) {
+		return nil, fmt.Errorf("field %s has wire type %d", field.Name, wireField.WireType)
+	}
+
+	v := wireField.Value
+	switch field.Type {
+	case protoTypeDouble:
+		return protoJSONFloatValue(math.Float64frombits(v)), nil
+	case protoTypeFloat:
+		return protoJSONFloatValue(float64(math.Float32frombits(uint32(v)))), nil
+	case protoTypeInt64, protoTypeSfixed64:
+		return strconv.FormatInt(int64(v), 10), nil
+	case protoTypeUint64, protoTypeFixed64:
+		return strconv.FormatUint(v, 10), nil
+	case protoTypeInt32, protoTypeSfixed32:
+		return int32(v), nil
+	case protoTypeUint32, protoTypeFixed32:
+		return uint32(v), nil
+	case protoTypeSint32:
+		return int32(uint32(v>>1)) ^ -int32(v&1), nil
+	case protoTypeSint64:
+		return strconv.FormatInt(int64(v>>1)^-int64(v&1), 10), nil
+	case protoTypeBool:
+		return v != 0, nil
+	case protoTypeEnum:
+		if name, found := s.Enums[field.TypeName].Names[int32(v)]; found {
+			return name, nil
+		}
+		return int32(v), nil
+	case protoTypeString:
+		return string(wireField.Bytes), nil
+	case protoTypeBytes:
+		return base64.StdEncoding.EncodeToString(wireField.Bytes), nil
+	case protoTypeMessage:
+		return s.DecodeJSON(s.Messages[field.TypeName], wireField.Bytes)
+	}
+
+	return nil, fmt.Errorf("unsupported field type %d", field.Type)
+}
+
+// unpackProtoValues splits a packed repeated field into single values
+func unpackProtoValues(field *ProtoField, data []byte) ([]protoWireField, error) {
+	values := []protoWireField{}
+	wireType := protoWireType(field.Type)
+	for len(data) > 0 {
+		value := protoWireField{Number: field.Number, WireType: wireType}
+		switch wireType {
+		case protoWireVarint:
+			var n int
+			if value.Value, n = proto.DecodeVarint(data); n == 0 {
+				return nil, fmt.Errorf("malformed packed field %s", field.Name)
+			}
+			data = data[n:]
+		case protoWireFixed64:
+			if len(data) < 8 {
+				return nil, fmt.Errorf("malformed packed field %s", field.Name)
+			}
+			value.Value = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case protoWireFixed32:
+			if len(data) < 4 {
+				return nil, fmt.Errorf("malformed packed field %s", field.Name)
+			}
+			value.Value = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// protoJSONDefault is the JSON value of a field that is not set
+func (s *ProtoDescriptorSet) protoJSONDefault(field *ProtoField) interface{} {
+	if field.Repeated {
+		if field.Type == protoTypeMessage && s.Messages[field.TypeName].MapEntry {
+			return map[string]interface{}{}
+		}
+		return []interface{}{}
+	}
+
+	switch field.Type {
+	case protoTypeString, protoTypeBytes:
+		return ""
+	case protoTypeBool:
+		return false
+	case protoTypeInt64, protoTypeUint64, protoTypeFixed64, protoTypeSfixed64, protoTypeSint64:
+		return "0"
+	case protoTypeEnum:
+		if name, found := s.Enums[field.TypeName].Names[0]; found {
+			return name
+		}
+		return 0
+	case protoTypeMessage:
+		return nil
+	}
+
+	return 0
+}
+
+// DecodeJSON decodes a message into a JSON object, unknown fields are dropped
+func (s *ProtoDescriptorSet) DecodeJSON(message *ProtoMessage, data []byte) (map[string]interface{}, error) {
+	wireFields, err := readProtoFields(data)
+	if err != nil {
+		return nil, err
+	}
+
+	object := map[string]interface{}{}
+	for _, wireField := range wireFields {
+		field := message.byNumber[wireField.Number]
+		if field == nil {
+			continue
+		}
+
+		if !field.Repeated {
+			if object[field.JSONName], err = s.decodeProtoValue(field, wireField); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if field.Type == protoTypeMessage && s.Messages[field.TypeName].MapEntry {
+			entryMessage := s.Messages[field.TypeName]
+			entry, err := s.decodeProtoValue(field, wireField)
+			if err != nil {
+				return nil, err
+			}
+			entryObject := entry.(map[string]interface{})
+
+			entries, _ := object[field.JSONName].(map[string]interface{})
+			if entries == nil {
+				entries = map[string]interface{}{}
+				object[field.JSONName] = entries
+			}
+
+			key, found := entryObject["key"]
+			if !found {
+				key = s.protoJSONDefault(entryMessage.Field("key"))
+			}
+			value, found := entryObject["value"]
+			if !found {
+				value = s.protoJSONDefault(entryMessage.Field("value"))
+			}
+			entries[fmt.Sprint(key)] = value
+			continue
+		}
+
+		values := []protoWireField{wireField}
+		if wireField.WireType == protoWireBytes && protoWireType(field.Type) != protoWireBytes {
+			if values, err = unpackProtoValues(field, wireField.Bytes); err != nil {
+				return nil, err
+			}
+		}
+
+		list, _ := object[field.JSONName].([]interface{})
+		for _, value := range values {
+			decoded, err := s.decodeProtoValue(field, value)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, decoded)
+		}
+		object[field.JSONName] = list
+	}
+
+	return object, nil
+}
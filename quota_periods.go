@@ -0,0 +1,168 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/TykTechnologies/logrus"
+	"github.com/pmylund/go-cache"
+)
+
+// QuotaPeriod aligns a quota window to a calendar boundary instead of rolling
+// QuotaRenewalRate seconds from the first request in the window
+type QuotaPeriod string
+
+const (
+	QuotaPeriodRolling QuotaPeriod = ""
+	QuotaPeriodHourly  QuotaPeriod = "hourly"
+	QuotaPeriodDaily   QuotaPeriod = "daily"
+	QuotaPeriodWeekly  QuotaPeriod = "weekly"
+	QuotaPeriodMonthly QuotaPeriod = "monthly"
+)
+
+const (
+	QuotaResetPolicyPrefix string = "quota-reset-policy-"
+	QuotaResetOrgPrefix    string = "quota-reset-org-"
+
+	// QuotaResetMarkerTTL outlives the longest calendar period and rolling quotas of up to a year,
+	// by then every counter the reset was meant for has expired by itself
+	QuotaResetMarkerTTL int64 = 366 * 24 * 60 * 60
+)
+
+// QuotaResetCache keeps reset markers in memory so the limiter doesn't
+// have to query the store for them on every request
+var QuotaResetCache *cache.Cache = cache.New(5*time.Second, 10*time.Second)
+
+func (s *SessionState) quotaLocation() *time.Location {
+	if s.QuotaTimezone == "" {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(s.QuotaTimezone)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix":   "quota",
+			"timezone": s.QuotaTimezone,
+		}).Warning("Invalid quota timezone, falling back to UTC: ", err)
+		return time.UTC
+	}
+
+	return loc
+}
+
+// QuotaPeriodEnd returns the epoch at which the quota window containing "now" ends,
+// for rolling quotas this is simply now + QuotaRenewalRate
+func (s *SessionState) QuotaPeriodEnd(now time.Time) int64 {
+	local := now.In(s.quotaLocation())
+	y, m, d := local.Date()
+
+	var end time.Time
+	switch QuotaPeriod(s.QuotaRenewalPeriod) {
+	case QuotaPeriodHourly:
+		end = time.Date(y, m, d, local.Hour(), 0, 0, 0, local.Location()).Add(time.Hour)
+	case QuotaPeriodDaily:
+		end = time.Date(y, m, d+1, 0, 0, 0, 0, local.Location())
+	case QuotaPeriodWeekly:
+		// Weeks start on a Monday
+		daysLeft := (7 - (int(local.Weekday())+6)%7)
+		end = time.Date(y, m, d+daysLeft, 0, 0, 0, 0, local.Location())
+	case QuotaPeriodMonthly:
+		end = time.Date(y, m+1, 1, 0, 0, 0, 0, local.Location())
+	default:
+		return now.Unix() + s.QuotaRenewalRate
+	}
+
+	return end.Unix()
+}
+
+// QuotaPeriodTTL is the number of seconds a quota counter created at "now" should live for
+func (s *SessionState) QuotaPeriodTTL(now time.Time) int64 {
+	ttl := s.QuotaPeriodEnd(now) - now.Unix()
+	if ttl < 1 {
+		return 1
+	}
+
+	return ttl
+}
+
+func getQuotaResetMarker(rawKey string, store StorageHandler) int64 {
+	if cachedVal, found := QuotaResetCache.Get(rawKey); found {
+		return cachedVal.(int64)
+	}
+
+	var marker int64
+	val, err := store.GetRawKey(rawKey)
+	if err == nil {
+		marker, _ = strconv.ParseInt(val, 10, 64)
+	}
+
+	QuotaResetCache.Set(rawKey, marker, cache.DefaultExpiration)
+	return marker
+}
+
+// ScheduleQuotaReset records a reset marker for every key attached to a policy
+// or owned by an org, limiters will clear the quota counter of any key whose
+// last reset happened before the marker the next time it is seen
+func ScheduleQuotaReset(rawKey string, store StorageHandler) (int64, error) {
+	marker := time.Now().Unix()
+	if err := store.SetRawKey(rawKey, strconv.FormatInt(marker, 10), QuotaResetMarkerTTL); err != nil {
+		return 0, err
+	}
+
+	QuotaResetCache.Delete(rawKey)
+	return marker, nil
+}
+
+// pendingQuotaReset returns the newest reset marker that applies to the session
+// and hasn't been applied yet, or 0 if there is none
+func pendingQuotaReset(currentSession *SessionState, store StorageHandler) int64 {
+	var marker int64
+	for _, policyID := range currentSession.PolicyIDs() {
+		policyMarker := getQuotaResetMarker(QuotaResetPolicyPrefix+policyID, store)
+		if policyMarker > marker {
+			marker = policyMarker
+		}
+	}
+
+	if currentSession.OrgID != "" {
+		orgMarker := getQuotaResetMarker(QuotaResetOrgPrefix+currentSession.OrgID, store)
+		if orgMarker > marker {
+			marker = orgMarker
+		}
+	}
+
+	if marker > currentSession.QuotaLastReset {
+		return marker
+	}
+
+	return 0
+}
+
+// carryQuotaLastReset keeps the resets a key has already had when it is replaced through the API, so
+// they aren't applied to it again. New keys start after any reset scheduled before they existed.
+func carryQuotaLastReset(keyName string, session *SessionState) {
+	managers := []SessionHandler{FallbackKeySesionManager}
+	if len(session.AccessRights) > 0 {
+		managers = managers[:0]
+		for apiID := range session.AccessRights {
+			if spec := GetSpecForApi(apiID); spec != nil {
+				managers = append(managers, spec.SessionManager)
+			}
+		}
+	}
+
+	for _, manager := range managers {
+		// Unloaded specs and the fallback manager before start-up have nothing to look in
+		if manager == nil || manager.GetStore() == nil {
+			continue
+		}
+		if existing, found := manager.GetSessionDetail(keyName); found {
+			session.QuotaLastReset = existing.QuotaLastReset
+			return
+		}
+	}
+
+	if session.QuotaLastReset == 0 {
+		session.QuotaLastReset = time.Now().Unix()
+	}
+}
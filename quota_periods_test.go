@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuotaPeriodEnd(t *testing.T) {
+	now := time.Date(2016, time.November, 16, 13, 45, 10, 0, time.UTC) // a Wednesday
+
+	tests := []struct {
+		period   QuotaPeriod
+		timezone string
+		expected time.Time
+	}{
+		{QuotaPeriodHourly, "", time.Date(2016, time.November, 16, 14, 0, 0, 0, time.UTC)},
+		{QuotaPeriodDaily, "", time.Date(2016, time.November, 17, 0, 0, 0, 0, time.UTC)},
+		{QuotaPeriodWeekly, "", time.Date(2016, time.November, 21, 0, 0, 0, 0, time.UTC)},
+		{QuotaPeriodMonthly, "", time.Date(2016, time.December, 1, 0, 0, 0, 0, time.UTC)},
+		{QuotaPeriodDaily, "Etc/GMT-3", time.Date(2016, time.November, 16, 21, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		thisSession := SessionState{QuotaRenewalPeriod: string(test.period), QuotaTimezone: test.timezone}
+		end := thisSession.QuotaPeriodEnd(now)
+		if end != test.expected.Unix() {
+			t.Errorf("Period %q (%q): expected %v, got %v", test.period, test.timezone, test.expected, time.Unix(end, 0).UTC())
+		}
+	}
+}
+
+func TestQuotaPeriodEndRolling(t *testing.T) {
+	now := time.Now()
+	thisSession := SessionState{QuotaRenewalRate: 300}
+
+	if thisSession.QuotaPeriodEnd(now) != now.Unix()+300 {
+		t.Error("Rolling quota should renew QuotaRenewalRate seconds from now")
+	}
+
+	if thisSession.QuotaPeriodTTL(now) != 300 {
+		t.Error("Rolling quota TTL should equal QuotaRenewalRate, got: ", thisSession.QuotaPeriodTTL(now))
+	}
+}
+
+func TestQuotaPeriodEndEndOfMonth(t *testing.T) {
+	now := time.Date(2016, time.December, 31, 23, 59, 59, 0, time.UTC)
+	thisSession := SessionState{QuotaRenewalPeriod: string(QuotaPeriodMonthly)}
+
+	if thisSession.QuotaPeriodEnd(now) != time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC).Unix() {
+		t.Error("Monthly quota should roll over into the next year")
+	}
+
+	if thisSession.QuotaPeriodTTL(now) != 1 {
+		t.Error("Expected a TTL of one second, got: ", thisSession.QuotaPeriodTTL(now))
+	}
+}
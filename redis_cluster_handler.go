@@ -829,3 +829,67 @@ func (r *RedisClusterStorageManager) SetRollingWindowPipeline(keyName string, pe
 	}
 	return 0, []interface{}{}
 }
+
+// AcquireLease adds a lease to a sorted set that expires after leaseTTL seconds, expired leases are purged first
+// so that slots held by crashed nodes are eventually freed. Returns false if the set would grow beyond limit.
+func (r *RedisClusterStorageManager) AcquireLease(keyName string, leaseID string, limit int64, leaseTTL int64) bool {
+	if GetRelevantClusterReference(r.IsCache) == nil {
+		log.Info("Connection dropped, connecting..")
+		r.Connect()
+		return r.AcquireLease(keyName, leaseID, limit, leaseTTL)
+	}
+
+	fixedKey := r.fixKey(keyName)
+	now := time.Now()
+
+	ZREMRANGEBYSCORE := rediscluster.ClusterTransaction{}
+	ZREMRANGEBYSCORE.Cmd = "ZREMRANGEBYSCORE"
+	ZREMRANGEBYSCORE.Args = []interface{}{fixedKey, "-inf", now.UnixNano()}
+
+	ZADD := rediscluster.ClusterTransaction{}
+	ZADD.Cmd = "ZADD"
+	ZADD.Args = []interface{}{fixedKey, now.Add(time.Duration(leaseTTL) * time.Second).UnixNano(), leaseID}
+
+	ZCARD := rediscluster.ClusterTransaction{}
+	ZCARD.Cmd = "ZCARD"
+	ZCARD.Args = []interface{}{fixedKey}
+
+	EXPIRE := rediscluster.ClusterTransaction{}
+	EXPIRE.Cmd = "EXPIRE"
+	EXPIRE.Args = []interface{}{fixedKey, leaseTTL}
+
+	redVal, err := redis.Values(GetRelevantClusterReference(r.IsCache).DoTransaction([]rediscluster.ClusterTransaction{ZREMRANGEBYSCORE, ZADD, ZCARD, EXPIRE}))
+	if err != nil || len(redVal) < 3 {
+		// Fail open, an unavailable store shouldn't take the API down with it
+		log.Error("Multi command failed: ", err)
+		return true
+	}
+
+	inFlight, err := redis.Int64(redVal[2], nil)
+	if err != nil {
+		log.Error("Could not read lease count: ", err)
+		return true
+	}
+
+	if inFlight > limit {
+		r.ReleaseLease(keyName, leaseID)
+		return false
+	}
+
+	return true
+}
+
+// ReleaseLease removes a lease that was added with AcquireLease
+func (r *RedisClusterStorageManager) ReleaseLease(keyName string, leaseID string) {
+	if GetRelevantClusterReference(r.IsCache) == nil {
+		log.Info("Connection dropped, connecting..")
+		r.Connect()
+		r.ReleaseLease(keyName, leaseID)
+		return
+	}
+
+	_, err := GetRelevantClusterReference(r.IsCache).Do("ZREM", r.fixKey(keyName), leaseID)
+	if err != nil {
+		log.Error("Error trying to release lease: ", err)
+	}
+}
@@ -10,3 +10,12 @@ func HandleReloadMsg() {
 	}).Info("Reloading endpoints")
 	ReloadURLStructure()
 }
+
+// HandlePolicyChangedMsg reloads policies without rebuilding the API router, keys
+// pick up the re-merged policies the next time they are seen
+func HandlePolicyChangedMsg() {
+	log.WithFields(logrus.Fields{
+		"prefix": "pub-sub",
+	}).Info("Reloading policies")
+	getPolicies()
+}
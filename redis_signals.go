@@ -77,6 +77,8 @@ func HandleRedisMsg(message redis.Message) {
 		OnServerStatusReceivedHandler(thisMessage.Payload)
 	case NoticeGatewayLENotification:
 		OnLESSLStatusReceivedHandler(thisMessage.Payload)
+	case NoticePolicyChanged:
+		HandlePolicyChangedMsg()
 	default:
 		HandleReloadMsg()
 		break
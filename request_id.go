@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/context"
+	"github.com/lonelycode/go-uuid/uuid"
+)
+
+const (
+	defaultRequestIDHeader = "X-Request-ID"
+	maxRequestIDLength     = 128
+)
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func requestIDHeader() string {
+	if config.RequestID.HeaderName != "" {
+		return config.RequestID.HeaderName
+	}
+	return defaultRequestIDHeader
+}
+
+// newULID builds a ULID, a millisecond timestamp followed by 80 random bits written in Crockford's
+// base32 so IDs sort by the time they were made
+func newULID(t time.Time, entropy io.Reader) string {
+	var id [16]byte
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	binary.BigEndian.PutUint16(id[0:], uint16(ms>>32))
+	binary.BigEndian.PutUint32(id[2:], uint32(ms))
+	io.ReadFull(entropy, id[6:])
+
+	hi, lo := binary.BigEndian.Uint64(id[:8]), binary.BigEndian.Uint64(id[8:])
+	encoded := make([]byte, 26)
+	for i := len(encoded) - 1; i >= 0; i-- {
+		encoded[i] = crockfordAlphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(encoded)
+}
+
+func newRequestID() string {
+	if config.RequestID.Generator == "ulid" {
+		return newULID(time.Now(), rand.Reader)
+	}
+	return uuid.NewRandom().String()
+}
+
+// validRequestID only accepts IDs from clients that are short and printable, so they are safe to log
+// and forward
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// dropUpstreamRequestID keeps a response from repeating the request ID, the gateway has set it on
+// the client response already and cached responses carry the one of the request that filled them
+func dropUpstreamRequestID(header http.Header) {
+	if config.RequestID.Enabled {
+		header.Del(requestIDHeader())
+	}
+}
+
+// RequestIDMiddleware gives every request an ID, taken from the client when it sends a usable one,
+// that is forwarded upstream, returned to the client and added to the context variables
+type RequestIDMiddleware struct {
+	*TykMiddleware
+}
+
+func (m *RequestIDMiddleware) GetName() string {
+	return "RequestIDMiddleware"
+}
+
+// New lets you do any initialisations for the object can be done here
+func (m *RequestIDMiddleware) New() {}
+
+// GetConfig retrieves the configuration from the API config - we user mapstructure for this for simplicity
+func (m *RequestIDMiddleware) GetConfig() (interface{}, error) {
+	return nil, nil
+}
+
+func (m *RequestIDMiddleware) IsEnabledForSpec() bool {
+	return config.RequestID.Enabled
+}
+
+// ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
+func (m *RequestIDMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, configuration interface{}) (error, int) {
+	headerName := requestIDHeader()
+	id := r.Header.Get(headerName)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+
+	r.Header.Set(headerName, id)
+	w.Header().Set(headerName, id)
+
+	contextDataObject, ok := context.Get(r, ContextData).(map[string]interface{})
+	if !ok {
+		contextDataObject = make(map[string]interface{})
+	}
+	contextDataObject["request_id"] = id
+	context.Set(r, ContextData, contextDataObject)
+
+	return nil, 200
+}
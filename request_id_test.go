@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/context"
+)
+
+func TestULID(t *testing.T) {
+	at := time.Unix(0, 1469918176385*int64(time.Millisecond))
+	if id := newULID(at, bytes.NewReader(make([]byte, 10))); id != "01ARYZ6S410000000000000000" {
+		t.Error("ULIDs should start with the encoded timestamp, got: ", id)
+	}
+	if id := newULID(at, bytes.NewReader(bytes.Repeat([]byte{0xff}, 10))); id != "01ARYZ6S41ZZZZZZZZZZZZZZZZ" {
+		t.Error("ULIDs should end with the encoded entropy, got: ", id)
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	defer func() { config.RequestID = RequestIDConf{} }()
+	config.RequestID = RequestIDConf{Enabled: true}
+
+	spec := createDefinitionFromString(headerTemplateDefinition)
+	mw := &RequestIDMiddleware{&TykMiddleware{spec, nil}}
+
+	call := func(header, clientID string) (*http.Request, *httptest.ResponseRecorder) {
+		req, _ := http.NewRequest("GET", "/v1/orders", nil)
+		if clientID != "" {
+			req.Header.Set(header, clientID)
+		}
+		recorder := httptest.NewRecorder()
+		mw.ProcessRequest(recorder, req, nil)
+		return req, recorder
+	}
+
+	req, recorder := call("X-Request-ID", "client-id-1")
+	if req.Header.Get("X-Request-ID") != "client-id-1" || recorder.Header().Get("X-Request-ID") != "client-id-1" || requestID(req) != "client-id-1" {
+		t.Error("A usable client ID should be kept, got: ", recorder.Header())
+	}
+	if contextData := context.Get(req, ContextData).(map[string]interface{}); contextData["request_id"] != "client-id-1" {
+		t.Error("The ID should be added to the context variables, got: ", contextData)
+	}
+	context.Clear(req)
+
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	for _, clientID := range []string{"", "has space", strings.Repeat("a", 129)} {
+		req, recorder = call("X-Request-ID", clientID)
+		if id := recorder.Header().Get("X-Request-ID"); !uuidPattern.MatchString(id) || req.Header.Get("X-Request-ID") != id {
+			t.Errorf("Client ID %q should be replaced with a UUID, got: %s", clientID, id)
+		}
+		context.Clear(req)
+	}
+
+	config.RequestID = RequestIDConf{Enabled: true, HeaderName: "X-Correlation-ID", Generator: "ulid"}
+	req, recorder = call("X-Correlation-ID", "")
+	if id := recorder.Header().Get("X-Correlation-ID"); !regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`).MatchString(id) || requestID(req) != id {
+		t.Error("The configured header and generator should be used, got: ", recorder.Header())
+	}
+	context.Clear(req)
+
+	// Requests the middleware hasn't seen only report client IDs that are safe to log
+	req, _ = http.NewRequest("GET", "/v1/orders", nil)
+	req.Header.Set("X-Correlation-ID", "forged\" level=info")
+	if id := requestID(req); id != "" {
+		t.Error("Unusable client IDs should not be reported, got: ", id)
+	}
+	req.Header.Set("X-Correlation-ID", "client-id-2")
+	if id := requestID(req); id != "client-id-2" {
+		t.Error("Usable client IDs should be reported, got: ", id)
+	}
+
+	header := http.Header{"X-Correlation-Id": {"upstream"}}
+	dropUpstreamRequestID(header)
+	if len(header) != 0 {
+		t.Error("Responses shouldn't repeat the request ID, got: ", header)
+	}
+}
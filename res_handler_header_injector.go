@@ -1,7 +1,6 @@
 package main
 
 import (
-	"github.com/TykTechnologies/tykcommon"
 	"github.com/mitchellh/mapstructure"
 	"net/http"
 )
@@ -48,16 +47,20 @@ func (h HeaderInjector) HandleResponse(rw http.ResponseWriter, res *http.Respons
 	}
 
 	if stat == StatusHeaderInjected {
-		thisMeta := meta.(*tykcommon.HeaderInjectionMeta)
-
-		for _, dKey := range thisMeta.DeleteHeaders {
-			res.Header.Del(dKey)
-		}
-
-		for nKey, nVal := range thisMeta.AddHeaders {
-			res.Header.Add(nKey, nVal)
+		thisMeta := meta.(*HeaderInjectionSpec)
+		if thisMeta.Applies(req) {
+			for _, dKey := range thisMeta.DeleteHeaders {
+				res.Header.Del(dKey)
+			}
+
+			for nKey, nVal := range thisMeta.AddHeaders {
+				res.Header.Add(nKey, nVal)
+			}
+
+			data := newHeaderTemplateData(req, h.Spec)
+			data.Status = res.StatusCode
+			thisMeta.renderTemplateHeaders(res.Header, data)
 		}
-
 	}
 
 	// Global header options
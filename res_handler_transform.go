@@ -5,7 +5,8 @@ import (
 	"encoding/json"
 	"github.com/TykTechnologies/logrus"
 	"github.com/clbanning/mxj"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/gorilla/context"
 	"github.com/mitchellh/mapstructure"
 	"io/ioutil"
 	"net/http"
@@ -39,6 +40,25 @@ func (rt ResponseTransformMiddleware) New(c interface{}, spec *APISpec) (TykResp
 	return thisHandler, nil
 }
 
+// responseHasBody reports whether a response may carry a body, 1xx, 204 and 304 responses and
+// replies to HEAD never do so there is nothing to transform
+func responseHasBody(res *http.Response, req *http.Request) bool {
+	switch {
+	case req.Method == "HEAD":
+		return false
+	case res.StatusCode >= 100 && res.StatusCode < 200:
+		return false
+	case res.StatusCode == http.StatusNoContent, res.StatusCode == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// BuffersResponseBody keeps the processor away from streamed responses
+func (rt ResponseTransformMiddleware) BuffersResponseBody() bool {
+	return true
+}
+
 func (rt ResponseTransformMiddleware) HandleResponse(rw http.ResponseWriter, res *http.Response, req *http.Request, ses *SessionState) error {
 	// New request checker, more targetted, less likely to fail
 	var stat RequestStatus
@@ -47,7 +67,7 @@ func (rt ResponseTransformMiddleware) HandleResponse(rw http.ResponseWriter, res
 
 	_, versionPaths, _, _ := rt.Spec.GetVersionData(req)
 	found, meta = rt.Spec.CheckSpecMatchesStatus(req.URL.Path, req.Method, versionPaths, TransformedResponse)
-	if found {
+	if found && responseHasBody(res, req) {
 		stat = StatusTransformResponse
 	}
 
@@ -58,10 +78,41 @@ func (rt ResponseTransformMiddleware) HandleResponse(rw http.ResponseWriter, res
 		defer res.Body.Close()
 		body, err := ioutil.ReadAll(res.Body)
 
+		if thisMeta.Mapping != nil {
+			var contextData, metaData interface{}
+			if thisMeta.TemplateMeta.TemplateData.EnableSession && ses != nil {
+				metaData = ses.MetaData
+			}
+			if rt.Spec.EnableContextVars {
+				contextData = context.Get(req, ContextData)
+			}
+
+			mapped, mapErr := applyJSONMapping(thisMeta.Mapping, thisMeta.TemplateMeta.TemplateData.Input, body, contextData, metaData)
+			if mapErr != nil {
+				log.WithFields(logrus.Fields{
+					"prefix":      "outbound-transform",
+					"server_name": rt.Spec.APIDefinition.Proxy.TargetURL,
+					"api_id":      rt.Spec.APIDefinition.APIID,
+					"path":        req.URL.Path,
+					"request_id":  requestID(req),
+				}).Error("Failed to apply mapping to response: ", mapErr)
+
+				// The client expects the mapped shape, the upstream's body is not sent in its place
+				replaceWithBadGateway(res, "Upstream response could not be transformed")
+				return nil
+			}
+
+			res.Header.Set("Content-Type", "application/json")
+			res.ContentLength = int64(len(mapped))
+			res.Header.Set("Content-Length", strconv.Itoa(len(mapped)))
+			res.Body = ioutil.NopCloser(bytes.NewReader(mapped))
+			return nil
+		}
+
 		// Put into an interface:
 		var bodyData interface{}
 		switch thisMeta.TemplateMeta.TemplateData.Input {
-		case tykcommon.RequestXML:
+		case apidef.RequestXML:
 			mxj.XmlCharsetReader = WrappedCharsetReader
 			var xErr error
 			bodyData, xErr = mxj.NewMapXml(body) // unmarshal
@@ -71,9 +122,10 @@ func (rt ResponseTransformMiddleware) HandleResponse(rw http.ResponseWriter, res
 					"server_name": rt.Spec.APIDefinition.Proxy.TargetURL,
 					"api_id":      rt.Spec.APIDefinition.APIID,
 					"path":        req.URL.Path,
+					"request_id":  requestID(req),
 				}).Error("Error unmarshalling XML: ", err)
 			}
-		case tykcommon.RequestJSON:
+		case apidef.RequestJSON:
 			json.Unmarshal(body, &bodyData)
 		default:
 			json.Unmarshal(body, &bodyData)
@@ -89,6 +141,7 @@ func (rt ResponseTransformMiddleware) HandleResponse(rw http.ResponseWriter, res
 				"server_name": rt.Spec.APIDefinition.Proxy.TargetURL,
 				"api_id":      rt.Spec.APIDefinition.APIID,
 				"path":        req.URL.Path,
+				"request_id":  requestID(req),
 			}).Error("Failed to apply template to request: ", err)
 		}
 
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/TykTechnologies/logrus"
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/gorilla/context"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	ResponseValidationReport  = "report"
+	ResponseValidationEnforce = "enforce"
+)
+
+type ResponseJSONValidatorOptions struct {
+	// Mode is either "report" (the default) which only records violations, or "enforce" which
+	// replaces invalid responses with a 502
+	Mode string `mapstructure:"mode" bson:"mode" json:"mode"`
+}
+
+// ResponseJSONValidator checks upstream responses against the schemas published for an endpoint
+type ResponseJSONValidator struct {
+	Spec   *APISpec
+	config ResponseJSONValidatorOptions
+}
+
+func (rv ResponseJSONValidator) New(c interface{}, spec *APISpec) (TykResponseHandler, error) {
+	thisHandler := ResponseJSONValidator{}
+	thisModuleConfig := ResponseJSONValidatorOptions{}
+
+	err := mapstructure.Decode(c, &thisModuleConfig)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	if thisModuleConfig.Mode != ResponseValidationEnforce {
+		if thisModuleConfig.Mode != "" && thisModuleConfig.Mode != ResponseValidationReport {
+			log.Warning("Unknown response validation mode, only reporting violations: ", thisModuleConfig.Mode)
+		}
+		thisModuleConfig.Mode = ResponseValidationReport
+	}
+
+	thisHandler.config = thisModuleConfig
+	thisHandler.Spec = spec
+
+	log.Debug("Response validation processor initialised")
+
+	return thisHandler, nil
+}
+
+// validatorForCode finds the schema for a status code, exact codes win over ranges such as
+// "2XX" and "default" catches everything else
+func (s *ValidateResponseSpec) validatorForCode(code int) *JSONSchema {
+	asString := strconv.Itoa(code)
+	for _, key := range []string{asString, asString[:1] + "XX", "DEFAULT"} {
+		if validator, found := s.Validators[key]; found {
+			return validator
+		}
+	}
+
+	return nil
+}
+
+// BuffersResponseBody is true as the whole body is needed to validate it
+func (rv ResponseJSONValidator) BuffersResponseBody() bool {
+	return true
+}
+
+// validatorFor finds the schema a response has to match, if there is one
+func (rv ResponseJSONValidator) validatorFor(res *http.Response, req *http.Request) *JSONSchema {
+	_, versionPaths, _, _ := rv.Spec.GetVersionData(req)
+	found, meta := rv.Spec.CheckSpecMatchesStatus(req.URL.Path, req.Method, versionPaths, ValidateJSONResponse)
+	if !found {
+		return nil
+	}
+
+	return meta.(*ValidateResponseSpec).validatorForCode(res.StatusCode)
+}
+
+// HandleUnreadableResponse deals with streamed bodies and bodies in an encoding the gateway can't
+// decode. They can't be checked, so they are rejected when the schema is enforced and recorded as a
+// violation when it is only reported
+func (rv ResponseJSONValidator) HandleUnreadableResponse(rw http.ResponseWriter, res *http.Response, req *http.Request, ses *SessionState) error {
+	if rv.validatorFor(res, req) == nil {
+		return nil
+	}
+
+	reason := "Upstream response could not be decoded for validation"
+	if isStreamingResponse(res, rv.Spec) {
+		reason = "Upstream response is streamed and was not validated"
+	}
+
+	log.WithFields(logrus.Fields{
+		"prefix":      "response-validation",
+		"server_name": rv.Spec.APIDefinition.Proxy.TargetURL,
+		"api_id":      rv.Spec.APIDefinition.APIID,
+		"path":        req.URL.Path,
+		"encoding":    res.Header.Get("Content-Encoding"),
+		"mode":        rv.config.Mode,
+		"request_id":  requestID(req),
+	}).Warning(reason)
+
+	if rv.config.Mode == ResponseValidationEnforce {
+		replaceWithBadGateway(res, "Upstream response could not be validated")
+		return nil
+	}
+
+	context.Set(req, ResponseValidationErrors, []string{"/: " + reason})
+
+	return nil
+}
+
+func (rv ResponseJSONValidator) HandleResponse(rw http.ResponseWriter, res *http.Response, req *http.Request, ses *SessionState) error {
+	validator := rv.validatorFor(res, req)
+	if validator == nil {
+		return nil
+	}
+
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		// What was read is gone, the body can't be passed on whatever the mode
+		replaceWithBadGateway(res, "Upstream response could not be validated")
+		return err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	validationErrors := validator.ValidateBytes(body)
+	if len(validationErrors) == 0 {
+		return nil
+	}
+
+	violations := make([]string, len(validationErrors))
+	for i, validationError := range validationErrors {
+		violations[i] = validationError.Pointer + ": " + validationError.Message
+	}
+	context.Set(req, ResponseValidationErrors, violations)
+
+	log.WithFields(logrus.Fields{
+		"prefix":      "response-validation",
+		"server_name": rv.Spec.APIDefinition.Proxy.TargetURL,
+		"api_id":      rv.Spec.APIDefinition.APIID,
+		"path":        req.URL.Path,
+		"code":        res.StatusCode,
+		"errors":      len(validationErrors),
+		"request_id":  requestID(req),
+	}).Warning("Upstream response does not match its schema")
+
+	go rv.Spec.FireEvent(EVENT_ResponseValidationFailed,
+		EVENT_ResponseValidationFailedMeta{
+			EventMetaDefault: EventMetaDefault{Message: "Upstream response failed validation", OriginatingRequest: EncodeRequestToEvent(req), RequestID: requestID(req)},
+			Path:             req.URL.Path,
+			Method:           req.Method,
+			APIID:            rv.Spec.APIDefinition.APIID,
+			StatusCode:       res.StatusCode,
+			Errors:           validationErrors,
+		})
+
+	if rv.config.Mode != ResponseValidationEnforce {
+		return nil
+	}
+
+	replaceWithBadGateway(res, "Upstream response failed validation")
+
+	return nil
+}
+
+// enableResponseValidation adds the validator in report mode to imported definitions that carry
+// response schemas, enforcing them is left to the API owner
+func enableResponseValidation(thisDefinition *apidef.APIDefinition) {
+	for _, processor := range thisDefinition.ResponseProcessors {
+		if processor.Name == "response_json_validator" {
+			return
+		}
+	}
+
+	for _, version := range thisDefinition.VersionData.Versions {
+		if len(version.ExtendedPaths.ValidateResponse) > 0 {
+			thisDefinition.ResponseProcessors = append(thisDefinition.ResponseProcessors, apidef.ResponseProcessor{
+				Name:    "response_json_validator",
+				Options: map[string]interface{}{"mode": ResponseValidationReport},
+			})
+			return
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/context"
+)
+
+var validateResponseDefinition = `
+
+	{
+		"name": "Tyk Test API",
+		"api_id": "1",
+		"org_id": "default",
+		"definition": {
+			"location": "header",
+			"key": "version"
+		},
+		"auth": {
+			"auth_header_name": "authorization"
+		},
+		"version_data": {
+			"not_versioned": true,
+			"versions": {
+				"Default": {
+					"name": "Default",
+					"use_extended_paths": true,
+					"extended_paths": {
+						"validate_response": [{
+							"path": "/v1/pets",
+							"method": "GET",
+							"schemas": {
+								"200": {"type": "array", "items": {"type": "object", "required": ["id"]}},
+								"default": {"type": "object", "required": ["error"]}
+							}
+						}]
+					}
+				}
+			}
+		},
+		"proxy": {
+			"listen_path": "/v1",
+			"target_url": "http://example.com",
+			"strip_listen_path": false
+		}
+	}
+
+`
+
+func testValidatedResponse(t *testing.T, processor TykResponseHandler, code int, body string) (*http.Response, *http.Request) {
+	req, _ := http.NewRequest("GET", "/v1/pets", nil)
+	res := &http.Response{
+		StatusCode: code,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+	}
+
+	if err := processor.HandleResponse(httptest.NewRecorder(), res, req, &SessionState{}); err != nil {
+		t.Fatal("Response processor failed: ", err)
+	}
+
+	return res, req
+}
+
+func TestResponseJSONValidator(t *testing.T) {
+	spec := createDefinitionFromString(validateResponseDefinition)
+
+	report, _ := ResponseJSONValidator{}.New(map[string]interface{}{}, spec)
+	res, req := testValidatedResponse(t, report, 200, `[{"id": 1}]`)
+	if _, found := context.GetOk(req, ResponseValidationErrors); found || res.StatusCode != 200 {
+		t.Error("Valid responses should pass untouched")
+	}
+	context.Clear(req)
+
+	res, req = testValidatedResponse(t, report, 200, `[{"id": 1}, {}]`)
+	violations, _ := context.Get(req, ResponseValidationErrors).([]string)
+	if len(violations) != 1 || violations[0] != "/1/id: Property is required" {
+		t.Error("Violations should be recorded for analytics, got: ", violations)
+	}
+	if body, _ := ioutil.ReadAll(res.Body); res.StatusCode != 200 || string(body) != `[{"id": 1}, {}]` {
+		t.Error("Report mode should not change the response, got: ", res.StatusCode, string(body))
+	}
+	context.Clear(req)
+
+	enforce, _ := ResponseJSONValidator{}.New(map[string]interface{}{"mode": "enforce"}, spec)
+	res, req = testValidatedResponse(t, enforce, 500, `{"message": "boom"}`)
+	if res.StatusCode != 502 || res.Header.Get("Content-Type") != "application/json" {
+		t.Error("Enforce mode should replace invalid responses with a 502, got: ", res.StatusCode)
+	}
+	context.Clear(req)
+
+	streamed := func(processor TykResponseHandler) (*http.Response, *http.Request) {
+		req, _ := http.NewRequest("GET", "/v1/pets", nil)
+		res := &http.Response{
+			StatusCode:    200,
+			Header:        http.Header{"Content-Type": []string{"text/event-stream"}},
+			ContentLength: -1,
+			Body:          ioutil.NopCloser(bytes.NewBufferString("data: {}\n\n")),
+		}
+		spec.ResponseChain = &[]TykResponseHandler{processor}
+		ResponseChain{}.Go(spec, httptest.NewRecorder(), res, req, &SessionState{})
+		return res, req
+	}
+
+	res, req = streamed(enforce)
+	if res.StatusCode != 502 {
+		t.Error("Enforce mode should reject streams it can't validate, got: ", res.StatusCode)
+	}
+	context.Clear(req)
+
+	res, req = streamed(report)
+	violations, _ = context.Get(req, ResponseValidationErrors).([]string)
+	if res.StatusCode != 200 || len(violations) != 1 {
+		t.Error("Report mode should pass streams on and record that they weren't validated, got: ", res.StatusCode, violations)
+	}
+	context.Clear(req)
+}
+
+func TestImportedResponseValidation(t *testing.T) {
+	importer, _ := GetImporterForSource(SwaggerSource)
+	if err := importer.ReadString(swaggerMockTestDoc); err != nil {
+		t.Fatal("Import failed: ", err)
+	}
+
+	def, err := createDefFromSwagger(importer.(*SwaggerAST), "default", "http://example.com", false)
+	if err != nil {
+		t.Fatal("Definition creation failed: ", err)
+	}
+
+	version := def.VersionData.Versions["v1"]
+	if len(version.ExtendedPaths.ValidateResponse) != 1 || len(version.ExtendedPaths.ValidateResponse[0].Schemas) != 1 {
+		t.Fatal("Response schemas should be imported, got: ", version.ExtendedPaths.ValidateResponse)
+	}
+
+	if len(def.ResponseProcessors) != 1 || def.ResponseProcessors[0].Name != "response_json_validator" {
+		t.Error("Imported definitions should report contract drift, got: ", def.ResponseProcessors)
+	}
+}
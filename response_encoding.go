@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/andybalholm/brotli"
+)
+
+const defaultCompressionMinSize = 1024
+
+var defaultCompressibleContentTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/problem+json",
+	"image/svg+xml",
+}
+
+// defaultMaxDecodedResponseSize caps decoded bodies when max_decoded_response_size isn't set, a
+// small compressed body can otherwise expand to fill the gateway's memory
+const defaultMaxDecodedResponseSize = 100 << 20
+
+var errDecodedResponseTooLarge = errors.New("decoded response body exceeds the size limit")
+
+// readCloser pairs a wrapping reader with the body it reads from, so closing it closes the body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// decodedBodyReader fails once more than the limit has been decoded rather than cutting the body short
+type decodedBodyReader struct {
+	limited *io.LimitedReader
+}
+
+func (r decodedBodyReader) Read(p []byte) (int, error) {
+	n, err := r.limited.Read(p)
+	if r.limited.N <= 0 {
+		return n, errDecodedResponseTooLarge
+	}
+	return n, err
+}
+
+func newDecodedBodyReader(decoded io.Reader) io.Reader {
+	limit := config.MaxDecodedResponseSize
+	if limit <= 0 {
+		limit = defaultMaxDecodedResponseSize
+	}
+	// One byte past the limit tells a body that is too large from one that just fits
+	return decodedBodyReader{io.LimitReader(decoded, limit+1).(*io.LimitedReader)}
+}
+
+// decodeResponseBody replaces a gzip, deflate or brotli encoded body with its decoded content and
+// returns the encoding that was removed. Anything else is left as it is and nothing is returned.
+// Decoded bodies are capped at max_decoded_response_size, reading past it fails.
+func decodeResponseBody(res *http.Response) (string, error) {
+	encoding := strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding")))
+	if res.Body == nil || res.ContentLength == 0 || res.StatusCode == 204 || res.StatusCode == 304 {
+		return "", nil
+	}
+	if res.Request != nil && res.Request.Method == "HEAD" {
+		return "", nil
+	}
+
+	var decoded io.Reader
+	switch encoding {
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(res.Body)
+		if err != nil {
+			return "", err
+		}
+		decoded = reader
+	case "deflate":
+		// deflate should be zlib wrapped, but plenty of servers send the raw stream
+		buffered := bufio.NewReader(res.Body)
+		header, _ := buffered.Peek(2)
+		if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			reader, err := zlib.NewReader(buffered)
+			if err != nil {
+				return "", err
+			}
+			decoded = reader
+		} else {
+			decoded = flate.NewReader(buffered)
+		}
+	case "br":
+		decoded = brotli.NewReader(res.Body)
+	default:
+		return "", nil
+	}
+
+	res.Body = readCloser{newDecodedBodyReader(decoded), res.Body}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed = true
+
+	return encoding, nil
+}
+
+// acceptValue is one entry of an Accept style header along with its weight
+type acceptValue struct {
+	value  string
+	weight float64
+}
+
+// parseAcceptHeader splits an Accept style header into its values, lower cased and in the order given
+func parseAcceptHeader(header string) []acceptValue {
+	values := []acceptValue{}
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(params[0]))
+		if value == "" {
+			continue
+		}
+		weight := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					weight = q
+				}
+			}
+		}
+		values = append(values, acceptValue{value, weight})
+	}
+
+	return values
+}
+
+// negotiateResponseEncoding picks the encoding the client prefers out of the ones the gateway can
+// produce, nothing is returned when the client only takes the body as it is
+func negotiateResponseEncoding(acceptEncoding string) string {
+	weights := map[string]float64{}
+	wildcard := -1.0
+	for _, accepted := range parseAcceptHeader(acceptEncoding) {
+		switch accepted.value {
+		case "x-gzip":
+			weights["gzip"] = accepted.weight
+		case "*":
+			wildcard = accepted.weight
+		default:
+			weights[accepted.value] = accepted.weight
+		}
+	}
+
+	best, bestWeight := "", 0.0
+	for _, coding := range []string{"gzip", "deflate"} {
+		weight, found := weights[coding]
+		if !found {
+			weight = wildcard
+		}
+		if weight > bestWeight {
+			best, bestWeight = coding, weight
+		}
+	}
+
+	return best
+}
+
+func isCompressibleContentType(contentType string, patterns []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if len(patterns) == 0 {
+		patterns = defaultCompressibleContentTypes
+	}
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == mediaType || (strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, pattern[:len(pattern)-1])) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// responseLargeEnough checks a body against the minimum size, bodies with no length have just
+// enough of them read to tell
+func responseLargeEnough(res *http.Response, minSize int64) (bool, error) {
+	if res.ContentLength >= 0 {
+		return res.ContentLength >= minSize, nil
+	}
+
+	prefix, err := ioutil.ReadAll(io.LimitReader(res.Body, minSize))
+	res.Body = readCloser{io.MultiReader(bytes.NewReader(prefix), res.Body), res.Body}
+
+	return int64(len(prefix)) >= minSize, err
+}
+
+func newResponseEncoder(w io.Writer, encoding string, level int) io.WriteCloser {
+	if level < flate.HuffmanOnly || level > flate.BestCompression || level == 0 {
+		level = flate.DefaultCompression
+	}
+
+	var encoder io.WriteCloser
+	if encoding == "deflate" {
+		encoder, _ = zlib.NewWriterLevel(w, level)
+	} else {
+		encoder, _ = gzip.NewWriterLevel(w, level)
+	}
+
+	return encoder
+}
+
+// encodeResponseBody compresses a response for the client. Bodies that were decoded on the way in
+// are encoded again whenever the client accepts it, anything else is only compressed when the API
+// enables compression and the body is of a listed type and large enough. The body is compressed as
+// it is sent rather than buffered.
+func encodeResponseBody(res *http.Response, req *http.Request, options *apidef.ResponseCompressionOptions, decoded bool) error {
+	if res.Body == nil || res.Header.Get("Content-Encoding") != "" || req.Method == "HEAD" || isGRPCResponse(res) {
+		return nil
+	}
+	switch res.StatusCode {
+	case 204, 206, 304:
+		return nil
+	}
+
+	if !decoded && (!options.Enabled || !isCompressibleContentType(res.Header.Get("Content-Type"), options.ContentTypes)) {
+		return nil
+	}
+
+	encoding := negotiateResponseEncoding(req.Header.Get("Accept-Encoding"))
+	if encoding != "" && !decoded {
+		minSize := options.MinSize
+		if minSize <= 0 {
+			minSize = defaultCompressionMinSize
+		}
+		largeEnough, err := responseLargeEnough(res, minSize)
+		if err != nil {
+			return err
+		}
+		if !largeEnough {
+			encoding = ""
+		}
+	}
+
+	// The header is shared with the copy kept for the cache, which stores the body unencoded
+	header := make(http.Header, len(res.Header)+1)
+	copyHeader(header, res.Header)
+	res.Header = header
+	res.Header.Add("Vary", "Accept-Encoding")
+	if encoding == "" {
+		return nil
+	}
+
+	body := res.Body
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		defer body.Close()
+		encoder := newResponseEncoder(pipeWriter, encoding, options.Level)
+		_, err := io.Copy(encoder, body)
+		if closeErr := encoder.Close(); err == nil {
+			err = closeErr
+		}
+		pipeWriter.CloseWithError(err)
+	}()
+
+	res.Body = pipeReader
+	res.Header.Set("Content-Encoding", encoding)
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed = false
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gorilla/context"
+)
+
+func TestResponseEncodingNegotiation(t *testing.T) {
+	for acceptEncoding, expected := range map[string]string{
+		"":                        "",
+		"gzip, deflate, br":       "gzip",
+		"deflate, gzip;q=0.5":     "deflate",
+		"br, *;q=0.2":             "gzip",
+		"*, gzip;q=0":             "deflate",
+		"identity, X-GZIP;q=0.8":  "gzip",
+		"gzip;q=0, deflate;q=0.0": "",
+	} {
+		if encoding := negotiateResponseEncoding(acceptEncoding); encoding != expected {
+			t.Errorf("Accept-Encoding %q should pick %q, got %q", acceptEncoding, expected, encoding)
+		}
+	}
+
+	if !isCompressibleContentType("text/html; charset=utf-8", nil) || isCompressibleContentType("image/png", nil) {
+		t.Error("Text should be compressed by default, images should not")
+	}
+	if !isCompressibleContentType("application/vnd.api+json", []string{"application/*"}) || isCompressibleContentType("text/plain", []string{"application/json"}) {
+		t.Error("Configured content types should replace the defaults")
+	}
+}
+
+func gzipBody(body string) []byte {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Write([]byte(body))
+	writer.Close()
+	return buf.Bytes()
+}
+
+func brotliBody(body string) []byte {
+	var buf bytes.Buffer
+	writer := brotli.NewWriter(&buf)
+	writer.Write([]byte(body))
+	writer.Close()
+	return buf.Bytes()
+}
+
+func TestEncodedResponseProcessing(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Query().Get("body") {
+		case "invalid":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gzipBody(`[{"id": 1}, {}]`))
+		case "valid":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gzipBody(`[{"id": 1}]`))
+		case "brotli":
+			w.Header().Set("Content-Encoding", "br")
+			w.Write(brotliBody(`[{"id": 1}, {}]`))
+		case "large":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gzipBody(`[{"id": 1}` + strings.Repeat(`, {"id": 1}`, 100) + `]`))
+		case "unknown":
+			w.Header().Set("Content-Encoding", "zstd")
+			w.Write([]byte("not really zstd"))
+		default:
+			w.Write([]byte(`[{"id": 1}, {"id": 2}, {"id": 3}]`))
+		}
+	}))
+	defer upstream.Close()
+
+	spec := createDefinitionFromString(validateResponseDefinition)
+	spec.Proxy.TargetURL = upstream.URL
+	enforce, _ := ResponseJSONValidator{}.New(map[string]interface{}{"mode": "enforce"}, spec)
+	spec.ResponseChain = &[]TykResponseHandler{enforce}
+	spec.ResponseHandlersActive = true
+
+	remote, _ := url.Parse(spec.Proxy.TargetURL)
+	proxy := TykNewSingleHostReverseProxy(remote, spec)
+
+	call := func(query, acceptEncoding string) (*httptest.ResponseRecorder, string) {
+		req, _ := http.NewRequest("GET", "/v1/pets?body="+query, nil)
+		req.RemoteAddr = "127.0.0.1:1234"
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		recorder := httptest.NewRecorder()
+		proxy.ServeHTTP(recorder, req)
+		context.Clear(req)
+
+		body := recorder.Body.Bytes()
+		if recorder.Header().Get("Content-Encoding") == "gzip" {
+			reader, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Fatal("Response should be gzipped: ", err)
+			}
+			body, _ = ioutil.ReadAll(reader)
+		}
+		return recorder, string(body)
+	}
+
+	recorder, body := call("invalid", "gzip")
+	if recorder.Code != 502 || recorder.Header().Get("Content-Encoding") != "gzip" || !strings.Contains(body, "failed validation") {
+		t.Error("Encoded bodies should be validated and encoded again, got: ", recorder.Code, recorder.Header(), body)
+	}
+
+	recorder, body = call("valid", "identity")
+	if recorder.Code != 200 || recorder.Header().Get("Content-Encoding") != "" || body != `[{"id": 1}]` {
+		t.Error("Clients that don't take gzip should get the decoded body, got: ", recorder.Code, recorder.Header(), body)
+	}
+
+	recorder, body = call("brotli", "identity")
+	if recorder.Code != 502 || !strings.Contains(body, "failed validation") {
+		t.Error("Brotli bodies should be decoded and validated, got: ", recorder.Code, body)
+	}
+
+	recorder, body = call("unknown", "identity")
+	if recorder.Code != 502 || strings.Contains(body, "not really zstd") {
+		t.Error("Bodies that can't be decoded should not get past an enforced schema, got: ", recorder.Code, body)
+	}
+
+	config.MaxDecodedResponseSize = 100
+	recorder, body = call("large", "identity")
+	config.MaxDecodedResponseSize = 0
+	if recorder.Code != 502 || strings.Contains(body, `"id"`) {
+		t.Error("Bodies that decode past the limit should be rejected, got: ", recorder.Code, body)
+	}
+
+	recorder, body = call("plain", "gzip")
+	if recorder.Header().Get("Content-Encoding") != "" || recorder.Header().Get("Vary") != "" {
+		t.Error("Responses should not be compressed unless compression is enabled, got: ", recorder.Header())
+	}
+
+	spec.ResponseCompression.Enabled = true
+	spec.ResponseCompression.MinSize = 10
+	recorder, body = call("plain", "deflate;q=0.5, gzip")
+	if recorder.Header().Get("Content-Encoding") != "gzip" || recorder.Header().Get("Vary") != "Accept-Encoding" || body != `[{"id": 1}, {"id": 2}, {"id": 3}]` {
+		t.Error("Large enough responses should be compressed, got: ", recorder.Header(), body)
+	}
+
+	spec.ResponseCompression.MinSize = 1000
+	recorder, body = call("plain", "gzip")
+	if recorder.Header().Get("Content-Encoding") != "" || recorder.Header().Get("Vary") != "Accept-Encoding" || body != `[{"id": 1}, {"id": 2}, {"id": 3}]` {
+		t.Error("Small responses should be sent as they are, got: ", recorder.Header(), body)
+	}
+}
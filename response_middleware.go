@@ -1,14 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"net/http"
+	"strconv"
 )
 
 var RESPONSE_PROCESSORS map[string]TykResponseHandler = map[string]TykResponseHandler{
 	"header_injector":         HeaderInjector{},
 	"response_body_transform": ResponseTransformMiddleware{},
 	"header_transform":        HeaderTransform{},
+	"response_json_validator": ResponseJSONValidator{},
 }
 
 type TykResponseHandler interface {
@@ -16,6 +21,18 @@ type TykResponseHandler interface {
 	New(interface{}, *APISpec) (TykResponseHandler, error)
 }
 
+// TykBufferingResponseHandler is implemented by processors that read the whole response body,
+// they are skipped for streamed responses
+type TykBufferingResponseHandler interface {
+	BuffersResponseBody() bool
+}
+
+// TykUnreadableResponseHandler is implemented by buffering processors that must have their say
+// when a body is streamed or in an encoding the gateway can't decode, instead of being skipped
+type TykUnreadableResponseHandler interface {
+	HandleUnreadableResponse(http.ResponseWriter, *http.Response, *http.Request, *SessionState) error
+}
+
 func GetResponseProcessorByName(name string) (TykResponseHandler, error) {
 	processor, ok := RESPONSE_PROCESSORS[name]
 	if !ok {
@@ -28,13 +45,27 @@ func GetResponseProcessorByName(name string) (TykResponseHandler, error) {
 
 type ResponseChain struct{}
 
-func (r ResponseChain) Go(chain *[]TykResponseHandler, rw http.ResponseWriter, res *http.Response, req *http.Request, ses *SessionState) error {
+func (r ResponseChain) Go(spec *APISpec, rw http.ResponseWriter, res *http.Response, req *http.Request, ses *SessionState) error {
 
-	if chain == nil {
+	if spec.ResponseChain == nil {
 		return nil
 	}
 
-	for _, rh := range *chain {
+	// Bodies the gateway couldn't decode are as unreadable as streams
+	streaming := isStreamingResponse(res, spec)
+	unreadable := !streaming && res.Header.Get("Content-Encoding") != ""
+	for _, rh := range *spec.ResponseChain {
+		if buffering, ok := rh.(TykBufferingResponseHandler); ok && (streaming || unreadable) && buffering.BuffersResponseBody() {
+			if unreadableHandler, ok := rh.(TykUnreadableResponseHandler); ok {
+				if mwErr := unreadableHandler.HandleUnreadableResponse(rw, res, req, ses); mwErr != nil {
+					return mwErr
+				}
+				continue
+			}
+			log.Debug("Skipping response processor, the body is streamed or encoded")
+			continue
+		}
+
 		mwErr := rh.HandleResponse(rw, res, req, ses)
 		if mwErr != nil {
 			return mwErr
@@ -43,3 +74,20 @@ func (r ResponseChain) Go(chain *[]TykResponseHandler, rw http.ResponseWriter, r
 
 	return nil
 }
+
+// replaceWithBadGateway swaps an upstream response for a 502 with a JSON error, the upstream's
+// body is closed and none of its headers are kept
+func replaceWithBadGateway(res *http.Response, message string) {
+	if res.Body != nil {
+		res.Body.Close()
+	}
+
+	replacement, _ := json.Marshal(map[string]string{"error": message})
+	res.StatusCode = http.StatusBadGateway
+	res.Status = strconv.Itoa(http.StatusBadGateway) + " " + http.StatusText(http.StatusBadGateway)
+	res.Header = http.Header{}
+	res.Header.Set("Content-Type", "application/json")
+	res.Header.Set("Content-Length", strconv.Itoa(len(replacement)))
+	res.ContentLength = int64(len(replacement))
+	res.Body = ioutil.NopCloser(bytes.NewReader(replacement))
+}
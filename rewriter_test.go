@@ -1,14 +1,18 @@
 package main
 
 import (
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/gorilla/context"
+	"io/ioutil"
+	"net/http"
+	"strings"
 	"testing"
 )
 
 func TestRewriter(t *testing.T) {
 	rw := URLRewriter{}
 
-	testConf := tykcommon.URLRewriteMeta{
+	testConf := apidef.URLRewriteMeta{
 		Path:         "",
 		Method:       "",
 		MatchPattern: "test/straight/rewrite",
@@ -32,7 +36,7 @@ func TestRewriter(t *testing.T) {
 func TestRewriterWithOneVal(t *testing.T) {
 	rw := URLRewriter{}
 
-	testConf := tykcommon.URLRewriteMeta{
+	testConf := apidef.URLRewriteMeta{
 		Path:         "",
 		Method:       "",
 		MatchPattern: "test/val/(.*)",
@@ -56,7 +60,7 @@ func TestRewriterWithOneVal(t *testing.T) {
 func TestRewriterWithThreeVals(t *testing.T) {
 	rw := URLRewriter{}
 
-	testConf := tykcommon.URLRewriteMeta{
+	testConf := apidef.URLRewriteMeta{
 		Path:         "",
 		Method:       "",
 		MatchPattern: "test/val/(.*)/space/(.*)/and/then/(.*)",
@@ -80,7 +84,7 @@ func TestRewriterWithThreeVals(t *testing.T) {
 func TestRewriterWithReverse(t *testing.T) {
 	rw := URLRewriter{}
 
-	testConf := tykcommon.URLRewriteMeta{
+	testConf := apidef.URLRewriteMeta{
 		Path:         "",
 		Method:       "",
 		MatchPattern: "test/val/(.*)/space/(.*)/and/then/(.*)",
@@ -104,7 +108,7 @@ func TestRewriterWithReverse(t *testing.T) {
 func TestRewriterWithMissing(t *testing.T) {
 	rw := URLRewriter{}
 
-	testConf := tykcommon.URLRewriteMeta{
+	testConf := apidef.URLRewriteMeta{
 		Path:         "",
 		Method:       "",
 		MatchPattern: "test/val/(.*)/space/(.*)/and/then/(.*)",
@@ -128,7 +132,7 @@ func TestRewriterWithMissing(t *testing.T) {
 func TestRewriterWithMissingAgain(t *testing.T) {
 	rw := URLRewriter{}
 
-	testConf := tykcommon.URLRewriteMeta{
+	testConf := apidef.URLRewriteMeta{
 		Path:         "",
 		Method:       "",
 		MatchPattern: "test/val/(.*)/space/(.*)/and/then/(.*)",
@@ -152,7 +156,7 @@ func TestRewriterWithMissingAgain(t *testing.T) {
 func TestRewriterWithQS(t *testing.T) {
 	rw := URLRewriter{}
 
-	testConf := tykcommon.URLRewriteMeta{
+	testConf := apidef.URLRewriteMeta{
 		Path:         "",
 		Method:       "",
 		MatchPattern: "(.*)",
@@ -176,7 +180,7 @@ func TestRewriterWithQS(t *testing.T) {
 func TestRewriterWithQS2(t *testing.T) {
 	rw := URLRewriter{}
 
-	testConf := tykcommon.URLRewriteMeta{
+	testConf := apidef.URLRewriteMeta{
 		Path:         "",
 		Method:       "",
 		MatchPattern: "test/val/(.*)/space/(.*)/and/then(.*)",
@@ -196,3 +200,66 @@ func TestRewriterWithQS2(t *testing.T) {
 		t.Error("Transform failed, expected: %v, got: %v ", expected, val)
 	}
 }
+
+func TestRewriterTriggers(t *testing.T) {
+	rw := URLRewriter{}
+
+	testConf := apidef.URLRewriteMeta{
+		MatchPattern: "/widgets/(.*)",
+		RewriteTo:    "/default/$1",
+		Triggers: []apidef.RoutingTrigger{
+			{
+				On: apidef.RoutingTriggerOnAll,
+				Options: apidef.RoutingTriggerOptions{
+					HeaderMatches:   map[string]apidef.StringRegexMap{"x-tier": {MatchPattern: "^gold$"}},
+					QueryValMatches: map[string]apidef.StringRegexMap{"debug": {MatchPattern: ".*", Reverse: true}},
+				},
+				RewriteTo: "http://gold.example.com/$1",
+			},
+			{
+				On: apidef.RoutingTriggerOnAny,
+				Options: apidef.RoutingTriggerOptions{
+					SessionMetaMatches: map[string]apidef.StringRegexMap{"region": {MatchPattern: "^eu"}},
+					PayloadMatches:     map[string]apidef.StringRegexMap{"order.country": {MatchPattern: "^(DE|FR)$"}},
+				},
+				RewriteTo: "/eu/$1/$tyk_meta.region",
+			},
+		},
+	}
+	rewriteSpec, err := CompileURLRewrite(testConf)
+	if err != nil {
+		t.Fatal("Compile failed: ", err)
+	}
+
+	cases := []struct {
+		url, tier, body, region, expected string
+	}{
+		{"/widgets/1", "gold", "", "", "http://gold.example.com/1"},
+		{"/widgets/1?debug=1", "gold", "", "", "/default/1?debug=1"},
+		{"/widgets/1", "", `{"order": {"country": "DE"}}`, "", "/eu/1/$tyk_meta.region"},
+		{"/widgets/1", "", "", "eu-west", "/eu/1/eu-west"},
+		{"/gadgets/1", "gold", "", "", "/gadgets/1"},
+	}
+	for _, c := range cases {
+		r, _ := http.NewRequest("POST", c.url, strings.NewReader(c.body))
+		if c.tier != "" {
+			r.Header.Set("X-Tier", c.tier)
+		}
+		if c.region != "" {
+			context.Set(r, SessionData, SessionState{MetaData: map[string]interface{}{"region": c.region}})
+		}
+
+		if val := rw.RewriteSpec(&rewriteSpec, r.URL.String(), true, r); val != c.expected {
+			t.Errorf("Triggers picked the wrong target for %s, expected: %v, got: %v", c.url, c.expected, val)
+		}
+		if body, _ := ioutil.ReadAll(r.Body); string(body) != c.body {
+			t.Error("The request body should be left for the rest of the chain")
+		}
+		context.Clear(r)
+	}
+
+	testConf.Triggers[0].Options.HeaderMatches["x-tier"] = apidef.StringRegexMap{MatchPattern: "("}
+	if _, err := CompileURLRewrite(testConf); err == nil {
+		t.Error("Invalid trigger patterns should fail to compile")
+	}
+}
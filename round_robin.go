@@ -3,7 +3,7 @@ package main
 import (
 	"sync"
 
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 )
 
 type RoundRobin struct {
@@ -13,7 +13,7 @@ type RoundRobin struct {
 	cur int
 }
 
-func (r *RoundRobin) SetMax(rp *tykcommon.HostList) {
+func (r *RoundRobin) SetMax(rp *apidef.HostList) {
 	
 	// r.max = len(*rp.(*[]string)) - 1
 	r.max = rp.Len() - 1
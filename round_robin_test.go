@@ -1,13 +1,13 @@
 package main
 
 import "testing"
-import "github.com/TykTechnologies/tykcommon"
+import "github.com/TykTechnologies/tyk/apidef"
 
 func TestRR(t *testing.T) {
 	thisArr1 := []string{"1", "2", "3"}
 
 	thisRR := RoundRobin{}
-	asHL := tykcommon.NewHostListFromList(thisArr1)
+	asHL := apidef.NewHostListFromList(thisArr1)
 	thisRR.SetMax(asHL)
 
 	val := thisRR.GetPos()
@@ -147,7 +147,8 @@ func (l SessionLimiter) ForwardMessageNaiveKey(currentSession *SessionState, key
 }
 
 // IsQuotaExceeded will confirm if a session key has exceeded it's quota, if a quota has been exceeded,
-// but the quata renewal time has passed, it will be refreshed.
+// but the quata renewal time has passed, it will be refreshed. It only counts down the session it is
+// given, so scheduled policy and org resets are not applied, the limiters use IsRedisQuotaExceeded.
 func (l SessionLimiter) IsQuotaExceeded(currentSession *SessionState) bool {
 	if currentSession.QuotaMax == -1 {
 		// No quota set
@@ -158,7 +159,7 @@ func (l SessionLimiter) IsQuotaExceeded(currentSession *SessionState) bool {
 		current := time.Now().Unix()
 		if currentSession.QuotaRenews-current < 0 {
 			// quota used up, but we're passed renewal time
-			currentSession.QuotaRenews = current + currentSession.QuotaRenewalRate
+			currentSession.QuotaRenews = currentSession.QuotaPeriodEnd(time.Now())
 			currentSession.QuotaRemaining = currentSession.QuotaMax
 			return false
 		}
@@ -187,9 +188,18 @@ func (l SessionLimiter) IsRedisQuotaExceeded(currentSession *SessionState, key s
 	log.Debug("[QUOTA] Inbound raw key is: ", key)
 	rawKey := QuotaKeyPrefix + publicHash(key)
 	log.Debug("[QUOTA] Quota limiter key is: ", rawKey)
-	log.Debug("Renewing with TTL: ", currentSession.QuotaRenewalRate)
+
+	// Has an admin reset the quota for this key's policy or org since we last saw it?
+	if resetAt := pendingQuotaReset(currentSession, store); resetAt > 0 {
+		log.Debug("[QUOTA] Applying scheduled quota reset: ", resetAt)
+		store.DeleteRawKey(rawKey)
+		currentSession.QuotaLastReset = resetAt
+	}
+
+	quotaTTL := currentSession.QuotaPeriodTTL(time.Now())
+	log.Debug("Renewing with TTL: ", quotaTTL)
 	// INCR the key (If it equals 1 - set EXPIRE)
-	qInt := store.IncrememntWithExpire(rawKey, currentSession.QuotaRenewalRate)
+	qInt := store.IncrememntWithExpire(rawKey, quotaTTL)
 
 	// if the returned val is >= quota: block
 	if (int64(qInt) - 1) >= currentSession.QuotaMax {
@@ -213,8 +223,7 @@ func (l SessionLimiter) IsRedisQuotaExceeded(currentSession *SessionState, key s
 
 	// If this is a new Quota period, ensure we let the end user know
 	if int64(qInt) == 1 {
-		current := time.Now().Unix()
-		currentSession.QuotaRenews = current + currentSession.QuotaRenewalRate
+		currentSession.QuotaRenews = currentSession.QuotaPeriodEnd(time.Now())
 	}
 
 	// If not, pass and set the values of the session to quotamax - counter
@@ -3,9 +3,9 @@
 package main
 
 import (
+	"fmt"
 	"github.com/spaolacci/murmur3"
 	"gopkg.in/vmihailenco/msgpack.v2"
-	"fmt"
 	"hash"
 )
 
@@ -24,39 +24,56 @@ type AccessSpec struct {
 
 // AccessDefinition defines which versions of an API a key has access to
 type AccessDefinition struct {
-	APIName     string       `json:"api_name" msg:"api_name"`
-	APIID       string       `json:"api_id" msg:"api_id"`
-	Versions    []string     `json:"versions" msg:"versions"`
-	AllowedURLs []AccessSpec `bson:"allowed_urls"  json:"allowed_urls" msg:"allowed_urls"` // mapped string MUST be a valid regex
+	APIName     string         `json:"api_name" msg:"api_name"`
+	APIID       string         `json:"api_id" msg:"api_id"`
+	Versions    []string       `json:"versions" msg:"versions"`
+	AllowedURLs []AccessSpec   `bson:"allowed_urls"  json:"allowed_urls" msg:"allowed_urls"` // mapped string MUST be a valid regex
+	GraphQL     *GraphQLAccess `bson:"graphql" json:"graphql,omitempty" msg:"graphql"`
+}
+
+// GraphQLAccess restricts the GraphQL operations and fields a key may use, fields are either a
+// bare name matched at any depth or a dotted path such as "mutation.deleteUser"
+type GraphQLAccess struct {
+	AllowedOperations []string `bson:"allowed_operations" json:"allowed_operations" msg:"allowed_operations"`
+	BlockedOperations []string `bson:"blocked_operations" json:"blocked_operations" msg:"blocked_operations"`
+	BlockedFields     []string `bson:"blocked_fields" json:"blocked_fields" msg:"blocked_fields"`
 }
 
 // SessionState objects represent a current API session, mainly used for rate limiting.
 type SessionState struct {
-	LastCheck        int64                       `json:"last_check" msg:"last_check"`
-	Allowance        float64                     `json:"allowance" msg:"allowance"`
-	Rate             float64                     `json:"rate" msg:"rate"`
-	Per              float64                     `json:"per" msg:"per"`
-	Expires          int64                       `json:"expires" msg:"expires"`
-	QuotaMax         int64                       `json:"quota_max" msg:"quota_max"`
-	QuotaRenews      int64                       `json:"quota_renews" msg:"quota_renews"`
-	QuotaRemaining   int64                       `json:"quota_remaining" msg:"quota_remaining"`
-	QuotaRenewalRate int64                       `json:"quota_renewal_rate" msg:"quota_renewal_rate"`
-	AccessRights     map[string]AccessDefinition `json:"access_rights" msg:"access_rights"`
-	OrgID            string                      `json:"org_id" msg:"org_id"`
-	OauthClientID    string                      `json:"oauth_client_id" msg:"oauth_client_id"`
-	OauthKeys        map[string]string           `json:"oauth_keys" msg:"oauth_keys"`
-	BasicAuthData    struct {
+	LastCheck             int64                       `json:"last_check" msg:"last_check"`
+	Allowance             float64                     `json:"allowance" msg:"allowance"`
+	Rate                  float64                     `json:"rate" msg:"rate"`
+	Per                   float64                     `json:"per" msg:"per"`
+	Expires               int64                       `json:"expires" msg:"expires"`
+	ActivatesAt           int64                       `json:"activates_at" msg:"activates_at"`
+	ExpiryGracePeriod     int64                       `json:"expiry_grace_period" msg:"expiry_grace_period"`
+	RotatedAt             int64                       `json:"rotated_at" msg:"rotated_at"`
+	QuotaMax              int64                       `json:"quota_max" msg:"quota_max"`
+	QuotaRenews           int64                       `json:"quota_renews" msg:"quota_renews"`
+	QuotaRemaining        int64                       `json:"quota_remaining" msg:"quota_remaining"`
+	QuotaRenewalRate      int64                       `json:"quota_renewal_rate" msg:"quota_renewal_rate"`
+	QuotaRenewalPeriod    string                      `json:"quota_renewal_period" msg:"quota_renewal_period"`
+	QuotaTimezone         string                      `json:"quota_timezone" msg:"quota_timezone"`
+	QuotaLastReset        int64                       `json:"quota_last_reset" msg:"quota_last_reset"`
+	MaxConcurrentRequests int64                       `json:"max_concurrent_requests" msg:"max_concurrent_requests"`
+	AccessRights          map[string]AccessDefinition `json:"access_rights" msg:"access_rights"`
+	OrgID                 string                      `json:"org_id" msg:"org_id"`
+	OauthClientID         string                      `json:"oauth_client_id" msg:"oauth_client_id"`
+	OauthKeys             map[string]string           `json:"oauth_keys" msg:"oauth_keys"`
+	BasicAuthData         struct {
 		Password string   `json:"password" msg:"password"`
 		Hash     HashType `json:"hash_type" msg:"hash_type"`
 	} `json:"basic_auth_data" msg:"basic_auth_data"`
 	JWTData struct {
 		Secret string `json:"secret" msg:"secret"`
 	} `json:"jwt_data" msg:"jwt_data"`
-	HMACEnabled   bool   `json:"hmac_enabled" msg:"hmac_enabled"`
-	HmacSecret    string `json:"hmac_string" msg:"hmac_string"`
-	IsInactive    bool   `json:"is_inactive" msg:"is_inactive"`
-	ApplyPolicyID string `json:"apply_policy_id" msg:"apply_policy_id"`
-	DataExpires   int64  `json:"data_expires" msg:"data_expires"`
+	HMACEnabled   bool     `json:"hmac_enabled" msg:"hmac_enabled"`
+	HmacSecret    string   `json:"hmac_string" msg:"hmac_string"`
+	IsInactive    bool     `json:"is_inactive" msg:"is_inactive"`
+	ApplyPolicyID string   `json:"apply_policy_id" msg:"apply_policy_id"`
+	ApplyPolicies []string `json:"apply_policies" msg:"apply_policies"`
+	DataExpires   int64    `json:"data_expires" msg:"data_expires"`
 	Monitor       struct {
 		TriggerLimits []float64 `json:"trigger_limits" msg:"trigger_limits"`
 	} `json:"monitor" msg:"monitor"`
@@ -65,7 +82,7 @@ type SessionState struct {
 	Tags                    []string    `json:"tags" msg:"tags"`
 	Alias                   string      `json:"alias" msg:"alias"`
 	LastUpdated             string      `json:"last_updated" msg:"last_updated"`
-	IdExtractorDeadline		int64	`json:"id_extractor_deadline" msg:"id_extractor_deadline"`
+	IdExtractorDeadline     int64       `json:"id_extractor_deadline" msg:"id_extractor_deadline"`
 	SessionLifetime         int64       `bson:"session_lifetime" json:"session_lifetime"`
 
 	firstSeenHash string
@@ -80,7 +97,7 @@ func (s *SessionState) SetFirstSeenHash() {
 		return
 	}
 
-    s.firstSeenHash = fmt.Sprintf("%x", murmurHasher.Sum(encoded))
+	s.firstSeenHash = fmt.Sprintf("%x", murmurHasher.Sum(encoded))
 }
 
 func (s *SessionState) GetHash() string {
@@ -90,7 +107,7 @@ func (s *SessionState) GetHash() string {
 		return ""
 	}
 
-    return fmt.Sprintf("%x", murmurHasher.Sum(encoded))
+	return fmt.Sprintf("%x", murmurHasher.Sum(encoded))
 }
 
 func (s *SessionState) HasChanged() bool {
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	textTemplate "text/template"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+const (
+	SOAP11EnvelopeNamespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	SOAP12EnvelopeNamespace = "http://www.w3.org/2003/05/soap-envelope"
+
+	wsdlNamespace       = "http://schemas.xmlsoap.org/wsdl/"
+	wsdlSOAP11Namespace = "http://schemas.xmlsoap.org/wsdl/soap/"
+	wsdlSOAP12Namespace = "http://schemas.xmlsoap.org/wsdl/soap12/"
+	xsiNamespace        = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+var xmlElementName = regexp.MustCompile(`^[A-Za-z_][\w.\-]*$`)
+
+// SOAPMediationSpec is a SOAP endpoint with its operation details resolved from the WSDL and its
+// envelope template loaded
+type SOAPMediationSpec struct {
+	apidef.SOAPMediationMeta
+	Template     *textTemplate.Template
+	ResponsePath JSONPath
+}
+
+type wsdlDefinitions struct {
+	TargetNamespace string        `xml:"targetNamespace,attr"`
+	Bindings        []wsdlBinding `xml:"http://schemas.xmlsoap.org/wsdl/ binding"`
+}
+
+type wsdlBinding struct {
+	Operations []wsdlBindingOperation `xml:"http://schemas.xmlsoap.org/wsdl/ operation"`
+}
+
+type wsdlBindingOperation struct {
+	Name   string             `xml:"name,attr"`
+	SOAP11 *wsdlSOAPOperation `xml:"http://schemas.xmlsoap.org/wsdl/soap/ operation"`
+	SOAP12 *wsdlSOAPOperation `xml:"http://schemas.xmlsoap.org/wsdl/soap12/ operation"`
+}
+
+type wsdlSOAPOperation struct {
+	Action string `xml:"soapAction,attr"`
+}
+
+// applyWSDL fills in whatever the endpoint doesn't set itself from the operation's binding, SOAP
+// 1.1 bindings are preferred when the operation is bound for both versions
+func (s *SOAPMediationSpec) applyWSDL(data []byte) error {
+	var definitions wsdlDefinitions
+	if err := xml.Unmarshal(data, &definitions); err != nil {
+		return err
+	}
+
+	var version string
+	var soapOperation *wsdlSOAPOperation
+	for _, binding := range definitions.Bindings {
+		for _, operation := range binding.Operations {
+			if operation.Name != s.Operation {
+				continue
+			}
+			if operation.SOAP11 != nil {
+				version, soapOperation = "1.1", operation.SOAP11
+			} else if operation.SOAP12 != nil && soapOperation == nil {
+				version, soapOperation = "1.2", operation.SOAP12
+			}
+		}
+	}
+
+	if soapOperation != nil {
+		if s.SOAPVersion == "" {
+			s.SOAPVersion = version
+		}
+		if s.SOAPAction == "" {
+			s.SOAPAction = soapOperation.Action
+		}
+		if s.Namespace == "" {
+			s.Namespace = definitions.TargetNamespace
+		}
+		return nil
+	}
+
+	return fmt.Errorf("operation %q is not bound to SOAP in the WSDL", s.Operation)
+}
+
+func (s *SOAPMediationSpec) envelopeNamespace() string {
+	if s.SOAPVersion == "1.2" {
+		return SOAP12EnvelopeNamespace
+	}
+	return SOAP11EnvelopeNamespace
+}
+
+// BuildEnvelope wraps a request in a SOAP envelope, with a template the template produces the
+// whole envelope, otherwise every field of the request becomes an element of the operation
+func (s *SOAPMediationSpec) BuildEnvelope(bodyData interface{}) ([]byte, error) {
+	var envelope bytes.Buffer
+
+	if s.Template != nil {
+		err := s.Template.Execute(&envelope, escapeXMLValues(bodyData))
+		return envelope.Bytes(), err
+	}
+
+	fields, ok := bodyData.(map[string]interface{})
+	if bodyData != nil && !ok {
+		return nil, errors.New("SOAP requests must be JSON objects")
+	}
+
+	envelope.WriteString(xml.Header)
+	envelope.WriteString(`<soap:Envelope xmlns:soap="` + s.envelopeNamespace() + `"><soap:Body>`)
+	envelope.WriteString("<" + s.Operation)
+	if s.Namespace != "" {
+		envelope.WriteString(` xmlns="`)
+		xml.EscapeText(&envelope, []byte(s.Namespace))
+		envelope.WriteString(`"`)
+	}
+	envelope.WriteString(">")
+	if err := writeXMLFields(&envelope, fields); err != nil {
+		return nil, err
+	}
+	envelope.WriteString("</" + s.Operation + "></soap:Body></soap:Envelope>")
+
+	return envelope.Bytes(), nil
+}
+
+// escapeXMLValues copies a request with every string escaped for XML, templates are plain text so
+// a value could otherwise close its element and add its own
+func escapeXMLValues(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		escaped := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			escaped[escapeXMLString(key)] = escapeXMLValues(item)
+		}
+		return escaped
+	case []interface{}:
+		escaped := make([]interface{}, len(v))
+		for i, item := range v {
+			escaped[i] = escapeXMLValues(item)
+		}
+		return escaped
+	case string:
+		return escapeXMLString(v)
+	}
+
+	return value
+}
+
+func escapeXMLString(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func writeXMLFields(buf *bytes.Buffer, fields map[string]interface{}) error {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := writeXMLElement(buf, name, fields[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeXMLElement encodes a JSON value as an element, arrays repeat the element for every item
+func writeXMLElement(buf *bytes.Buffer, name string, value interface{}) error {
+	if !xmlElementName.MatchString(name) {
+		return fmt.Errorf("%q is not a valid XML element name", name)
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if err := writeXMLElement(buf, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case nil:
+		buf.WriteString("<" + name + ` xmlns:xsi="` + xsiNamespace + `" xsi:nil="true"/>`)
+		return nil
+	}
+
+	buf.WriteString("<" + name + ">")
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if err := writeXMLFields(buf, v); err != nil {
+			return err
+		}
+	default:
+		xml.EscapeText(buf, []byte(fmt.Sprint(v)))
+	}
+	buf.WriteString("</" + name + ">")
+
+	return nil
+}
+
+// SetRequestHeaders sets the content type and action the SOAP version expects
+func (s *SOAPMediationSpec) SetRequestHeaders(header http.Header) {
+	if s.SOAPVersion == "1.2" {
+		contentType := "application/soap+xml; charset=utf-8"
+		if s.SOAPAction != "" {
+			contentType += `; action="` + s.SOAPAction + `"`
+		}
+		header.Set("Content-Type", contentType)
+		header.Del("SOAPAction")
+		return
+	}
+
+	header.Set("Content-Type", "text/xml; charset=utf-8")
+	header.Set("SOAPAction", `"`+s.SOAPAction+`"`)
+}
+
+type xmlNode struct {
+	Name     xml.Name
+	Attrs    []xml.Attr
+	Children []*xmlNode
+	Text     string
+}
+
+func parseXMLNode(r io.Reader) (*xmlNode, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = WrappedCharsetReader
+
+	var stack []*xmlNode
+	var root *xmlNode
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{Name: t.Name, Attrs: t.Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, node)
+			} else if root == nil {
+				root = node
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].Text += string(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, errors.New("no XML element found")
+	}
+	return root, nil
+}
+
+func (n *xmlNode) child(space, local string) *xmlNode {
+	for _, child := range n.Children {
+		if child.Name.Local == local && (space == "" || child.Name.Space == space) {
+			return child
+		}
+	}
+	return nil
+}
+
+// text returns the trimmed text of a child element, or an empty string if there isn't one
+func (n *xmlNode) childText(space, local string) string {
+	if child := n.child(space, local); child != nil {
+		return strings.TrimSpace(child.Text)
+	}
+	return ""
+}
+
+// JSON converts the element's content. Elements are keyed by local name, so the prefixes a
+// service happens to use don't matter, repeated elements become arrays and attributes are kept
+// with a "-" prefix. Leaf elements become strings and xsi:nil elements become null.
+func (n *xmlNode) JSON() interface{} {
+	object := make(map[string]interface{})
+	for _, attr := range n.Attrs {
+		if attr.Name.Space == xsiNamespace && attr.Name.Local == "nil" && attr.Value == "true" {
+			return nil
+		}
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" || attr.Name.Space == xsiNamespace {
+			continue
+		}
+		object["-"+attr.Name.Local] = attr.Value
+	}
+
+	if len(n.Children) == 0 {
+		text := strings.TrimSpace(n.Text)
+		if len(object) == 0 {
+			return text
+		}
+		if text != "" {
+			object["#text"] = text
+		}
+		return object
+	}
+
+	for _, child := range n.Children {
+		value := child.JSON()
+		existing, found := object[child.Name.Local]
+		switch {
+		case !found:
+			object[child.Name.Local] = value
+		case isJSONArray(existing):
+			object[child.Name.Local] = append(existing.([]interface{}), value)
+		default:
+			object[child.Name.Local] = []interface{}{existing, value}
+		}
+	}
+
+	return object
+}
+
+func isJSONArray(value interface{}) bool {
+	_, ok := value.([]interface{})
+	return ok
+}
+
+// SOAPFaultError is the JSON error a SOAP fault is turned into
+type SOAPFaultError struct {
+	Status    string      `json:"status"`
+	Error     string      `json:"error"`
+	FaultCode string      `json:"fault_code"`
+	Detail    interface{} `json:"detail,omitempty"`
+}
+
+// faultStatus maps a fault code to a status, configured codes can be either the full code or the
+// part after the prefix. Faults the client caused are a 400, anything else is the upstream's fault.
+func (s *SOAPMediationSpec) faultStatus(code string) int {
+	local := code
+	if i := strings.LastIndex(code, ":"); i >= 0 {
+		local = code[i+1:]
+	}
+
+	if status, found := s.FaultStatusCodes[code]; found {
+		return status
+	}
+	if status, found := s.FaultStatusCodes[local]; found {
+		return status
+	}
+
+	switch local {
+	case "Client", "Sender":
+		return 400
+	}
+	return 502
+}
+
+func soapFault(fault *xmlNode) (code, reason string, detail interface{}) {
+	if fault.Name.Space == SOAP12EnvelopeNamespace {
+		if codeNode := fault.child(SOAP12EnvelopeNamespace, "Code"); codeNode != nil {
+			code = codeNode.childText(SOAP12EnvelopeNamespace, "Value")
+		}
+		if reasonNode := fault.child(SOAP12EnvelopeNamespace, "Reason"); reasonNode != nil {
+			reason = reasonNode.childText(SOAP12EnvelopeNamespace, "Text")
+		}
+		if detailNode := fault.child(SOAP12EnvelopeNamespace, "Detail"); detailNode != nil {
+			detail = detailNode.JSON()
+		}
+		return
+	}
+
+	code = fault.childText("", "faultcode")
+	reason = fault.childText("", "faultstring")
+	if detailNode := fault.child("", "detail"); detailNode != nil {
+		detail = detailNode.JSON()
+	}
+	return
+}
+
+// TranslateResponse turns a SOAP response into JSON. Faults become JSON errors with a status
+// mapped from their code, anything else is the content of the body, or the part of it picked out
+// by the response path.
+func (s *SOAPMediationSpec) TranslateResponse(body io.Reader) (int, []byte, error) {
+	envelope, err := parseXMLNode(body)
+	if err != nil {
+		return 0, nil, err
+	}
+	if envelope.Name.Local != "Envelope" || (envelope.Name.Space != SOAP11EnvelopeNamespace && envelope.Name.Space != SOAP12EnvelopeNamespace) {
+		return 0, nil, errors.New("response is not a SOAP envelope")
+	}
+
+	soapBody := envelope.child(envelope.Name.Space, "Body")
+	if soapBody == nil {
+		return 0, nil, errors.New("SOAP envelope has no body")
+	}
+
+	if fault := soapBody.child(envelope.Name.Space, "Fault"); fault != nil {
+		code, reason, detail := soapFault(fault)
+		encoded, err := json.Marshal(SOAPFaultError{"error", reason, code, detail})
+		return s.faultStatus(code), encoded, err
+	}
+
+	var result interface{} = soapBody.JSON()
+	if len(s.ResponsePath) > 0 {
+		var found bool
+		if result, found = s.ResponsePath.Get(result); !found {
+			return 0, nil, fmt.Errorf("response path %q was not found", s.SOAPMediationMeta.ResponsePath)
+		}
+	}
+
+	encoded, err := json.Marshal(result)
+	return 0, encoded, err
+}
+
+// mediateSOAPResponse replaces an upstream SOAP response with its JSON translation
+func mediateSOAPResponse(res *http.Response, spec *SOAPMediationSpec) error {
+	defer res.Body.Close()
+
+	status, body, err := spec.TranslateResponse(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if status != 0 {
+		res.StatusCode = status
+		res.Status = strconv.Itoa(status) + " " + http.StatusText(status)
+	}
+	res.Header.Del("SOAPAction")
+	res.Header.Set("Content-Type", "application/json")
+	res.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	res.ContentLength = int64(len(body))
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return nil
+}
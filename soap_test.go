@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	textTemplate "text/template"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/gorilla/context"
+)
+
+const soapTestWSDL = `<?xml version="1.0"?>
+<definitions xmlns="http://schemas.xmlsoap.org/wsdl/" xmlns:soap="http://schemas.xmlsoap.org/wsdl/soap/"
+	xmlns:soap12="http://schemas.xmlsoap.org/wsdl/soap12/" targetNamespace="http://example.com/stock">
+	<binding name="StockSoap12" type="tns:Stock">
+		<operation name="GetPrice"><soap12:operation soapAction="urn:GetPrice12"/></operation>
+	</binding>
+	<binding name="StockSoap" type="tns:Stock">
+		<operation name="GetPrice"><soap:operation soapAction="urn:GetPrice"/></operation>
+	</binding>
+</definitions>`
+
+var soapMediationDefinition = `
+
+	{
+		"name": "Tyk Test API",
+		"api_id": "1",
+		"org_id": "default",
+		"definition": {
+			"location": "header",
+			"key": "version"
+		},
+		"auth": {
+			"auth_header_name": "authorization"
+		},
+		"version_data": {
+			"not_versioned": true,
+			"versions": {
+				"Default": {
+					"name": "Default",
+					"use_extended_paths": true,
+					"extended_paths": {
+						"soap_mediation": [{
+							"path": "stock/{symbol}",
+							"method": "GET",
+							"operation": "GetPrice",
+							"namespace": "http://example.com/stock",
+							"soap_action": "urn:GetPrice",
+							"response_path": "GetPriceResponse",
+							"fault_status_codes": {"NotFound": 404}
+						}]
+					}
+				}
+			}
+		},
+		"proxy": {
+			"listen_path": "/v1",
+			"target_url": "http://example.com",
+			"strip_listen_path": false
+		}
+	}
+
+`
+
+func TestSOAPEnvelope(t *testing.T) {
+	spec := SOAPMediationSpec{SOAPMediationMeta: apidef.SOAPMediationMeta{Operation: "GetPrice"}}
+	if err := spec.applyWSDL([]byte(soapTestWSDL)); err != nil {
+		t.Fatal(err)
+	}
+	if spec.SOAPVersion != "1.1" || spec.SOAPAction != "urn:GetPrice" || spec.Namespace != "http://example.com/stock" {
+		t.Error("SOAP 1.1 bindings should be preferred, got: ", spec.SOAPMediationMeta)
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(`{"symbol": "A&B", "days": [1, 2], "currency": null}`))
+	decoder.UseNumber()
+	var bodyData interface{}
+	decoder.Decode(&bodyData)
+
+	envelope, err := spec.BuildEnvelope(bodyData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<GetPrice xmlns="http://example.com/stock"><currency xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:nil="true"/>` +
+		`<days>1</days><days>2</days><symbol>A&amp;B</symbol></GetPrice></soap:Body></soap:Envelope>`
+	if !strings.HasSuffix(string(envelope), expected) {
+		t.Error("Fields should become elements of the operation, got: ", string(envelope))
+	}
+
+	if _, err := spec.BuildEnvelope(map[string]interface{}{"bad name": 1}); err == nil {
+		t.Error("Fields that aren't valid element names should be rejected")
+	}
+
+	templated := SOAPMediationSpec{Template: textTemplate.Must(textTemplate.New("blob").Parse(
+		`<soap:Envelope><soap:Body><tns:x>{{.symbol}}</tns:x>{{range .tags}}<tns:tag>{{.}}</tns:tag>{{end}}</soap:Body></soap:Envelope>`))}
+	envelope, err = templated.BuildEnvelope(map[string]interface{}{"symbol": "</tns:x><evil/>", "tags": []interface{}{"<b>"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(envelope) != `<soap:Envelope><soap:Body><tns:x>&lt;/tns:x&gt;&lt;evil/&gt;</tns:x><tns:tag>&lt;b&gt;</tns:tag></soap:Body></soap:Envelope>` {
+		t.Error("Template values should be escaped, got: ", string(envelope))
+	}
+
+	header := http.Header{}
+	spec.SetRequestHeaders(header)
+	if header.Get("Content-Type") != "text/xml; charset=utf-8" || header.Get("SOAPAction") != `"urn:GetPrice"` {
+		t.Error("SOAP 1.1 calls should send the action as a header, got: ", header)
+	}
+
+	spec.SOAPVersion, header = "1.2", http.Header{}
+	spec.SetRequestHeaders(header)
+	if header.Get("Content-Type") != `application/soap+xml; charset=utf-8; action="urn:GetPrice"` || header.Get("SOAPAction") != "" {
+		t.Error("SOAP 1.2 calls should send the action in the content type, got: ", header)
+	}
+}
+
+func TestSOAPResponseTranslation(t *testing.T) {
+	path, _ := ParseJSONPath("GetPriceResponse")
+	spec := SOAPMediationSpec{
+		SOAPMediationMeta: apidef.SOAPMediationMeta{FaultStatusCodes: map[string]int{"NotFound": 404}},
+		ResponsePath:      path,
+	}
+
+	status, body, err := spec.TranslateResponse(strings.NewReader(`<?xml version="1.0"?>
+		<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><s:Body>
+			<m:GetPriceResponse xmlns:m="http://example.com/stock">
+				<m:Price currency="USD">34.5</m:Price><m:Trade>1</m:Trade><m:Trade>2</m:Trade><m:Note xsi:nil="true"/>
+			</m:GetPriceResponse>
+		</s:Body></s:Envelope>`))
+	if err != nil || status != 0 || string(body) != `{"Note":null,"Price":{"#text":"34.5","-currency":"USD"},"Trade":["1","2"]}` {
+		t.Error("Responses should be read by local name, got: ", status, string(body), err)
+	}
+
+	status, body, _ = spec.TranslateResponse(strings.NewReader(`
+		<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>
+			<faultcode>soap:Client</faultcode><faultstring>Unknown symbol</faultstring>
+		</soap:Fault></soap:Body></soap:Envelope>`))
+	if status != 400 || string(body) != `{"status":"error","error":"Unknown symbol","fault_code":"soap:Client"}` {
+		t.Error("Client faults should be a 400, got: ", status, string(body))
+	}
+
+	status, body, _ = spec.TranslateResponse(strings.NewReader(`
+		<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body><env:Fault>
+			<env:Code><env:Value>app:NotFound</env:Value></env:Code>
+			<env:Reason><env:Text xml:lang="en">No such stock</env:Text></env:Reason>
+			<env:Detail><symbol>XYZ</symbol></env:Detail>
+		</env:Fault></env:Body></env:Envelope>`))
+	if status != 404 || string(body) != `{"status":"error","error":"No such stock","fault_code":"app:NotFound","detail":{"symbol":"XYZ"}}` {
+		t.Error("Configured fault codes should set the status, got: ", status, string(body))
+	}
+
+	if _, _, err := spec.TranslateResponse(strings.NewReader(`<html></html>`)); err == nil {
+		t.Error("Responses that aren't envelopes should fail")
+	}
+}
+
+func TestSOAPMediation(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/xml")
+		if r.Method != "POST" || r.Header.Get("SOAPAction") != `"urn:GetPrice"` || !bytes.Contains(body, []byte("<symbol>ACME</symbol>")) {
+			w.WriteHeader(500)
+			w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>
+				<faultcode>soap:Server</faultcode><faultstring>Bad call</faultstring></soap:Fault></soap:Body></soap:Envelope>`))
+			return
+		}
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>
+			<GetPriceResponse><Price>34.5</Price></GetPriceResponse></soap:Body></soap:Envelope>`))
+	}))
+	defer upstream.Close()
+
+	spec := createDefinitionFromString(soapMediationDefinition)
+	spec.Proxy.TargetURL = upstream.URL
+
+	remote, _ := url.Parse(spec.Proxy.TargetURL)
+	proxy := TykNewSingleHostReverseProxy(remote, spec)
+	mw := &SOAPMediation{&TykMiddleware{spec, proxy}}
+
+	call := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RemoteAddr = "127.0.0.1:1234"
+		recorder := httptest.NewRecorder()
+		if err, code := mw.ProcessRequest(recorder, req, nil); err != nil {
+			t.Fatal("Mediation failed: ", code, err)
+		}
+		proxy.ServeHTTP(recorder, req)
+		context.Clear(req)
+		return recorder
+	}
+
+	recorder := call("/v1/stock/ACME?symbol=ACME")
+	if recorder.Code != 200 || recorder.Body.String() != `{"Price":"34.5"}` || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Error("JSON calls should be mediated both ways, got: ", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = call("/v1/stock/OTHER?symbol=OTHER")
+	if recorder.Code != 502 || recorder.Body.String() != `{"status":"error","error":"Bad call","fault_code":"soap:Server"}` {
+		t.Error("Server faults should be a bad gateway, got: ", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+)
+
+// isStreamingResponse spots responses that are sent as they are produced and must be passed on as
+// they arrive rather than buffered. Server-sent events always are, chunked bodies with no length
+// only when the API says its upstream streams them, as most are ordinary documents
+func isStreamingResponse(res *http.Response, spec *APISpec) bool {
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		return true
+	}
+
+	if spec == nil || !spec.Proxy.StreamChunkedResponses || res.ContentLength >= 0 {
+		return false
+	}
+
+	for _, encoding := range res.TransferEncoding {
+		if encoding == "chunked" {
+			return true
+		}
+	}
+
+	return false
+}
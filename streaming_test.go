@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type bufferingTestHandler struct {
+	called bool
+}
+
+func (h *bufferingTestHandler) HandleResponse(rw http.ResponseWriter, res *http.Response, req *http.Request, ses *SessionState) error {
+	h.called = true
+	return nil
+}
+
+func (h *bufferingTestHandler) New(c interface{}, spec *APISpec) (TykResponseHandler, error) {
+	return h, nil
+}
+
+func (h *bufferingTestHandler) BuffersResponseBody() bool {
+	return true
+}
+
+func TestStreamingResponseDetection(t *testing.T) {
+	sse := &http.Response{Header: http.Header{"Content-Type": []string{"text/event-stream; charset=utf-8"}}, ContentLength: -1}
+	chunked := &http.Response{Header: http.Header{"Content-Type": []string{"application/json"}}, ContentLength: -1, TransferEncoding: []string{"chunked"}}
+	sized := &http.Response{Header: http.Header{"Content-Type": []string{"application/json"}}, ContentLength: 20}
+
+	spec := createDefinitionFromString(nonExpiringDefNoWhiteList)
+	if !isStreamingResponse(sse, spec) || isStreamingResponse(chunked, spec) || isStreamingResponse(sized, spec) {
+		t.Error("Only event streams should be treated as streams by default")
+	}
+
+	spec.Proxy.StreamChunkedResponses = true
+	if !isStreamingResponse(chunked, spec) || isStreamingResponse(sized, spec) {
+		t.Error("Chunked bodies without a length should be streams when the API opts in")
+	}
+	spec.Proxy.StreamChunkedResponses = false
+
+	handler := &bufferingTestHandler{}
+	spec.ResponseChain = &[]TykResponseHandler{handler}
+	ResponseChain{}.Go(spec, httptest.NewRecorder(), sse, nil, nil)
+	if handler.called {
+		t.Error("Processors that buffer the body should be skipped for streams")
+	}
+
+	ResponseChain{}.Go(spec, httptest.NewRecorder(), sized, nil, nil)
+	if !handler.called {
+		t.Error("Processors should still run for ordinary responses")
+	}
+}
+
+var chunkedTransformDefinition = `
+	{
+		"name": "Tyk Test API",
+		"api_id": "1",
+		"org_id": "default",
+		"definition": {
+			"location": "header",
+			"key": "version"
+		},
+		"auth": {
+			"auth_header_name": "authorization"
+		},
+		"version_data": {
+			"not_versioned": true,
+			"versions": {
+				"Default": {
+					"name": "Default",
+					"use_extended_paths": true,
+					"extended_paths": {
+						"transform_response": [{
+							"path": "/greeting",
+							"method": "GET",
+							"template_data": {
+								"input_type": "json",
+								"template_mode": "blob",
+								"template_source": "eyJncmVldGluZyI6ICJ7ey5uYW1lfX0ifQ=="
+							}
+						}]
+					}
+				}
+			}
+		},
+		"proxy": {
+			"listen_path": "/",
+			"target_url": "http://example.com",
+			"strip_listen_path": false
+		}
+	}
+`
+
+func TestChunkedResponseTransformed(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": `))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(`"tyk"}`))
+	}))
+	defer upstream.Close()
+
+	spec := createDefinitionFromString(chunkedTransformDefinition)
+	transform, _ := ResponseTransformMiddleware{}.New(nil, spec)
+	spec.ResponseChain = &[]TykResponseHandler{transform}
+	spec.ResponseHandlersActive = true
+
+	remote, _ := url.Parse(upstream.URL)
+	proxy := TykNewSingleHostReverseProxy(remote, spec)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxy.ServeHTTP(w, r)
+	}))
+	defer gateway.Close()
+
+	res, err := http.Get(gateway.URL + "/greeting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, _ := ioutil.ReadAll(res.Body)
+	if string(body) != `{"greeting": "tyk"}` {
+		t.Error("Chunked JSON responses should still be transformed, got: ", string(body))
+	}
+}
+
+func TestServerSentEventsProxy(t *testing.T) {
+	release := make(chan bool)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("data: second\n\n"))
+	}))
+	defer upstream.Close()
+
+	spec := createDefinitionFromString(nonExpiringDefNoWhiteList)
+	remote, _ := url.Parse(upstream.URL)
+	proxy := TykNewSingleHostReverseProxy(remote, spec)
+	proxy.FlushInterval = time.Hour
+
+	var proxied *http.Response
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The cache path is the one that would buffer the body
+		proxied = proxy.ServeHTTPForCache(w, r)
+	}))
+	defer gateway.Close()
+
+	res, err := http.Get(gateway.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	reader := bufio.NewReader(res.Body)
+	events := make(chan string, 2)
+	go func() {
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(events)
+				return
+			}
+			if line != "\n" {
+				events <- line
+			}
+		}
+	}()
+
+	select {
+	case event := <-events:
+		if event != "data: first\n" {
+			t.Error("Events should be passed on unchanged, got: ", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Events should be flushed as they arrive")
+	}
+
+	close(release)
+	if event := <-events; event != "data: second\n" {
+		t.Error("The stream should carry on until the upstream ends it, got: ", event)
+	}
+	<-events
+
+	if proxied == nil || proxied.Body != nil || !isStreamingResponse(proxied, spec) {
+		t.Error("Streams should not be buffered for the cache, got: ", proxied)
+	}
+}
@@ -3,9 +3,10 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/lonelycode/go-uuid/uuid"
-	"github.com/TykTechnologies/tykcommon"
 	"io/ioutil"
+	"sort"
 	"strings"
 )
 
@@ -25,16 +26,25 @@ type DefinitionObjectAST struct {
 }
 
 type ResponseCodeObjectAST struct {
-	Description string `json:"description"`
-	Schema      struct {
-		Items map[string]interface{} `json:"items"`
-		Type  string                 `json:"type"`
-	} `json:"schema"`
+	Description string                            `json:"description"`
+	Schema      map[string]interface{}            `json:"schema"`
+	Examples    map[string]interface{}            `json:"examples"`
+	Headers     map[string]map[string]interface{} `json:"headers"`
+}
+
+type ParameterObjectAST struct {
+	Name     string                 `json:"name"`
+	In       string                 `json:"in"`
+	Required bool                   `json:"required"`
+	Schema   map[string]interface{} `json:"schema"`
 }
 
 type PathMethodObject struct {
 	Description string                           `json:"description"`
 	OperationID string                           `json:"operationId"`
+	Consumes    []string                         `json:"consumes"`
+	Produces    []string                         `json:"produces"`
+	Parameters  []ParameterObjectAST             `json:"parameters"`
 	Responses   map[string]ResponseCodeObjectAST `json:"responses"`
 }
 
@@ -72,39 +82,55 @@ type SwaggerAST struct {
 	Produces []string                  `json:"produces"`
 	Schemes  []string                  `json:"schemes"`
 	Swagger  string                    `json:"swagger"`
+
+	rawDefinitions interface{}
 }
 
 func (s *SwaggerAST) ReadString(asJson string) error {
-	marshallErr := json.Unmarshal([]byte(asJson), &s)
+	// Swagger files may be YAML and use references into the definitions
+	doc, err := decodeYAML(asJson)
+	if err != nil {
+		log.Error("Decoding failed: ", err)
+		return err
+	}
+
+	resolved, err := json.Marshal(resolveOpenAPIRefs(doc, doc, map[string]bool{}))
+	if err != nil {
+		log.Error("Marshalling failed: ", err)
+		return err
+	}
+
+	marshallErr := json.Unmarshal(resolved, &s)
 	if marshallErr != nil {
 		log.Error("Marshalling failed: ", marshallErr)
 		return marshallErr
 	}
 
+	// Definitions are kept as is for the request validation schemas
+	if asMap, isMap := doc.(map[string]interface{}); isMap {
+		s.rawDefinitions = asMap["definitions"]
+	}
+
 	return nil
 }
 
-func (s *SwaggerAST) ConvertIntoApiVersion(asMock bool) (tykcommon.VersionInfo, error) {
-	thisVersionInfo := tykcommon.VersionInfo{}
-
-	if asMock {
-		return thisVersionInfo, errors.New("Swagger mocks not supported")
-	}
-
+func (s *SwaggerAST) ConvertIntoApiVersion(asMock bool) (apidef.VersionInfo, error) {
+	thisVersionInfo := apidef.VersionInfo{}
 	thisVersionInfo.UseExtendedPaths = true
 	thisVersionInfo.Name = s.Info.Version
-	thisVersionInfo.ExtendedPaths.WhiteList = make([]tykcommon.EndPointMeta, 0)
+	thisVersionInfo.ExtendedPaths.WhiteList = make([]apidef.EndPointMeta, 0)
+	thisVersionInfo.ExtendedPaths.ValidateJSON = make([]apidef.ValidatePathMeta, 0)
+	thisVersionInfo.ExtendedPaths.ValidateResponse = make([]apidef.ValidateResponseMeta, 0)
 
 	if len(s.Paths) == 0 {
 		return thisVersionInfo, errors.New("No paths defined in swagger file!")
 	}
 	for pathName, pathSpec := range s.Paths {
 		log.Debug("path: %s", pathName)
-		newEndpointMeta := tykcommon.EndPointMeta{}
-		newEndpointMeta.MethodActions = make(map[string]tykcommon.EndpointMethodMeta)
+		newEndpointMeta := apidef.EndPointMeta{}
+		newEndpointMeta.MethodActions = make(map[string]apidef.EndpointMethodMeta)
 		newEndpointMeta.Path = pathName
 
-		// We just want the paths here, no mocks
 		methods := map[string]PathMethodObject{
 			"GET":     pathSpec.Get,
 			"PUT":     pathSpec.Put,
@@ -119,9 +145,29 @@ func (s *SwaggerAST) ConvertIntoApiVersion(asMock bool) (tykcommon.VersionInfo,
 			if len(m.Responses) == 0 && m.Description == "" && m.OperationID == "" {
 				continue
 			}
-			thisMethodAction := tykcommon.EndpointMethodMeta{}
-			thisMethodAction.Action = tykcommon.NoAction
+			thisMethodAction := apidef.EndpointMethodMeta{}
+			thisMethodAction.Action = apidef.NoAction
+			if asMock {
+				thisMethodAction = swaggerMockMethodMeta(m, s.Produces)
+			}
 			newEndpointMeta.MethodActions[methodName] = thisMethodAction
+
+			if schema := s.bodyParameterSchema(m); schema != nil {
+				thisVersionInfo.ExtendedPaths.ValidateJSON = append(thisVersionInfo.ExtendedPaths.ValidateJSON, apidef.ValidatePathMeta{
+					Path:   pathName,
+					Method: methodName,
+					Schema: schema,
+				})
+			}
+
+			// Mocked endpoints never reach the upstream so there is nothing to check
+			if schemas := s.responseSchemas(m); !asMock && len(schemas) > 0 {
+				thisVersionInfo.ExtendedPaths.ValidateResponse = append(thisVersionInfo.ExtendedPaths.ValidateResponse, apidef.ValidateResponseMeta{
+					Path:    pathName,
+					Method:  methodName,
+					Schemas: schemas,
+				})
+			}
 		}
 
 		thisVersionInfo.ExtendedPaths.WhiteList = append(thisVersionInfo.ExtendedPaths.WhiteList, newEndpointMeta)
@@ -130,9 +176,119 @@ func (s *SwaggerAST) ConvertIntoApiVersion(asMock bool) (tykcommon.VersionInfo,
 	return thisVersionInfo, nil
 }
 
-func (s *SwaggerAST) InsertIntoAPIDefinitionAsVersion(thisVersion tykcommon.VersionInfo, thisDefinition *tykcommon.APIDefinition, versionName string) error {
+// bodyParameterSchema returns the schema of the body parameter when the operation consumes JSON
+func (s *SwaggerAST) bodyParameterSchema(m PathMethodObject) map[string]interface{} {
+	consumes := m.Consumes
+	if len(consumes) == 0 {
+		consumes = s.Consumes
+	}
+	if !strings.Contains(swaggerMediaType(nil, consumes), "json") {
+		return nil
+	}
+
+	for _, param := range m.Parameters {
+		if param.In == "body" && len(param.Schema) > 0 {
+			return validationSchema(param.Schema, map[string]interface{}{"definitions": s.rawDefinitions})
+		}
+	}
+
+	return nil
+}
+
+// responseSchemas returns the response schemas of an operation keyed by status code
+func (s *SwaggerAST) responseSchemas(m PathMethodObject) map[string]map[string]interface{} {
+	produces := m.Produces
+	if len(produces) == 0 {
+		produces = s.Produces
+	}
+	if !strings.Contains(swaggerMediaType(nil, produces), "json") {
+		return nil
+	}
+
+	schemas := make(map[string]map[string]interface{})
+	for code, response := range m.Responses {
+		if len(response.Schema) > 0 {
+			schemas[code] = validationSchema(response.Schema, map[string]interface{}{"definitions": s.rawDefinitions})
+		}
+	}
+
+	return schemas
+}
+
+// swaggerMediaType picks the media type to mock, JSON is preferred
+func swaggerMediaType(examples map[string]interface{}, produces []string) string {
+	candidates := produces
+	if len(examples) > 0 {
+		candidates = []string{}
+		for mediaType := range examples {
+			candidates = append(candidates, mediaType)
+		}
+		sort.Strings(candidates)
+	}
+
+	for _, mediaType := range candidates {
+		if strings.Contains(mediaType, "json") {
+			return mediaType
+		}
+	}
+
+	if len(candidates) > 0 {
+		return candidates[0]
+	}
+
+	return "application/json"
+}
+
+// swaggerMockMethodMeta builds a reply for every response of an operation, using the examples
+// where they exist and synthesising a body from the schema where they don't
+func swaggerMockMethodMeta(m PathMethodObject, produces []string) apidef.EndpointMethodMeta {
+	if len(m.Produces) > 0 {
+		produces = m.Produces
+	}
+
+	codes := make([]string, 0, len(m.Responses))
+	for code := range m.Responses {
+		codes = append(codes, code)
+	}
+
+	defaultCode, defaultKey := mockResponseCode(codes)
+	sort.Strings(codes)
+
+	responses := []apidef.MockResponseMeta{}
+	for _, key := range codes {
+		response := m.Responses[key]
+		thisResponse := apidef.MockResponseMeta{
+			Code:    mockCodeForKey(key, defaultKey, defaultCode),
+			Headers: make(map[string]string),
+		}
+
+		for name, header := range response.Headers {
+			if example := synthesiseSchemaExample(header, 0); example != nil {
+				thisResponse.Headers[name] = strings.Trim(encodeMockBody("", example), "\"")
+			}
+		}
+
+		mediaType := swaggerMediaType(response.Examples, produces)
+		if example, found := response.Examples[mediaType]; found {
+			thisResponse.Data = encodeMockBody(mediaType, example)
+		} else if response.Schema != nil && strings.Contains(mediaType, "json") {
+			thisResponse.Data = encodeMockBody(mediaType, synthesiseSchemaExample(response.Schema, 0))
+		}
+
+		if thisResponse.Data != "" {
+			thisResponse.Headers["Content-Type"] = mediaType
+		}
+
+		responses = append(responses, thisResponse)
+	}
+
+	return newMockMethodMeta(defaultCode, responses)
+}
+
+func (s *SwaggerAST) InsertIntoAPIDefinitionAsVersion(thisVersion apidef.VersionInfo, thisDefinition *apidef.APIDefinition, versionName string) error {
 	thisDefinition.VersionData.NotVersioned = false
 	thisDefinition.VersionData.Versions[versionName] = thisVersion
+	enableResponseValidation(thisDefinition)
 	return nil
 }
 
@@ -206,8 +362,8 @@ func handleSwaggerMode(arguments map[string]interface{}) {
 	}
 }
 
-func createDefFromSwagger(s *SwaggerAST, orgId, upstreamURL string, as_mock bool) (*tykcommon.APIDefinition, error) {
-	thisAD := tykcommon.APIDefinition{}
+func createDefFromSwagger(s *SwaggerAST, orgId, upstreamURL string, as_mock bool) (*apidef.APIDefinition, error) {
+	thisAD := apidef.APIDefinition{}
 	thisAD.Name = s.Info.Title
 	thisAD.Active = true
 	thisAD.UseKeylessAccess = true
@@ -215,16 +371,13 @@ func createDefFromSwagger(s *SwaggerAST, orgId, upstreamURL string, as_mock bool
 	thisAD.OrgID = orgId
 	thisAD.VersionDefinition.Key = "version"
 	thisAD.VersionDefinition.Location = "header"
-	thisAD.VersionData.Versions = make(map[string]tykcommon.VersionInfo)
+	thisAD.VersionData.Versions = make(map[string]apidef.VersionInfo)
 	thisAD.VersionData.NotVersioned = false
 	thisAD.Proxy.ListenPath = "/" + thisAD.APIID + "/"
 	thisAD.Proxy.StripListenPath = true
 	thisAD.Proxy.TargetURL = upstreamURL
 
-	if as_mock {
-		log.Warning("Mocks not supported for Swagger definitions, ignoring option")
-	}
-	versionData, err := s.ConvertIntoApiVersion(false)
+	versionData, err := s.ConvertIntoApiVersion(as_mock)
 	if err != nil {
 		log.Error("Conversion into API Def failed: ", err)
 	}
@@ -21,15 +21,15 @@ import (
 	"strings"
 	"sync"
 	"time"
-	"github.com/TykTechnologies/tykcommon"
+	"github.com/TykTechnologies/tyk/apidef"
 
 )
 
 var ServiceCache *cache.Cache
 
-func GetURLFromService(spec *APISpec) (*tykcommon.HostList, error) {
+func GetURLFromService(spec *APISpec) (*apidef.HostList, error) {
 
-	doCacheRefresh := func () (*tykcommon.HostList, error) {
+	doCacheRefresh := func () (*apidef.HostList, error) {
 		log.Debug("--> Refreshing")
 		spec.ServiceRefreshInProgress = true
 		sd := ServiceDiscovery{}
@@ -77,7 +77,7 @@ func GetURLFromService(spec *APISpec) (*tykcommon.HostList, error) {
 	}
 
 	log.Debug("Returning from cache.")
-	return cachedServiceData.(*tykcommon.HostList), nil
+	return cachedServiceData.(*apidef.HostList), nil
 }
 
 func EnsureTransport(host string) string {
@@ -94,7 +94,7 @@ func EnsureTransport(host string) string {
 	return host
 }
 
-func GetNextTarget(targetData *tykcommon.HostList, spec *APISpec) string {
+func GetNextTarget(targetData *apidef.HostList, spec *APISpec) string {
 	if spec.Proxy.EnableLoadBalancing {
 		log.Debug("[PROXY] [LOAD BALANCING] Load balancer enabled, getting upstream target")
 		// Use a HostList
@@ -148,7 +148,7 @@ func GetNextTarget(targetData *tykcommon.HostList, spec *APISpec) string {
 func TykNewSingleHostReverseProxy(target *url.URL, spec *APISpec) *ReverseProxy {
 	// initalise round robin
 	spec.RoundRobin = &RoundRobin{}
-	spec.RoundRobin.SetMax(tykcommon.NewHostList())
+	spec.RoundRobin.SetMax(apidef.NewHostList())
 
 	if spec.Proxy.ServiceDiscovery.UseDiscoveryService {
 		log.Debug("[PROXY] Service discovery enabled")
@@ -464,7 +464,13 @@ func GetTransport(timeOut int, rw http.ResponseWriter, req *http.Request, p *Rev
 	}
 
 	if IsWebsocket(req) {
-		wsTransport := &WSDialer{thisTransport, rw, p.TLSClientConfig}
+		wsTransport := &WSDialer{
+			TykTransporter: thisTransport,
+			RW:             rw,
+			TLSConfig:      p.TLSClientConfig,
+			Spec:           p.TykAPISpec,
+			Request:        req,
+		}
 		return wsTransport
 	}
 
@@ -508,6 +514,7 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 	log.Debug("Outbound Request: ", outreq.URL.String())
 
 	// Do not modify outbound request headers if they are WS
+	copiedHeaders := false
 	if !IsWebsocket(outreq) {
 
 		// Remove hop-by-hop headers to the backend.  Especially
@@ -515,7 +522,6 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 		// connection, regardless of what the client sent to us.  This
 		// is modifying the same underlying map from req (shallow
 		// copied above) so we only copy it if necessary.
-		copiedHeaders := false
 		for _, h := range hopHeaders {
 			if outreq.Header.Get(h) != "" {
 				if !copiedHeaders {
@@ -531,6 +537,59 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 		}
 	}
 
+	if outreq.URL.Scheme == InternalAPIScheme {
+		// Calls to other APIs on this gateway carry our context variables with them, the transport is
+		// used directly as the default one may copy the request and lose its context
+		transport = headerTimeoutTransport{
+			Transport: InternalAPITransport{},
+			timeout:   time.Duration(timeout) * time.Second,
+		}
+		if contextData, found := context.GetOk(req, ContextData); found {
+			context.Set(outreq, ContextData, contextData)
+			defer context.Clear(outreq)
+		}
+	} else if outreq.Header.Get(InternalRouteHeader) != "" {
+		if !copiedHeaders {
+			headers := make(http.Header)
+			copyHeader(headers, outreq.Header)
+			outreq.Header = headers
+			copiedHeaders = true
+		}
+		outreq.Header.Del(InternalRouteHeader)
+	}
+
+	// Transcoded REST calls were turned into gRPC messages by the GRPCTranscode middleware
+	transcodeMeta, transcoding := context.GetOk(req, GRPCTranscodeMethod)
+	if transcoding {
+		prepareGRPCTranscodeRequest(outreq)
+	}
+
+	// Mediated SOAP calls have their replies and faults turned back into JSON
+	soapMeta, mediatingSOAP := context.GetOk(req, SOAPMediationSpecKey)
+
+	// gRPC-Web calls are translated to gRPC so that browsers can reach gRPC services
+	grpcWeb, grpcWebText := false, false
+	if p.TykAPISpec.EnableGRPCWeb {
+		grpcWeb, grpcWebText = isGRPCWebRequest(req)
+		if grpcWeb {
+			translateGRPCWebRequest(outreq, grpcWebText)
+		}
+	}
+
+	if h2Transport, useHTTP2 := p.upstreamHTTP2Transport(outreq, timeout); useHTTP2 {
+		transport = h2Transport
+		// Te is a hop-by-hop header, but gRPC servers need to know trailers are understood
+		if isGRPCRequest(outreq) && outreq.Header.Get("Te") == "" {
+			if !copiedHeaders {
+				headers := make(http.Header)
+				copyHeader(headers, outreq.Header)
+				outreq.Header = headers
+				copiedHeaders = true
+			}
+			outreq.Header.Set("Te", "trailers")
+		}
+	}
+
 	var thisIP string
 	if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
 		// If we aren't the first proxy retain prior
@@ -543,6 +602,25 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 		thisIP = clientIP
 	}
 
+	// The gateway's own credentials go on last, signatures have to cover the request as it is sent
+	if p.TykAPISpec.UpstreamAuthenticator != nil && outreq.URL.Scheme != InternalAPIScheme {
+		if !copiedHeaders {
+			headers := make(http.Header)
+			copyHeader(headers, outreq.Header)
+			outreq.Header = headers
+			copiedHeaders = true
+		}
+		if err := p.TykAPISpec.UpstreamAuthenticator.Authenticate(outreq); err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix":     "proxy",
+				"api_id":     p.TykAPISpec.APIDefinition.APIID,
+				"request_id": requestID(req),
+			}).Error("Upstream authentication failed: ", err)
+			p.ErrorHandler.HandleError(rw, logreq, "There was a problem proxying the request", 502)
+			return nil
+		}
+	}
+
 	// Circuit breaker
 	breakerEnforced, breakerConf := p.CheckCircuitBreakerEnforced(p.TykAPISpec, req)
 
@@ -560,7 +638,7 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 				breakerConf.CB.Success()
 			}
 		} else {
-			p.ErrorHandler.HandleError(rw, logreq, "Service temporarily unnavailable.", 503)
+			p.ErrorHandler.HandleTypedError(rw, logreq, ErrorTypeCircuitOpen, "Service temporarily unnavailable.", 503, nil)
 			return nil
 		}
 	} else {
@@ -568,6 +646,10 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 	}
 
 	if err != nil {
+		if err == errWebSocketConnectionLimit {
+			p.ErrorHandler.HandleError(rw, logreq, "Too many WebSocket connections for this key", 429)
+			return nil
+		}
 
 		var authHeaderValue string
 		contextAuthVal, authOk := context.GetOk(req, AuthHeaderValue)
@@ -593,10 +675,11 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 			"user_name":   alias,
 			"org_id":      p.TykAPISpec.APIDefinition.OrgID,
 			"api_id":      p.TykAPISpec.APIDefinition.APIID,
+			"request_id":  requestID(req),
 		}).Error("http: proxy error: ", err)
 
 		if strings.Contains(err.Error(), "timeout awaiting response headers") {
-			p.ErrorHandler.HandleError(rw, logreq, "Upstream service reached hard timeout.", 408)
+			p.ErrorHandler.HandleTypedError(rw, logreq, ErrorTypeUpstreamTimeout, "Upstream service reached hard timeout.", 408, nil)
 
 			if p.TykAPISpec.Proxy.ServiceDiscovery.UseDiscoveryService {
 				if ServiceCache != nil {
@@ -620,8 +703,45 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 		return nil
 	}
 
+	if grpcWeb {
+		translateGRPCWebResponse(res, req.Header.Get("Content-Type"), grpcWebText)
+	}
+
+	if transcoding {
+		if err := transcodeGRPCResponse(res, transcodeMeta.(*GRPCTranscodeSpec)); err != nil {
+			log.Error("Failed to transcode gRPC response: ", err)
+			p.ErrorHandler.HandleError(rw, logreq, "There was a problem proxying the request", 502)
+			return nil
+		}
+	}
+
+	if mediatingSOAP {
+		if err := mediateSOAPResponse(res, soapMeta.(*SOAPMediationSpec)); err != nil {
+			log.Error("Failed to translate SOAP response: ", err)
+			p.ErrorHandler.HandleError(rw, logreq, "There was a problem proxying the request", 502)
+			return nil
+		}
+	}
+
+	// Streams are passed on as they arrive, nothing may hold on to the body
+	streaming := isStreamingResponse(res, p.TykAPISpec)
+
+	// The cache and response processors see the body decoded, it is encoded again for the client
+	var upstreamEncoding string
+	if !streaming && (withCache || p.TykAPISpec.ResponseHandlersActive) {
+		if upstreamEncoding, err = decodeResponseBody(res); err != nil {
+			res.Body.Close()
+			log.Error("Failed to decode upstream response: ", err)
+			p.ErrorHandler.HandleError(rw, logreq, "There was a problem proxying the request", 502)
+			return nil
+		}
+	}
+
 	inres := new(http.Response)
-	if withCache {
+	if withCache && streaming {
+		*inres = *res
+		inres.Body = nil
+	} else if withCache {
 		*inres = *res // includes shallow copies of maps, but okay
 
 		defer res.Body.Close()
@@ -632,6 +752,9 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 
 		p.CopyResponse(&bodyBuffer, res.Body)
 		*bodyBuffer2 = bodyBuffer
+		if upstreamEncoding != "" {
+			res.ContentLength = int64(bodyBuffer.Len())
+		}
 
 		// Create new ReadClosers so we can split output
 		res.Body = ioutil.NopCloser(&bodyBuffer)
@@ -645,7 +768,7 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 
 	if p.TykAPISpec.ResponseHandlersActive {
 		// Middleware chain handling here - very simple, but should do the trick
-		chainErr := p.ResponseHandler.Go(p.TykAPISpec.ResponseChain, rw, res, req, &ses)
+		chainErr := p.ResponseHandler.Go(p.TykAPISpec, rw, res, req, &ses)
 		if chainErr != nil {
 			log.Error("Response chain failed! ", chainErr)
 		}
@@ -654,6 +777,11 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 	// We should at least copy the status code in
 	inres.StatusCode = res.StatusCode
 	inres.ContentLength = res.ContentLength
+	if !streaming {
+		if err := encodeResponseBody(res, req, &p.TykAPISpec.ResponseCompression, upstreamEncoding != ""); err != nil {
+			log.Error("Failed to compress response: ", err)
+		}
+	}
 	p.HandleResponse(rw, res, req, &ses)
 	return inres
 }
@@ -678,10 +806,24 @@ func (p *ReverseProxy) HandleResponse(rw http.ResponseWriter, res *http.Response
 		res.Header.Add("X-RateLimit-Reset", strconv.Itoa(int(ses.QuotaRenews)))
 	}
 
+	dropUpstreamRequestID(res.Header)
 	copyHeader(rw.Header(), res.Header)
 
 	rw.WriteHeader(res.StatusCode)
-	p.CopyResponse(rw, res.Body)
+	if wf, ok := rw.(writeFlusher); ok && isStreamingResponse(res, p.TykAPISpec) {
+		// Clients should see the headers before the first event arrives
+		wf.Flush()
+		io.Copy(flushWriter{wf}, res.Body)
+	} else if wf, ok := rw.(writeFlusher); ok && isGRPCResponse(res) {
+		io.Copy(flushWriter{wf}, res.Body)
+	} else {
+		p.CopyResponse(rw, res.Body)
+	}
+
+	// Trailers are only complete once the body has been read
+	for key, values := range res.Trailer {
+		rw.Header()[http.TrailerPrefix+key] = values
+	}
 	return nil
 }
 
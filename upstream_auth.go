@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/logrus"
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+const (
+	secretsReference = "secrets://"
+	envReference     = "env://"
+
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+
+	// Tokens are refreshed a little before they expire, tokens that don't say when they expire are
+	// kept for the default lifetime. Failed fetches are retried with a growing delay.
+	oauth2RefreshMargin    = 60 * time.Second
+	oauth2DefaultExpiry    = 5 * time.Minute
+	oauth2RequestTimeout   = 10 * time.Second
+	oauth2RetryInterval    = 10 * time.Second
+	oauth2MaxRetryInterval = 5 * time.Minute
+)
+
+// resolveSecret returns the value a secret refers to. "secrets://name" is looked up in the
+// gateway's secrets config and "env://NAME" in the environment, anything else is the secret itself.
+func resolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, secretsReference):
+		name := strings.TrimPrefix(value, secretsReference)
+		secret, found := config.Secrets[name]
+		if !found {
+			return "", fmt.Errorf("secret %q is not in the gateway config", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, envReference):
+		name := strings.TrimPrefix(value, envReference)
+		secret, found := os.LookupEnv(name)
+		if !found {
+			return "", fmt.Errorf("environment variable %q is not set", name)
+		}
+		return secret, nil
+	}
+
+	return value, nil
+}
+
+func resolveSecrets(values ...*string) error {
+	for _, value := range values {
+		resolved, err := resolveSecret(*value)
+		if err != nil {
+			return err
+		}
+		*value = resolved
+	}
+	return nil
+}
+
+// UpstreamAuthenticator adds the gateway's own credentials to a request on its way upstream
+type UpstreamAuthenticator interface {
+	Authenticate(r *http.Request) error
+}
+
+// NewUpstreamAuthenticator sets up upstream auth for an API, there is none when no type is set
+func NewUpstreamAuthenticator(meta apidef.UpstreamAuthMeta) (UpstreamAuthenticator, error) {
+	switch meta.Type {
+	case "":
+		return nil, nil
+	case apidef.UpstreamAuthHMAC:
+		options := meta.HMAC
+		if err := resolveSecrets(&options.Secret); err != nil {
+			return nil, err
+		}
+		if options.KeyID == "" || options.Secret == "" {
+			return nil, errors.New("HMAC signing needs a key ID and a secret")
+		}
+		if len(options.Headers) == 0 {
+			options.Headers = []string{"(request-target)", "date"}
+		}
+		return &upstreamHMACSigner{options}, nil
+	case apidef.UpstreamAuthSigV4:
+		options := meta.SigV4
+		if err := resolveSecrets(&options.AccessKey, &options.SecretKey, &options.SessionToken); err != nil {
+			return nil, err
+		}
+		if options.AccessKey == "" || options.SecretKey == "" || options.Region == "" || options.Service == "" {
+			return nil, errors.New("SigV4 signing needs an access key, secret key, region and service")
+		}
+		return &upstreamSigV4Signer{options: options, now: time.Now}, nil
+	case apidef.UpstreamAuthOAuth2:
+		options := meta.OAuth2
+		if err := resolveSecrets(&options.ClientID, &options.ClientSecret); err != nil {
+			return nil, err
+		}
+		if options.TokenURL == "" || options.ClientID == "" {
+			return nil, errors.New("OAuth2 client credentials need a token URL and a client ID")
+		}
+		if options.Header == "" {
+			options.Header = "Authorization"
+		}
+		return &upstreamOAuth2Client{options: options, client: &http.Client{Timeout: oauth2RequestTimeout}}, nil
+	case apidef.UpstreamAuthBasic:
+		options := meta.BasicAuth
+		if err := resolveSecrets(&options.Username, &options.Password); err != nil {
+			return nil, err
+		}
+		return &upstreamBasicAuth{options}, nil
+	}
+
+	return nil, fmt.Errorf("unknown upstream auth type %q", meta.Type)
+}
+
+// upstreamAuthError stands in for auth that couldn't be set up, requests fail rather than being
+// sent without credentials
+type upstreamAuthError struct {
+	err error
+}
+
+func (u upstreamAuthError) Authenticate(r *http.Request) error {
+	return u.err
+}
+
+type upstreamBasicAuth struct {
+	options apidef.UpstreamBasicAuthOptions
+}
+
+func (u *upstreamBasicAuth) Authenticate(r *http.Request) error {
+	r.SetBasicAuth(u.options.Username, u.options.Password)
+	return nil
+}
+
+// upstreamHMACSigner signs requests the way the HMAC middleware checks them, so one gateway can
+// call an API that another protects with signatures
+type upstreamHMACSigner struct {
+	options apidef.UpstreamHMACOptions
+}
+
+func (u *upstreamHMACSigner) Authenticate(r *http.Request) error {
+	// A date the client sent, in either header, would not be when the request was signed
+	r.Header.Del(AltHeaderSpec)
+	r.Header.Set(DateHeaderSpec, time.Now().UTC().Format(http.TimeFormat))
+
+	fieldValues := &HMACFieldValues{KeyID: u.options.KeyID, Algorthm: "hmac-sha1", Headers: u.options.Headers}
+	signatureString, err := generateHMACSignatureStringFromRequest(r, fieldValues)
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set("Authorization", fmt.Sprintf(`Signature keyId="%s",algorithm="%s",headers="%s",signature="%s"`,
+		fieldValues.KeyID, fieldValues.Algorthm, strings.Join(fieldValues.Headers, " "),
+		generateEncodedSignature(signatureString, u.options.Secret)))
+
+	return nil
+}
+
+// upstreamSigV4Signer signs requests with AWS Signature Version 4
+type upstreamSigV4Signer struct {
+	options apidef.UpstreamSigV4Options
+	now     func() time.Time
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// sigV4Escape encodes everything but the RFC 3986 unreserved characters, slashes are kept when
+// encoding a path
+func sigV4Escape(value string, path bool) string {
+	var escaped bytes.Buffer
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			escaped.WriteByte(c)
+		case c == '/' && path:
+			escaped.WriteByte(c)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
+}
+
+func sigV4CanonicalQuery(query url.Values) string {
+	var pairs []string
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, sigV4Escape(key, false)+"="+sigV4Escape(value, false))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func (u *upstreamSigV4Signer) Authenticate(r *http.Request) error {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			return err
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+	}
+	payloadHash := sha256Hex(body)
+
+	now := u.now().UTC()
+	amzDate := now.Format(sigV4TimeFormat)
+	r.Header.Set("X-Amz-Date", amzDate)
+	if u.options.SessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", u.options.SessionToken)
+	}
+	if u.options.Service == "s3" {
+		r.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range r.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.Join(strings.Fields(strings.Join(values, ",")), " ")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders bytes.Buffer
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	// Paths are encoded twice for everything but S3
+	path := r.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	canonicalPath := sigV4Escape(path, true)
+	if u.options.Service != "s3" {
+		canonicalPath = sigV4Escape(canonicalPath, true)
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		canonicalPath,
+		sigV4CanonicalQuery(r.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	date := now.Format("20060102")
+	scope := strings.Join([]string{date, u.options.Region, u.options.Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{sigV4Algorithm, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+u.options.SecretKey), date)
+	key = hmacSHA256(key, u.options.Region)
+	key = hmacSHA256(key, u.options.Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	r.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, u.options.AccessKey, scope, signedHeaders, signature))
+
+	return nil
+}
+
+// upstreamOAuth2Client fetches tokens with the client credentials grant and shares them between
+// requests. Tokens are refreshed in the background before they expire, only one fetch runs at a
+// time and fetches that fail are retried with a growing delay rather than on every request.
+type upstreamOAuth2Client struct {
+	options apidef.UpstreamOAuth2Options
+	client  *http.Client
+
+	mu        sync.Mutex
+	token     string
+	tokenType string
+	expires   time.Time
+	refreshAt time.Time
+	fetching  chan struct{}
+	failures  uint
+	retryAt   time.Time
+	lastErr   error
+}
+
+type oauth2TokenResponse struct {
+	AccessToken string      `json:"access_token"`
+	TokenType   string      `json:"token_type"`
+	ExpiresIn   json.Number `json:"expires_in"`
+}
+
+func (u *upstreamOAuth2Client) fetchToken() (*oauth2TokenResponse, time.Duration, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(u.options.Scopes) > 0 {
+		form.Set("scope", strings.Join(u.options.Scopes, " "))
+	}
+
+	req, err := http.NewRequest("POST", u.options.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(u.options.ClientID), url.QueryEscape(u.options.ClientSecret))
+
+	res, err := u.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if res.StatusCode != 200 {
+		return nil, 0, fmt.Errorf("token endpoint returned %d: %s", res.StatusCode, body)
+	}
+
+	var token oauth2TokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, 0, err
+	}
+	if token.AccessToken == "" {
+		return nil, 0, errors.New("token endpoint returned no access token")
+	}
+
+	lifetime := oauth2DefaultExpiry
+	if seconds, err := strconv.ParseInt(token.ExpiresIn.String(), 10, 64); err == nil && seconds > 0 {
+		lifetime = time.Duration(seconds) * time.Second
+	}
+
+	return &token, lifetime, nil
+}
+
+// startFetch fetches a token without holding the lock, requests that need the result wait on the
+// returned channel. It must be called with the lock held and no fetch running.
+func (u *upstreamOAuth2Client) startFetch() chan struct{} {
+	fetching := make(chan struct{})
+	u.fetching = fetching
+
+	go func() {
+		token, lifetime, err := u.fetchToken()
+
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		defer close(fetching)
+		u.fetching = nil
+
+		now := time.Now()
+		if err != nil {
+			u.failures++
+			delay := oauth2RetryInterval << (u.failures - 1)
+			if delay > oauth2MaxRetryInterval || delay <= 0 {
+				delay = oauth2MaxRetryInterval
+			}
+			u.retryAt, u.lastErr = now.Add(delay), err
+
+			if u.token != "" && now.Before(u.expires) {
+				log.WithFields(logrus.Fields{
+					"prefix": "proxy",
+				}).Warning("Upstream token refresh failed, using the current token: ", err)
+			}
+			return
+		}
+
+		margin := oauth2RefreshMargin
+		if margin > lifetime/2 {
+			margin = lifetime / 2
+		}
+		u.token, u.tokenType = token.AccessToken, token.TokenType
+		u.expires, u.refreshAt = now.Add(lifetime), now.Add(lifetime-margin)
+		u.failures, u.retryAt, u.lastErr = 0, time.Time{}, nil
+	}()
+
+	return fetching
+}
+
+func (u *upstreamOAuth2Client) Authenticate(r *http.Request) error {
+	u.mu.Lock()
+	for {
+		now := time.Now()
+		canFetch := u.fetching == nil && !now.Before(u.retryAt)
+
+		if u.token != "" && now.Before(u.expires) {
+			// A token that hasn't expired yet is used while its successor is fetched
+			if canFetch && !now.Before(u.refreshAt) {
+				u.startFetch()
+			}
+			break
+		}
+
+		fetching := u.fetching
+		if fetching == nil {
+			if !canFetch {
+				err := u.lastErr
+				u.mu.Unlock()
+				return err
+			}
+			fetching = u.startFetch()
+		}
+
+		u.mu.Unlock()
+		select {
+		case <-fetching:
+		case <-r.Context().Done():
+			return r.Context().Err()
+		}
+		u.mu.Lock()
+
+		if u.lastErr != nil && (u.token == "" || !time.Now().Before(u.expires)) {
+			err := u.lastErr
+			u.mu.Unlock()
+			return err
+		}
+	}
+	token, tokenType := u.token, u.tokenType
+	u.mu.Unlock()
+
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	r.Header.Set(u.options.Header, tokenType+" "+token)
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/gorilla/context"
+)
+
+func TestUpstreamSecrets(t *testing.T) {
+	config.Secrets = map[string]string{"billing": "s3cr3t"}
+	defer func() { config.Secrets = nil }()
+	os.Setenv("TYK_TEST_UPSTREAM_SECRET", "from-env")
+	defer os.Unsetenv("TYK_TEST_UPSTREAM_SECRET")
+
+	for value, expected := range map[string]string{
+		"plain":                          "plain",
+		"secrets://billing":              "s3cr3t",
+		"env://TYK_TEST_UPSTREAM_SECRET": "from-env",
+	} {
+		if secret, err := resolveSecret(value); err != nil || secret != expected {
+			t.Errorf("%q should resolve to %q, got %q %v", value, expected, secret, err)
+		}
+	}
+
+	if _, err := resolveSecret("secrets://missing"); err == nil {
+		t.Error("Missing secrets should be an error")
+	}
+	if _, err := NewUpstreamAuthenticator(apidef.UpstreamAuthMeta{Type: apidef.UpstreamAuthHMAC}); err == nil {
+		t.Error("Incomplete upstream auth should be rejected")
+	}
+}
+
+func TestUpstreamSigV4Signing(t *testing.T) {
+	signer := &upstreamSigV4Signer{
+		options: apidef.UpstreamSigV4Options{
+			AccessKey: "AKIDEXAMPLE",
+			SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+			Region:    "us-east-1",
+			Service:   "service",
+		},
+		now: func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) },
+	}
+
+	// Requests from the AWS signature test suite
+	for target, signature := range map[string]string{
+		"https://example.amazonaws.com/":                             "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		"https://example.amazonaws.com/?Param2=value2&Param1=value1": "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+	} {
+		req, _ := http.NewRequest("GET", target, nil)
+		signer.Authenticate(req)
+
+		expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=" + signature
+		if req.Header.Get("Authorization") != expected {
+			t.Errorf("%s was signed wrongly, got: %s", target, req.Header.Get("Authorization"))
+		}
+	}
+}
+
+func TestUpstreamHMACSigning(t *testing.T) {
+	signer, err := NewUpstreamAuthenticator(apidef.UpstreamAuthMeta{
+		Type: apidef.UpstreamAuthHMAC,
+		HMAC: apidef.UpstreamHMACOptions{KeyID: "9876", Secret: "9879879878787878"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://upstream/orders", nil)
+	req.Header.Set(AltHeaderSpec, "Mon, 01 Jan 2001 00:00:00 GMT")
+	signer.Authenticate(req)
+
+	// The signature should pass the same checks the HMAC middleware makes
+	fieldValues, err := getFieldValues(stripSignature(req.Header.Get("Authorization")))
+	if err != nil {
+		t.Fatal("Signature header should parse: ", err)
+	}
+	signatureString, _ := generateHMACSignatureStringFromRequest(req, fieldValues)
+	if fieldValues.KeyID != "9876" || generateEncodedSignature(signatureString, "9879879878787878") != fieldValues.Signature {
+		t.Error("Signature should verify, got: ", req.Header.Get("Authorization"))
+	}
+	signedAt, _ := http.ParseTime(req.Header.Get("Date"))
+	if req.Header.Get(AltHeaderSpec) != "" || time.Since(signedAt) > time.Minute {
+		t.Error("Requests should be signed with the current date, got: ", req.Header)
+	}
+}
+
+func TestUpstreamOAuth2ClientCredentials(t *testing.T) {
+	var fetches, requests int32
+	var failing int32
+	release := make(chan bool)
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		r.ParseForm()
+		clientID, clientSecret, _ := r.BasicAuth()
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+		if atomic.LoadInt32(&failing) == 1 || clientID != "gateway" || clientSecret != "pa ss" || r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("scope") != "read write" {
+			w.WriteHeader(401)
+			return
+		}
+		count := atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "token-` + string('0'+count) + `", "token_type": "bearer", "expires_in": 3600}`))
+	}))
+	defer tokenServer.Close()
+
+	auth, _ := NewUpstreamAuthenticator(apidef.UpstreamAuthMeta{
+		Type: apidef.UpstreamAuthOAuth2,
+		OAuth2: apidef.UpstreamOAuth2Options{
+			TokenURL: tokenServer.URL, ClientID: "gateway", ClientSecret: "pa ss", Scopes: []string{"read", "write"},
+		},
+	})
+	client := auth.(*upstreamOAuth2Client)
+
+	authenticate := func() string {
+		req, _ := http.NewRequest("GET", "http://upstream/", nil)
+		if err := auth.Authenticate(req); err != nil {
+			return err.Error()
+		}
+		return req.Header.Get("Authorization")
+	}
+	// waitForFetch waits for a background refresh to finish
+	waitForFetch := func() {
+		client.mu.Lock()
+		fetching := client.fetching
+		client.mu.Unlock()
+		if fetching != nil {
+			<-fetching
+		}
+	}
+	expire := func(refresh, expired bool) {
+		client.mu.Lock()
+		if refresh {
+			client.refreshAt = time.Now().Add(-time.Second)
+		}
+		if expired {
+			client.expires = time.Now().Add(-time.Second)
+		}
+		client.retryAt = time.Time{}
+		client.mu.Unlock()
+	}
+
+	// Requests arriving together share one fetch
+	tokens := make(chan string, 5)
+	for i := 0; i < 5; i++ {
+		go func() { tokens <- authenticate() }()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for i := 0; i < 5; i++ {
+		if token := <-tokens; token != "Bearer token-1" {
+			t.Error("Waiting requests should get the fetched token, got: ", token)
+		}
+	}
+	if authenticate() != "Bearer token-1" || fetches != 1 {
+		t.Error("Tokens should be fetched once and reused, fetches: ", fetches)
+	}
+
+	// Tokens close to expiring keep being used while they are refreshed
+	expire(true, false)
+	if token := authenticate(); token != "Bearer token-1" {
+		t.Error("The current token should be used during a refresh, got: ", token)
+	}
+	waitForFetch()
+	if token := authenticate(); token != "Bearer token-2" {
+		t.Error("Tokens should be refreshed before they expire, got: ", token)
+	}
+
+	atomic.StoreInt32(&failing, 1)
+	expire(true, false)
+	authenticate()
+	waitForFetch()
+	if token := authenticate(); token != "Bearer token-2" {
+		t.Error("Failed refreshes should keep using a token that hasn't expired, got: ", token)
+	}
+
+	expire(true, true)
+	if token := authenticate(); token == "Bearer token-2" {
+		t.Error("Expired tokens should not be used")
+	}
+
+	before := atomic.LoadInt32(&requests)
+	if token := authenticate(); token == "Bearer token-2" || atomic.LoadInt32(&requests) != before {
+		t.Error("Failed fetches should not be retried straight away, got: ", token)
+	}
+	client.mu.Lock()
+	if client.failures != 2 || client.retryAt.Sub(time.Now()) <= oauth2RetryInterval {
+		t.Error("The retry delay should grow with each failure, got: ", client.failures, client.retryAt)
+	}
+	client.mu.Unlock()
+}
+
+func TestUpstreamAuthProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		w.Write([]byte(user + ":" + pass))
+	}))
+	defer upstream.Close()
+
+	spec := createDefinitionFromString(validateResponseDefinition)
+	spec.Proxy.TargetURL = upstream.URL
+	spec.DoNotTrack = true
+	spec.UpstreamAuthenticator = &upstreamBasicAuth{apidef.UpstreamBasicAuthOptions{Username: "gateway", Password: "secret"}}
+
+	remote, _ := url.Parse(spec.Proxy.TargetURL)
+	proxy := TykNewSingleHostReverseProxy(remote, spec)
+	proxy.New(nil, spec)
+
+	call := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/v1/pets", nil)
+		req.RemoteAddr = "127.0.0.1:1234"
+		req.Header.Set("Authorization", "client-key")
+		recorder := httptest.NewRecorder()
+		proxy.ServeHTTP(recorder, req)
+		context.Clear(req)
+		return recorder
+	}
+
+	if recorder := call(); recorder.Body.String() != "gateway:secret" {
+		t.Error("Upstream credentials should replace the client's, got: ", recorder.Body.String())
+	}
+
+	spec.UpstreamAuthenticator = upstreamAuthError{errors.New("secret missing")}
+	if recorder := call(); recorder.Code != 502 {
+		t.Error("Requests should fail when upstream auth can't be set up, got: ", recorder.Code)
+	}
+}
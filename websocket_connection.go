@@ -0,0 +1,807 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TykTechnologies/logrus"
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/gorilla/context"
+)
+
+const (
+	wsOpContinuation byte = 0x0
+	wsOpText         byte = 0x1
+	wsOpBinary       byte = 0x2
+	wsOpClose        byte = 0x8
+
+	WSCloseNormal          = 1000
+	WSCloseGoingAway       = 1001
+	WSCloseProtocolError   = 1002
+	WSCloseAbnormal        = 1006
+	WSClosePolicyViolation = 1008
+	WSCloseMessageTooBig   = 1009
+	WSCloseInternalError   = 1011
+
+	WebSocketEventOpen  = "open"
+	WebSocketEventClose = "close"
+
+	// Messages sent by the client travel upstream, the replies travel downstream
+	WebSocketUpstream   = "upstream"
+	WebSocketDownstream = "downstream"
+
+	WebSocketMessageForward = "forward"
+	WebSocketMessageDrop    = "drop"
+	WebSocketMessageClose   = "close"
+
+	defaultWebSocketAuthRefresh    int64 = 60
+	defaultWebSocketMaxMessageSize int64 = 1 << 20
+	webSocketCloseTimeout                = 5 * time.Second
+)
+
+// webSocketWatchInterval is how often open connections are checked for timeouts and revoked keys
+var webSocketWatchInterval = time.Second
+
+var errWebSocketClosed = errors.New("websocket connection closed by the gateway")
+var errWebSocketConnectionLimit = errors.New("too many WebSocket connections for this key")
+
+// WebSocketStats is attached to the analytics records written when a connection opens and closes,
+// bytes and messages "in" were sent by the client and "out" were sent to it
+type WebSocketStats struct {
+	Event       string
+	Duration    int64
+	BytesIn     int64
+	BytesOut    int64
+	MessagesIn  int64
+	MessagesOut int64
+	CloseCode   int
+	CloseReason string
+}
+
+// WebSocketMessageVerdict is what a message hook decided to do with a message
+type WebSocketMessageVerdict struct {
+	Action string
+	Data   []byte
+	Reason string
+}
+
+// WebSocketMessageHook inspects complete messages before they are passed on, hooks can rewrite,
+// drop or close the connection on a message
+type WebSocketMessageHook interface {
+	HandleMessage(c *WebSocketConnection, direction string, opcode byte, payload []byte) (WebSocketMessageVerdict, error)
+}
+
+// WebSocketMessageObject is passed to JSVM message hooks, binary messages are base64 encoded
+type WebSocketMessageObject struct {
+	Direction string `json:"direction"`
+	Type      string `json:"type"`
+	Data      string `json:"data"`
+}
+
+// WebSocketMessageReturnObject is the JSON a JSVM message hook returns, leaving out the data
+// forwards the message unchanged
+type WebSocketMessageReturnObject struct {
+	Action string  `json:"action"`
+	Data   *string `json:"data"`
+	Reason string  `json:"reason"`
+}
+
+// JSVMWebSocketHook runs a JS function for every message
+type JSVMWebSocketHook struct {
+	Spec *APISpec
+	Name string
+}
+
+func (h *JSVMWebSocketHook) HandleMessage(c *WebSocketConnection, direction string, opcode byte, payload []byte) (WebSocketMessageVerdict, error) {
+	message := WebSocketMessageObject{Direction: direction, Type: "text", Data: string(payload)}
+	if opcode == wsOpBinary {
+		message.Type = "binary"
+		message.Data = base64.StdEncoding.EncodeToString(payload)
+	}
+
+	asJsonMessage, err := json.Marshal(message)
+	if err != nil {
+		return WebSocketMessageVerdict{}, err
+	}
+
+	thisVM := h.Spec.JSVM.VM.Copy()
+	returnRaw, err := thisVM.Run(h.Name + `(` + string(asJsonMessage) + `, ` + jsonConfigData(h.Spec) + `);`)
+	if err != nil {
+		return WebSocketMessageVerdict{}, err
+	}
+	returnDataStr, _ := returnRaw.ToString()
+
+	returned := WebSocketMessageReturnObject{}
+	if err := json.Unmarshal([]byte(returnDataStr), &returned); err != nil {
+		return WebSocketMessageVerdict{}, err
+	}
+
+	verdict := WebSocketMessageVerdict{Action: returned.Action, Data: payload, Reason: returned.Reason}
+	if returned.Data != nil {
+		verdict.Data = []byte(*returned.Data)
+		if opcode == wsOpBinary {
+			if verdict.Data, err = base64.StdEncoding.DecodeString(*returned.Data); err != nil {
+				return verdict, err
+			}
+		}
+	}
+
+	return verdict, nil
+}
+
+// newWebSocketMessageHook picks the hook for the middleware driver the API uses
+func newWebSocketMessageHook(spec *APISpec) WebSocketMessageHook {
+	name := spec.WebSocket.MessageHook.Name
+	if name == "" {
+		return nil
+	}
+
+	driver := spec.CustomMiddleware.Driver
+	if driver == "" || driver == apidef.OttoDriver {
+		if !config.EnableJSVM || spec.JSVM == nil {
+			log.WithFields(logrus.Fields{
+				"prefix": "websocket",
+				"api_id": spec.APIID,
+			}).Warning("WebSocket message hook is set but the JSVM is disabled")
+			return nil
+		}
+		return &JSVMWebSocketHook{spec, name}
+	}
+
+	if !EnableCoProcess {
+		return nil
+	}
+
+	return newCoProcessWebSocketHook(spec, name)
+}
+
+type wsFrameHeader struct {
+	Fin    bool
+	Rsv    byte
+	Opcode byte
+	Masked bool
+	Mask   [4]byte
+	Length int64
+	raw    []byte
+}
+
+func (h wsFrameHeader) isControl() bool {
+	return h.Opcode&0x8 != 0
+}
+
+// readWSFrameHeader reads a frame header (RFC 6455 section 5.2), keeping the bytes as they were
+// sent so that frames can be passed on without being re-encoded
+func readWSFrameHeader(r io.Reader) (wsFrameHeader, error) {
+	var h wsFrameHeader
+	raw := make([]byte, 2, 14)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return h, err
+	}
+
+	h.Fin = raw[0]&0x80 != 0
+	h.Rsv = raw[0] & 0x70
+	h.Opcode = raw[0] & 0x0f
+	h.Masked = raw[1]&0x80 != 0
+
+	extended := 0
+	switch raw[1] & 0x7f {
+	case 126:
+		extended = 2
+	case 127:
+		extended = 8
+	default:
+		h.Length = int64(raw[1] & 0x7f)
+	}
+
+	maskLength := 0
+	if h.Masked {
+		maskLength = 4
+	}
+
+	raw = raw[:2+extended+maskLength]
+	if _, err := io.ReadFull(r, raw[2:]); err != nil {
+		return h, err
+	}
+
+	switch extended {
+	case 2:
+		h.Length = int64(binary.BigEndian.Uint16(raw[2:4]))
+	case 8:
+		h.Length = int64(binary.BigEndian.Uint64(raw[2:10]))
+		if h.Length < 0 {
+			return h, errors.New("websocket frame is too large")
+		}
+	}
+
+	if h.Masked {
+		copy(h.Mask[:], raw[2+extended:])
+	}
+	if h.isControl() && (h.Length > 125 || !h.Fin) {
+		return h, errors.New("invalid websocket control frame")
+	}
+	h.raw = raw
+
+	return h, nil
+}
+
+func maskWSPayload(mask [4]byte, payload []byte) {
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+}
+
+// encodeWSFrame builds a single frame, frames sent to the upstream must be masked
+func encodeWSFrame(opcode byte, masked bool, payload []byte) []byte {
+	frame := make([]byte, 2, 14+len(payload))
+	frame[0] = 0x80 | opcode
+
+	switch length := len(payload); {
+	case length < 126:
+		frame[1] = byte(length)
+	case length <= 0xffff:
+		frame[1] = 126
+		frame = append(frame, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(length))
+	default:
+		frame[1] = 127
+		frame = append(frame, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(frame[2:], uint64(length))
+	}
+
+	if !masked {
+		return append(frame, payload...)
+	}
+
+	var mask [4]byte
+	rand.Read(mask[:])
+	frame[1] |= 0x80
+	frame = append(frame, mask[:]...)
+	start := len(frame)
+	frame = append(frame, payload...)
+	maskWSPayload(mask, frame[start:])
+
+	return frame
+}
+
+func wsClosePayload(code int, reason string) []byte {
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+
+	return append(payload, reason...)
+}
+
+// readWebSocketHandshake reads the upstream's reply to the upgrade request, it is returned as it
+// was sent so that it can be passed on untouched
+func readWebSocketHandshake(r *bufio.Reader) ([]byte, int, error) {
+	var head []byte
+	for {
+		line, err := r.ReadBytes('\n')
+		head = append(head, line...)
+		if err != nil {
+			return head, 0, err
+		}
+		if len(head) > 1<<16 {
+			return head, 0, errors.New("upgrade response headers are too large")
+		}
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			break
+		}
+	}
+
+	parts := strings.SplitN(string(head), " ", 3)
+	if len(parts) < 3 {
+		return head, 0, errors.New("malformed upgrade response")
+	}
+	status, err := strconv.Atoi(parts[1])
+
+	return head, status, err
+}
+
+// wsPeer is one side of a proxied connection
+type wsPeer struct {
+	sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	mask   bool
+	broken bool
+}
+
+func (p *wsPeer) write(frame []byte) error {
+	p.Lock()
+	defer p.Unlock()
+	_, err := p.conn.Write(frame)
+	if err != nil {
+		p.broken = true
+	}
+
+	return err
+}
+
+// copyFrame streams a frame through without holding it in memory
+func (p *wsPeer) copyFrame(header wsFrameHeader, src io.Reader) error {
+	p.Lock()
+	defer p.Unlock()
+	if _, err := p.conn.Write(header.raw); err != nil {
+		p.broken = true
+		return err
+	}
+	if _, err := io.CopyN(p.conn, src, header.Length); err != nil {
+		// The peer has half a frame, it can't be sent a close frame now
+		p.broken = true
+		return err
+	}
+
+	return nil
+}
+
+// WebSocketConnection relays frames between a client and the upstream, enforcing the limits set
+// in the API definition and keeping the counts that are recorded in analytics
+type WebSocketConnection struct {
+	Spec    *APISpec
+	Request *http.Request
+	Key     string
+
+	keyHash  string
+	client   *wsPeer
+	upstream *wsPeer
+	hook     WebSocketMessageHook
+	lease    *ConcurrencyLease
+	started  time.Time
+	expires  int64
+
+	lastActivity int64
+	bytesIn      int64
+	bytesOut     int64
+	messagesIn   int64
+	messagesOut  int64
+
+	// Only touched by the goroutine relaying client messages
+	allowance float64
+	lastCheck time.Time
+
+	closeOnce       sync.Once
+	closed          chan struct{}
+	closeMu         sync.Mutex
+	closeCode       int
+	closeReason     string
+	closedByGateway bool
+}
+
+func NewWebSocketConnection(spec *APISpec, r *http.Request, client net.Conn, clientReader *bufio.Reader, upstream net.Conn, upstreamReader *bufio.Reader) *WebSocketConnection {
+	c := &WebSocketConnection{
+		Spec:      spec,
+		Request:   r,
+		client:    &wsPeer{conn: client, reader: clientReader},
+		upstream:  &wsPeer{conn: upstream, reader: upstreamReader, mask: true},
+		hook:      newWebSocketMessageHook(spec),
+		started:   time.Now(),
+		allowance: spec.WebSocket.MessageRate,
+		lastCheck: time.Now(),
+		closed:    make(chan struct{}),
+	}
+	c.lastActivity = c.started.UnixNano()
+
+	if authHeaderValue, found := context.GetOk(r, AuthHeaderValue); found {
+		c.Key = authHeaderValue.(string)
+		c.keyHash = publicHash(c.Key)
+	}
+	if sessVal, found := context.GetOk(r, SessionData); found {
+		c.expires = sessVal.(SessionState).Expires
+	}
+
+	return c
+}
+
+// acquireWebSocketLease takes one of the key's connection slots, the slot is held until the
+// connection closes
+func acquireWebSocketLease(spec *APISpec, r *http.Request) (*ConcurrencyLease, error) {
+	limit := spec.WebSocket.MaxConnectionsPerKey
+	authHeaderValue, found := context.GetOk(r, AuthHeaderValue)
+	if limit <= 0 || !found || authHeaderValue.(string) == "" {
+		return nil, nil
+	}
+
+	lease, ok := concurrencyLimiter.Acquire(ConcurrencyWSKeyPrefix+publicHash(authHeaderValue.(string)), limit)
+	if !ok {
+		log.WithFields(logrus.Fields{
+			"prefix":     "websocket",
+			"path":       r.URL.Path,
+			"origin":     GetIPFromRequest(r),
+			"key":        authHeaderValue,
+			"request_id": requestID(r),
+		}).Info("WebSocket connection limit exceeded.")
+
+		go spec.FireEvent(EVENT_ConcurrencyLimitExceeded,
+			EVENT_ConcurrencyLimitExceededMeta{
+				EventMetaDefault: EventMetaDefault{Message: "WebSocket Connection Limit Exceeded", OriginatingRequest: EncodeRequestToEvent(r), RequestID: requestID(r)},
+				Path:             r.URL.Path,
+				Origin:           GetIPFromRequest(r),
+				Key:              authHeaderValue.(string),
+				LimitedBy:        "websocket",
+			})
+
+		return nil, errWebSocketConnectionLimit
+	}
+
+	return &lease, nil
+}
+
+// Serve relays frames until either side goes away or the gateway closes the connection
+func (c *WebSocketConnection) Serve() {
+	trackWebSocket(c)
+	defer untrackWebSocket(c)
+
+	c.record(WebSocketEventOpen)
+	go c.watch()
+
+	errc := make(chan error, 2)
+	go func() { errc <- c.relay(c.client, c.upstream, WebSocketUpstream) }()
+	go func() { errc <- c.relay(c.upstream, c.client, WebSocketDownstream) }()
+
+	<-errc
+	c.Close(0, "")
+	<-errc
+
+	c.closeMu.Lock()
+	closedByGateway, code, reason := c.closedByGateway, c.closeCode, c.closeReason
+	c.closeMu.Unlock()
+
+	if closedByGateway {
+		for _, peer := range []*wsPeer{c.client, c.upstream} {
+			if !peer.broken {
+				peer.conn.SetWriteDeadline(time.Now().Add(webSocketCloseTimeout))
+				peer.write(encodeWSFrame(wsOpClose, peer.mask, wsClosePayload(code, reason)))
+			}
+		}
+	}
+	c.client.conn.Close()
+	c.upstream.conn.Close()
+
+	c.record(WebSocketEventClose)
+}
+
+// Close ends the connection, a non-zero code is sent to both sides in a close frame
+func (c *WebSocketConnection) Close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		if code != 0 {
+			c.closeMu.Lock()
+			c.closeCode, c.closeReason, c.closedByGateway = code, reason, true
+			c.closeMu.Unlock()
+
+			log.WithFields(logrus.Fields{
+				"prefix": "websocket",
+				"api_id": c.Spec.APIID,
+				"origin": GetIPFromRequest(c.Request),
+				"code":   code,
+			}).Info("Closing WebSocket connection: ", reason)
+		}
+		close(c.closed)
+
+		// Stop the relays at their next read, writes in progress are given time to finish
+		now := time.Now()
+		for _, peer := range []*wsPeer{c.client, c.upstream} {
+			peer.conn.SetReadDeadline(now)
+			peer.conn.SetWriteDeadline(now.Add(webSocketCloseTimeout))
+		}
+	})
+}
+
+// Stats returns the connection's counters so far
+func (c *WebSocketConnection) Stats() WebSocketStats {
+	c.closeMu.Lock()
+	defer c.closeMu.Unlock()
+
+	return WebSocketStats{
+		Duration:    int64(time.Since(c.started) / time.Millisecond),
+		BytesIn:     atomic.LoadInt64(&c.bytesIn),
+		BytesOut:    atomic.LoadInt64(&c.bytesOut),
+		MessagesIn:  atomic.LoadInt64(&c.messagesIn),
+		MessagesOut: atomic.LoadInt64(&c.messagesOut),
+		CloseCode:   c.closeCode,
+		CloseReason: c.closeReason,
+	}
+}
+
+func (c *WebSocketConnection) record(event string) {
+	stats := c.Stats()
+	stats.Event = event
+	if event == WebSocketEventOpen {
+		stats.CloseCode, stats.CloseReason = 0, ""
+	} else if stats.CloseCode == 0 {
+		stats.CloseCode = WSCloseAbnormal
+	}
+
+	context.Set(c.Request, WebSocketConnectionStats, &stats)
+	handler := SuccessHandler{&TykMiddleware{c.Spec, nil}}
+	handler.RecordHit(nil, c.Request, stats.Duration, http.StatusSwitchingProtocols, nil, nil)
+	context.Delete(c.Request, WebSocketConnectionStats)
+}
+
+// allowMessage applies the message rate, this is the same leaky bucket used for session rate limits
+func (c *WebSocketConnection) allowMessage() bool {
+	rate, per := c.Spec.WebSocket.MessageRate, c.Spec.WebSocket.MessagePer
+	if rate <= 0 || per <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	c.allowance += now.Sub(c.lastCheck).Seconds() * (rate / per)
+	c.lastCheck = now
+	if c.allowance > rate {
+		c.allowance = rate
+	}
+
+	if c.allowance < 1 {
+		return false
+	}
+	c.allowance--
+
+	return true
+}
+
+func (c *WebSocketConnection) maxMessageSize() int64 {
+	if c.Spec.WebSocket.MaxMessageSize > 0 {
+		return c.Spec.WebSocket.MaxMessageSize
+	}
+
+	return defaultWebSocketMaxMessageSize
+}
+
+func (c *WebSocketConnection) relay(from, to *wsPeer, direction string) error {
+	bytesCounter, messageCounter := &c.bytesIn, &c.messagesIn
+	if direction == WebSocketDownstream {
+		bytesCounter, messageCounter = &c.bytesOut, &c.messagesOut
+	}
+
+	var message []byte
+	var messageOpcode byte
+	for {
+		header, err := readWSFrameHeader(from.reader)
+		if err != nil {
+			return err
+		}
+		atomic.StoreInt64(&c.lastActivity, time.Now().UnixNano())
+		atomic.AddInt64(bytesCounter, int64(len(header.raw))+header.Length)
+
+		if header.isControl() {
+			payload := make([]byte, header.Length)
+			if _, err := io.ReadFull(from.reader, payload); err != nil {
+				return err
+			}
+			if header.Opcode == wsOpClose {
+				c.notePeerClose(header, payload)
+			}
+			if err := to.write(append(header.raw, payload...)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if header.Opcode != wsOpContinuation {
+			atomic.AddInt64(messageCounter, 1)
+			if direction == WebSocketUpstream && !c.allowMessage() {
+				c.Close(WSClosePolicyViolation, "message rate limit exceeded")
+				return errWebSocketClosed
+			}
+		}
+
+		if c.hook == nil {
+			if err := to.copyFrame(header, from.reader); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Extensions such as permessage-deflate are stripped from the upgrade when there is a hook,
+		// a peer setting the reserved bits anyway sends frames the hook couldn't read or re-encode
+		if header.Rsv != 0 {
+			c.Close(WSCloseProtocolError, "extensions are not supported")
+			return errWebSocketClosed
+		}
+
+		// Messages are put back together so that hooks see them whole
+		if header.Opcode != wsOpContinuation {
+			messageOpcode = header.Opcode
+			message = message[:0]
+		}
+		if int64(len(message))+header.Length > c.maxMessageSize() {
+			c.Close(WSCloseMessageTooBig, "message is too big to inspect")
+			return errWebSocketClosed
+		}
+
+		payload := make([]byte, header.Length)
+		if _, err := io.ReadFull(from.reader, payload); err != nil {
+			return err
+		}
+		if header.Masked {
+			maskWSPayload(header.Mask, payload)
+		}
+		message = append(message, payload...)
+
+		if header.Fin {
+			if err := c.inspect(to, direction, messageOpcode, message); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *WebSocketConnection) inspect(to *wsPeer, direction string, opcode byte, message []byte) error {
+	verdict, err := c.hook.HandleMessage(c, direction, opcode, message)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "websocket",
+			"api_id": c.Spec.APIID,
+		}).Error("WebSocket message hook failed: ", err)
+		c.Close(WSCloseInternalError, "message hook failed")
+		return errWebSocketClosed
+	}
+
+	switch verdict.Action {
+	case WebSocketMessageDrop:
+		return nil
+	case WebSocketMessageClose:
+		reason := verdict.Reason
+		if reason == "" {
+			reason = "message rejected"
+		}
+		c.Close(WSClosePolicyViolation, reason)
+		return errWebSocketClosed
+	}
+
+	return to.write(encodeWSFrame(opcode, to.mask, verdict.Data))
+}
+
+func (c *WebSocketConnection) notePeerClose(header wsFrameHeader, payload []byte) {
+	code, reason := WSCloseNormal, ""
+	if len(payload) >= 2 {
+		status := make([]byte, len(payload))
+		copy(status, payload)
+		if header.Masked {
+			maskWSPayload(header.Mask, status)
+		}
+		code, reason = int(binary.BigEndian.Uint16(status)), string(status[2:])
+	}
+
+	c.closeMu.Lock()
+	if c.closeCode == 0 {
+		c.closeCode, c.closeReason = code, reason
+	}
+	c.closeMu.Unlock()
+}
+
+// watch closes the connection when it runs out of time or its key stops being valid
+func (c *WebSocketConnection) watch() {
+	ticker := time.NewTicker(webSocketWatchInterval)
+	defer ticker.Stop()
+
+	conf := c.Spec.WebSocket
+	refreshInterval := conf.AuthRefreshInterval
+	if refreshInterval <= 0 {
+		refreshInterval = defaultWebSocketAuthRefresh
+	}
+	lastRefresh, lastRenew := time.Now(), time.Now()
+
+	for {
+		select {
+		case <-c.closed:
+			return
+		case now := <-ticker.C:
+			if conf.MaxDuration > 0 && now.Sub(c.started) >= time.Duration(conf.MaxDuration)*time.Second {
+				c.Close(WSCloseGoingAway, "maximum connection duration reached")
+				return
+			}
+
+			idle := now.Sub(time.Unix(0, atomic.LoadInt64(&c.lastActivity)))
+			if conf.IdleTimeout > 0 && idle >= time.Duration(conf.IdleTimeout)*time.Second {
+				c.Close(WSCloseGoingAway, "connection idle for too long")
+				return
+			}
+
+			if c.Key == "" {
+				continue
+			}
+
+			if c.expires > 0 && now.Unix() >= c.expires {
+				c.Close(WSClosePolicyViolation, "key expired")
+				return
+			}
+
+			if now.Sub(lastRefresh) >= time.Duration(refreshInterval)*time.Second {
+				lastRefresh = now
+				if reason := c.checkSession(); reason != "" {
+					c.Close(WSClosePolicyViolation, reason)
+					return
+				}
+			}
+
+			if c.lease != nil && now.Sub(lastRenew) >= time.Duration(concurrencyLimiter.leaseTimeout()/2)*time.Second {
+				lastRenew = now
+				concurrencyLimiter.Renew(*c.lease, conf.MaxConnectionsPerKey)
+			}
+		}
+	}
+}
+
+// checkSession looks the key up again, keys removed on other nodes are picked up here
+func (c *WebSocketConnection) checkSession() string {
+	thisSession, found := c.Spec.SessionManager.GetSessionDetail(c.Key)
+	if !found {
+		return "key deleted"
+	}
+	if thisSession.IsInactive {
+		return "key inactive"
+	}
+	if c.Spec.AuthManager.IsKeyExpired(&thisSession) {
+		return "key expired"
+	}
+	c.expires = thisSession.Expires
+
+	return ""
+}
+
+var webSocketConnections = struct {
+	sync.Mutex
+	byKey map[string]map[*WebSocketConnection]bool
+}{byKey: make(map[string]map[*WebSocketConnection]bool)}
+
+func trackWebSocket(c *WebSocketConnection) {
+	if c.keyHash == "" {
+		return
+	}
+
+	webSocketConnections.Lock()
+	defer webSocketConnections.Unlock()
+	if webSocketConnections.byKey[c.keyHash] == nil {
+		webSocketConnections.byKey[c.keyHash] = make(map[*WebSocketConnection]bool)
+	}
+	webSocketConnections.byKey[c.keyHash][c] = true
+}
+
+func untrackWebSocket(c *WebSocketConnection) {
+	if c.keyHash == "" {
+		return
+	}
+
+	webSocketConnections.Lock()
+	defer webSocketConnections.Unlock()
+	delete(webSocketConnections.byKey[c.keyHash], c)
+	if len(webSocketConnections.byKey[c.keyHash]) == 0 {
+		delete(webSocketConnections.byKey, c.keyHash)
+	}
+}
+
+// closeWebSocketsForKey closes the connections opened with a key that has been removed, keyHash
+// is the key as it is stored and an apiID of "-1" closes connections on every API
+func closeWebSocketsForKey(keyHash string, apiID string) int {
+	webSocketConnections.Lock()
+	toClose := []*WebSocketConnection{}
+	for c := range webSocketConnections.byKey[keyHash] {
+		if apiID == "-1" || apiID == "" || c.Spec.APIID == apiID {
+			toClose = append(toClose, c)
+		}
+	}
+	webSocketConnections.Unlock()
+
+	for _, c := range toClose {
+		c.Close(WSClosePolicyViolation, "key deleted")
+	}
+
+	return len(toClose)
+}
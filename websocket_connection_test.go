@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/context"
+)
+
+func readWSTestFrame(t *testing.T, r *bufio.Reader) (wsFrameHeader, []byte) {
+	header, err := readWSFrameHeader(r)
+	if err != nil {
+		t.Fatal("Could not read frame: ", err)
+	}
+	payload := make([]byte, header.Length)
+	io.ReadFull(r, payload)
+	if header.Masked {
+		maskWSPayload(header.Mask, payload)
+	}
+
+	return header, payload
+}
+
+// echoWebSocketUpstream accepts upgrades and sends every message straight back
+func echoWebSocketUpstream(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				if _, err := http.ReadRequest(reader); err != nil {
+					return
+				}
+				conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n"))
+
+				for {
+					header, err := readWSFrameHeader(reader)
+					if err != nil {
+						return
+					}
+					payload := make([]byte, header.Length)
+					io.ReadFull(reader, payload)
+					maskWSPayload(header.Mask, payload)
+					conn.Write(encodeWSFrame(header.Opcode, false, payload))
+					if header.Opcode == wsOpClose {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	return l
+}
+
+func dialWebSocket(t *testing.T, server *httptest.Server) (net.Conn, *bufio.Reader, int) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("GET /v1/chat HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+
+	reader := bufio.NewReader(conn)
+	_, status, err := readWebSocketHandshake(reader)
+	if err != nil {
+		t.Fatal("Could not read upgrade response: ", err)
+	}
+
+	return conn, reader, status
+}
+
+func TestWebSocketFrames(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), 300)
+	header, err := readWSFrameHeader(bytes.NewReader(encodeWSFrame(wsOpText, true, payload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !header.Fin || header.Opcode != wsOpText || !header.Masked || header.Length != 300 || len(header.raw) != 8 {
+		t.Error("Extended lengths and masks should be read, got: ", header)
+	}
+
+	if _, err := readWSFrameHeader(bytes.NewReader([]byte{0x09, 126, 0, 200})); err == nil {
+		t.Error("Control frames over 125 bytes should be rejected")
+	}
+
+	head, status, err := readWebSocketHandshake(bufio.NewReader(strings.NewReader("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n\r\n\x81\x00")))
+	if err != nil || status != 101 || !bytes.HasSuffix(head, []byte("\r\n\r\n")) {
+		t.Error("The upgrade response should be read up to the first frame, got: ", status, err)
+	}
+}
+
+func TestWebSocketProxy(t *testing.T) {
+	config.HttpServerOptions.EnableWebSockets = true
+	defer func() { config.HttpServerOptions.EnableWebSockets = false }()
+
+	upstream := echoWebSocketUpstream(t)
+	defer upstream.Close()
+
+	spec := createDefinitionFromString(nonExpiringDefNoWhiteList)
+	redisStore := RedisClusterStorageManager{KeyPrefix: "apikey-"}
+	healthStore := &RedisClusterStorageManager{KeyPrefix: "apihealth."}
+	orgStore := &RedisClusterStorageManager{KeyPrefix: "orgKey."}
+	spec.Init(&redisStore, &redisStore, healthStore, orgStore)
+	spec.WebSocket.MaxConnectionsPerKey = 1
+	spec.WebSocket.MessageRate = 3
+	spec.WebSocket.MessagePer = 60
+	remote, _ := url.Parse("http://" + upstream.Addr().String())
+	proxy := TykNewSingleHostReverseProxy(remote, spec)
+	proxy.New(nil, spec)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		context.Set(r, AuthHeaderValue, "ws-test-key")
+		proxy.ServeHTTP(w, r)
+		context.Clear(r)
+	}))
+	defer server.Close()
+
+	conn, reader, status := dialWebSocket(t, server)
+	defer conn.Close()
+	if status != 101 {
+		t.Fatal("The upgrade should be passed through, got: ", status)
+	}
+
+	for _, message := range []string{"one", "two"} {
+		conn.Write(encodeWSFrame(wsOpText, true, []byte(message)))
+		if _, payload := readWSTestFrame(t, reader); string(payload) != message {
+			t.Error("Messages should be relayed both ways, got: ", string(payload))
+		}
+	}
+
+	second, _, status := dialWebSocket(t, server)
+	second.Close()
+	if status != 429 {
+		t.Error("A key should not be able to open more connections than its limit, got: ", status)
+	}
+
+	if closed := closeWebSocketsForKey(publicHash("ws-test-key"), "-1"); closed != 1 {
+		t.Error("Deleting a key should close its connections, closed: ", closed)
+	}
+	header, payload := readWSTestFrame(t, reader)
+	if header.Opcode != wsOpClose || binary.BigEndian.Uint16(payload) != WSClosePolicyViolation || string(payload[2:]) != "key deleted" {
+		t.Errorf("The client should be sent a close frame, got: %d %q", header.Opcode, payload)
+	}
+
+	conn, reader, status = dialWebSocket(t, server)
+	defer conn.Close()
+	if status != 101 {
+		t.Fatal("Slots should be released when a connection closes, got: ", status)
+	}
+	for _, message := range []string{"one", "two", "three", "four"} {
+		conn.Write(encodeWSFrame(wsOpText, true, []byte(message)))
+	}
+	// Echoes still in flight when the limit is hit may be cut off
+	for i := 0; i < 4; i++ {
+		if header, payload = readWSTestFrame(t, reader); header.Opcode == wsOpClose {
+			break
+		}
+	}
+	if header.Opcode != wsOpClose || binary.BigEndian.Uint16(payload) != WSClosePolicyViolation {
+		t.Errorf("Clients going over the message rate should be disconnected, got: %d %q", header.Opcode, payload)
+	}
+}
+
+func TestWebSocketMessageHook(t *testing.T) {
+	spec := createDefinitionFromString(nonExpiringDefNoWhiteList)
+	spec.JSVM = &JSVM{}
+	spec.JSVM.Init()
+	spec.JSVM.VM.Run(`function shout(message, config) {
+		if (message.data == "secret") {
+			return JSON.stringify({action: "drop"});
+		}
+		return JSON.stringify({data: message.direction + ": " + message.data.toUpperCase()});
+	}`)
+	hook := &JSVMWebSocketHook{spec, "shout"}
+
+	verdict, err := hook.HandleMessage(nil, WebSocketUpstream, wsOpText, []byte("hello"))
+	if err != nil || string(verdict.Data) != "upstream: HELLO" {
+		t.Error("Hooks should be able to rewrite messages, got: ", string(verdict.Data), err)
+	}
+
+	verdict, err = hook.HandleMessage(nil, WebSocketDownstream, wsOpText, []byte("secret"))
+	if err != nil || verdict.Action != WebSocketMessageDrop || string(verdict.Data) != "secret" {
+		t.Error("Hooks should be able to drop messages, got: ", verdict, err)
+	}
+}
+
+type recordingWebSocketHook struct {
+	called bool
+}
+
+func (h *recordingWebSocketHook) HandleMessage(c *WebSocketConnection, direction string, opcode byte, payload []byte) (WebSocketMessageVerdict, error) {
+	h.called = true
+	return WebSocketMessageVerdict{Data: payload}, nil
+}
+
+func TestWebSocketHookCompressedFrames(t *testing.T) {
+	config.HttpServerOptions.EnableWebSockets = true
+	defer func() { config.HttpServerOptions.EnableWebSockets = false }()
+
+	extensions := make(chan string, 1)
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	go func() {
+		conn, err := upstream.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+		extensions <- req.Header.Get("Sec-WebSocket-Extensions")
+		conn.Write([]byte("HTTP/1.1 403 Forbidden\r\nContent-Length: 0\r\n\r\n"))
+	}()
+
+	spec := createDefinitionFromString(nonExpiringDefNoWhiteList)
+	store := &InMemoryStorageManager{Sessions: make(map[string]string)}
+	spec.Init(store, store, store, store)
+	spec.WebSocket.MessageHook.Name = "inspect"
+	remote, _ := url.Parse("http://" + upstream.Addr().String())
+	proxy := TykNewSingleHostReverseProxy(remote, spec)
+	proxy.New(nil, spec)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxy.ServeHTTP(w, r)
+		context.Clear(r)
+	}))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET /v1/chat HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Extensions: permessage-deflate\r\n\r\n"))
+	select {
+	case offered := <-extensions:
+		if offered != "" {
+			t.Error("Extensions should not be offered to the upstream when there is a message hook, got: ", offered)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The upgrade never reached the upstream")
+	}
+
+	// A peer that sets RSV1 anyway is disconnected before the hook sees the frame
+	client, clientEnd := net.Pipe()
+	defer client.Close()
+	defer clientEnd.Close()
+	upstreamConn, upstreamEnd := net.Pipe()
+	defer upstreamConn.Close()
+	defer upstreamEnd.Close()
+
+	req, _ := http.NewRequest("GET", "/v1/chat", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	compressed := encodeWSFrame(wsOpText, true, []byte("not really deflated"))
+	compressed[0] |= 0x40
+
+	c := NewWebSocketConnection(spec, req, client, bufio.NewReader(bytes.NewReader(compressed)), upstreamConn, bufio.NewReader(upstreamConn))
+	hook := &recordingWebSocketHook{}
+	c.hook = hook
+	if err := c.relay(c.client, c.upstream, WebSocketUpstream); err != errWebSocketClosed {
+		t.Error("Compressed frames should close the connection, got: ", err)
+	}
+	if hook.called || c.Stats().CloseCode != WSCloseProtocolError {
+		t.Error("Compressed frames should be refused with a protocol error, got: ", c.Stats().CloseCode, hook.called)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var jsonNumberRegex = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// yamlValue decodes a YAML node into the types encoding/json produces, numbers are kept as
+// written so "version: 1.0" isn't read back as 1
+type yamlValue struct {
+	value interface{}
+}
+
+func (v *yamlValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var node interface{}
+	if err := unmarshal(&node); err != nil {
+		return err
+	}
+
+	switch node.(type) {
+	case map[interface{}]interface{}:
+		var mapping map[string]yamlValue
+		if err := unmarshal(&mapping); err != nil {
+			return err
+		}
+		asMap := make(map[string]interface{}, len(mapping))
+		for key, val := range mapping {
+			asMap[key] = val.value
+		}
+		v.value = asMap
+	case []interface{}:
+		var sequence []yamlValue
+		if err := unmarshal(&sequence); err != nil {
+			return err
+		}
+		asSlice := make([]interface{}, len(sequence))
+		for i, val := range sequence {
+			asSlice[i] = val.value
+		}
+		v.value = asSlice
+	case int, int64, uint64, float64:
+		var raw string
+		if err := unmarshal(&raw); err == nil && jsonNumberRegex.MatchString(raw) {
+			v.value = json.Number(raw)
+		} else {
+			v.value = node
+		}
+	default:
+		v.value = node
+	}
+
+	return nil
+}
+
+// decodeYAML decodes a YAML (or JSON) document into maps, slices and scalars
+func decodeYAML(data string) (interface{}, error) {
+	if trimmed := strings.TrimSpace(data); strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		var value interface{}
+		decoder := json.NewDecoder(strings.NewReader(trimmed))
+		decoder.UseNumber()
+		err := decoder.Decode(&value)
+		return value, err
+	}
+
+	var doc yamlValue
+	if err := yaml.Unmarshal([]byte(data), &doc); err != nil {
+		return nil, err
+	}
+
+	if doc.value == nil {
+		return nil, errors.New("document is empty")
+	}
+
+	return doc.value, nil
+}